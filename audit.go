@@ -0,0 +1,103 @@
+package wt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/windf17/wt/models"
+)
+
+// auditLog 审计记录，内存中保留最近的事件，并同步转发给外部输出
+type auditLog struct {
+	mu sync.Mutex
+	// events 环形缓冲区
+	events []models.AuditEvent
+	// next 下一个写入位置
+	next int
+	// seq 最近一个事件的序号
+	seq  uint64
+	sink models.AuditSink
+}
+
+/**
+ * newAuditLog 创建审计记录
+ * @param {int} capacity 内存中保留的事件数量
+ * @returns {*auditLog} 审计记录
+ */
+func newAuditLog(capacity int) *auditLog {
+	return &auditLog{events: make([]models.AuditEvent, 0, capacity)}
+}
+
+/**
+ * record 记录事件并转发给外部输出
+ * 不能在持有管理器锁时调用，避免外部输出阻塞鉴权
+ * @param {[]models.AuditEvent} events 事件列表
+ */
+func (a *auditLog) record(events ...models.AuditEvent) {
+	if len(events) == 0 {
+		return
+	}
+	a.mu.Lock()
+	for i := range events {
+		a.seq++
+		events[i].Seq = a.seq
+		if len(a.events) < cap(a.events) {
+			a.events = append(a.events, events[i])
+		} else {
+			a.events[a.next] = events[i]
+		}
+		a.next = (a.next + 1) % cap(a.events)
+	}
+	sink := a.sink
+	a.mu.Unlock()
+
+	if sink != nil {
+		for _, e := range events {
+			sink.Record(e)
+		}
+	}
+}
+
+/**
+ * list 按发生顺序获取内存中保留的事件
+ * @returns {[]models.AuditEvent} 事件列表
+ */
+func (a *auditLog) list() []models.AuditEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	result := make([]models.AuditEvent, 0, len(a.events))
+	if len(a.events) == cap(a.events) {
+		result = append(result, a.events[a.next:]...)
+		return append(result, a.events[:a.next]...)
+	}
+	return append(result, a.events...)
+}
+
+/**
+ * SetAuditSink 设置审计事件的外部输出，如写入日志或数据库
+ * @param {models.AuditSink} sink 外部输出，为nil时只在内存中保留最近的事件
+ */
+func (tm *Manager[T]) SetAuditSink(sink models.AuditSink) {
+	tm.audit.mu.Lock()
+	defer tm.audit.mu.Unlock()
+	tm.audit.sink = sink
+}
+
+/**
+ * AuditEvents 获取内存中保留的最近审计事件（最多DEFAULT_AUDIT_CAPACITY条）
+ * @returns {[]models.AuditEvent} 按发生顺序排列的事件列表
+ */
+func (tm *Manager[T]) AuditEvents() []models.AuditEvent {
+	return tm.audit.list()
+}
+
+/**
+ * tokenFingerprint 计算token的指纹，用于在审计记录等场景中代替token原文
+ * @param {string} key token字符串
+ * @returns {string} 指纹
+ */
+func tokenFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
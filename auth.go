@@ -2,12 +2,19 @@ package wt
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/windf17/wt/models"
 	"github.com/windf17/wt/utility"
 )
 
+// authDisabled 未配置任何用户组时authorize返回的特殊键值，表示跳过鉴权
+const authDisabled = "auth_disabled"
+
 /**
  * Auth 专门负责对客户端访问指定API进行鉴权
  * 包含完整的鉴权流程：Token验证、IP验证和API权限验证
@@ -17,89 +24,531 @@ import (
  * @returns {error} 鉴权结果
  */
 func (tm *Manager[T]) Auth(key string, clientIp string, api string) error {
+	return tm.AuthWithMethod(key, clientIp, "", api)
+}
+
+/**
+ * AuthWithMethod 带请求方法的鉴权，请求方法会传给自定义鉴权器
+ * @param {string} key token字符串
+ * @param {string} clientIp 客户端IP地址
+ * @param {string} method 请求方法，如"GET"
+ * @param {string} api 请求的API地址
+ * @returns {error} 鉴权结果，自定义鉴权器返回的错误原样返回
+ */
+func (tm *Manager[T]) AuthWithMethod(key string, clientIp string, method string, api string) error {
+	errKey, err := tm.authorize(key, clientIp, method, api, nil)
+	if err != nil {
+		return err
+	}
+	switch errKey {
+	case "":
+		// 鉴权通过，继续更新访问时间
+	case "token_expired":
+		// token已过期，需要删除该token
+		tm.lock()
+		// 重新检查token是否仍然过期
+		if currentToken, err := tm.store.Get(key); err == nil && currentToken != nil && currentToken.IsExpired() {
+			tm.removeTokenLocked(key, currentToken)
+		}
+		tm.unlock()
+		return errors.New(getErrorMessage(tm.config.Language, errKey))
+	case authDisabled:
+		// 没有配置用户组，跳过权限验证，直接返回成功
+		return nil
+	default:
+		return errors.New(getErrorMessage(tm.config.Language, errKey))
+	}
+
+	// 第三阶段：更新最后访问时间，顺便恢复已到期的临时提权
+	tm.lock()
+	// 重新验证token是否仍然有效（防止在锁切换期间token被删除）
+	currentToken, err := tm.store.Get(key)
+	if err != nil || currentToken == nil || currentToken.IsExpired() {
+		tm.unlock()
+		// Token在锁切换期间被删除或过期
+		return errors.New(getErrorMessage(tm.config.Language, "forbidden")) // Token无效，拒绝访问
+	}
+	// 更新最后访问时间
+	tm.touchTokenLocked(key, time.Now())
+	var event models.AuditEvent
+	var reverted bool
+	if currentToken.Elevation != nil {
+		updated := *currentToken
+		if event, reverted = revertExpiredElevationLocked(&updated, tm.now()); reverted {
+			reverted = tm.putTokenLocked(key, &updated) == nil
+		}
+	}
+	tm.unlock()
+
+	if reverted {
+		tm.audit.record(event)
+	}
+	return nil
+}
+
+/**
+ * Explain 解释一次鉴权的决策过程，管理器本身不修改任何状态（不续期、不删除过期token、不扣减限流和配额）
+ * 用于排查Auth返回"未授权"等错误的具体原因；已注册的自定义鉴权器会像Auth一样被调用，
+ * 因此鉴权器不能有副作用（如计数、记录访问），否则Explain也会触发这些副作用
+ * @param {string} key token字符串
+ * @param {string} clientIp 客户端IP地址
+ * @param {string} api 请求的API地址
+ * @returns {*models.AuthDecision} 鉴权决策详情
+ */
+func (tm *Manager[T]) Explain(key string, clientIp string, api string) *models.AuthDecision {
+	return tm.ExplainWithMethod(key, clientIp, "", api)
+}
+
+/**
+ * ExplainWithMethod 解释一次带请求方法的鉴权决策过程，与Explain一样会调用已注册的自定义鉴权器
+ * @param {string} key token字符串
+ * @param {string} clientIp 客户端IP地址
+ * @param {string} method 请求方法，如"GET"
+ * @param {string} api 请求的API地址
+ * @returns {*models.AuthDecision} 鉴权决策详情
+ */
+func (tm *Manager[T]) ExplainWithMethod(key string, clientIp string, method string, api string) *models.AuthDecision {
+	d := &models.AuthDecision{API: api, Method: method}
+	errKey, err := tm.authorize(key, clientIp, method, api, d)
+	if errKey == authDisabled {
+		d.AuthDisabled = true
+		errKey = ""
+	}
+	d.Allowed = errKey == ""
+	if !d.Allowed {
+		d.ErrorKey = errKey
+		d.Reason = getErrorMessage(tm.config.Language, errKey)
+		if err != nil {
+			d.Reason = err.Error()
+		}
+	}
+	return d
+}
+
+/**
+ * UseAuthorizer 注册自定义鉴权器，同一阶段的鉴权器按注册顺序执行
+ * 任意鉴权器返回VerdictDeny或错误时立即拒绝；返回VerdictAllow时跳过之后的所有检查直接放行
+ * 后置鉴权器只在内置规则允许访问时执行，不能放行被内置规则拒绝的请求
+ * @param {models.AuthStage} stage 执行阶段
+ * @param {models.Authorizer[T]} a 鉴权器
+ * @returns {error} 阶段无效或鉴权器为nil时返回错误
+ */
+func (tm *Manager[T]) UseAuthorizer(stage models.AuthStage, a models.Authorizer[T]) error {
+	if a == nil {
+		return errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+	tm.lock()
+	defer tm.unlock()
+	// 总是复制一份新切片，鉴权过程中持有的旧切片不受影响
+	switch stage {
+	case models.AuthStagePreRule:
+		tm.preAuthorizers = append(slices.Clip(tm.preAuthorizers), a)
+	case models.AuthStagePostRule:
+		tm.postAuthorizers = append(slices.Clip(tm.postAuthorizers), a)
+	default:
+		return errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+	return nil
+}
+
+// authSubject 鉴权所需的token与用户组快照，读取后即可释放锁
+type authSubject[T any] struct {
+	token models.Token[T]
+	group *models.Group
+	// groupID 鉴权使用的用户组ID，临时提权期间为目标用户组
+	groupID uint
+	now     time.Time
+	pre     []models.Authorizer[T]
+	post    []models.Authorizer[T]
+}
+
+/**
+ * authorize 执行鉴权流程中只读的判断部分
+ * 只在读取token和用户组时持有读锁，规则匹配和自定义鉴权器都在锁外执行
+ * @param {string} key token字符串
+ * @param {string} clientIp 客户端IP地址
+ * @param {string} method 请求方法
+ * @param {string} api 请求的API地址
+ * @param {*models.AuthDecision} d 决策记录，为nil时不记录细节
+ * @returns {string, error} 错误键值（空字符串表示通过，authDisabled表示未启用鉴权）和自定义鉴权器返回的错误
+ */
+func (tm *Manager[T]) authorize(key string, clientIp string, method string, api string, d *models.AuthDecision) (string, error) {
+	s, errKey := tm.loadAuthSubject(key, clientIp, d)
+	if errKey != "" {
+		return errKey, nil
+	}
+	g := s.group
+
+	// 严格路径模式：先规范化请求路径，有歧义的路径直接拒绝
+	var segments []string
+	if tm.config.StrictPaths {
+		var err error
+		segments, err = utility.CanonicalizePath(api, utility.CanonicalOptions{CaseInsensitive: tm.config.CaseInsensitivePaths})
+		if err != nil {
+			if d != nil {
+				d.PathSegments = []string{}
+			}
+			return "invalid_path", fmt.Errorf("%s: %w", getErrorMessage(tm.config.Language, "invalid_path"), err)
+		}
+	}
+
+	// 用户组网络限制
+	if g.Network != nil {
+		passed := g.Network.Permits(clientIp)
+		if errKey := recordCondition(d, "group", "network", passed, "ip_not_allowed"); errKey != "" {
+			return errKey, nil
+		}
+	}
+
+	// 用户组访问时间窗口
+	if len(g.TimeWindows) > 0 {
+		passed := models.InTimeWindows(g.TimeWindows, s.now)
+		if errKey := recordCondition(d, "group", "time_window", passed, "outside_time_window"); errKey != "" {
+			return errKey, nil
+		}
+	}
+
+	// 只有注册了自定义鉴权器时才构造上下文，避免影响默认鉴权路径的性能
+	var ctx *models.AuthContext[T]
+	if len(s.pre) > 0 || len(s.post) > 0 {
+		if segments == nil {
+			segments = utility.ParseURLToPathSegments(api)
+		}
+		ctx = &models.AuthContext[T]{
+			Key:          key,
+			Token:        s.token,
+			UserData:     s.token.UserData,
+			TenantID:     s.token.TenantID,
+			Group:        g,
+			API:          api,
+			PathSegments: segments,
+			Method:       method,
+			IP:           clientIp,
+		}
+	}
+
+	// 用户组限流，与规则限流在所有检查完成后一起扣减
+	var limits []rateRequest
+	if g.RateLimit != nil {
+		limits = append(limits, rateRequest{
+			scope: "group",
+			id:    rateBucketID("g:"+strconv.FormatUint(uint64(s.groupID), 10), g.RateLimit, key, &s.token, clientIp),
+			limit: g.RateLimit,
+		})
+	}
+
+	// 前置自定义鉴权器
+	if verdict, err := runAuthorizers(models.AuthStagePreRule, s.pre, ctx, d); err != nil || verdict == models.VerdictDeny {
+		return "forbidden", err
+	} else if verdict == models.VerdictAllow {
+		return tm.enforceLimits(key, s, limits, requestQuotas(s.group, segments, api), d, true)
+	}
+
+	// 第二阶段：API权限验证
+	// 如果用户组没有配置任何API规则，则拒绝访问
+	if len(g.ApiRules) == 0 {
+		return "unauthorized", nil // 无权访问
+	}
+	// 检查API路径权限
+	var rule *models.ApiRule
+	if d != nil {
+		if tm.config.StrictPaths {
+			d.PathSegments, d.Candidates, d.Winner = utility.ExplainSegments(segments, g.ApiRules)
+		} else {
+			d.PathSegments, d.Candidates, d.Winner = utility.ExplainPermission(api, g.ApiRules)
+		}
+		if d.Winner != nil {
+			rule = &g.ApiRules[d.Winner.Index]
+		}
+	} else {
+		var index int
+		if tm.config.StrictPaths {
+			index = utility.MatchCompiledSegments(segments, g)
+		} else {
+			index = utility.MatchCompiledRule(api, g)
+		}
+		if index >= 0 {
+			rule = &g.ApiRules[index]
+		}
+	}
+	if rule == nil || !rule.Rule {
+		return "unauthorized", nil // 无权访问
+	}
+
+	// 生效规则上的附加条件
+	if cond := rule.Conditions; cond != nil {
+		if cond.Network != nil {
+			passed := cond.Network.Permits(clientIp)
+			if errKey := recordCondition(d, "rule", "network", passed, "ip_not_allowed"); errKey != "" {
+				return errKey, nil
+			}
+		}
+		if len(cond.TimeWindows) > 0 {
+			passed := models.InTimeWindows(cond.TimeWindows, s.now)
+			if errKey := recordCondition(d, "rule", "time_window", passed, "outside_time_window"); errKey != "" {
+				return errKey, nil
+			}
+		}
+	}
+
+	// 限流：用户组和规则的限流一起检查、一起扣减
+	if cond := rule.Conditions; cond != nil && cond.RateLimit != nil {
+		scope := "r:" + strconv.FormatUint(uint64(s.groupID), 10) + ":" + strings.Join(rule.Path, "/")
+		limits = append(limits, rateRequest{
+			scope: "rule",
+			id:    rateBucketID(scope, cond.RateLimit, key, &s.token, clientIp),
+			limit: cond.RateLimit,
+		})
+	}
+
+	// 后置自定义鉴权器，已超限的请求不再执行
+	if len(s.post) > 0 {
+		if d == nil {
+			if errKey, err := tm.enforceLimits(key, s, limits, nil, nil, false); errKey != "" {
+				return errKey, err
+			}
+		}
+		winner := *rule
+		ctx.Rule = &winner
+		if verdict, err := runAuthorizers(models.AuthStagePostRule, s.post, ctx, d); err != nil || verdict == models.VerdictDeny {
+			return "forbidden", err
+		}
+	}
+
+	// 限流和用量配额最后一起检查、一起扣减，被任何检查拒绝的请求都不消耗
+	return tm.enforceLimits(key, s, limits, requestQuotas(s.group, segments, api), d, true)
+}
+
+/**
+ * enforceLimits 检查限流和用量配额，全部通过后才一起扣减，任意一项超限时都不消耗
+ * 在读锁内执行，保证扣减时token仍然存在，删除token时能够释放对应的令牌桶
+ * @param {string} key token字符串
+ * @param {*authSubject[T]} s 鉴权快照
+ * @param {[]rateRequest} limits 限流项
+ * @param {[]*models.Quota} quotas 请求命中的配额
+ * @param {*models.AuthDecision} d 决策记录，不为nil时只检查不扣减
+ * @param {bool} consume 是否扣减，为false时只检查
+ * @returns {string, error} 错误键值和限流或配额错误
+ */
+func (tm *Manager[T]) enforceLimits(key string, s *authSubject[T], limits []rateRequest, quotas []*models.Quota, d *models.AuthDecision, consume bool) (string, error) {
+	if len(limits) == 0 && len(quotas) == 0 {
+		return "", nil
+	}
+	tm.rLock()
+	defer tm.rUnlock()
+	if t, err := tm.store.Get(key); err != nil || t == nil {
+		return "forbidden", nil // Token在鉴权期间被删除
+	}
+	// 固定按限流器、配额计数器的顺序加锁
+	tm.limiter.mu.Lock()
+	defer tm.limiter.mu.Unlock()
+	tm.quotas.mu.Lock()
+	defer tm.quotas.mu.Unlock()
+
+	levels, limited, retryAfter := tm.limiter.checkLocked(limits, s.now)
+	for i := range limits {
+		passed := limited != &limits[i]
+		recordCondition(d, limits[i].scope, "rate_limit", passed, "rate_limited")
+		if !passed {
+			break
+		}
+	}
+	if limited != nil {
+		if d != nil {
+			d.RetryAfter = retryAfter
+		}
+		return "rate_limited", &models.RateLimitError{
+			Scope:      limited.scope,
+			RetryAfter: retryAfter,
+			Message:    getErrorMessage(tm.config.Language, "rate_limited"),
+		}
+	}
+
+	if len(quotas) > 0 {
+		exceeded, resetAt := tm.quotas.checkLocked(s.token.TenantID, s.token.UserID, quotas, s.now)
+		recordCondition(d, "group", "quota", exceeded == nil, "quota_exceeded")
+		if exceeded != nil {
+			return "quota_exceeded", &models.QuotaExceededError{
+				Name:    exceeded.Key(),
+				ResetAt: resetAt,
+				Message: getErrorMessage(tm.config.Language, "quota_exceeded"),
+			}
+		}
+	}
+
+	if consume && d == nil {
+		tm.limiter.consumeLocked(key, limits, levels, s.now)
+		tm.quotas.consumeLocked(s.token.TenantID, s.token.UserID, quotas, s.now)
+	}
+	return "", nil
+}
+
+/**
+ * requestQuotas 找出请求命中的用户组配额
+ * @param {*models.Group} g 用户组
+ * @param {[]string} segments 请求路径段，为nil时从api解析
+ * @param {string} api 请求的API地址
+ * @returns {[]*models.Quota} 命中的配额
+ */
+func requestQuotas(g *models.Group, segments []string, api string) []*models.Quota {
+	if len(g.Quotas) == 0 {
+		return nil
+	}
+	if segments == nil {
+		segments = utility.ParseURLToPathSegments(api)
+	}
+	return matchQuotas(g.Quotas, segments)
+}
+
+/**
+ * loadAuthSubject 在读锁内完成Token、IP和用户组检查，并复制鉴权所需的数据
+ * @param {string} key token字符串
+ * @param {string} clientIp 客户端IP地址
+ * @param {*models.AuthDecision} d 决策记录，为nil时不记录细节
+ * @returns {*authSubject[T], string} 鉴权快照和错误键值
+ */
+func (tm *Manager[T]) loadAuthSubject(key string, clientIp string, d *models.AuthDecision) (*authSubject[T], string) {
 	// 输入参数验证
 	if strings.TrimSpace(key) == "" {
-		return errors.New(getErrorMessage(tm.config.Language, "invalid_token")) // 无效Token
+		if d != nil {
+			d.TokenCheck.ErrorKey = "invalid_token"
+		}
+		return nil, "invalid_token" // 无效Token
 	}
 	if clientIp == "" {
-		return errors.New(getErrorMessage(tm.config.Language, "invalid_ip")) // 无效IP
+		if d != nil {
+			d.BindingCheck.ErrorKey = "invalid_ip"
+		}
+		return nil, "invalid_ip" // 无效IP
 	}
-	// 检查是否启用了鉴权功能（如果没有配置任何用户组，则禁用鉴权）
+
 	tm.rLock()
-	if len(tm.groups) == 0 {
-		tm.rUnlock()
-		// 没有配置用户组，跳过权限验证，直接返回成功
-		return nil
+	defer tm.rUnlock()
+
+	// 检查是否启用了鉴权功能（如果没有配置任何用户组，则禁用鉴权）
+	if tm.groupCountLocked() == 0 {
+		return nil, authDisabled
 	}
 
 	// 第一阶段：Token验证（防止盗用）
-	t, exists := tm.tokens[key]
-	if !exists {
-		tm.rUnlock()
-		return errors.New(getErrorMessage(tm.config.Language, "invalid_token")) // 无效Token
+	t, err := tm.store.Get(key)
+	if err != nil {
+		if d != nil {
+			d.TokenCheck.ErrorKey = "internal"
+		}
+		return nil, "internal" // 存储不可用
 	}
 	if t == nil {
-		// token的key存在但值为nil，需要删除该token
-		tm.rUnlock()
-		// 使用专门的安全删除方法，避免锁升级死锁
-		tm.DelToken(key)
-		return errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
+		if d != nil {
+			d.TokenCheck.ErrorKey = "invalid_token"
+		}
+		return nil, "invalid_token" // 无效Token
 	}
 	if t.IsExpired() {
-		// token已过期，需要删除该token
-		tm.rUnlock()
-		// 升级为写锁进行删除操作
-		tm.lock()
-		// 重新检查token是否仍然过期
-		if currentToken, exists := tm.tokens[key]; exists && currentToken != nil && currentToken.IsExpired() {
-			delete(tm.tokens, key)
+		if d != nil {
+			d.TokenCheck.ErrorKey = "token_expired"
 		}
-		tm.unlock()
-		return errors.New(getErrorMessage(tm.config.Language, "token_expired")) // Token过期，拒绝访问
+		return nil, "token_expired" // Token过期，拒绝访问
+	}
+	if d != nil {
+		d.TokenCheck.Passed = true
+		d.TenantID = t.TenantID
+		d.GroupID = t.GroupID
 	}
 
 	// IP验证：若token有效但是ip不匹配，则判断为token被盗用
 	if t.IP != clientIp {
-		tm.rUnlock()
-		return errors.New(getErrorMessage(tm.config.Language, "forbidden")) // IP不匹配，token被盗用，禁止访问
+		if d != nil {
+			d.BindingCheck.ErrorKey = "forbidden"
+		}
+		return nil, "forbidden" // IP不匹配，token被盗用，禁止访问
+	}
+	if d != nil {
+		d.BindingCheck.Passed = true
 	}
 
-	// 获取用户组配置
-	g := tm.groups[t.GroupID]
+	// 获取用户组配置，只在token所属租户内查找；临时提权期间使用目标用户组
+	now := tm.now()
+	groupID, elevated := tm.effectiveGroupID(t, now)
+	g := tm.groups[t.TenantID][groupID]
 	if g == nil {
-		tm.rUnlock()
-		return errors.New(getErrorMessage(tm.config.Language, "forbidden")) // 用户组不存在，拒绝访问
+		return nil, "forbidden" // 用户组不存在，拒绝访问
+	}
+	if d != nil {
+		d.GroupFound = true
+		d.GroupName = g.Name
+		if elevated {
+			d.GroupID = groupID
+			d.ElevatedFrom = t.GroupID
+		}
 	}
 
-	// 第二阶段：API权限验证
-	// 如果用户组没有配置任何API规则，则拒绝访问
-	if len(g.ApiRules) == 0 {
-		tm.rUnlock()
-		return errors.New(getErrorMessage(tm.config.Language, "unauthorized")) // 无权访问
+	s := &authSubject[T]{
+		token:   *t,
+		group:   g,
+		groupID: groupID,
+		now:     now,
+		pre:     tm.preAuthorizers,
+		post:    tm.postAuthorizers,
 	}
-	// 检查API路径权限
-	if !utility.HasPermission(api, g.ApiRules) {
-		tm.rUnlock()
-		return errors.New(getErrorMessage(tm.config.Language, "unauthorized")) // 无权访问
+	// 用户数据会交给自定义鉴权器，只有注册了鉴权器时才需要深拷贝
+	if len(s.pre) > 0 || len(s.post) > 0 {
+		s.token = *snapshotToken(t)
 	}
+	return s, ""
+}
 
-	// 第三阶段：更新最后访问时间
-	// 释放读锁，升级为写锁
-	tm.rUnlock()
-	tm.lock()
+/**
+ * runAuthorizers 按顺序执行同一阶段的自定义鉴权器，遇到放行或拒绝时短路返回
+ * @param {models.AuthStage} stage 执行阶段
+ * @param {[]models.Authorizer[T]} authorizers 鉴权器列表
+ * @param {*models.AuthContext[T]} ctx 请求上下文
+ * @param {*models.AuthDecision} d 决策记录，为nil时不记录
+ * @returns {models.AuthVerdict, error} 判定结果和鉴权器返回的错误
+ */
+func runAuthorizers[T any](stage models.AuthStage, authorizers []models.Authorizer[T], ctx *models.AuthContext[T], d *models.AuthDecision) (models.AuthVerdict, error) {
+	for _, a := range authorizers {
+		verdict, err := a.Authorize(ctx)
+		if err != nil {
+			// 返回错误时一律视为拒绝（失败即拒绝）
+			verdict = models.VerdictDeny
+		}
+		if d != nil {
+			r := models.AuthorizerResult{Name: a.Name(), Stage: stage.String(), Verdict: verdict.String()}
+			if err != nil {
+				r.Error = err.Error()
+			}
+			d.Authorizers = append(d.Authorizers, r)
+		}
+		if verdict != models.VerdictAbstain {
+			return verdict, err
+		}
+	}
+	return models.VerdictAbstain, nil
+}
 
-	// 重新验证token是否仍然有效（防止在锁切换期间token被删除）
-	if currentToken, exists := tm.tokens[key]; exists && currentToken != nil && !currentToken.IsExpired() {
-		// 更新最后访问时间
-		currentToken.LastAccessTime = time.Now()
-		tm.tokens[key] = currentToken
-		tm.unlock()
-		return nil
-	} else {
-		// Token在锁切换期间被删除或过期
-		tm.unlock()
-		return errors.New(getErrorMessage(tm.config.Language, "forbidden")) // Token无效，拒绝访问
+/**
+ * recordCondition 记录附加条件的检查结果
+ * @param {*models.AuthDecision} d 决策记录，为nil时不记录
+ * @param {string} scope 条件范围
+ * @param {string} kind 条件类型
+ * @param {bool} passed 是否满足
+ * @param {string} errKey 未满足时的错误键值
+ * @returns {string} 未满足时返回errKey，否则返回空字符串
+ */
+func recordCondition(d *models.AuthDecision, scope, kind string, passed bool, errKey string) string {
+	if passed {
+		errKey = ""
+	}
+	if d != nil {
+		d.Conditions = append(d.Conditions, models.ConditionResult{
+			Scope:    scope,
+			Kind:     kind,
+			Passed:   passed,
+			ErrorKey: errKey,
+		})
 	}
+	return errKey
 }
 
 /**
@@ -8,11 +8,25 @@ import (
 )
 
 /**
- * BatchDeleteTokensByUserIDs 批量删除多个用户的所有token
+ * BatchDeleteTokensByUserIDs 批量删除默认租户下多个用户的所有token
  * @param {[]uint} userIDs 用户ID列表
  * @returns {error} 操作结果错误信息
  */
 func (tm *Manager[T]) BatchDeleteTokensByUserIDs(userIDs []uint) error {
+	return tm.batchDeleteTokensByUserIDs(DEFAULT_TENANT, userIDs)
+}
+
+/**
+ * BatchDeleteTokensByGroupIDs 批量删除默认租户下多个用户组的所有token
+ * @param {[]uint} groupIDs 用户组ID列表
+ * @returns {error} 操作结果错误信息
+ */
+func (tm *Manager[T]) BatchDeleteTokensByGroupIDs(groupIDs []uint) error {
+	return tm.batchDeleteTokensByGroupIDs(DEFAULT_TENANT, groupIDs)
+}
+
+// batchDeleteTokensByUserIDs 批量删除指定租户下多个用户的所有token
+func (tm *Manager[T]) batchDeleteTokensByUserIDs(tenantID string, userIDs []uint) error {
 	if len(userIDs) == 0 {
 		return nil // 空列表被认为是成功的操作
 	}
@@ -27,51 +41,27 @@ func (tm *Manager[T]) BatchDeleteTokensByUserIDs(userIDs []uint) error {
 	tm.lock()
 	defer tm.unlock()
 
-	// 创建用户ID集合用于快速查找
-	userIDSet := make(map[uint]bool)
+	// 通过存储的用户索引收集token键
+	var keys []string
 	for _, userID := range userIDs {
-		userIDSet[userID] = true
-	}
-
-	// 统计每个用户删除的token数量
-	deleteCount := make(map[uint]int)
-	totalDeleted := 0
-	expiredDeleted := 0
-	activeDeleted := 0
-
-	// 批量删除
-	for token, ut := range tm.tokens {
-		if userIDSet[ut.UserID] {
-			// 检查token是否过期
-			if ut.IsExpired() {
-				expiredDeleted++
-			} else {
-				activeDeleted++
-			}
-			delete(tm.tokens, token)
-			deleteCount[ut.UserID]++
-			totalDeleted++
+		userKeys, err := tm.store.KeysByUser(tenantID, userID)
+		if err != nil {
+			return tm.storeError(err)
 		}
+		keys = append(keys, userKeys...)
 	}
-
-	// 原子性更新统计信息
-	if totalDeleted > 0 {
-		tm.stats.TotalTokens -= totalDeleted
-		if activeDeleted > 0 {
-			tm.stats.ActiveTokens -= activeDeleted
-		}
-		tm.stats.LastUpdateTime = time.Now()
+	tokens, err := tm.tokensByKeysLocked(keys, nil)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// 批量删除并原子性更新统计信息
+	_, err = tm.deleteTokensLocked(tokens)
+	return err
 }
 
-/**
- * BatchDeleteTokensByGroupIDs 批量删除多个用户组的所有token
- * @param {[]uint} groupIDs 用户组ID列表
- * @returns {error} 操作结果错误信息
- */
-func (tm *Manager[T]) BatchDeleteTokensByGroupIDs(groupIDs []uint) error {
+// batchDeleteTokensByGroupIDs 批量删除指定租户下多个用户组的所有token
+func (tm *Manager[T]) batchDeleteTokensByGroupIDs(tenantID string, groupIDs []uint) error {
 	if len(groupIDs) == 0 {
 		return nil // 空列表被认为是成功的操作
 	}
@@ -88,51 +78,28 @@ func (tm *Manager[T]) BatchDeleteTokensByGroupIDs(groupIDs []uint) error {
 
 	// 检查用户组是否存在
 	for _, groupID := range groupIDs {
-		if _, exists := tm.groups[groupID]; !exists {
+		if _, exists := tm.groups[tenantID][groupID]; !exists {
 			return errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
 		}
 	}
 
-	// 创建用户组ID集合用于快速查找
-	groupIDSet := make(map[uint]bool)
+	// 通过存储的用户组索引收集token键
+	var keys []string
 	for _, groupID := range groupIDs {
-		groupIDSet[groupID] = true
-	}
-
-	// 统计每个用户组删除的token数量
-	deleteCount := make(map[uint]int)
-	totalDeleted := 0
-	expiredDeleted := 0
-	activeDeleted := 0
-
-	// 批量删除
-	for token, ut := range tm.tokens {
-		if groupIDSet[ut.GroupID] {
-			// 检查token是否过期
-			if ut.IsExpired() {
-				expiredDeleted++
-			} else {
-				activeDeleted++
-			}
-			delete(tm.tokens, token)
-			deleteCount[ut.GroupID]++
-			totalDeleted++
+		groupKeys, err := tm.store.KeysByGroup(tenantID, groupID)
+		if err != nil {
+			return tm.storeError(err)
 		}
+		keys = append(keys, groupKeys...)
 	}
-
-	// 直接更新统计信息，避免重复加锁
-	if activeDeleted > 0 {
-		tm.stats.TotalTokens -= activeDeleted
-		tm.stats.ActiveTokens -= activeDeleted
-		tm.stats.LastUpdateTime = time.Now()
-	}
-	if expiredDeleted > 0 {
-		// 对于过期token，只减少总数，不减少过期token计数
-		tm.stats.TotalTokens -= expiredDeleted
-		tm.stats.LastUpdateTime = time.Now()
+	tokens, err := tm.tokensByKeysLocked(keys, nil)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// 批量删除并原子性更新统计信息
+	_, err = tm.deleteTokensLocked(tokens)
+	return err
 }
 
 /**
@@ -143,38 +110,53 @@ func (tm *Manager[T]) BatchDeleteExpiredTokens() error {
 	tm.lock()
 	defer tm.unlock()
 
-	expiredTokens := make([]string, 0)
-
 	// 收集过期token
-	for key, token := range tm.tokens {
-		if token == nil {
-			expiredTokens = append(expiredTokens, key)
-		} else if token.IsExpired() {
-			expiredTokens = append(expiredTokens, key)
-		}
+	tokens, err := tm.tokensWhereLocked(nil)
+	if err != nil {
+		return err
 	}
 
 	// 批量删除
-	for _, key := range expiredTokens {
-		delete(tm.tokens, key)
+	deleteCount := 0
+	for key, token := range tokens {
+		if token != nil && !token.IsExpired() {
+			continue
+		}
+		if err = tm.removeTokenLocked(key, token); err != nil {
+			break
+		}
+		deleteCount++
 	}
 
-	deleteCount := len(expiredTokens)
 	if deleteCount > 0 {
 		// 删除过期token时，只减少总数，不减少过期token计数（过期token数是累计统计）
 		tm.stats.TotalTokens -= deleteCount
 		tm.stats.LastUpdateTime = time.Now()
 	}
 
-	return nil
+	return err
 }
 
 /**
- * GetTokensByUserID 获取指定用户的所有token
+ * GetTokensByUserID 获取默认租户下指定用户的所有token
  * @param {uint} userID 用户ID
- * @returns {[]*models.Token[T]} token列表
+ * @returns {[]*models.Token[T]} token副本列表，修改它们不会影响管理器中的token
  */
 func (tm *Manager[T]) GetTokensByUserID(userID uint) []*models.Token[T] {
+	return tm.getTokensByUserID(DEFAULT_TENANT, userID)
+}
+
+/**
+ * GetTokensByGroupID 获取默认租户下指定用户组的所有token
+ * @param {uint} groupID 用户组ID
+ * @returns {[]*models.Token[T]} token副本列表，修改它们不会影响管理器中的token
+ */
+func (tm *Manager[T]) GetTokensByGroupID(groupID uint) []*models.Token[T] {
+	return tm.getTokensByGroupID(DEFAULT_TENANT, groupID)
+}
+
+// getTokensByUserID 获取指定租户下某个用户的所有token
+func (tm *Manager[T]) getTokensByUserID(tenantID string, userID uint) []*models.Token[T] {
 	if userID == 0 {
 		return nil
 	}
@@ -182,22 +164,20 @@ func (tm *Manager[T]) GetTokensByUserID(userID uint) []*models.Token[T] {
 	tm.rLock()
 	defer tm.rUnlock()
 
-	tokens := make([]*models.Token[T], 0)
-	for _, token := range tm.tokens {
-		if token.UserID == userID {
-			tokens = append(tokens, token)
-		}
+	found, err := tm.tokensByKeysLocked(tm.store.KeysByUser(tenantID, userID))
+	if err != nil {
+		return nil
+	}
+	tokens := make([]*models.Token[T], 0, len(found))
+	for _, token := range found {
+		tokens = append(tokens, snapshotToken(token))
 	}
 
 	return tokens
 }
 
-/**
- * GetTokensByGroupID 获取指定用户组的所有token
- * @param {uint} groupID 用户组ID
- * @returns {[]*models.Token[T]} token列表
- */
-func (tm *Manager[T]) GetTokensByGroupID(groupID uint) []*models.Token[T] {
+// getTokensByGroupID 获取指定租户下某个用户组的所有token
+func (tm *Manager[T]) getTokensByGroupID(tenantID string, groupID uint) []*models.Token[T] {
 	if groupID == 0 {
 		return nil
 	}
@@ -206,15 +186,17 @@ func (tm *Manager[T]) GetTokensByGroupID(groupID uint) []*models.Token[T] {
 	defer tm.rUnlock()
 
 	// 检查用户组是否存在
-	if _, exists := tm.groups[groupID]; !exists {
+	if _, exists := tm.groups[tenantID][groupID]; !exists {
 		return nil
 	}
 
-	tokens := make([]*models.Token[T], 0)
-	for _, token := range tm.tokens {
-		if token.GroupID == groupID {
-			tokens = append(tokens, token)
-		}
+	found, err := tm.tokensByKeysLocked(tm.store.KeysByGroup(tenantID, groupID))
+	if err != nil {
+		return nil
+	}
+	tokens := make([]*models.Token[T], 0, len(found))
+	for _, token := range found {
+		tokens = append(tokens, snapshotToken(token))
 	}
 
 	return tokens
@@ -0,0 +1,79 @@
+package wt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * SetChangeHandler 设置状态变更回调，token被删除（过期清理除外）和用户组被修改时调用，用于在多个实例之间同步
+ * 回调在持有写锁时调用，必须尽快返回，不能调用管理器的方法；快照和预写日志的恢复不会触发回调
+ * @param {func(models.Change)} fn 变更回调，为nil时取消
+ */
+func (tm *Manager[T]) SetChangeHandler(fn func(c models.Change)) {
+	tm.lock()
+	defer tm.unlock()
+	tm.onChange = fn
+}
+
+/**
+ * ApplyChange 应用其他实例的状态变更，不会触发变更回调；变更是幂等的，重复应用没有副作用
+ * 要删除的token或用户组已不存在时不返回错误
+ * @param {models.Change} c 状态变更
+ * @returns {error} 参数或存储错误
+ */
+func (tm *Manager[T]) ApplyChange(c models.Change) error {
+	tm.lock()
+	defer tm.unlock()
+	fn := tm.onChange
+	tm.onChange = nil
+	defer func() { tm.onChange = fn }()
+
+	switch c.Op {
+	case models.ChangeRevoke:
+		t, err := tm.store.Get(c.Key)
+		if err != nil {
+			return tm.storeError(err)
+		}
+		if t == nil {
+			return nil
+		}
+		_, err = tm.deleteTokensLocked(map[string]*models.Token[T]{c.Key: t})
+		return err
+	case models.ChangeSetGroup:
+		if c.Group == nil || c.Group.ID == 0 {
+			return errors.New(getErrorMessage(tm.config.Language, "group_invalid"))
+		}
+		if err := tm.validateGroup(*c.Group); err != nil {
+			return err
+		}
+		return tm.setGroupLocked(c.TenantID, *c.Group)
+	case models.ChangeDelGroup:
+		if _, exists := tm.groups[c.TenantID][c.GroupID]; !exists {
+			return nil
+		}
+		return tm.removeGroupLocked(c.TenantID, c.GroupID)
+	}
+	return errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+}
+
+// notifyLocked 调用变更回调（调用方需持有写锁）
+func (tm *Manager[T]) notifyLocked(c models.Change) {
+	if tm.onChange != nil {
+		tm.onChange(c)
+	}
+}
+
+// notifyRevokeLocked 通知token被删除，已过期的token各实例会自行清理，不通知（调用方需持有写锁）
+func (tm *Manager[T]) notifyRevokeLocked(key string, t *models.Token[T]) {
+	if tm.onChange == nil || t == nil || t.IsExpired() {
+		return
+	}
+	c := models.Change{Op: models.ChangeRevoke, TenantID: t.TenantID, Key: key}
+	if t.ExpireSeconds != 0 {
+		c.ExpiresAt = t.LoginTime.Add(time.Duration(t.ExpireSeconds) * time.Second)
+	}
+	tm.onChange(c)
+}
@@ -0,0 +1,211 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_HTTP_PATH 默认的同步接口路径
+const DEFAULT_HTTP_PATH = "/wt/replication"
+
+// SIGNATURE_HEADER 请求签名的头部，值为请求体的HMAC-SHA256（十六进制）
+const SIGNATURE_HEADER = "X-WT-Signature"
+
+// MAX_MESSAGE_SIZE 单个消息的最大字节数
+const MAX_MESSAGE_SIZE = 64 << 20
+
+// ErrSignature 签名不匹配
+var ErrSignature = errors.New("消息签名不匹配")
+
+// HTTPOptions HTTP传输选项
+type HTTPOptions struct {
+	// Path 同步接口路径，为空时使用DEFAULT_HTTP_PATH
+	Path string
+	// Secret 集群共享密钥，不为空时对请求体签名并校验，所有节点必须一致
+	Secret []byte
+	// Client 发送请求使用的客户端，为nil时使用http.DefaultClient
+	Client *http.Client
+}
+
+// HTTPTransport 基于HTTP的传输方式，消息以JSON编码后POST到对等节点的同步接口
+//
+// 可以用NewHTTPTransport监听独立的地址，也可以作为http.Handler挂载到已有的服务上
+type HTTPTransport struct {
+	path   string
+	secret []byte
+	client *http.Client
+
+	mu      sync.RWMutex
+	handler func(msg *Message) *Message
+
+	listener net.Listener
+	server   *http.Server
+}
+
+/**
+ * NewHTTPTransport 创建HTTP传输并监听addr，addr的端口为0时自动分配
+ * @param {string} addr 监听地址，如"127.0.0.1:0"；为空时不监听，只作为http.Handler使用
+ * @param {HTTPOptions} opts 传输选项
+ * @returns {*HTTPTransport, error} 传输和监听错误
+ */
+func NewHTTPTransport(addr string, opts HTTPOptions) (*HTTPTransport, error) {
+	if opts.Path == "" {
+		opts.Path = DEFAULT_HTTP_PATH
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	t := &HTTPTransport{path: opts.Path, secret: opts.Secret, client: opts.Client}
+	if addr == "" {
+		return t, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(t.path, t)
+	t.listener = ln
+	t.server = &http.Server{Handler: mux}
+	go t.server.Serve(ln)
+	return t, nil
+}
+
+// Addr 对等节点访问本节点使用的地址（基础URL），未监听时为空
+func (t *HTTPTransport) Addr() string {
+	if t.listener == nil {
+		return ""
+	}
+	return "http://" + t.listener.Addr().String()
+}
+
+// Close 停止监听
+func (t *HTTPTransport) Close() error {
+	if t.server == nil {
+		return nil
+	}
+	return t.server.Close()
+}
+
+// Listen 设置收到消息时的处理函数
+func (t *HTTPTransport) Listen(handler func(msg *Message) *Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handler = handler
+}
+
+/**
+ * Send 把消息POST到对等节点的同步接口
+ * @param {context.Context} ctx 上下文
+ * @param {string} peer 对等节点的基础URL，如"http://10.0.0.2:8080"
+ * @param {*Message} msg 消息
+ * @returns {*Message, error} 回复和错误
+ */
+func (t *HTTPTransport) Send(ctx context.Context, peer string, msg *Message) (*Message, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(peer, "/")+t.path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(t.secret) > 0 {
+		req.Header.Set(SIGNATURE_HEADER, t.sign(body))
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MAX_MESSAGE_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if len(t.secret) > 0 && !t.verify(data, resp.Header.Get(SIGNATURE_HEADER)) {
+		return nil, ErrSignature
+	}
+	reply := &Message{}
+	if err := json.Unmarshal(data, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// ServeHTTP 处理对等节点发来的消息
+func (t *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, MAX_MESSAGE_SIZE))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(t.secret) > 0 && !t.verify(body, r.Header.Get(SIGNATURE_HEADER)) {
+		http.Error(w, ErrSignature.Error(), http.StatusUnauthorized)
+		return
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.mu.RLock()
+	handler := t.handler
+	t.mu.RUnlock()
+	if handler == nil {
+		http.Error(w, ErrClosed.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	reply := handler(msg)
+	if reply == nil {
+		reply = &Message{}
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(t.secret) > 0 {
+		w.Header().Set(SIGNATURE_HEADER, t.sign(data))
+	}
+	w.Write(data)
+}
+
+// sign 计算消息签名
+func (t *HTTPTransport) sign(body []byte) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify 校验消息签名
+func (t *HTTPTransport) verify(body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
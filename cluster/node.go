@@ -0,0 +1,493 @@
+// Package cluster 在多个管理器实例之间同步token撤销（注销、踢下线等）和用户组变更
+//
+// 每个实例运行一个Node，本地的变更作为事件异步推送给所有对等节点；
+// 推送失败（网络分区、节点重启）不重试，由定期的反熵同步补齐：双方交换已有的事件ID，互相补发对方缺少的事件。
+//
+// 事件ID由节点ID、节点每次启动时随机生成的实例标识和序号组成，重复收到的事件被忽略，因此推送和同步都是幂等的；
+// 节点重启后序号从头开始，实例标识保证新事件不会被对等节点当作已处理过的事件。
+// 事件时间使用混合逻辑时钟，同一个用户组的并发修改按(时间, 节点ID, 序号)取最后写入者。
+// token撤销事件保留到token原本的过期时间（永不过期的token保留TombstoneTTL），之后不再同步。
+//
+// 只同步变更，不同步token本身；各实例的token仍来自各自的存储（共享存储、快照等）
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// DEFAULT_SYNC_INTERVAL 默认的反熵同步间隔
+const DEFAULT_SYNC_INTERVAL = 30 * time.Second
+
+// DEFAULT_TOMBSTONE_TTL 默认的永不过期token撤销记录保留时间
+const DEFAULT_TOMBSTONE_TTL = 24 * time.Hour
+
+// DEFAULT_TIMEOUT 默认的单次发送超时时间
+const DEFAULT_TIMEOUT = 5 * time.Second
+
+// ErrClosed 节点已关闭
+var ErrClosed = errors.New("节点已关闭")
+
+// Replica 可同步的管理器，*wt.Manager实现了它
+type Replica interface {
+	// 设置状态变更回调
+	SetChangeHandler(fn func(c models.Change))
+	// 应用其他实例的状态变更，不触发变更回调
+	ApplyChange(c models.Change) error
+}
+
+// Transport 节点之间的传输方式，内置HTTPTransport
+type Transport interface {
+	// Send 把消息发送给对等节点并返回其回复
+	Send(ctx context.Context, peer string, msg *Message) (*Message, error)
+	// Listen 设置收到消息时的处理函数，返回值作为回复；为nil时拒绝所有消息
+	Listen(handler func(msg *Message) *Message)
+}
+
+// Event 一次状态变更
+type Event struct {
+	// ID 全局唯一的事件ID，由节点ID、实例标识和序号组成
+	ID string `json:"id"`
+	// Node 产生事件的节点ID
+	Node string `json:"node"`
+	// Seq 事件在产生它的节点中的序号
+	Seq uint64 `json:"seq"`
+	// Time 混合逻辑时钟的时间（纳秒）
+	Time int64 `json:"time"`
+	// Change 状态变更
+	Change models.Change `json:"change"`
+}
+
+// Message 节点之间传递的消息
+type Message struct {
+	// From 发送方节点ID
+	From string `json:"from"`
+	// Events 推送的事件，或同步时对方缺少的事件
+	Events []Event `json:"events,omitempty"`
+	// Sync 是否为反熵同步请求，回复中Have为回复方已有的事件ID
+	Sync bool `json:"sync,omitempty"`
+	// Have 同步时发送方已有的事件ID
+	Have []string `json:"have,omitempty"`
+}
+
+// Options 节点选项
+type Options struct {
+	// ID 节点ID，在集群内必须唯一，为空时随机生成
+	ID string
+	// Peers 对等节点的地址，由Transport解释（HTTPTransport为基础URL）
+	Peers []string
+	// SyncInterval 反熵同步间隔，为0时使用DEFAULT_SYNC_INTERVAL，为负数时只在启动和调用SyncNow时同步
+	SyncInterval time.Duration
+	// TombstoneTTL 永不过期token的撤销记录保留时间，为0时使用DEFAULT_TOMBSTONE_TTL
+	TombstoneTTL time.Duration
+	// Timeout 单次发送的超时时间，为0时使用DEFAULT_TIMEOUT
+	Timeout time.Duration
+	// OnError 推送、同步或应用事件失败时调用，peer为空表示本地应用失败，可以为nil
+	OnError func(peer string, err error)
+}
+
+// groupKey 用户组的键
+type groupKey struct {
+	tenantID string
+	id       uint
+}
+
+// Node 集群中的一个节点
+type Node struct {
+	id        string
+	replica   Replica
+	transport Transport
+	peers     []string
+	ttl       time.Duration
+	timeout   time.Duration
+	onError   func(peer string, err error)
+
+	// incarnation 本次启动的实例标识，节点重启后序号从头开始，事件ID仍然不会重复
+	incarnation string
+
+	// mu 保护以下字段
+	mu sync.Mutex
+	// seq 本节点最后一个事件的序号
+	seq uint64
+	// clock 混合逻辑时钟，为已产生和已收到的事件时间的最大值
+	clock int64
+	// events 需要同步的事件：未到期的撤销事件和每个用户组最新的事件
+	events map[string]*Event
+	// seen 已处理过的事件ID及其可以遗忘的时间，用于去重
+	seen map[string]time.Time
+	// groups 每个用户组最新的事件ID
+	groups map[groupKey]string
+	// outbox 等待推送的事件
+	outbox []Event
+
+	// applyMu 串行应用收到的事件，保证同一个用户组的事件按顺序生效
+	applyMu sync.Mutex
+
+	wake      chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+/**
+ * New 创建节点：注册变更回调和消息处理函数，启动推送和反熵同步，并立即与所有对等节点同步一次
+ * @param {Replica} replica 管理器，通常为manager.(*wt.Manager[T])
+ * @param {Transport} transport 传输方式
+ * @param {Options} opts 节点选项
+ * @returns {*Node, error} 节点和错误
+ */
+func New(replica Replica, transport Transport, opts Options) (*Node, error) {
+	if replica == nil || transport == nil {
+		return nil, errors.New("replica和transport不能为nil")
+	}
+	if opts.ID == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		opts.ID = hex.EncodeToString(b)
+	}
+	incarnation := make([]byte, 8)
+	if _, err := rand.Read(incarnation); err != nil {
+		return nil, err
+	}
+	if opts.SyncInterval == 0 {
+		opts.SyncInterval = DEFAULT_SYNC_INTERVAL
+	}
+	if opts.TombstoneTTL <= 0 {
+		opts.TombstoneTTL = DEFAULT_TOMBSTONE_TTL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_TIMEOUT
+	}
+	n := &Node{
+		id:          opts.ID,
+		incarnation: hex.EncodeToString(incarnation),
+		replica:     replica,
+		transport:   transport,
+		peers:       append([]string(nil), opts.Peers...),
+		ttl:         opts.TombstoneTTL,
+		timeout:     opts.Timeout,
+		onError:     opts.OnError,
+		events:      make(map[string]*Event),
+		seen:        make(map[string]time.Time),
+		groups:      make(map[groupKey]string),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	transport.Listen(n.handle)
+	replica.SetChangeHandler(n.record)
+
+	n.wg.Add(1)
+	go n.pushLoop()
+	n.wg.Add(1)
+	go n.syncLoop(opts.SyncInterval)
+	return n, nil
+}
+
+// ID 节点ID
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Close 取消变更回调和消息处理，停止推送和同步；未推送的事件由其他节点之后的反熵同步补齐
+func (n *Node) Close() error {
+	n.closeOnce.Do(func() {
+		n.replica.SetChangeHandler(nil)
+		n.transport.Listen(nil)
+		close(n.stop)
+		n.wg.Wait()
+	})
+	return nil
+}
+
+/**
+ * SyncNow 立即与所有对等节点进行反熵同步
+ * @returns {error} 各个对等节点的同步错误
+ */
+func (n *Node) SyncNow() error {
+	var errs []error
+	for _, peer := range n.peers {
+		if err := n.syncPeer(peer); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", peer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+/**
+ * record 变更回调：为本地变更生成事件并等待推送（在管理器持有写锁时调用，不能阻塞）
+ * @param {models.Change} c 状态变更
+ */
+func (n *Node) record(c models.Change) {
+	n.mu.Lock()
+	n.seq++
+	now := time.Now().UnixNano()
+	if now <= n.clock {
+		now = n.clock + 1
+	}
+	n.clock = now
+	ev := Event{ID: n.id + "-" + n.incarnation + "-" + strconv.FormatUint(n.seq, 10), Node: n.id, Seq: n.seq, Time: now, Change: c}
+	n.keepLocked(&ev)
+	n.outbox = append(n.outbox, ev)
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// handle 处理收到的消息
+func (n *Node) handle(msg *Message) *Message {
+	n.receive(msg.From, msg.Events)
+	if !msg.Sync {
+		return &Message{From: n.id}
+	}
+	missing, have := n.diff(msg.Have)
+	return &Message{From: n.id, Events: missing, Have: have}
+}
+
+/**
+ * receive 应用收到的事件，已处理过的事件被忽略
+ * 用户组事件只在比该用户组已有的事件新时应用；应用期间该用户组有了更新的事件（如本地的并发修改）时，
+ * 重新应用最新的事件，保证管理器中的用户组与最新的事件一致
+ * @param {string} peer 发送方，用于报告错误
+ * @param {[]Event} events 收到的事件
+ */
+func (n *Node) receive(peer string, events []Event) {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	for i := range events {
+		ev := events[i]
+		n.mu.Lock()
+		if _, ok := n.seen[ev.ID]; ok {
+			n.mu.Unlock()
+			continue
+		}
+		if ev.Time > n.clock {
+			n.clock = ev.Time
+		}
+		apply := n.keepLocked(&ev)
+		n.mu.Unlock()
+		if !apply {
+			continue
+		}
+
+		for {
+			if err := n.replica.ApplyChange(ev.Change); err != nil {
+				n.report("", fmt.Errorf("事件%s（来自%s）: %w", ev.ID, peer, err))
+			}
+			if ev.Change.Op == models.ChangeRevoke {
+				break
+			}
+			n.mu.Lock()
+			latest := n.events[n.groups[groupOf(ev.Change)]]
+			n.mu.Unlock()
+			if latest == nil || latest.ID == ev.ID {
+				break
+			}
+			ev = *latest
+		}
+	}
+}
+
+/**
+ * keepLocked 记录事件：标记为已处理，按类型决定是否保留以供同步（调用方需持有mu）
+ * @param {*Event} ev 事件
+ * @returns {bool} 事件是否需要应用：撤销事件总是需要，用户组事件只在比已有的新时需要
+ */
+func (n *Node) keepLocked(ev *Event) bool {
+	if ev.Change.Op == models.ChangeRevoke {
+		until := ev.Change.ExpiresAt
+		if until.IsZero() {
+			until = time.Unix(0, ev.Time).Add(n.ttl)
+		}
+		n.seen[ev.ID] = until
+		if until.After(time.Now()) {
+			n.events[ev.ID] = ev
+		}
+		return true
+	}
+
+	n.seen[ev.ID] = time.Now().Add(n.ttl)
+	k := groupOf(ev.Change)
+	if cur := n.events[n.groups[k]]; cur != nil {
+		if !newer(ev, cur) {
+			return false
+		}
+		delete(n.events, cur.ID)
+	}
+	n.groups[k] = ev.ID
+	n.events[ev.ID] = ev
+	return true
+}
+
+// diff 获取对方没有的事件，以及本节点已有的事件ID
+func (n *Node) diff(theirs []string) ([]Event, []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pruneLocked()
+	known := make(map[string]bool, len(theirs))
+	for _, id := range theirs {
+		known[id] = true
+	}
+	var missing []Event
+	have := make([]string, 0, len(n.events))
+	for id, ev := range n.events {
+		have = append(have, id)
+		if !known[id] {
+			missing = append(missing, *ev)
+		}
+	}
+	return missing, have
+}
+
+/**
+ * syncPeer 与一个对等节点进行反熵同步：发送已有的事件ID，应用对方回复中本节点缺少的事件，再补发对方缺少的事件
+ * @param {string} peer 对等节点地址
+ * @returns {error} 发送错误
+ */
+func (n *Node) syncPeer(peer string) error {
+	_, have := n.diff(nil)
+	reply, err := n.send(peer, &Message{From: n.id, Sync: true, Have: have})
+	if err != nil {
+		return err
+	}
+	n.receive(peer, reply.Events)
+	missing, _ := n.diff(reply.Have)
+	if len(missing) == 0 {
+		return nil
+	}
+	_, err = n.send(peer, &Message{From: n.id, Events: missing})
+	return err
+}
+
+// pushLoop 把本地事件推送给所有对等节点，失败时不重试
+func (n *Node) pushLoop() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-n.wake:
+		}
+		n.mu.Lock()
+		events := n.outbox
+		n.outbox = nil
+		n.mu.Unlock()
+		if len(events) == 0 {
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, peer := range n.peers {
+			wg.Add(1)
+			go func(peer string) {
+				defer wg.Done()
+				if _, err := n.send(peer, &Message{From: n.id, Events: events}); err != nil {
+					n.report(peer, err)
+				}
+			}(peer)
+		}
+		wg.Wait()
+	}
+}
+
+// syncLoop 启动时和之后每隔interval进行一次反熵同步
+func (n *Node) syncLoop(interval time.Duration) {
+	defer n.wg.Done()
+	n.syncAll()
+	if interval < 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+			n.syncAll()
+		}
+	}
+}
+
+// syncAll 与所有对等节点同步，逐个报告错误
+func (n *Node) syncAll() {
+	for _, peer := range n.peers {
+		select {
+		case <-n.stop:
+			return
+		default:
+		}
+		if err := n.syncPeer(peer); err != nil {
+			n.report(peer, err)
+		}
+	}
+}
+
+// send 带超时地发送消息
+func (n *Node) send(peer string, msg *Message) (*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	reply, err := n.transport.Send(ctx, peer, msg)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		reply = &Message{}
+	}
+	return reply, nil
+}
+
+// pruneLocked 删除已到期的撤销事件和可以遗忘的事件ID（调用方需持有mu）
+func (n *Node) pruneLocked() {
+	now := time.Now()
+	for id, until := range n.seen {
+		if now.After(until) {
+			delete(n.seen, id)
+		}
+	}
+	for id, ev := range n.events {
+		if ev.Change.Op != models.ChangeRevoke {
+			continue
+		}
+		if _, ok := n.seen[id]; !ok {
+			delete(n.events, id)
+		}
+	}
+}
+
+// report 报告错误
+func (n *Node) report(peer string, err error) {
+	if n.onError != nil {
+		n.onError(peer, err)
+	}
+}
+
+// groupOf 用户组事件对应的用户组
+func groupOf(c models.Change) groupKey {
+	if c.Group != nil {
+		return groupKey{c.TenantID, c.Group.ID}
+	}
+	return groupKey{c.TenantID, c.GroupID}
+}
+
+// newer 事件a是否比b新，按(时间, 节点ID, 序号)比较
+func newer(a, b *Event) bool {
+	if a.Time != b.Time {
+		return a.Time > b.Time
+	}
+	if a.Node != b.Node {
+		return a.Node > b.Node
+	}
+	return a.Seq > b.Seq
+}
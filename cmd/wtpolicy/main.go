@@ -0,0 +1,88 @@
+/*
+wtpolicy 策略文件命令行工具
+
+用法：
+
+	wtpolicy test -policy policy.yaml -cases cases.yaml [-lang zh]
+
+读取策略文件和测试用例文件，逐条校验访问预期。
+所有用例通过时退出码为0，存在失败用例时为1，文件无法读取或校验失败时为2。
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+/**
+ * run 执行命令并返回退出码
+ * @param {[]string} args 命令行参数（不含程序名）
+ * @param {io.Writer} stdout 标准输出
+ * @param {io.Writer} stderr 错误输出
+ * @returns {int} 退出码
+ */
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(stderr, "usage: wtpolicy test -policy <file> -cases <file>")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	policyPath := fs.String("policy", "", "策略文件（JSON或YAML）")
+	casesPath := fs.String("cases", "", "测试用例文件（JSON或YAML）")
+	lang := fs.String("lang", "en", "决策原因使用的语言，zh或en")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *policyPath == "" || *casesPath == "" {
+		fs.Usage()
+		return 2
+	}
+
+	policyFile, err := os.Open(*policyPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer policyFile.Close()
+	policy, err := wt.LoadPolicy(policyFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s:\n%v\n", *policyPath, err)
+		return 2
+	}
+	groups, err := wt.PolicyGroups(policy, wt.DEFAULT_DELIMITER)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", *policyPath, err)
+		return 2
+	}
+
+	casesFile, err := os.Open(*casesPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer casesFile.Close()
+	suite, err := wt.LoadPolicyTests(casesFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s:\n%v\n", *casesPath, err)
+		return 2
+	}
+
+	config := models.ConfigRaw{Delimiter: wt.DEFAULT_DELIMITER, Language: *lang}
+	results := wt.RunPolicyTests(groups, config, suite.Cases)
+	if err := wt.FormatPolicyTestResults(stdout, results); err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `schemaVersion: 1
+groups:
+  - id: 2
+    name: user
+    allow: [/api/user]
+    deny: [/api/user/admin]
+    tokenExpire: 1h
+`
+
+/**
+ * writeFile 在临时目录中写入文件并返回路径
+ */
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+/**
+ * TestRun 测试各种参数和文件下的退出码与输出
+ */
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	policy := writeFile(t, dir, "policy.yaml", testPolicy)
+	invalid := writeFile(t, dir, "invalid.yaml", "schemaVersion: 1\ngroups:\n  - id: 0\n    name: bad\n")
+	passing := writeFile(t, dir, "pass.yaml", "schemaVersion: 1\ncases:\n  - group: 2\n    path: /api/user/profile\n    expect: allow\n")
+	failing := writeFile(t, dir, "fail.yaml", "schemaVersion: 1\ncases:\n  - group: 2\n    path: /api/user/admin\n    expect: allow\n")
+	badCases := writeFile(t, dir, "bad-cases.yaml", "schemaVersion: 1\ncases:\n  - group: 2\n    path: /api\n    expect: maybe\n")
+	missing := filepath.Join(dir, "missing.yaml")
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout []string
+		stderr []string
+	}{
+		{"no subcommand", nil, 2, nil, []string{"usage: wtpolicy test"}},
+		{"unknown subcommand", []string{"lint"}, 2, nil, []string{"usage: wtpolicy test"}},
+		{"unknown flag", []string{"test", "-verbose"}, 2, nil, []string{"-verbose"}},
+		{"missing flags", []string{"test", "-policy", policy}, 2, nil, []string{"-cases"}},
+		{"missing policy file", []string{"test", "-policy", missing, "-cases", passing}, 2, nil, []string{"missing.yaml"}},
+		{"invalid policy", []string{"test", "-policy", invalid, "-cases", passing}, 2, nil, []string{"invalid.yaml:", "groups[0].id"}},
+		{"missing cases file", []string{"test", "-policy", policy, "-cases", missing}, 2, nil, []string{"missing.yaml"}},
+		{"invalid cases", []string{"test", "-policy", policy, "-cases", badCases}, 2, nil, []string{"bad-cases.yaml:", "cases[0].expect"}},
+		{"all passed", []string{"test", "-policy", policy, "-cases", passing}, 0,
+			[]string{"PASS group 2 /api/user/profile", "1 passed, 0 failed"}, nil},
+		{"failed", []string{"test", "-policy", policy, "-cases", failing}, 1,
+			[]string{"FAIL group 2 /api/user/admin: expected allow, got deny", "reason: Unauthorized access", "0 passed, 1 failed"}, nil},
+		{"failed in Chinese", []string{"test", "-policy", policy, "-cases", failing, "-lang", "zh"}, 1,
+			[]string{"reason: 未授权访问"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("exit code = %d, expected %d\nstdout:\n%s\nstderr:\n%s", code, tt.code, stdout.String(), stderr.String())
+			}
+			for _, want := range tt.stdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout missing %q:\n%s", want, stdout.String())
+				}
+			}
+			for _, want := range tt.stderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr missing %q:\n%s", want, stderr.String())
+				}
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ const (
 
 // 默认配置常量
 const (
+	// DEFAULT_TENANT 默认租户ID，不区分租户时所有用户组和token都属于该租户
+	DEFAULT_TENANT = ""
 
 	// DEFAULT_MAX_TOKENS 默认最大Token数量
 	DEFAULT_MAX_TOKENS = 10000
@@ -25,6 +27,22 @@ const (
 	DEFAULT_DELIMITER = " "
 	// DEFAULT_TOKEN_RENEW_TIME 默认Token续期时间
 	DEFAULT_TOKEN_RENEW_TIME = "10m"
+	// DEFAULT_AUDIT_CAPACITY 内存中保留的最近审计事件数量
+	DEFAULT_AUDIT_CAPACITY = 1000
+	// DEFAULT_JOURNAL_COMPACT_SIZE 预写日志超过该字节数时自动压缩为快照
+	DEFAULT_JOURNAL_COMPACT_SIZE = 64 << 20
+)
+
+// 持久化文件常量
+const (
+	// SNAPSHOT_FILE 日志目录中的快照文件名
+	SNAPSHOT_FILE = "tokens.snap"
+	// JOURNAL_FILE 日志目录中的预写日志文件名
+	JOURNAL_FILE = "tokens.wal"
+	// KEY_ID_SIZE 加密文件头中密钥标识的字节数
+	KEY_ID_SIZE = 8
+	// MAX_PREVIOUS_KEYS 密钥轮换后最多保留的旧密钥数量，超出时丢弃最早的密钥
+	MAX_PREVIOUS_KEYS = 2
 )
 
 // 时间单位常量
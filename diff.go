@@ -0,0 +1,150 @@
+package wt
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+/**
+ * DiffGroups 比较两套用户组配置，用于在UpdateAllGroup之前审阅变更
+ * 访问差异以两套配置中所有规则路径的前缀作为样例路径，逐一比较变更前后的HasPermission结果；
+ * 任意请求路径的结果都等于它所匹配的最长样例前缀的结果，因此这些样例覆盖了全部行为差异
+ * @param {[]models.GroupRaw} oldGroups 变更前的用户组配置
+ * @param {[]models.GroupRaw} newGroups 变更后的用户组配置
+ * @param {string} delimiter API分隔符
+ * @returns {*models.PolicyDiff} 差异
+ */
+func DiffGroups(oldGroups, newGroups []models.GroupRaw, delimiter string) *models.PolicyDiff {
+	oldByID := make(map[uint]models.GroupRaw, len(oldGroups))
+	for _, g := range oldGroups {
+		oldByID[g.ID] = g
+	}
+	newByID := make(map[uint]models.GroupRaw, len(newGroups))
+	for _, g := range newGroups {
+		newByID[g.ID] = g
+	}
+
+	ids := make([]uint, 0, len(oldByID)+len(newByID))
+	for id := range oldByID {
+		ids = append(ids, id)
+	}
+	for id := range newByID {
+		if _, ok := oldByID[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	diff := &models.PolicyDiff{}
+	for _, id := range ids {
+		oldRaw, inOld := oldByID[id]
+		newRaw, inNew := newByID[id]
+		g := models.GroupDiff{ID: id, Name: newRaw.Name}
+		if !inNew {
+			g.Name = oldRaw.Name
+		}
+		if inOld && inNew {
+			g.Fields = diffGroupFields(oldRaw, newRaw)
+		}
+		g.Access = diffGroupAccess(oldRaw, newRaw, inOld, inNew, delimiter)
+
+		switch {
+		case !inOld:
+			diff.Added = append(diff.Added, g)
+		case !inNew:
+			diff.Removed = append(diff.Removed, g)
+		case len(g.Fields) > 0 || len(g.Access) > 0:
+			diff.Changed = append(diff.Changed, g)
+		}
+	}
+	return diff
+}
+
+/**
+ * diffGroupFields 比较用户组的配置项（规则本身通过访问差异体现）
+ * @param {models.GroupRaw} oldRaw 变更前
+ * @param {models.GroupRaw} newRaw 变更后
+ * @returns {[]models.FieldChange} 配置项变化
+ */
+func diffGroupFields(oldRaw, newRaw models.GroupRaw) []models.FieldChange {
+	var changes []models.FieldChange
+	add := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			changes = append(changes, models.FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	add("name", oldRaw.Name, newRaw.Name)
+	// 比较解析后的秒数，"60m"与"1h"视为相同
+	if utility.ParseDuration(oldRaw.TokenExpire) != utility.ParseDuration(newRaw.TokenExpire) {
+		add("tokenExpire", oldRaw.TokenExpire, newRaw.TokenExpire)
+	}
+	add("allowMultipleLogin", strconv.FormatBool(oldRaw.AllowMultipleLogin == 1), strconv.FormatBool(newRaw.AllowMultipleLogin == 1))
+	add("timeWindows", diffJSON(oldRaw.TimeWindows), diffJSON(newRaw.TimeWindows))
+	add("allowCidrs", strings.Join(oldRaw.AllowCIDRs, ","), strings.Join(newRaw.AllowCIDRs, ","))
+	add("denyCidrs", strings.Join(oldRaw.DenyCIDRs, ","), strings.Join(newRaw.DenyCIDRs, ","))
+	add("rateLimit", diffJSON(oldRaw.RateLimit), diffJSON(newRaw.RateLimit))
+	add("quotas", diffJSON(oldRaw.Quotas), diffJSON(newRaw.Quotas))
+	add("ruleConditions", diffJSON(oldRaw.RuleConditions), diffJSON(newRaw.RuleConditions))
+	return changes
+}
+
+/**
+ * diffGroupAccess 比较用户组在样例路径上的访问结果
+ * @param {models.GroupRaw} oldRaw 变更前
+ * @param {models.GroupRaw} newRaw 变更后
+ * @param {bool} inOld 变更前是否存在该用户组
+ * @param {bool} inNew 变更后是否存在该用户组
+ * @param {string} delimiter API分隔符
+ * @returns {[]models.AccessChange} 访问结果变化
+ */
+func diffGroupAccess(oldRaw, newRaw models.GroupRaw, inOld, inNew bool, delimiter string) []models.AccessChange {
+	var oldRules, newRules []models.ApiRule
+	if inOld {
+		oldRules = ConvGroup(oldRaw, delimiter).ApiRules
+	}
+	if inNew {
+		newRules = ConvGroup(newRaw, delimiter).ApiRules
+	}
+
+	samples := make(map[string]bool)
+	for _, rules := range [][]models.ApiRule{oldRules, newRules} {
+		for _, r := range rules {
+			for n := 1; n <= len(r.Path); n++ {
+				samples["/"+strings.Join(r.Path[:n], "/")] = true
+			}
+		}
+	}
+	paths := make([]string, 0, len(samples))
+	for p := range samples {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var changes []models.AccessChange
+	for _, p := range paths {
+		before := utility.HasPermission(p, oldRules)
+		after := utility.HasPermission(p, newRules)
+		if before != after {
+			changes = append(changes, models.AccessChange{Path: p, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+/**
+ * diffJSON 将配置项序列化为便于比较的字符串
+ * @param {any} v 配置项
+ * @returns {string} JSON字符串，空值返回空字符串
+ */
+func diffJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" || string(data) == "[]" || string(data) == "{}" {
+		return ""
+	}
+	return string(data)
+}
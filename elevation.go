@@ -0,0 +1,230 @@
+package wt
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * Elevate 临时提权：有效期内Auth使用目标用户组鉴权，到期后自动恢复为原用户组
+ * 对已提权的token再次提权时替换原有的提权；每次提权都会记录审计事件
+ * @param {string} key token字符串
+ * @param {uint} targetGroupID 目标用户组ID，必须与token属于同一租户
+ * @param {time.Duration} duration 提权时长
+ * @param {string} reason 提权原因，不能为空
+ * @returns {*models.Elevation, error} 提权记录和错误信息
+ */
+func (tm *Manager[T]) Elevate(key string, targetGroupID uint, duration time.Duration, reason string) (*models.Elevation, error) {
+	if duration <= 0 || reason == "" {
+		return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+	tm.lock()
+	t, err := tm.store.Get(key)
+	if err != nil {
+		tm.unlock()
+		return nil, tm.storeError(err)
+	}
+	if t == nil || t.IsExpired() {
+		tm.unlock()
+		return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
+	}
+	if t.GroupID == targetGroupID {
+		tm.unlock()
+		return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+	if tm.groups[t.TenantID][targetGroupID] == nil {
+		tm.unlock()
+		return nil, errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
+	}
+	now := tm.now()
+	e := &models.Elevation{
+		ID:              tokenFingerprint(key),
+		TenantID:        t.TenantID,
+		UserID:          t.UserID,
+		OriginalGroupID: t.GroupID,
+		GroupID:         targetGroupID,
+		Reason:          reason,
+		StartedAt:       now,
+		ExpiresAt:       now.Add(duration),
+	}
+	// 总是替换整个提权记录，已复制出去的token快照不受影响
+	updated := *t
+	updated.Elevation = e
+	updated.Version++
+	err = tm.putTokenLocked(key, &updated)
+	tm.unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	tm.audit.record(elevationEvent(models.AuditElevate, e, now, reason))
+	result := *e
+	return &result, nil
+}
+
+/**
+ * RevokeElevation 提前撤销临时提权，token立即恢复为原用户组
+ * @param {string} id 提权ID
+ * @param {string} reason 撤销原因
+ * @returns {error} 提权不存在或已到期时返回错误
+ */
+func (tm *Manager[T]) RevokeElevation(id string, reason string) error {
+	tm.lock()
+	now := tm.now()
+	tokens, err := tm.tokensWhereLocked(func(t *models.Token[T]) bool {
+		return t.Elevation != nil && t.Elevation.ID == id && t.Elevation.Active(now)
+	})
+	var revoked *models.Elevation
+	for key, t := range tokens {
+		updated := *t
+		updated.Elevation = nil
+		updated.Version++
+		if err = tm.putTokenLocked(key, &updated); err == nil {
+			revoked = t.Elevation
+		}
+		break
+	}
+	tm.unlock()
+
+	if err != nil {
+		return err
+	}
+	if revoked == nil {
+		return errors.New(getErrorMessage(tm.config.Language, "elevation_not_found"))
+	}
+	tm.audit.record(elevationEvent(models.AuditElevationRevoked, revoked, now, reason))
+	return nil
+}
+
+/**
+ * ListElevations 获取所有仍然有效的临时提权
+ * @returns {[]models.Elevation} 按到期时间排列的提权列表
+ */
+func (tm *Manager[T]) ListElevations() []models.Elevation {
+	tm.rLock()
+	now := tm.now()
+	var result []models.Elevation
+	tm.store.Range(func(_ string, t *models.Token[T]) bool {
+		if t != nil && t.Elevation.Active(now) {
+			result = append(result, *t.Elevation)
+		}
+		return true
+	})
+	tm.rUnlock()
+
+	slices.SortFunc(result, func(a, b models.Elevation) int {
+		if c := a.ExpiresAt.Compare(b.ExpiresAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return result
+}
+
+/**
+ * RevertExpiredElevations 将所有到期的临时提权恢复为原用户组
+ * Auth在使用到期的提权时会自动忽略它，这里负责清理并记录审计事件
+ * @returns {int} 恢复的数量
+ */
+func (tm *Manager[T]) RevertExpiredElevations() int {
+	tm.lock()
+	now := tm.now()
+	var events []models.AuditEvent
+	tokens, _ := tm.tokensWhereLocked(func(t *models.Token[T]) bool {
+		return t.Elevation != nil && !t.Elevation.Active(now)
+	})
+	for key, t := range tokens {
+		updated := *t
+		if event, ok := revertExpiredElevationLocked(&updated, now); ok && tm.putTokenLocked(key, &updated) == nil {
+			events = append(events, event)
+		}
+	}
+	tm.unlock()
+
+	tm.audit.record(events...)
+	return len(events)
+}
+
+/**
+ * StartElevationSweeper 启动后台任务，定期恢复到期的临时提权
+ * @param {time.Duration} interval 检查间隔
+ * @returns {func()} 停止后台任务的函数，可以重复调用
+ */
+func (tm *Manager[T]) StartElevationSweeper(interval time.Duration) func() {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				tm.RevertExpiredElevations()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+/**
+ * effectiveGroupID 获取token当前用于鉴权的用户组ID（调用方需持有锁）
+ * @param {*models.Token[T]} t token信息
+ * @param {time.Time} now 当前时间
+ * @returns {uint, bool} 用户组ID，以及是否来自有效的临时提权
+ */
+func (tm *Manager[T]) effectiveGroupID(t *models.Token[T], now time.Time) (uint, bool) {
+	if e := t.Elevation; e.Active(now) && tm.groups[t.TenantID][e.GroupID] != nil {
+		return e.GroupID, true
+	}
+	// 提权到期或目标用户组已被删除时使用原用户组
+	return t.GroupID, false
+}
+
+/**
+ * revertExpiredElevationLocked 清除token上已到期的提权（调用方需持有写锁）
+ * @param {*models.Token[T]} t token信息
+ * @param {time.Time} now 当前时间
+ * @returns {models.AuditEvent, bool} 审计事件，以及是否发生了恢复
+ */
+func revertExpiredElevationLocked[T any](t *models.Token[T], now time.Time) (models.AuditEvent, bool) {
+	if t == nil || t.Elevation == nil || t.Elevation.Active(now) {
+		return models.AuditEvent{}, false
+	}
+	e := t.Elevation
+	t.Elevation = nil
+	t.Version++
+	return elevationEvent(models.AuditElevationExpired, e, now, e.Reason), true
+}
+
+/**
+ * elevationEvent 生成提权相关的审计事件
+ * @param {string} action 事件类型
+ * @param {*models.Elevation} e 提权记录
+ * @param {time.Time} now 发生时间
+ * @param {string} reason 原因
+ * @returns {models.AuditEvent} 审计事件
+ */
+func elevationEvent(action string, e *models.Elevation, now time.Time, reason string) models.AuditEvent {
+	return models.AuditEvent{
+		Time:          now,
+		Action:        action,
+		TenantID:      e.TenantID,
+		UserID:        e.UserID,
+		TokenID:       e.ID,
+		GroupID:       e.OriginalGroupID,
+		TargetGroupID: e.GroupID,
+		Reason:        reason,
+	}
+}
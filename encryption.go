@@ -0,0 +1,97 @@
+package wt
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrEncryptionKey 持久化文件使用的密钥与当前设置的密钥不一致，或文件已加密但没有设置密钥
+var ErrEncryptionKey = errors.New("加密密钥不匹配")
+
+// fileFlagEncrypted 快照和预写日志文件头中的标志位：内容已使用AES-GCM加密
+const fileFlagEncrypted = 1
+
+/**
+ * SetEncryption 设置持久化文件的加密密钥，此后写入的快照和预写日志使用AES-GCM加密
+ * 加密文件的文件头记录密钥标识，并与密钥标识一起作为附加认证数据，读取时密钥不一致会返回ErrEncryptionKey；
+ * 未加密的文件仍然可以读取，便于迁移。已打开预写日志时立即压缩，之后的日志记录也会加密
+ * @param {*SecurityManager} sm 安全管理器，为nil时关闭加密
+ * @returns {error} 压缩错误
+ */
+func (tm *Manager[T]) SetEncryption(sm *SecurityManager) error {
+	tm.lock()
+	defer tm.unlock()
+	tm.security = sm
+	if tm.journal != nil {
+		return tm.compactLocked()
+	}
+	return nil
+}
+
+/**
+ * RotateEncryptionKey 轮换加密密钥，并在后台用新密钥重新加密预写日志目录中的快照和日志
+ * 轮换之后写入的快照立即使用新密钥；旧密钥保留在SecurityManager的密钥环中，用旧密钥加密的文件
+ * （包括通过SaveSnapshot保存在其他位置的快照）仍然可以读取，重新保存后可以调用SecurityManager.RetirePreviousKeys丢弃。
+ * 密钥环只保留最近MAX_PREVIOUS_KEYS个旧密钥，更早的密钥在轮换时丢弃，用它们加密的文件不能再读取。
+ * 后台重新加密只在编码快照时持有读锁，不会长时间阻塞鉴权和登录；完成前进程退出时，需要旧密钥才能读取预写日志
+ * @param {string} newPassword 新密码，重启后需要配合新的盐值（SecurityManager.Salt）使用
+ * @returns {<-chan error} 重新加密完成时收到结果，成功为nil
+ */
+func (tm *Manager[T]) RotateEncryptionKey(newPassword string) <-chan error {
+	done := make(chan error, 1)
+	tm.lock()
+	sm := tm.security
+	if sm == nil {
+		tm.unlock()
+		done <- errors.New(getErrorMessage(tm.config.Language, "encryption_disabled"))
+		return done
+	}
+	// 已打开的预写日志继续使用创建时的密钥，直到压缩时换成新密钥
+	sm.RotateKey(newPassword)
+	tm.unlock()
+
+	go func() {
+		tm.rLock()
+		current := tm.security == sm
+		tm.rUnlock()
+		if !current {
+			// 已经换成其他密钥，SetEncryption会在写锁内压缩
+			done <- nil
+			return
+		}
+		done <- tm.compactConcurrently()
+	}()
+	return done
+}
+
+/**
+ * sealerLocked 获取写入文件使用的AES-GCM实例（调用方需持有锁）
+ * @returns {cipher.AEAD, []byte, error} AES-GCM实例和密钥标识，未设置加密时都为nil
+ */
+func (tm *Manager[T]) sealerLocked() (cipher.AEAD, []byte, error) {
+	if tm.security == nil {
+		return nil, nil, nil
+	}
+	return tm.security.aead()
+}
+
+/**
+ * openerLocked 获取解密文件使用的AES-GCM实例，文件可以使用当前密钥或轮换前还没有丢弃的密钥加密（调用方需持有锁）
+ * @param {[]byte} fileKeyID 文件头中的密钥标识
+ * @returns {cipher.AEAD, error} AES-GCM实例，密钥不一致时返回ErrEncryptionKey
+ */
+func (tm *Manager[T]) openerLocked(fileKeyID []byte) (cipher.AEAD, error) {
+	if tm.security == nil {
+		return nil, fmt.Errorf("%w: 文件使用密钥%s加密，但没有设置密钥", ErrEncryptionKey, hex.EncodeToString(fileKeyID))
+	}
+	aead, ok, err := tm.security.aeadFor(fileKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: 文件使用密钥%s加密，当前密钥为%s", ErrEncryptionKey, hex.EncodeToString(fileKeyID), tm.security.KeyID())
+	}
+	return aead, nil
+}
@@ -13,6 +13,16 @@ func getErrorMessage(language, errorKey string) string {
 	return getEnglishErrorMessage(errorKey)
 }
 
+/**
+ * GetErrorMessage 根据语言获取错误信息，供存储后端等子包返回与管理器一致的错误信息
+ * @param {string} language 语言类型，"zh"为中文，其他为英文
+ * @param {string} errorKey 错误键值
+ * @returns {string} 错误信息
+ */
+func GetErrorMessage(language, errorKey string) string {
+	return getErrorMessage(language, errorKey)
+}
+
 /**
  * getChineseErrorMessage 获取中文错误信息
  * @param {string} errorKey 错误键值
@@ -65,6 +75,15 @@ func getChineseErrorMessage(errorKey string) string {
 		"db_timeout":          "数据库操作超时",
 		"db_duplicate":        "唯一键冲突",
 		"db_foreign_key":      "外键约束违反",
+		"outside_time_window": "当前时间不在允许的访问时段内",
+		"invalid_path":        "请求路径不合法",
+		"rate_limited":        "请求过于频繁，请稍后重试",
+		"quota_exceeded":      "调用次数已用尽",
+		"elevation_not_found": "提权记录不存在",
+		"version_conflict":    "Token已被修改，请重新获取后再试",
+		"journal_open":        "预写日志已经打开",
+		"journal_not_open":    "预写日志未打开",
+		"encryption_disabled": "未设置加密密钥",
 		"unknown":             "未知错误",
 	}
 
@@ -126,6 +145,15 @@ func getEnglishErrorMessage(errorKey string) string {
 		"db_timeout":          "Database operation timeout",
 		"db_duplicate":        "Duplicate key violation",
 		"db_foreign_key":      "Foreign key violation",
+		"outside_time_window": "Access outside the permitted time window",
+		"invalid_path":        "Invalid request path",
+		"rate_limited":        "Too many requests, please retry later",
+		"quota_exceeded":      "Usage quota exceeded",
+		"elevation_not_found": "Elevation not found",
+		"version_conflict":    "Token was modified concurrently, reload and retry",
+		"journal_open":        "Journal is already open",
+		"journal_not_open":    "Journal is not open",
+		"encryption_disabled": "Encryption is not enabled",
 		"unknown":             "Unknown error",
 	}
 
@@ -133,4 +161,4 @@ func getEnglishErrorMessage(errorKey string) string {
 		return msg
 	}
 	return "Unknown error"
-}
\ No newline at end of file
+}
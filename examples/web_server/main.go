@@ -104,8 +104,16 @@ func initTokenManager() {
 	// 1. 设置自定义Token生成器（可选）
 	// tokenManager.SetTokenGenerator(customTokenGenerator)
 
-	// 2. 设置自定义验证函数（可选）
-	// tokenManager.SetCustomValidator(customValidator)
+	// 2. 注册自定义鉴权器（可选），在规则匹配前后插入功能开关、资源ACL等检查
+	// tokenManager.UseAuthorizer(models.AuthStagePreRule, models.AuthorizerFunc[UserInfo]{
+	//     ID: "feature-flag",
+	//     Fn: func(ctx *models.AuthContext[UserInfo]) (models.AuthVerdict, error) {
+	//         if ctx.Method == "DELETE" && ctx.UserData.Role != "admin" {
+	//             return models.VerdictDeny, nil
+	//         }
+	//         return models.VerdictAbstain, nil
+	//     },
+	// })
 
 	// 3. 动态添加用户组（可选）
 	// newGroup := wt.GroupRaw{
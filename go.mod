@@ -5,3 +5,5 @@ go 1.23.0
 toolchain go1.24.3
 
 require golang.org/x/crypto v0.40.0
+
+require gopkg.in/yaml.v3 v3.0.1
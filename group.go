@@ -2,6 +2,7 @@ package wt
 
 import (
 	"errors"
+	"net/netip"
 	"sort"
 	"strings"
 
@@ -9,11 +10,40 @@ import (
 	"github.com/windf17/wt/utility"
 )
 
-// GetGroup 获取并验证用户组配置
+// GetGroup 获取并验证默认租户下的用户组配置
 func (tm *Manager[T]) GetGroup(groupID uint) (*models.Group, error) {
+	return tm.getGroup(DEFAULT_TENANT, groupID)
+}
+
+// AddGroup 在默认租户下新增用户组
+func (tm *Manager[T]) AddGroup(raw *models.GroupRaw) error {
+	return tm.addGroup(DEFAULT_TENANT, raw)
+}
+
+// DelGroup 删除默认租户下的指定用户组及其所有token
+func (tm *Manager[T]) DelGroup(groupID uint) error {
+	return tm.delGroup(DEFAULT_TENANT, groupID)
+}
+
+// UpdateGroup 更新默认租户下的用户组
+func (tm *Manager[T]) UpdateGroup(groupID uint, raw *models.GroupRaw) error {
+	return tm.updateGroup(DEFAULT_TENANT, groupID, raw)
+}
+
+/**
+ * UpdateAllGroup 批量更新默认租户下的所有用户组
+ * @param {[]models.GroupRaw} groups 用户组原始数据列表
+ * @returns {error} 操作结果错误信息
+ */
+func (tm *Manager[T]) UpdateAllGroup(groups []models.GroupRaw) error {
+	return tm.updateAllGroup(DEFAULT_TENANT, groups)
+}
+
+// getGroup 获取指定租户下的用户组
+func (tm *Manager[T]) getGroup(tenantID string, groupID uint) (*models.Group, error) {
 	tm.rLock()
 	defer tm.rUnlock()
-	g := tm.groups[groupID]
+	g := tm.groups[tenantID][groupID]
 	if g == nil {
 		return nil, errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
 	}
@@ -21,21 +51,21 @@ func (tm *Manager[T]) GetGroup(groupID uint) (*models.Group, error) {
 	return g, nil
 }
 
-// AddGroup 新增用户组
-func (tm *Manager[T]) AddGroup(raw *models.GroupRaw) error {
+// addGroup 在指定租户下新增用户组
+func (tm *Manager[T]) addGroup(tenantID string, raw *models.GroupRaw) error {
 	if raw.ID == 0 {
 		return errors.New(getErrorMessage(tm.config.Language, "group_invalid"))
 	}
+	if err := tm.validateGroup(*raw); err != nil {
+		return err
+	}
 	tm.lock()
 	defer tm.unlock()
-	group := ConvGroup(*raw, tm.config.Delimiter)
-	tm.groups[raw.ID] = group
-
-	return nil
+	return tm.setGroupLocked(tenantID, *raw)
 }
 
-// DelGroup 删除指定用户组及其所有token
-func (tm *Manager[T]) DelGroup(groupID uint) error {
+// delGroup 删除指定租户下的用户组及其所有token
+func (tm *Manager[T]) delGroup(tenantID string, groupID uint) error {
 	if groupID == 0 {
 		return errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
 	}
@@ -43,75 +73,182 @@ func (tm *Manager[T]) DelGroup(groupID uint) error {
 	defer tm.unlock()
 
 	// 检查用户组是否存在
-	if _, exists := tm.groups[groupID]; !exists {
+	if _, exists := tm.groups[tenantID][groupID]; !exists {
 		return errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
 	}
 
 	// 删除该用户组的所有token
-	deleteCount := 0
-	for token, ut := range tm.tokens {
-		if ut.GroupID == groupID {
-			delete(tm.tokens, token)
-			deleteCount++
-		}
+	tokens, err := tm.tokensByKeysLocked(tm.store.KeysByGroup(tenantID, groupID))
+	if err != nil {
+		return err
 	}
-
-	// 删除用户组本身
-	delete(tm.groups, groupID)
-
-	if deleteCount > 0 {
-		tm.updateStatsCount(-deleteCount, true)
+	if _, err := tm.deleteTokensLocked(tokens); err != nil {
+		return err
 	}
 
-	return nil
+	// 删除用户组本身
+	return tm.removeGroupLocked(tenantID, groupID)
 }
 
-// UpdateGroup 更新用户组
-func (tm *Manager[T]) UpdateGroup(groupID uint, raw *models.GroupRaw) error {
+// updateGroup 更新指定租户下的用户组
+func (tm *Manager[T]) updateGroup(tenantID string, groupID uint, raw *models.GroupRaw) error {
 
 	if raw.ID == 0 {
 		return errors.New(getErrorMessage(tm.config.Language, "group_invalid"))
 	}
+	if err := tm.validateGroup(*raw); err != nil {
+		return err
+	}
 	tm.lock()
 	defer tm.unlock()
-	_, exists := tm.groups[groupID]
+	_, exists := tm.groups[tenantID][groupID]
 	if !exists {
 		return errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
 	}
-	group := ConvGroup(*raw, tm.config.Delimiter)
-	tm.groups[raw.ID] = group
-
-	return nil
+	return tm.setGroupLocked(tenantID, *raw)
 }
 
-/**
- * UpdateAllGroup 批量更新所有用户组
- * @param {[]models.GroupRaw} groups 用户组原始数据列表
- * @returns {error} 操作结果错误信息
- */
-func (tm *Manager[T]) UpdateAllGroup(groups []models.GroupRaw) error {
+// updateAllGroup 替换指定租户下的所有用户组，其他租户不受影响
+func (tm *Manager[T]) updateAllGroup(tenantID string, groups []models.GroupRaw) error {
 	// 验证所有用户组配置
 	for _, group := range groups {
 		if group.ID == 0 {
 			return errors.New(getErrorMessage(tm.config.Language, "group_invalid"))
 		}
+		if err := tm.validateGroup(group); err != nil {
+			return err
+		}
 	}
 
 	tm.lock()
 	defer tm.unlock()
 
-	// 清空现有的用户组
-	tm.groups = make(map[uint]*models.Group)
+	// 清空该租户现有的用户组
+	for groupID := range tm.groups[tenantID] {
+		if err := tm.removeGroupLocked(tenantID, groupID); err != nil {
+			return err
+		}
+	}
 
 	// 添加新的用户组
 	for _, raw := range groups {
-		group := ConvGroup(raw, tm.config.Delimiter)
-		tm.groups[raw.ID] = group
+		if err := tm.setGroupLocked(tenantID, raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateGroup 按管理器的分隔符验证用户组配置
+func (tm *Manager[T]) validateGroup(raw models.GroupRaw) error {
+	return validateGroupRaw(raw, tm.config.Delimiter)
+}
+
+/**
+ * setGroupLocked 新增或替换用户组，同时保存原始配置（调用方需持有写锁）
+ * 所有修改用户组的路径都必须经过这里，已打开预写日志时先写入日志，存储保存用户组时同时写入存储
+ * @param {string} tenantID 租户ID
+ * @param {models.GroupRaw} raw 原始用户组数据
+ * @returns {error} 日志或存储错误
+ */
+func (tm *Manager[T]) setGroupLocked(tenantID string, raw models.GroupRaw) error {
+	mark := tm.journalMarkLocked()
+	if err := tm.journalLocked(journalRecord{Op: journalSetGroup, TenantID: tenantID, Group: &raw}); err != nil {
+		return err
+	}
+	if tm.groupStore != nil {
+		if err := tm.groupStore.PutGroup(tenantID, raw); err != nil {
+			tm.rollbackJournalLocked(mark)
+			return tm.storeError(err)
+		}
+	}
+	tm.tenantGroupsLocked(tenantID)[raw.ID] = tm.convGroup(raw)
+	raws := tm.groupRaws[tenantID]
+	if raws == nil {
+		raws = make(map[uint]models.GroupRaw)
+		tm.groupRaws[tenantID] = raws
 	}
+	// 保存副本，调用方之后修改传入的配置不会影响持久化的内容
+	raws[raw.ID] = utility.DeepCopy(raw)
+	if tm.onChange != nil {
+		g := utility.DeepCopy(raw)
+		tm.notifyLocked(models.Change{Op: models.ChangeSetGroup, TenantID: tenantID, Group: &g})
+	}
+	tm.compactIfNeededLocked()
+	return nil
+}
 
+/**
+ * removeGroupLocked 删除用户组及其原始配置，不删除token（调用方需持有写锁）
+ * @param {string} tenantID 租户ID
+ * @param {uint} groupID 用户组ID
+ * @returns {error} 日志或存储错误
+ */
+func (tm *Manager[T]) removeGroupLocked(tenantID string, groupID uint) error {
+	mark := tm.journalMarkLocked()
+	if err := tm.journalLocked(journalRecord{Op: journalDelGroup, TenantID: tenantID, GroupID: groupID}); err != nil {
+		return err
+	}
+	if tm.groupStore != nil {
+		if err := tm.groupStore.DeleteGroup(tenantID, groupID); err != nil {
+			tm.rollbackJournalLocked(mark)
+			return tm.storeError(err)
+		}
+	}
+	delete(tm.groups[tenantID], groupID)
+	delete(tm.groupRaws[tenantID], groupID)
+	tm.notifyLocked(models.Change{Op: models.ChangeDelGroup, TenantID: tenantID, GroupID: groupID})
+	tm.compactIfNeededLocked()
 	return nil
 }
 
+// tenantGroupsLocked 获取租户的用户组表，不存在时创建（调用方需持有写锁）
+func (tm *Manager[T]) tenantGroupsLocked(tenantID string) map[uint]*models.Group {
+	g := tm.groups[tenantID]
+	if g == nil {
+		g = make(map[uint]*models.Group)
+		tm.groups[tenantID] = g
+	}
+	return g
+}
+
+// groupCountLocked 统计所有租户的用户组总数（调用方需持有锁）
+func (tm *Manager[T]) groupCountLocked() int {
+	n := 0
+	for _, g := range tm.groups {
+		n += len(g)
+	}
+	return n
+}
+
+/**
+ * convGroup 按管理器配置转换用户组，忽略大小写时规则路径统一转换为小写
+ * @param {models.GroupRaw} raw 原始用户组数据
+ * @returns {*models.Group} 转换后的用户组对象
+ */
+func (tm *Manager[T]) convGroup(raw models.GroupRaw) *models.Group {
+	g := ConvGroup(raw, tm.config.Delimiter)
+	if tm.config.StrictPaths && tm.config.CaseInsensitivePaths {
+		for i := range g.ApiRules {
+			for j, seg := range g.ApiRules[i].Path {
+				g.ApiRules[i].Path[j] = strings.ToLower(seg)
+			}
+		}
+		for i := range g.Quotas {
+			for j, seg := range g.Quotas[i].Path {
+				g.Quotas[i].Path[j] = strings.ToLower(seg)
+			}
+		}
+		// 转换后的路径可能改变排序，重新排序并编译前缀树
+		sort.SliceStable(g.ApiRules, func(i, j int) bool {
+			return compareApiRules(g.ApiRules[i].Path, g.ApiRules[j].Path)
+		})
+		g.Trie = models.NewRuleTrie(g.ApiRules)
+	}
+	return g
+}
+
 /**
  * ConvGroup 将GroupRaw转换为Group
  * @param {GroupRaw} raw 原始用户组数据
@@ -166,7 +303,19 @@ func ConvGroup(raw models.GroupRaw, delimiter string) *models.Group {
 		return compareApiRules(rules[i].Path, rules[j].Path)
 	})
 
+	// 处理时间窗口
+	g.TimeWindows = compileTimeWindows(raw.TimeWindows)
+	// 处理网络限制，配置错误时拒绝所有地址（ValidateGroupRaw会提前拦截这类配置）
+	g.Network = compileNetworkPolicy(raw.AllowCIDRs, raw.DenyCIDRs)
+	// 处理限流，配置错误时拒绝所有请求（ValidateGroupRaw会提前拦截这类配置）
+	g.RateLimit = raw.RateLimit.Compiled()
+	// 处理用量配额
+	g.Quotas = compileQuotas(raw.Quotas)
+	attachRuleConditions(rules, raw.RuleConditions)
+
 	g.ApiRules = rules
+	// 编译前缀树，鉴权时按路径段数而非规则数计算匹配成本
+	g.Trie = models.NewRuleTrie(rules)
 	return &g
 }
 
@@ -217,3 +366,76 @@ func compareApiRules(pathA, pathB []string) bool {
 	// 所有段都相同，保持原有顺序（稳定排序）
 	return false
 }
+
+/**
+ * compileTimeWindows 复制并编译时间窗口，配置错误的窗口在匹配时视为不满足
+ * @param {[]models.TimeWindow} windows 原始时间窗口
+ * @returns {[]models.TimeWindow} 编译后的时间窗口
+ */
+func compileTimeWindows(windows []models.TimeWindow) []models.TimeWindow {
+	if len(windows) == 0 {
+		return nil
+	}
+	compiled := make([]models.TimeWindow, len(windows))
+	copy(compiled, windows)
+	for i := range compiled {
+		compiled[i].Compile()
+	}
+	return compiled
+}
+
+/**
+ * attachRuleConditions 将GroupRaw中按路径配置的附加条件挂到对应的规则上
+ * @param {[]models.ApiRule} rules 规则数组
+ * @param {map[string]models.RuleCondition} conditions 以路径为键的附加条件
+ */
+func attachRuleConditions(rules []models.ApiRule, conditions map[string]models.RuleCondition) {
+	if len(conditions) == 0 {
+		return
+	}
+	byPath := make(map[string]models.RuleCondition, len(conditions))
+	for api, cond := range conditions {
+		byPath[strings.Join(utility.ParsePathToSegments(api), "/")] = cond
+	}
+	for i := range rules {
+		cond, ok := byPath[strings.Join(rules[i].Path, "/")]
+		if !ok {
+			continue
+		}
+		cond.TimeWindows = compileTimeWindows(cond.TimeWindows)
+		cond.Network = compileNetworkPolicy(cond.AllowCIDRs, cond.DenyCIDRs)
+		cond.RateLimit = cond.RateLimit.Compiled()
+		rules[i].Conditions = &cond
+	}
+}
+
+/**
+ * compileQuotas 复制配额配置并解析API前缀
+ * @param {[]models.Quota} quotas 原始配额配置
+ * @returns {[]models.Quota} 编译后的配额
+ */
+func compileQuotas(quotas []models.Quota) []models.Quota {
+	if len(quotas) == 0 {
+		return nil
+	}
+	compiled := make([]models.Quota, len(quotas))
+	copy(compiled, quotas)
+	for i := range compiled {
+		compiled[i].Path = utility.ParsePathToSegments(compiled[i].API)
+	}
+	return compiled
+}
+
+/**
+ * compileNetworkPolicy 编译网段列表，解析失败时返回拒绝所有地址的限制
+ * @param {[]string} allow 允许的网段
+ * @param {[]string} deny 禁止的网段
+ * @returns {*models.NetworkPolicy} 网络限制，为nil表示不限制
+ */
+func compileNetworkPolicy(allow, deny []string) *models.NetworkPolicy {
+	p, err := models.ParseNetworkPolicy(allow, deny)
+	if err != nil {
+		return &models.NetworkPolicy{Deny: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}}
+	}
+	return p
+}
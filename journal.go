@@ -0,0 +1,722 @@
+package wt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/windf17/wt/models"
+)
+
+// 预写日志文件的错误，可以用errors.Is判断具体原因
+var (
+	// ErrJournalCorrupt 预写日志中间的记录校验和不匹配或内容无法解析
+	ErrJournalCorrupt = errors.New("预写日志已损坏")
+	// ErrJournalVersion 预写日志的格式版本不受支持，通常由更新版本的程序写入
+	ErrJournalVersion = errors.New("不支持的预写日志格式版本")
+)
+
+// 预写日志文件格式：
+//
+//	magic(4) | version(2) | flags(2) | id(8) | [keyID(KEY_ID_SIZE)] | 记录...
+//
+// id在每次压缩清空日志时随机生成，快照记录它合并了哪个日志的前多少条记录，避免重放已合并的记录。每条记录为 length(4) | crc32c(4) | payload(length)，整数均为大端序，
+// 校验和使用Castagnoli多项式，只覆盖payload。flags包含fileFlagEncrypted时文件头带有keyID，
+// payload为 nonce | AES-GCM密文，附加认证数据为文件头和记录序号，记录不能被调换或移到其他文件
+const (
+	// journalMagic 预写日志文件头标识
+	journalMagic = "WTJL"
+	// journalVersion 当前的预写日志格式版本
+	journalVersion = 1
+	// journalHeaderSize 未加密时的文件头长度
+	journalHeaderSize = 4 + 2 + 2 + 8
+	// journalRecordHeaderSize 每条记录的长度和校验和所占的字节数
+	journalRecordHeaderSize = 4 + 4
+)
+
+// 预写日志记录的操作类型，每种操作都是幂等的，重复重放不会改变结果
+const (
+	// journalPutToken 新增或替换token（登录、修改用户数据、提权等）
+	journalPutToken = "put"
+	// journalDelToken 删除token
+	journalDelToken = "del"
+	// journalSetGroup 新增或替换用户组
+	journalSetGroup = "group"
+	// journalDelGroup 删除用户组
+	journalDelGroup = "ungroup"
+	// journalTenantMax 设置租户的最大token数量
+	journalTenantMax = "tenantMax"
+	// journalSetShared 修改用户的共享数据
+	journalSetShared = "shared"
+)
+
+// journalCRC 记录校验和使用的CRC表
+var journalCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// journalRecord 预写日志中的一条变更
+type journalRecord struct {
+	Op       string           `json:"op"`
+	Key      string           `json:"key,omitempty"`
+	Token    *tokenRecord     `json:"token,omitempty"`
+	TenantID string           `json:"tenantId,omitempty"`
+	Group    *models.GroupRaw `json:"group,omitempty"`
+	GroupID  uint             `json:"groupId,omitempty"`
+	Max      int              `json:"max,omitempty"`
+	Shared   *sharedRecord    `json:"shared,omitempty"`
+}
+
+// journal 已打开的预写日志
+type journal struct {
+	// f 预写日志文件
+	f *os.File
+	// dir 快照和预写日志所在的目录
+	dir string
+	// size 已写入的有效字节数
+	size int64
+	// compactSize 超过该字节数时自动压缩
+	compactSize int64
+	// header 文件头，加密时作为附加认证数据的一部分
+	header []byte
+	// aead 加密记录使用的AES-GCM实例，为nil时不加密
+	aead cipher.AEAD
+	// seq 下一条记录的序号
+	seq uint64
+	// err 写入失败且无法回滚时的错误，压缩成功前拒绝继续写入
+	err error
+}
+
+/**
+ * append 追加一条记录并同步到磁盘
+ * 写入失败时截掉写了一半的记录，保证之后的记录不会跟在残缺的记录后面
+ * @param {[]byte} payload 记录内容
+ * @returns {error} 写入错误
+ */
+func (j *journal) append(payload []byte) error {
+	if j.err != nil {
+		return j.err
+	}
+	if j.aead != nil {
+		// 每条记录使用新的随机nonce，写入失败后重试也不会重复使用
+		nonce := make([]byte, j.aead.NonceSize(), j.aead.NonceSize()+len(payload)+j.aead.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		payload = j.aead.Seal(nonce, nonce, payload, journalAD(j.header, j.seq))
+	}
+	buf := make([]byte, journalRecordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, journalCRC))
+	copy(buf[journalRecordHeaderSize:], payload)
+
+	_, err := j.f.Write(buf)
+	if err == nil {
+		err = j.f.Sync()
+	}
+	if err != nil {
+		if terr := j.truncate(j.size); terr != nil {
+			j.err = terr
+		}
+		return err
+	}
+	j.size += int64(len(buf))
+	j.seq++
+	return nil
+}
+
+/**
+ * reset 清空预写日志并写入新的文件头，之后的记录使用sm的当前密钥加密
+ * @param {*SecurityManager} sm 安全管理器，为nil时不加密
+ * @returns {error} 写入错误
+ */
+func (j *journal) reset(sm *SecurityManager) error {
+	header := make([]byte, journalHeaderSize, journalHeaderSize+KEY_ID_SIZE)
+	copy(header, journalMagic)
+	binary.BigEndian.PutUint16(header[4:6], journalVersion)
+	if _, err := rand.Read(header[8:16]); err != nil {
+		return err
+	}
+	var aead cipher.AEAD
+	if sm != nil {
+		var keyID []byte
+		var err error
+		if aead, keyID, err = sm.aead(); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint16(header[6:8], fileFlagEncrypted)
+		header = append(header, keyID...)
+	}
+
+	if err := j.truncate(0); err != nil {
+		return err
+	}
+	j.header = nil
+	if _, err := j.f.Write(header); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.size = int64(len(header))
+	j.header = header
+	j.aead = aead
+	j.seq = 0
+	j.err = nil
+	return nil
+}
+
+// journalMark 预写日志的写入位置，用于撤销之后追加的记录
+type journalMark struct {
+	size int64
+	seq  uint64
+}
+
+// mark 获取当前的写入位置
+func (j *journal) mark() journalMark {
+	return journalMark{size: j.size, seq: j.seq}
+}
+
+/**
+ * rollback 截掉写入位置之后追加的记录，变更没有在存储中生效时调用，保持日志与存储一致
+ * 截断失败时与append相同，压缩成功前拒绝继续写入
+ * @param {journalMark} m mark得到的写入位置
+ */
+func (j *journal) rollback(m journalMark) {
+	if j.size == m.size {
+		return
+	}
+	if err := j.truncate(m.size); err != nil {
+		j.err = err
+		return
+	}
+	j.seq = m.seq
+}
+
+// id 获取日志文件的标识，日志还没有文件头时为空
+func (j *journal) id() string {
+	if len(j.header) < journalHeaderSize {
+		return ""
+	}
+	return hex.EncodeToString(j.header[8:16])
+}
+
+// journalAD 加密记录的附加认证数据：文件头和记录序号
+func journalAD(header []byte, seq uint64) []byte {
+	ad := make([]byte, len(header)+8)
+	copy(ad, header)
+	binary.BigEndian.PutUint64(ad[len(header):], seq)
+	return ad
+}
+
+// truncate 把预写日志截断到指定长度并同步到磁盘
+func (j *journal) truncate(size int64) error {
+	if err := j.f.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := j.f.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.size = size
+	return nil
+}
+
+/**
+ * OpenJournal 打开预写日志，此后token、用户组、租户上限和用户共享数据的每次变更都先写入日志再生效
+ * 打开时用目录中的快照加上日志重放恢复状态，替换管理器中的现有内容，然后立即压缩；
+ * 目录中还没有快照时，以管理器的当前内容为起点。
+ * 崩溃时写了一半的最后一条记录会被截掉，中间的记录损坏时返回ErrJournalCorrupt。
+ * token的最后访问时间只用于淘汰，不写入日志
+ * @param {string} dir 快照和预写日志所在的目录，不存在时自动创建
+ * @param {int64} compactSize 日志超过该字节数时自动压缩，小于等于0时使用DEFAULT_JOURNAL_COMPACT_SIZE
+ * @returns {error} 读取、解析或写入错误
+ */
+func (tm *Manager[T]) OpenJournal(dir string, compactSize int64) error {
+	if compactSize <= 0 {
+		compactSize = DEFAULT_JOURNAL_COMPACT_SIZE
+	}
+	if err := os.MkdirAll(dir, DIR_PERM); err != nil {
+		return err
+	}
+
+	tm.lock()
+	defer tm.unlock()
+	if tm.journal != nil {
+		return errors.New(getErrorMessage(tm.config.Language, "journal_open"))
+	}
+
+	// 恢复的起点：目录中的快照，没有快照时使用当前内容
+	var state *persistedState[T]
+	snapPath := filepath.Join(dir, SNAPSHOT_FILE)
+	data, err := os.ReadFile(snapPath)
+	switch {
+	case err == nil:
+		if state, err = tm.decodeSnapshotLocked(data); err != nil {
+			return fmt.Errorf("%s: %w", snapPath, err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if state, err = tm.persistedStateLocked(); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	path := filepath.Join(dir, JOURNAL_FILE)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, FILE_PERM)
+	if err != nil {
+		return err
+	}
+	j := &journal{f: f, dir: dir, compactSize: compactSize}
+	if err := tm.replayJournalLocked(j, state); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := tm.restoreLocked(state); err != nil {
+		f.Close()
+		return err
+	}
+
+	tm.journal = j
+	if err := tm.compactLocked(); err != nil {
+		tm.journal = nil
+		f.Close()
+		return err
+	}
+	return nil
+}
+
+/**
+ * Compact 把预写日志压缩为日志目录中的新快照，然后清空日志
+ * @returns {error} 日志未打开或写入错误
+ */
+func (tm *Manager[T]) Compact() error {
+	tm.lock()
+	defer tm.unlock()
+	if tm.journal == nil {
+		return errors.New(getErrorMessage(tm.config.Language, "journal_not_open"))
+	}
+	return tm.compactLocked()
+}
+
+/**
+ * CloseJournal 关闭预写日志，此后的变更不再持久化；日志未打开时什么也不做
+ * @returns {error} 关闭文件的错误
+ */
+func (tm *Manager[T]) CloseJournal() error {
+	tm.lock()
+	defer tm.unlock()
+	if tm.journal == nil {
+		return nil
+	}
+	err := tm.journal.f.Close()
+	tm.journal = nil
+	return err
+}
+
+/**
+ * compactLocked 写入新快照并清空预写日志（调用方需持有写锁，日志已打开）
+ * 快照和日志都使用当前的加密密钥重新写入
+ * 快照记录了合并的日志，快照写入后、日志清空前崩溃时，下次打开不会再重放该日志，
+ * 即使日志仍使用轮换前的密钥也能正常打开
+ * @returns {error} 写入错误
+ */
+func (tm *Manager[T]) compactLocked() error {
+	j := tm.journal
+	data, err := tm.encodeSnapshotLocked(j)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(j.dir, SNAPSHOT_FILE), data); err != nil {
+		return err
+	}
+	// 重新写入文件头，密钥轮换或开启加密后日志随之换成当前密钥
+	return j.reset(tm.security)
+}
+
+/**
+ * SetJournalErrorHandler 设置预写日志自动压缩失败时的回调
+ * 自动压缩发生在变更已经写入日志之后，失败不影响变更本身，日志继续增长，下次变更时再尝试；
+ * 回调在持有写锁时调用，必须尽快返回，不能调用管理器的方法
+ * @param {func(error)} fn 错误回调，为nil时取消
+ */
+func (tm *Manager[T]) SetJournalErrorHandler(fn func(err error)) {
+	tm.lock()
+	defer tm.unlock()
+	tm.onJournalError = fn
+}
+
+/**
+ * compactConcurrently 压缩预写日志，只在编码快照时持有读锁，在替换快照和日志文件时短暂持有写锁
+ * 写入快照文件期间追加的日志记录用当前密钥重新写入新的日志；期间日志被关闭或已由其他操作压缩时什么也不做
+ * @returns {error} 编码或写入错误
+ */
+func (tm *Manager[T]) compactConcurrently() error {
+	tm.rLock()
+	j := tm.journal
+	if j == nil {
+		tm.rUnlock()
+		return nil
+	}
+	id, mark := j.id(), j.mark()
+	data, err := tm.encodeSnapshotLocked(j)
+	tm.rUnlock()
+	if err != nil {
+		return err
+	}
+
+	snapPath := filepath.Join(j.dir, SNAPSHOT_FILE)
+	tmp, err := writeTempFile(snapPath, data)
+	if err != nil {
+		return err
+	}
+	tm.lock()
+	defer tm.unlock()
+	if tm.journal != j || j.id() != id {
+		// 其他操作已经在写锁内用当前密钥压缩过，较旧的快照不能覆盖它
+		os.Remove(tmp)
+		return nil
+	}
+	if err := replaceFile(tmp, snapPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return tm.rewriteJournalLocked(j, mark)
+}
+
+/**
+ * rewriteJournalLocked 用当前密钥把日志中mark之后的记录写入新的日志文件，然后替换原日志（调用方需持有写锁）
+ * 替换前崩溃时原日志保持不变，快照记录了合并到哪条记录，重新打开时跳过已合并的记录
+ * @param {*journal} j 预写日志
+ * @param {journalMark} m 快照合并到的位置
+ * @returns {error} 读取、解密或写入错误，出错时继续使用原日志
+ */
+func (tm *Manager[T]) rewriteJournalLocked(j *journal, m journalMark) error {
+	tail := make([]byte, j.size-m.size)
+	if _, err := j.f.ReadAt(tail, m.size); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(j.dir, JOURNAL_FILE+".tmp-*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err := f.Chmod(FILE_PERM); err != nil {
+		return err
+	}
+	next := &journal{f: f, dir: j.dir, compactSize: j.compactSize}
+	if err := next.reset(tm.security); err != nil {
+		return err
+	}
+	seq := m.seq
+	for off := 0; off < len(tail); seq++ {
+		n := int(binary.BigEndian.Uint32(tail[off : off+4]))
+		payload := tail[off+journalRecordHeaderSize : off+journalRecordHeaderSize+n]
+		off += journalRecordHeaderSize + n
+		if j.aead != nil {
+			if payload, err = openJournalRecord(j.aead, j.header, seq, payload); err != nil {
+				return err
+			}
+		}
+		if err := next.append(payload); err != nil {
+			return err
+		}
+	}
+	if err := replaceFile(f.Name(), filepath.Join(j.dir, JOURNAL_FILE)); err != nil {
+		return err
+	}
+	committed = true
+	j.f.Close()
+	*j = *next
+	return nil
+}
+
+// compactIfNeededLocked 日志超过压缩阈值时压缩，失败时交给错误回调，下次变更再尝试（调用方需持有写锁）
+func (tm *Manager[T]) compactIfNeededLocked() {
+	if tm.journal == nil || tm.journal.size < tm.journal.compactSize {
+		return
+	}
+	if err := tm.compactLocked(); err != nil && tm.onJournalError != nil {
+		tm.onJournalError(err)
+	}
+}
+
+/**
+ * journalLocked 向预写日志追加一条变更，日志未打开时什么也不做（调用方需持有写锁）
+ * @param {journalRecord} rec 变更记录
+ * @returns {error} 写入错误
+ */
+func (tm *Manager[T]) journalLocked(rec journalRecord) error {
+	if tm.journal == nil {
+		return nil
+	}
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return tm.storeError(err)
+	}
+	if err := tm.journal.append(payload); err != nil {
+		return tm.storeError(err)
+	}
+	return nil
+}
+
+// journalMarkLocked 获取预写日志的当前写入位置，日志未打开时为零值（调用方需持有写锁）
+func (tm *Manager[T]) journalMarkLocked() journalMark {
+	if tm.journal == nil {
+		return journalMark{}
+	}
+	return tm.journal.mark()
+}
+
+// rollbackJournalLocked 撤销写入位置之后追加的日志记录，日志未打开时什么也不做（调用方需持有写锁）
+func (tm *Manager[T]) rollbackJournalLocked(m journalMark) {
+	if tm.journal != nil {
+		tm.journal.rollback(m)
+	}
+}
+
+/**
+ * journalPutLocked 向预写日志追加一条token的新增或替换（调用方需持有写锁）
+ * @param {string} key token键
+ * @param {*models.Token[T]} t token信息
+ * @returns {error} 编码或写入错误
+ */
+func (tm *Manager[T]) journalPutLocked(key string, t *models.Token[T]) error {
+	if tm.journal == nil {
+		return nil
+	}
+	r, err := tm.encodeTokenRecord(key, t)
+	if err != nil {
+		return tm.storeError(err)
+	}
+	return tm.journalLocked(journalRecord{Op: journalPutToken, Token: &r})
+}
+
+/**
+ * journalSharedLocked 向预写日志追加一条用户共享数据的修改（调用方需持有写锁）
+ * @param {userKey} k 用户
+ * @param {T} data 修改后的共享数据
+ * @returns {error} 编码或写入错误
+ */
+func (tm *Manager[T]) journalSharedLocked(k userKey, data T) error {
+	if tm.journal == nil {
+		return nil
+	}
+	r, err := tm.encodeSharedRecord(k, data)
+	if err != nil {
+		return tm.storeError(err)
+	}
+	return tm.journalLocked(journalRecord{Op: journalSetShared, Shared: &r})
+}
+
+/**
+ * replayJournalLocked 读取预写日志并依次应用到状态上，截掉写了一半的最后一条记录（调用方需持有写锁）
+ * @param {*journal} j 预写日志
+ * @param {*persistedState[T]} state 恢复的起点
+ * @returns {error} 读取或解析错误
+ */
+func (tm *Manager[T]) replayJournalLocked(j *journal, state *persistedState[T]) error {
+	data, err := io.ReadAll(j.f)
+	if err != nil {
+		return err
+	}
+	header, payloads, valid, err := parseJournal(data)
+	if err != nil {
+		return err
+	}
+	j.header = header
+	skip := 0
+	if id := j.id(); id != "" && id == state.foldedJournal {
+		// 快照已经合并了该日志的前面部分或全部记录，压缩后、替换日志前发生了崩溃
+		skip = len(payloads)
+		if state.foldedRecords != nil && *state.foldedRecords < uint64(skip) {
+			skip = int(*state.foldedRecords)
+		}
+	}
+	var aead cipher.AEAD
+	if len(header) > journalHeaderSize && len(payloads) > skip {
+		if aead, err = tm.openerLocked(header[journalHeaderSize:]); err != nil {
+			return err
+		}
+	}
+	for i := skip; i < len(payloads); i++ {
+		payload := payloads[i]
+		if aead != nil {
+			if payload, err = openJournalRecord(aead, header, uint64(i), payload); err != nil {
+				return fmt.Errorf("%w: 第%d条记录解密失败: %v", ErrJournalCorrupt, i, err)
+			}
+		}
+		if err := tm.applyJournalLocked(state, payload); err != nil {
+			return fmt.Errorf("%w: %v", ErrJournalCorrupt, err)
+		}
+	}
+
+	// valid之后是写了一半的记录；新文件或文件头没有写完整时，由随后的压缩重新写入文件头
+	if valid == 0 {
+		return nil
+	}
+	return j.truncate(valid)
+}
+
+// openJournalRecord 解密一条预写日志记录
+func openJournalRecord(aead cipher.AEAD, header []byte, seq uint64, payload []byte) ([]byte, error) {
+	if len(payload) < aead.NonceSize() {
+		return nil, errors.New("密文长度不足")
+	}
+	nonce := payload[:aead.NonceSize()]
+	return aead.Open(nil, nonce, payload[aead.NonceSize():], journalAD(header, seq))
+}
+
+/**
+ * applyJournalLocked 把一条记录应用到状态上（调用方需持有锁，用户数据使用当前的编解码器）
+ * @param {*persistedState[T]} state 状态
+ * @param {[]byte} payload 记录内容
+ * @returns {error} 解析错误
+ */
+func (tm *Manager[T]) applyJournalLocked(state *persistedState[T], payload []byte) error {
+	var rec journalRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case journalPutToken:
+		if rec.Token == nil {
+			return fmt.Errorf("%s: 缺少token", rec.Op)
+		}
+		t, err := tm.decodeTokenRecord(*rec.Token)
+		if err != nil {
+			return err
+		}
+		state.tokens[rec.Token.Key] = t
+	case journalDelToken:
+		state.deleteToken(rec.Key)
+	case journalSetGroup:
+		if rec.Group == nil {
+			return fmt.Errorf("%s: 缺少用户组", rec.Op)
+		}
+		state.setGroup(rec.TenantID, *rec.Group)
+	case journalDelGroup:
+		delete(state.groups[rec.TenantID], rec.GroupID)
+	case journalTenantMax:
+		if rec.Max <= 0 {
+			delete(state.tenantMax, rec.TenantID)
+		} else {
+			state.tenantMax[rec.TenantID] = rec.Max
+		}
+	case journalSetShared:
+		if rec.Shared == nil {
+			return fmt.Errorf("%s: 缺少共享数据", rec.Op)
+		}
+		k, data, err := tm.decodeSharedRecord(*rec.Shared)
+		if err != nil {
+			return err
+		}
+		state.shared[k] = data
+	default:
+		return fmt.Errorf("未知的操作类型: %q", rec.Op)
+	}
+	return nil
+}
+
+/**
+ * persistedStateLocked 把管理器的当前内容转换为持久化状态（调用方需持有锁）
+ * @returns {*persistedState[T], error} 当前状态和存储错误
+ */
+func (tm *Manager[T]) persistedStateLocked() (*persistedState[T], error) {
+	state := newPersistedState[T]()
+	state.expired = tm.stats.ExpiredTokens
+	for tenantID, raws := range tm.groupRaws {
+		for _, raw := range raws {
+			state.setGroup(tenantID, raw)
+		}
+	}
+	for tenantID, max := range tm.tenantMaxTokens {
+		state.tenantMax[tenantID] = max
+	}
+	tokens, err := tm.tokensWhereLocked(nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, t := range tokens {
+		if t != nil {
+			state.tokens[key] = t
+		}
+	}
+	for k, u := range tm.users {
+		state.shared[k] = u.data
+	}
+	return state, nil
+}
+
+/**
+ * parseJournal 校验预写日志并拆分出所有完整的记录
+ * 最后一条记录不完整或校验和不匹配时视为崩溃时写了一半，忽略该记录
+ * @param {[]byte} data 预写日志文件内容
+ * @returns {[]byte, [][]byte, int64, error} 文件头、记录内容列表、有效内容的长度，以及损坏或版本错误
+ */
+func parseJournal(data []byte) ([]byte, [][]byte, int64, error) {
+	if len(data) < journalHeaderSize {
+		// 创建文件时崩溃，文件头可能没有写完整
+		if !bytes.HasPrefix([]byte(journalMagic), data[:min(len(data), len(journalMagic))]) {
+			return nil, nil, 0, fmt.Errorf("%w: 文件头标识错误", ErrJournalCorrupt)
+		}
+		return nil, nil, 0, nil
+	}
+	if string(data[:4]) != journalMagic {
+		return nil, nil, 0, fmt.Errorf("%w: 文件头标识错误", ErrJournalCorrupt)
+	}
+	if v := binary.BigEndian.Uint16(data[4:6]); v != journalVersion {
+		return nil, nil, 0, fmt.Errorf("%w: %d", ErrJournalVersion, v)
+	}
+	headerSize := journalHeaderSize
+	switch flags := binary.BigEndian.Uint16(data[6:8]); flags {
+	case 0:
+	case fileFlagEncrypted:
+		headerSize += KEY_ID_SIZE
+	default:
+		return nil, nil, 0, fmt.Errorf("%w: 未知的文件头标志%#x", ErrJournalVersion, flags)
+	}
+	if len(data) < headerSize {
+		return nil, nil, 0, nil
+	}
+
+	var payloads [][]byte
+	off := headerSize
+	for off < len(data) {
+		rest := data[off:]
+		if len(rest) < journalRecordHeaderSize {
+			break
+		}
+		n := int(binary.BigEndian.Uint32(rest[0:4]))
+		if n > len(rest)-journalRecordHeaderSize {
+			break
+		}
+		end := journalRecordHeaderSize + n
+		payload := rest[journalRecordHeaderSize:end]
+		if crc32.Checksum(payload, journalCRC) != binary.BigEndian.Uint32(rest[4:8]) {
+			if off+end == len(data) {
+				break
+			}
+			return nil, nil, 0, fmt.Errorf("%w: 偏移%d处的记录校验和不匹配", ErrJournalCorrupt, off)
+		}
+		payloads = append(payloads, payload)
+		off += end
+	}
+	return data[:headerSize], payloads, int64(off), nil
+}
@@ -0,0 +1,470 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrCorrupt 数据文件中间的记录校验失败，文件已损坏
+var ErrCorrupt = errors.New("数据文件已损坏")
+
+// ErrVersion 数据文件格式版本不受支持
+var ErrVersion = errors.New("数据文件版本不受支持")
+
+// ErrClosed 数据库已关闭
+var ErrClosed = errors.New("数据库已关闭")
+
+const (
+	// fileMagic 数据文件魔数
+	fileMagic = "WTKV"
+	// fileVersion 数据文件格式版本
+	fileVersion = 1
+	// headerSize 文件头长度：魔数4字节、版本2字节、标志2字节、保留8字节
+	headerSize = 16
+	// recordHeaderSize 记录头长度：内容长度4字节、CRC32C校验4字节
+	recordHeaderSize = 8
+	// compactBatchSize 压缩时每条记录包含的键值对数量
+	compactBatchSize = 1000
+)
+
+// 记录中的操作类型
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+// DEFAULT_COMPACT_SIZE 默认的自动压缩阈值，文件超过该大小且一半以上是无效数据时压缩
+const DEFAULT_COMPACT_SIZE = 4 << 20
+
+// crcTable CRC32C（Castagnoli）校验表
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+/**
+ * DB 日志结构的键值数据库：所有数据保存在内存中，每次提交追加一条带校验的记录，启动时重放
+ *
+ * 文件格式：文件头（"WTKV" | 版本uint16 | 标志uint16 | 保留8字节）之后是连续的记录，
+ * 每条记录为 长度uint32 | CRC32C uint32 | 内容，内容是一个事务的所有操作。
+ * 一条记录要么完整写入，要么在重放时被丢弃，因此事务是原子的；末尾写了一半的记录在打开时截掉。
+ * 无效数据（被覆盖或删除的值）超过一半时自动压缩，压缩后的文件原子替换原文件
+ */
+type DB struct {
+	mu          sync.RWMutex
+	path        string
+	f           *os.File
+	data        map[string][]byte
+	size        int64
+	live        int64
+	compactSize int64
+	noSync      bool
+}
+
+// DBOptions 数据库选项
+type DBOptions struct {
+	// CompactSize 自动压缩阈值（字节），为0时使用DEFAULT_COMPACT_SIZE，为负数时不自动压缩
+	CompactSize int64
+	// NoSync 提交时不调用fsync，系统崩溃时可能丢失最近的提交（进程崩溃不受影响）
+	NoSync bool
+}
+
+/**
+ * OpenDB 打开或创建数据文件，重放所有记录
+ * @param {string} path 数据文件路径
+ * @param {DBOptions} opts 数据库选项
+ * @returns {*DB, error} 数据库和错误，文件损坏时返回ErrCorrupt
+ */
+func OpenDB(path string, opts DBOptions) (*DB, error) {
+	if opts.CompactSize == 0 {
+		opts.CompactSize = DEFAULT_COMPACT_SIZE
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, f: f, data: make(map[string][]byte), compactSize: opts.CompactSize, noSync: opts.NoSync}
+	if err := db.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Get 读取键的值，返回的切片不能修改
+func (db *DB) Get(key string) ([]byte, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	v, ok := db.data[key]
+	return v, ok
+}
+
+// Range 遍历所有键值对（顺序不确定），fn返回false时停止；遍历期间不能写入
+func (db *DB) Range(fn func(key string, value []byte) bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for k, v := range db.data {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Len 键的数量
+func (db *DB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.data)
+}
+
+// Size 数据文件的当前大小
+func (db *DB) Size() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.size
+}
+
+// Begin 开始事务；事务之间不隔离，并发提交时后提交的覆盖先提交的
+func (db *DB) Begin() *Tx {
+	return &Tx{db: db, writes: make(map[string][]byte)}
+}
+
+// Close 关闭数据文件
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return nil
+	}
+	err := db.f.Close()
+	db.f = nil
+	return err
+}
+
+/**
+ * Compact 把所有有效数据写入新文件并原子替换原文件
+ * @returns {error} 写入错误，出错时原文件保持不变
+ */
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.compactLocked()
+}
+
+// Tx 事务，写操作先保存在内存中，提交时作为一条记录写入
+type Tx struct {
+	db *DB
+	// writes 事务中的写操作，值为nil表示删除
+	writes map[string][]byte
+	// order 写操作的顺序，重复写同一个键时只保留最后一次
+	order []string
+	done  bool
+}
+
+// Get 读取键的值，能读到事务中的写入
+func (tx *Tx) Get(key string) ([]byte, bool) {
+	if v, ok := tx.writes[key]; ok {
+		return v, v != nil
+	}
+	return tx.db.Get(key)
+}
+
+// Put 写入键值对，value在提交前不能修改
+func (tx *Tx) Put(key string, value []byte) {
+	if value == nil {
+		value = []byte{}
+	}
+	tx.set(key, value)
+}
+
+// Delete 删除键
+func (tx *Tx) Delete(key string) {
+	tx.set(key, nil)
+}
+
+// Len 事务中的写操作数量
+func (tx *Tx) Len() int {
+	return len(tx.order)
+}
+
+// set 记录写操作
+func (tx *Tx) set(key string, value []byte) {
+	if _, ok := tx.writes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = value
+}
+
+/**
+ * Commit 把事务中的所有写操作作为一条记录追加到数据文件，写入成功后才修改内存中的数据
+ * @returns {error} 写入错误，出错时数据保持不变
+ */
+func (tx *Tx) Commit() error {
+	return tx.commit(!tx.db.noSync)
+}
+
+/**
+ * CommitNoSync 提交事务但不调用fsync，用于丢失后影响不大的写入（如访问时间）
+ * @returns {error} 写入错误
+ */
+func (tx *Tx) CommitNoSync() error {
+	return tx.commit(false)
+}
+
+// Rollback 丢弃事务中的所有写操作
+func (tx *Tx) Rollback() {
+	tx.done = true
+	tx.writes = nil
+	tx.order = nil
+}
+
+// commit 写入并应用事务
+func (tx *Tx) commit(sync bool) error {
+	if tx.done {
+		return errors.New("事务已结束")
+	}
+	tx.done = true
+	if len(tx.order) == 0 {
+		return nil
+	}
+	db := tx.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return ErrClosed
+	}
+	record := encodeRecord(tx.order, tx.writes)
+	if _, err := db.f.WriteAt(record, db.size); err != nil {
+		// 截掉可能写了一部分的记录
+		db.f.Truncate(db.size)
+		return err
+	}
+	if sync {
+		if err := db.f.Sync(); err != nil {
+			db.f.Truncate(db.size)
+			return err
+		}
+	}
+	db.size += int64(len(record))
+	for _, key := range tx.order {
+		db.applyLocked(key, tx.writes[key])
+	}
+	if db.compactSize > 0 && db.size > db.compactSize && db.size > 2*db.live {
+		// 压缩失败不影响已提交的数据，下次提交时重试
+		db.compactLocked()
+	}
+	return nil
+}
+
+// applyLocked 把一个写操作应用到内存中的数据并更新有效数据量（调用方需持有写锁）
+func (db *DB) applyLocked(key string, value []byte) {
+	if old, ok := db.data[key]; ok {
+		db.live -= entrySize(key, old)
+	}
+	if value == nil {
+		delete(db.data, key)
+		return
+	}
+	db.data[key] = value
+	db.live += entrySize(key, value)
+}
+
+// entrySize 键值对在记录中大约占用的字节数
+func entrySize(key string, value []byte) int64 {
+	return int64(1+2*binary.MaxVarintLen32+len(key)+len(value)) + recordHeaderSize
+}
+
+/**
+ * load 读取并重放数据文件，新文件写入文件头，末尾不完整的记录被截掉（调用方需持有写锁或尚未共享）
+ * @returns {error} 读取错误，中间的记录损坏时返回ErrCorrupt
+ */
+func (db *DB) load() error {
+	data, err := io.ReadAll(db.f)
+	if err != nil {
+		return err
+	}
+	if len(data) < headerSize {
+		// 新文件或文件头没有写完
+		header := make([]byte, headerSize)
+		copy(header, fileMagic)
+		binary.BigEndian.PutUint16(header[4:], fileVersion)
+		if err := db.f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := db.f.WriteAt(header, 0); err != nil {
+			return err
+		}
+		db.size = headerSize
+		return db.f.Sync()
+	}
+	if string(data[:4]) != fileMagic {
+		return fmt.Errorf("%w: 文件头无效", ErrCorrupt)
+	}
+	if v := binary.BigEndian.Uint16(data[4:]); v != fileVersion {
+		return fmt.Errorf("%w: %d", ErrVersion, v)
+	}
+
+	pos := headerSize
+	for pos < len(data) {
+		rest := data[pos:]
+		if len(rest) < recordHeaderSize {
+			break
+		}
+		n := int(binary.BigEndian.Uint32(rest))
+		if recordHeaderSize+n > len(rest) {
+			break
+		}
+		payload := rest[recordHeaderSize : recordHeaderSize+n]
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(rest[4:]) {
+			if recordHeaderSize+n == len(rest) {
+				// 最后一条记录写了一半
+				break
+			}
+			return fmt.Errorf("%w: 偏移%d的记录校验失败", ErrCorrupt, pos)
+		}
+		if err := db.replay(payload); err != nil {
+			return fmt.Errorf("%w: 偏移%d: %v", ErrCorrupt, pos, err)
+		}
+		pos += recordHeaderSize + n
+	}
+	if pos < len(data) {
+		if err := db.f.Truncate(int64(pos)); err != nil {
+			return err
+		}
+	}
+	db.size = int64(pos)
+	return nil
+}
+
+// replay 重放一条记录中的所有操作
+func (db *DB) replay(payload []byte) error {
+	count, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return errors.New("操作数量无效")
+	}
+	payload = payload[n:]
+	for i := uint64(0); i < count; i++ {
+		if len(payload) == 0 {
+			return errors.New("记录不完整")
+		}
+		op := payload[0]
+		key, rest, err := readBytes(payload[1:])
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opPut:
+			value, after, err := readBytes(rest)
+			if err != nil {
+				return err
+			}
+			db.applyLocked(string(key), value)
+			rest = after
+		case opDelete:
+			db.applyLocked(string(key), nil)
+		default:
+			return fmt.Errorf("未知的操作%d", op)
+		}
+		payload = rest
+	}
+	return nil
+}
+
+// readBytes 读取带长度前缀的字节串
+func readBytes(b []byte) ([]byte, []byte, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return nil, nil, errors.New("长度无效")
+	}
+	return b[n : n+int(l)], b[n+int(l):], nil
+}
+
+/**
+ * encodeRecord 把一组写操作编码为一条记录
+ * @param {[]string} keys 写操作的键，按顺序
+ * @param {map[string][]byte} writes 键对应的值，nil表示删除
+ * @returns {[]byte} 包含记录头的完整记录
+ */
+func encodeRecord(keys []string, writes map[string][]byte) []byte {
+	buf := make([]byte, recordHeaderSize, 256)
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	for _, key := range keys {
+		value := writes[key]
+		if value == nil {
+			buf = append(buf, opDelete)
+			buf = binary.AppendUvarint(buf, uint64(len(key)))
+			buf = append(buf, key...)
+			continue
+		}
+		buf = append(buf, opPut)
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+	}
+	payload := buf[recordHeaderSize:]
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.Checksum(payload, crcTable))
+	return buf
+}
+
+/**
+ * compactLocked 把所有有效数据写入临时文件，fsync后替换原文件（调用方需持有写锁）
+ * @returns {error} 写入错误，出错时原文件保持不变
+ */
+func (db *DB) compactLocked() error {
+	if db.f == nil {
+		return ErrClosed
+	}
+	dir := filepath.Dir(db.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(db.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, fileMagic)
+	binary.BigEndian.PutUint16(header[4:], fileVersion)
+	out := header
+	keys := make([]string, 0, compactBatchSize)
+	for key := range db.data {
+		keys = append(keys, key)
+		if len(keys) == compactBatchSize {
+			out = append(out, encodeRecord(keys, db.data)...)
+			keys = keys[:0]
+		}
+	}
+	if len(keys) > 0 {
+		out = append(out, encodeRecord(keys, db.data)...)
+	}
+	if _, err := tmp.Write(out); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, db.path); err != nil {
+		return fail(err)
+	}
+	// 替换成功后改为追加到新文件
+	db.f.Close()
+	db.f = tmp
+	db.size = int64(len(out))
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
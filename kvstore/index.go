@@ -0,0 +1,137 @@
+package kvstore
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+// expiryNode 过期时间索引的节点，按(at, key)排序，priority满足堆性质以保持平衡
+type expiryNode struct {
+	at          int64
+	key         string
+	priority    uint64
+	left, right *expiryNode
+}
+
+// expiryIndex 按过期时间（毫秒时间戳）排序的token键集合，插入、删除都是O(log n)，
+// 查询已过期的键只访问已过期的部分
+type expiryIndex struct {
+	root *expiryNode
+	size int
+}
+
+// less 比较两个(at, key)
+func less(at1 int64, key1 string, at2 int64, key2 string) bool {
+	if at1 != at2 {
+		return at1 < at2
+	}
+	return strings.Compare(key1, key2) < 0
+}
+
+// insert 插入(at, key)，已存在时不做任何操作
+func (idx *expiryIndex) insert(at int64, key string) {
+	var added bool
+	idx.root = insertNode(idx.root, &expiryNode{at: at, key: key, priority: rand.Uint64()}, &added)
+	if added {
+		idx.size++
+	}
+}
+
+// remove 删除(at, key)，不存在时不做任何操作
+func (idx *expiryIndex) remove(at int64, key string) {
+	var removed bool
+	idx.root = removeNode(idx.root, at, key, &removed)
+	if removed {
+		idx.size--
+	}
+}
+
+// before 按过期时间顺序获取过期时间早于at的所有键
+func (idx *expiryIndex) before(at int64) []string {
+	var keys []string
+	var walk func(n *expiryNode) bool
+	walk = func(n *expiryNode) bool {
+		if n == nil {
+			return true
+		}
+		if !walk(n.left) {
+			return false
+		}
+		if n.at >= at {
+			return false
+		}
+		keys = append(keys, n.key)
+		return walk(n.right)
+	}
+	walk(idx.root)
+	return keys
+}
+
+// insertNode 把节点插入子树，返回新的子树根
+func insertNode(n, node *expiryNode, added *bool) *expiryNode {
+	if n == nil {
+		*added = true
+		return node
+	}
+	switch {
+	case less(node.at, node.key, n.at, n.key):
+		n.left = insertNode(n.left, node, added)
+		if n.left.priority > n.priority {
+			n = rotateRight(n)
+		}
+	case less(n.at, n.key, node.at, node.key):
+		n.right = insertNode(n.right, node, added)
+		if n.right.priority > n.priority {
+			n = rotateLeft(n)
+		}
+	}
+	return n
+}
+
+// removeNode 从子树删除(at, key)，返回新的子树根
+func removeNode(n *expiryNode, at int64, key string, removed *bool) *expiryNode {
+	if n == nil {
+		return nil
+	}
+	switch {
+	case less(at, key, n.at, n.key):
+		n.left = removeNode(n.left, at, key, removed)
+	case less(n.at, n.key, at, key):
+		n.right = removeNode(n.right, at, key, removed)
+	default:
+		*removed = true
+		return merge(n.left, n.right)
+	}
+	return n
+}
+
+// merge 合并两棵子树，left中的所有节点都小于right
+func merge(left, right *expiryNode) *expiryNode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.priority > right.priority:
+		left.right = merge(left.right, right)
+		return left
+	}
+	right.left = merge(left, right.left)
+	return right
+}
+
+// rotateRight 右旋
+func rotateRight(n *expiryNode) *expiryNode {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	return l
+}
+
+// rotateLeft 左旋
+func rotateLeft(n *expiryNode) *expiryNode {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	return r
+}
@@ -0,0 +1,436 @@
+// Package kvstore 提供单机持久化的token存储，数据保存在本地的日志结构键值文件中，不需要运行数据库
+//
+// 键的布局：
+//
+//	t:{key}  token的各个字段（JSON），用户数据为编解码器的结果
+//	a:{key}  最后访问时间（纳秒时间戳，8字节），单独保存，访问时间的写入很小且不需要fsync
+//
+// 用户、用户组和过期时间的索引只保存在内存中，打开时根据token重建。
+// 存储实现了models.TxStore和models.ExpiryIndex：管理器一次删除多个token时在一个事务中完成，
+// 清理过期token时只读取已过期的部分
+package kvstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// 键的前缀
+const (
+	tokenPrefix  = "t:"
+	accessPrefix = "a:"
+)
+
+// ErrTxActive 已经有一个事务正在进行
+var ErrTxActive = errors.New("已有事务正在进行")
+
+// ErrNoTx 没有正在进行的事务
+var ErrNoTx = errors.New("没有正在进行的事务")
+
+// Options 存储选项
+type Options[T any] struct {
+	// Codec 用户数据的编解码器，为nil时使用JSON
+	Codec models.Codec[T]
+	// CompactSize 数据文件的自动压缩阈值，含义同DBOptions.CompactSize
+	CompactSize int64
+	// NoSync 提交时不调用fsync，含义同DBOptions.NoSync
+	NoSync bool
+}
+
+// Store 基于本地键值文件的token存储
+type Store[T any] struct {
+	db    *DB
+	codec models.Codec[T]
+
+	// mu 保护索引和事务
+	mu sync.RWMutex
+	// metas 已提交的token的索引字段
+	metas map[string]tokenMeta
+	// users 用户索引
+	users map[indexKey]map[string]struct{}
+	// groups 用户组索引
+	groups map[indexKey]map[string]struct{}
+	// expiry 过期时间索引，永不过期的token不在其中
+	expiry expiryIndex
+	// tx 正在进行的事务，为nil时每次写操作单独提交
+	tx *Tx
+	// txMetas 事务中修改的token索引字段，值为nil表示删除，提交后应用到索引
+	txMetas map[string]*tokenMeta
+}
+
+// tokenMeta 建立索引需要的token字段
+type tokenMeta struct {
+	tenantID string
+	userID   uint
+	groupID  uint
+	// expiresAt 过期时间的毫秒时间戳，0表示永不过期
+	expiresAt int64
+}
+
+// indexKey 用户和用户组索引的键
+type indexKey struct {
+	tenantID string
+	id       uint
+}
+
+// record token在文件中的格式
+type record struct {
+	TenantID       string            `json:"tenant,omitempty"`
+	UserID         uint              `json:"user"`
+	GroupID        uint              `json:"group"`
+	LoginTime      time.Time         `json:"login"`
+	ExpireSeconds  int64             `json:"expire"`
+	LastAccessTime time.Time         `json:"access"`
+	IP             string            `json:"ip"`
+	Version        uint64            `json:"version"`
+	Elevation      *models.Elevation `json:"elevation,omitempty"`
+	Data           []byte            `json:"data"`
+}
+
+/**
+ * Open 打开或创建数据文件并重建索引
+ * @param {string} path 数据文件路径
+ * @param {Options[T]} opts 存储选项
+ * @returns {*Store[T], error} token存储和错误，文件损坏时返回ErrCorrupt
+ */
+func Open[T any](path string, opts Options[T]) (*Store[T], error) {
+	if opts.Codec == nil {
+		opts.Codec = models.JSONCodec[T]{}
+	}
+	db, err := OpenDB(path, DBOptions{CompactSize: opts.CompactSize, NoSync: opts.NoSync})
+	if err != nil {
+		return nil, err
+	}
+	s := &Store[T]{
+		db:     db,
+		codec:  opts.Codec,
+		metas:  make(map[string]tokenMeta),
+		users:  make(map[indexKey]map[string]struct{}),
+		groups: make(map[indexKey]map[string]struct{}),
+	}
+	db.Range(func(k string, v []byte) bool {
+		key, ok := strings.CutPrefix(k, tokenPrefix)
+		if !ok {
+			return true
+		}
+		var r record
+		if err = json.Unmarshal(v, &r); err != nil {
+			err = fmt.Errorf("%w: token %q: %v", ErrCorrupt, key, err)
+			return false
+		}
+		meta := metaOf(&r)
+		s.indexLocked(key, &meta)
+		return true
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close 回滚未提交的事务并关闭数据文件
+func (s *Store[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx != nil {
+		s.tx.Rollback()
+		s.tx, s.txMetas = nil, nil
+	}
+	return s.db.Close()
+}
+
+// Compact 压缩数据文件，去掉被覆盖和删除的数据
+func (s *Store[T]) Compact() error {
+	return s.db.Compact()
+}
+
+// Get 获取token，事务中能读到事务中的写入
+func (s *Store[T]) Get(key string) (*models.Token[T], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getLocked(key)
+}
+
+// Put 保存token，不在事务中时立即提交
+func (s *Store[T]) Put(key string, t *models.Token[T]) error {
+	data, err := s.codec.Marshal(t.UserData)
+	if err != nil {
+		return err
+	}
+	r := record{
+		TenantID: t.TenantID, UserID: t.UserID, GroupID: t.GroupID,
+		LoginTime: t.LoginTime, ExpireSeconds: t.ExpireSeconds, LastAccessTime: t.LastAccessTime,
+		IP: t.IP, Version: t.Version, Elevation: t.Elevation, Data: data,
+	}
+	value, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+	meta := metaOf(&r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeLocked(key, &meta, true, func(tx *Tx) {
+		tx.Put(tokenPrefix+key, value)
+		// 保存的token已包含最新的访问时间
+		tx.Delete(accessPrefix + key)
+	})
+}
+
+// Delete 删除token，不存在时不返回错误
+func (s *Store[T]) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.readerLocked().Get(tokenPrefix + key); !ok {
+		return nil
+	}
+	return s.writeLocked(key, nil, true, func(tx *Tx) {
+		tx.Delete(tokenPrefix + key)
+		tx.Delete(accessPrefix + key)
+	})
+}
+
+// Touch 更新最后访问时间，只写入8字节且不调用fsync；token不存在时不会创建
+func (s *Store[T]) Touch(key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.readerLocked().Get(tokenPrefix + key); !ok {
+		return nil
+	}
+	value := binary.BigEndian.AppendUint64(nil, uint64(at.UnixNano()))
+	return s.writeLocked(key, nil, false, func(tx *Tx) {
+		tx.Put(accessPrefix+key, value)
+	})
+}
+
+// Range 遍历所有已提交的token，调用fn时不持有锁
+func (s *Store[T]) Range(fn func(key string, t *models.Token[T]) bool) error {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.metas))
+	for key := range s.metas {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+	for _, key := range keys {
+		t, err := s.Get(key)
+		if err != nil {
+			return err
+		}
+		// 遍历期间已被删除
+		if t == nil {
+			continue
+		}
+		if !fn(key, t) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// KeysByUser 获取租户内指定用户的所有token键，事务中的修改在提交后才反映到索引
+func (s *Store[T]) KeysByUser(tenantID string, userID uint) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return setKeys(s.users[indexKey{tenantID, userID}]), nil
+}
+
+// KeysByGroup 获取租户内指定用户组的所有token键，事务中的修改在提交后才反映到索引
+func (s *Store[T]) KeysByGroup(tenantID string, groupID uint) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return setKeys(s.groups[indexKey{tenantID, groupID}]), nil
+}
+
+// Len 获取已提交的token数量
+func (s *Store[T]) Len() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.metas), nil
+}
+
+// ExpiredKeys 按过期时间索引获取在指定时间之前过期的token键
+func (s *Store[T]) ExpiredKeys(before time.Time) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.expiry.before(before.UnixMilli()), nil
+}
+
+// Begin 开始事务，之后的写操作在Commit时作为一条记录写入
+func (s *Store[T]) Begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx != nil {
+		return ErrTxActive
+	}
+	s.tx = s.db.Begin()
+	s.txMetas = make(map[string]*tokenMeta)
+	return nil
+}
+
+// Commit 提交事务并更新索引，出错时事务中的写操作全部丢弃
+func (s *Store[T]) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx == nil {
+		return ErrNoTx
+	}
+	tx, metas := s.tx, s.txMetas
+	s.tx, s.txMetas = nil, nil
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for key, meta := range metas {
+		s.indexLocked(key, meta)
+	}
+	return nil
+}
+
+// Rollback 回滚事务
+func (s *Store[T]) Rollback() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx == nil {
+		return ErrNoTx
+	}
+	s.tx.Rollback()
+	s.tx, s.txMetas = nil, nil
+	return nil
+}
+
+// reader 读取数据的接口，DB和Tx都实现了它
+type reader interface {
+	Get(key string) ([]byte, bool)
+}
+
+// readerLocked 事务中从事务读取，否则从数据库读取（调用方需持有锁）
+func (s *Store[T]) readerLocked() reader {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+/**
+ * writeLocked 执行一次写操作：在事务中时加入事务，否则单独提交后更新索引（调用方需持有写锁）
+ * @param {string} key token键
+ * @param {*tokenMeta} meta 写入后token的索引字段，为nil表示删除；索引不变时传入nil且index为false
+ * @param {bool} index 是否需要更新索引
+ * @param {func(*Tx)} fn 写操作
+ * @returns {error} 写入错误
+ */
+func (s *Store[T]) writeLocked(key string, meta *tokenMeta, index bool, fn func(tx *Tx)) error {
+	if s.tx != nil {
+		fn(s.tx)
+		if index {
+			s.txMetas[key] = meta
+		}
+		return nil
+	}
+	tx := s.db.Begin()
+	fn(tx)
+	var err error
+	if index {
+		err = tx.Commit()
+	} else {
+		err = tx.CommitNoSync()
+	}
+	if err != nil {
+		return err
+	}
+	if index {
+		s.indexLocked(key, meta)
+	}
+	return nil
+}
+
+// getLocked 读取并解码token（调用方需持有锁）
+func (s *Store[T]) getLocked(key string) (*models.Token[T], error) {
+	r := s.readerLocked()
+	value, ok := r.Get(tokenPrefix + key)
+	if !ok {
+		return nil, nil
+	}
+	var rec record
+	if err := json.Unmarshal(value, &rec); err != nil {
+		return nil, err
+	}
+	data, err := s.codec.Unmarshal(rec.Data)
+	if err != nil {
+		return nil, err
+	}
+	t := &models.Token[T]{
+		UserID: rec.UserID, GroupID: rec.GroupID, TenantID: rec.TenantID,
+		LoginTime: rec.LoginTime, ExpireSeconds: rec.ExpireSeconds, LastAccessTime: rec.LastAccessTime,
+		IP: rec.IP, Version: rec.Version, Elevation: rec.Elevation, UserData: data,
+	}
+	if at, ok := r.Get(accessPrefix + key); ok && len(at) == 8 {
+		t.LastAccessTime = time.Unix(0, int64(binary.BigEndian.Uint64(at)))
+	}
+	return t, nil
+}
+
+// indexLocked 用token新的索引字段替换旧的，meta为nil表示token已删除（调用方需持有写锁）
+func (s *Store[T]) indexLocked(key string, meta *tokenMeta) {
+	if old, ok := s.metas[key]; ok {
+		removeFromSet(s.users, indexKey{old.tenantID, old.userID}, key)
+		removeFromSet(s.groups, indexKey{old.tenantID, old.groupID}, key)
+		if old.expiresAt != 0 {
+			s.expiry.remove(old.expiresAt, key)
+		}
+		delete(s.metas, key)
+	}
+	if meta == nil {
+		return
+	}
+	s.metas[key] = *meta
+	addToSet(s.users, indexKey{meta.tenantID, meta.userID}, key)
+	addToSet(s.groups, indexKey{meta.tenantID, meta.groupID}, key)
+	if meta.expiresAt != 0 {
+		s.expiry.insert(meta.expiresAt, key)
+	}
+}
+
+// metaOf 获取建立索引需要的字段
+func metaOf(r *record) tokenMeta {
+	m := tokenMeta{tenantID: r.TenantID, userID: r.UserID, groupID: r.GroupID}
+	if r.ExpireSeconds != 0 {
+		m.expiresAt = r.LoginTime.Add(time.Duration(r.ExpireSeconds) * time.Second).UnixMilli()
+	}
+	return m
+}
+
+// addToSet 把键加入索引
+func addToSet(idx map[indexKey]map[string]struct{}, k indexKey, key string) {
+	set := idx[k]
+	if set == nil {
+		set = make(map[string]struct{})
+		idx[k] = set
+	}
+	set[key] = struct{}{}
+}
+
+// removeFromSet 从索引删除键，集合为空时一并删除
+func removeFromSet(idx map[indexKey]map[string]struct{}, k indexKey, key string) {
+	set := idx[k]
+	delete(set, key)
+	if len(set) == 0 {
+		delete(idx, k)
+	}
+}
+
+// setKeys 集合中的所有键
+func setKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,208 @@
+package wt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+// 策略检查问题编码，编码一经发布不再改变含义
+const (
+	// LintDuplicateRule 同一列表中重复出现的规则
+	LintDuplicateRule = "WT001"
+	// LintAllowDenyConflict 同一路径同时出现在允许和禁止列表中
+	LintAllowDenyConflict = "WT002"
+	// LintRedundantRule 删除后不影响任何请求结果的规则
+	LintRedundantRule = "WT003"
+	// LintDenyOverridden 禁止规则下存在更长的允许规则，部分子路径实际被放行
+	LintDenyOverridden = "WT004"
+	// LintNoAllowRules 用户组没有任何允许规则，Auth永远不会通过
+	LintNoAllowRules = "WT005"
+	// LintInvalidTokenExpire TokenExpire无法解析
+	LintInvalidTokenExpire = "WT006"
+	// LintUnreachableRule 规则路径包含请求路径中不可能出现的字符，永远不会命中
+	LintUnreachableRule = "WT007"
+)
+
+// lintRule 检查过程中的规则
+type lintRule struct {
+	key      string
+	segments []string
+	allow    bool
+}
+
+// LintOptions 策略检查选项
+type LintOptions struct {
+	// Delimiter API分隔符，需与ConfigRaw.Delimiter一致；为空时按空白和逗号拆分
+	Delimiter string
+}
+
+/**
+ * LintGroups 静态检查用户组配置中的重复、冲突、冗余和无法生效的规则，AllowedAPIs和DeniedAPIs按空白和逗号拆分
+ * @param {[]models.GroupRaw} groups 用户组配置
+ * @returns {[]models.LintFinding} 检查结果，按用户组ID、规则路径和问题编码排序
+ */
+func LintGroups(groups []models.GroupRaw) []models.LintFinding {
+	return LintGroupsWithOptions(groups, LintOptions{})
+}
+
+/**
+ * LintGroupsWithOptions 按选项静态检查用户组配置，用于使用其他分隔符的配置
+ * @param {[]models.GroupRaw} groups 用户组配置
+ * @param {LintOptions} opts 检查选项
+ * @returns {[]models.LintFinding} 检查结果，按用户组ID、规则路径和问题编码排序
+ */
+func LintGroupsWithOptions(groups []models.GroupRaw, opts LintOptions) []models.LintFinding {
+	findings := make([]models.LintFinding, 0)
+	for _, raw := range groups {
+		findings = append(findings, lintGroup(raw, opts.Delimiter)...)
+	}
+	// 重复和冲突按发现的顺序报告，统一排序后输出才稳定
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.GroupID != b.GroupID {
+			return a.GroupID < b.GroupID
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Code < b.Code
+	})
+	return findings
+}
+
+/**
+ * lintGroup 检查单个用户组
+ * @param {models.GroupRaw} raw 用户组配置
+ * @param {string} delimiter API分隔符，为空时按空白和逗号拆分
+ * @returns {[]models.LintFinding} 检查结果
+ */
+func lintGroup(raw models.GroupRaw, delimiter string) []models.LintFinding {
+	var findings []models.LintFinding
+	report := func(code string, severity models.LintSeverity, rule string, format string, args ...any) {
+		findings = append(findings, models.LintFinding{
+			Code:      code,
+			Severity:  severity,
+			GroupID:   raw.ID,
+			GroupName: raw.Name,
+			Rule:      rule,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	if raw.TokenExpire != "" {
+		// 格式校验只检查单位，"1.5h"之类的值会通过校验但被ParseDuration解析为0
+		value := strings.TrimLeft(raw.TokenExpire[:len(raw.TokenExpire)-1], "0")
+		if err := validateTokenRenewTime(raw.TokenExpire); err != nil || (utility.ParseDuration(raw.TokenExpire) <= 0 && value != "") {
+			report(LintInvalidTokenExpire, models.LintError, "", "TokenExpire %q 无法解析，Token将永不过期", raw.TokenExpire)
+		}
+	}
+
+	// 收集规则，同时检查重复和冲突
+	rules := make(map[string]*lintRule)
+	conflicts := make(map[string]bool)
+	for _, list := range []struct {
+		apis  string
+		allow bool
+		name  string
+	}{{raw.DeniedAPIs, false, "DeniedAPIs"}, {raw.AllowedAPIs, true, "AllowedAPIs"}} {
+		seen := make(map[string]bool)
+		for _, api := range splitAPIs(list.apis, delimiter) {
+			segments := utility.ParsePathToSegments(api)
+			if len(segments) == 0 {
+				continue
+			}
+			key := "/" + strings.Join(segments, "/")
+			if seen[key] {
+				report(LintDuplicateRule, models.LintWarning, key, "规则在%s中重复出现", list.name)
+				continue
+			}
+			seen[key] = true
+			if strings.ContainsAny(key, "?#%") {
+				report(LintUnreachableRule, models.LintError, key, "请求路径会在解析时去除查询参数、锚点并解码百分号编码，该规则永远不会命中")
+			}
+			if existing, ok := rules[key]; ok && existing.allow != list.allow {
+				conflicts[key] = true
+				report(LintAllowDenyConflict, models.LintError, key, "同一路径同时出现在AllowedAPIs和DeniedAPIs中，实际结果取决于排序")
+				continue
+			}
+			rules[key] = &lintRule{key: key, segments: segments, allow: list.allow}
+		}
+	}
+
+	hasAllow := false
+	keys := make([]string, 0, len(rules))
+	for key, r := range rules {
+		keys = append(keys, key)
+		hasAllow = hasAllow || r.allow
+	}
+	sort.Strings(keys)
+	if !hasAllow {
+		report(LintNoAllowRules, models.LintError, "", "用户组没有任何允许规则，Auth永远不会通过")
+	}
+
+	for _, key := range keys {
+		r := rules[key]
+		if conflicts[key] {
+			continue
+		}
+		// 最近的上级规则决定了删除该规则后的结果
+		parent := nearestAncestor(r, rules)
+		switch {
+		case parent == nil && !r.allow:
+			report(LintRedundantRule, models.LintWarning, key, "没有上级允许规则，默认即为拒绝，该禁止规则是多余的")
+		case parent != nil && parent.allow == r.allow && !conflicts[parent.key]:
+			report(LintRedundantRule, models.LintWarning, key, "与上级规则%s效果相同，该规则是多余的", parent.key)
+		}
+
+		if !r.allow {
+			var overriding []string
+			for _, other := range keys {
+				o := rules[other]
+				if o.allow && len(o.segments) > len(r.segments) && hasSegmentPrefix(o.segments, r.segments) && nearestAncestor(o, rules) == r {
+					overriding = append(overriding, other)
+				}
+			}
+			if len(overriding) > 0 {
+				report(LintDenyOverridden, models.LintInfo, key, "禁止规则被更长的允许规则覆盖: %s", strings.Join(overriding, ", "))
+			}
+		}
+	}
+	return findings
+}
+
+/**
+ * nearestAncestor 查找路径最长的上级规则（规则路径为当前规则路径的真前缀）
+ * @param {*lintRule} r 当前规则
+ * @param {map[string]*lintRule} rules 全部规则
+ * @returns {*lintRule} 上级规则，没有时返回nil
+ */
+func nearestAncestor(r *lintRule, rules map[string]*lintRule) *lintRule {
+	for n := len(r.segments) - 1; n > 0; n-- {
+		if parent, ok := rules["/"+strings.Join(r.segments[:n], "/")]; ok {
+			return parent
+		}
+	}
+	return nil
+}
+
+/**
+ * hasSegmentPrefix 判断路径段数组是否以指定前缀开头
+ * @param {[]string} segments 路径段数组
+ * @param {[]string} prefix 前缀
+ * @returns {bool} 是否以前缀开头
+ */
+func hasSegmentPrefix(segments, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for i := range prefix {
+		if segments[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
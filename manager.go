@@ -7,29 +7,75 @@ import (
 	"time"
 
 	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
 )
 
 // Manager Token管理器结构体
 type Manager[T any] struct {
-	// tokens 存储所有token
-	tokens map[string]*models.Token[T]
-	// groups 存储所有用户组
-	groups map[uint]*models.Group
+	// store token存储，默认为内存存储
+	store models.TokenStore[T]
+	// groupStore 存储同时实现了models.GroupStore时用于保存用户组，否则为nil
+	groupStore models.GroupStore
+	// codec 持久化时用户数据的编解码器
+	codec models.Codec[T]
+	// groups 按租户存储所有用户组，不同租户的组ID可以重复
+	groups map[string]map[uint]*models.Group
+	// groupRaws 用户组的原始配置，与groups一一对应，用于持久化
+	groupRaws map[string]map[uint]models.GroupRaw
 	// config 配置信息
 	config *models.Config
 	// mu 读写锁
 	mu sync.RWMutex
 	// stats 统计信息
 	stats models.Stats
+	// tenantMaxTokens 各租户的最大token数量，未设置或为0表示不单独限制
+	tenantMaxTokens map[string]int
+	// preAuthorizers 规则匹配之前执行的自定义鉴权器
+	preAuthorizers []models.Authorizer[T]
+	// postAuthorizers 规则匹配之后执行的自定义鉴权器
+	postAuthorizers []models.Authorizer[T]
+	// limiter 限流器状态
+	limiter *rateLimiter
+	// quotas 用量配额计数
+	quotas *quotaTracker
+	// audit 审计记录
+	audit *auditLog
+	// users 用户级别的状态，按租户和用户ID存储，用户的最后一个token删除时释放
+	users map[userKey]*userState[T]
+	// journal 预写日志，未打开时为nil
+	journal *journal
+	// security 持久化文件的加密密钥，为nil时不加密
+	security *SecurityManager
+	// clock 时间来源，用于时间窗口等条件判断，可通过SetClock替换
+	clock func() time.Time
+	// onChange 状态变更回调，用于在多个实例之间同步，为nil时不通知
+	onChange func(c models.Change)
+	// onJournalError 预写日志自动压缩失败时的回调，为nil时不通知
+	onJournalError func(err error)
 }
 
 /**
- * InitTM 初始化Token管理器
+ * InitTM 初始化Token管理器，token保存在内存中
  * @param {*ConfigRaw} config 配置信息
  * @param {[]models.GroupRaw} groups 用户组配置
  * @returns {IManager[T]} Token管理器实例
  */
 func InitTM[T any](config models.ConfigRaw, groups []models.GroupRaw) (models.IManager[T], error) {
+	return InitTMWithStore(config, groups, NewMemoryTokenStore[T]())
+}
+
+/**
+ * InitTMWithStore 使用指定的token存储初始化Token管理器
+ * 存储中已有的token会被继续使用，统计信息和用户级别的状态据此重建
+ * @param {*ConfigRaw} config 配置信息
+ * @param {[]models.GroupRaw} groups 用户组配置
+ * @param {models.TokenStore[T]} store token存储
+ * @returns {IManager[T]} Token管理器实例
+ */
+func InitTMWithStore[T any](config models.ConfigRaw, groups []models.GroupRaw, store models.TokenStore[T]) (models.IManager[T], error) {
+	if store == nil {
+		return nil, errors.New(getErrorMessage(config.Language, "invalid_params"))
+	}
 	// 验证配置
 	if err := ValidateConfig(config); err != nil {
 		// 配置无效，返回nil
@@ -42,26 +88,68 @@ func InitTM[T any](config models.ConfigRaw, groups []models.GroupRaw) (models.IM
 		MaxTokens:      config.MaxTokens,
 		Delimiter:      config.Delimiter,
 		TokenRenewTime: parseTokenRenewTime(config.TokenRenewTime),
+		Location:       time.Local,
+
+		StrictPaths:          config.StrictPaths,
+		CaseInsensitivePaths: config.CaseInsensitivePaths,
+	}
+	if config.Timezone != "" {
+		loc, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Location = loc
 	}
 
 	// 创建管理器实例
 	tm := &Manager[T]{
-		tokens: make(map[string]*models.Token[T]),
-		groups: make(map[uint]*models.Group),
+		store:  store,
+		groups: map[string]map[uint]*models.Group{DEFAULT_TENANT: {}},
+		codec:  models.JSONCodec[T]{},
 		config: cfg,
 		stats:  models.Stats{LastUpdateTime: time.Now()},
+		clock:  time.Now,
+
+		groupRaws:       make(map[string]map[uint]models.GroupRaw),
+		tenantMaxTokens: make(map[string]int),
+		limiter:         newRateLimiter(),
+		quotas:          newQuotaTracker(),
+		audit:           newAuditLog(DEFAULT_AUDIT_CAPACITY),
+		users:           make(map[userKey]*userState[T]),
+	}
+
+	// 存储同时保存用户组时，先加载已保存的用户组，配置中ID相同的用户组会覆盖它们
+	if gs, ok := store.(models.GroupStore); ok {
+		saved, err := gs.Groups()
+		if err != nil {
+			return nil, tm.storeError(err)
+		}
+		for tenantID, raws := range saved {
+			for _, raw := range raws {
+				if err := tm.validateGroup(raw); err != nil {
+					return nil, err
+				}
+				tm.setGroupLocked(tenantID, raw)
+			}
+		}
+		tm.groupStore = gs
 	}
 
 	// 添加用户组（如果提供了groups）
 	if len(groups) > 0 {
 		for _, group := range groups {
-			if err := ValidateGroupRaw(group); err != nil {
-				// 用户组验证失败，返回错误
+			// AddGroup会验证用户组配置
+			if err := tm.AddGroup(&group); err != nil {
 				return nil, err
 			}
-			tm.AddGroup(&group)
 		}
 	}
+
+	tm.lock()
+	defer tm.unlock()
+	if err := tm.loadStoreLocked(); err != nil {
+		return nil, err
+	}
 	return tm, nil
 }
 
@@ -92,6 +180,24 @@ func parseTokenRenewTime(renewTime string) int64 {
 	}
 }
 
+/**
+ * SetClock 替换时间来源，便于测试时间窗口等与时间相关的条件
+ * @param {func() time.Time} clock 时间来源，为nil时恢复为time.Now
+ */
+func (tm *Manager[T]) SetClock(clock func() time.Time) {
+	if clock == nil {
+		clock = time.Now
+	}
+	tm.lock()
+	defer tm.unlock()
+	tm.clock = clock
+}
+
+// now 获取当前时间（已转换为配置的时区），调用方需持有锁
+func (tm *Manager[T]) now() time.Time {
+	return tm.clock().In(tm.config.Location)
+}
+
 // 锁操作方法
 func (tm *Manager[T]) lock() {
 	tm.mu.Lock()
@@ -120,24 +226,29 @@ func (tm *Manager[T]) SetUserData(key string, data T) error {
 	defer tm.unlock()
 
 	// 检查token是否存在
-	token, exists := tm.tokens[key]
-	if !exists {
+	token, err := tm.store.Get(key)
+	if err != nil {
+		return tm.storeError(err)
+	}
+	if token == nil {
 		return errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
 	}
 
 	// 检查token是否过期
 	if token.IsExpired() {
-		delete(tm.tokens, key)
+		tm.removeTokenLocked(key, token)
 		return errors.New(getErrorMessage(tm.config.Language, "token_expired"))
 	}
 
-	// 设置用户数据
-	token.UserData = data
+	// 设置用户数据，保存副本，调用方之后修改传入的数据不会影响管理器
+	updated := *token
+	updated.UserData = utility.DeepCopy(data)
+	updated.Version++
 
 	// 更新访问时间
-	token.LastAccessTime = time.Now()
+	updated.LastAccessTime = time.Now()
 
-	return nil
+	return tm.putTokenLocked(key, &updated)
 }
 
 // GetUserData 获取用户数据
@@ -147,8 +258,12 @@ func (tm *Manager[T]) GetUserData(key string) (T, error) {
 	var zeroValue T
 
 	// 检查token是否存在
-	token, exists := tm.tokens[key]
-	if !exists {
+	token, err := tm.store.Get(key)
+	if err != nil {
+		tm.rUnlock()
+		return zeroValue, tm.storeError(err)
+	}
+	if token == nil {
 		tm.rUnlock()
 		return zeroValue, errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
 	}
@@ -158,22 +273,64 @@ func (tm *Manager[T]) GetUserData(key string) (T, error) {
 		tm.rUnlock()
 		// 使用写锁删除过期token
 		tm.lock()
-		delete(tm.tokens, key)
+		tm.removeTokenLocked(key, nil)
 		tm.unlock()
 		return zeroValue, errors.New(getErrorMessage(tm.config.Language, "token_expired"))
 	}
 
-	// 获取用户数据
-	userData := token.UserData
+	// 获取用户数据的副本
+	userData := utility.DeepCopy(token.UserData)
 	tm.rUnlock()
 
 	// 使用写锁更新访问时间
 	tm.lock()
 	// 再次检查token是否仍然存在（避免竞态条件）
-	if token, exists := tm.tokens[key]; exists && !token.IsExpired() {
-		token.LastAccessTime = time.Now()
+	if token, _ := tm.store.Get(key); token != nil && !token.IsExpired() {
+		tm.touchTokenLocked(key, time.Now())
 	}
 	tm.unlock()
 
 	return userData, nil
 }
+
+/**
+ * UpdateUserData 在管理器锁内修改用户数据，避免先GetUserData再SetUserData时覆盖并发的修改
+ * mutator收到的是用户数据的副本，返回错误时副本被丢弃，用户数据保持不变
+ * mutator执行期间持有写锁，不能在其中调用管理器的其他方法
+ * @param {string} key token键
+ * @param {func(*T) error} mutator 修改函数
+ * @returns {error} 操作结果错误信息，mutator返回的错误原样返回
+ */
+func (tm *Manager[T]) UpdateUserData(key string, mutator func(data *T) error) error {
+	if key == "" {
+		return errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
+	}
+	if mutator == nil {
+		return errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+
+	tm.lock()
+	defer tm.unlock()
+
+	token, err := tm.store.Get(key)
+	if err != nil {
+		return tm.storeError(err)
+	}
+	if token == nil {
+		return errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
+	}
+	if token.IsExpired() {
+		tm.removeTokenLocked(key, token)
+		return errors.New(getErrorMessage(tm.config.Language, "token_expired"))
+	}
+
+	data := utility.DeepCopy(token.UserData)
+	if err := mutator(&data); err != nil {
+		return err
+	}
+	updated := *token
+	updated.UserData = data
+	updated.Version++
+	updated.LastAccessTime = time.Now()
+	return tm.putTokenLocked(key, &updated)
+}
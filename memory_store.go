@@ -0,0 +1,155 @@
+package wt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// tokenIndex token在二级索引中的位置，与token分开保存，调用方原地修改token时也能正确更新索引
+type tokenIndex struct {
+	tenant string
+	user   uint
+	group  uint
+}
+
+// indexKey 二级索引的键
+type indexKey struct {
+	tenant string
+	id     uint
+}
+
+// MemoryTokenStore 基于map的内存token存储，是管理器的默认存储，进程退出后数据丢失
+type MemoryTokenStore[T any] struct {
+	mu      sync.RWMutex
+	tokens  map[string]*models.Token[T]
+	index   map[string]tokenIndex
+	byUser  map[indexKey]map[string]struct{}
+	byGroup map[indexKey]map[string]struct{}
+}
+
+/**
+ * NewMemoryTokenStore 创建内存token存储
+ * @returns {*MemoryTokenStore[T]} 内存token存储
+ */
+func NewMemoryTokenStore[T any]() *MemoryTokenStore[T] {
+	return &MemoryTokenStore[T]{
+		tokens:  make(map[string]*models.Token[T]),
+		index:   make(map[string]tokenIndex),
+		byUser:  make(map[indexKey]map[string]struct{}),
+		byGroup: make(map[indexKey]map[string]struct{}),
+	}
+}
+
+// Get 获取token，返回的是存储内部的对象
+func (s *MemoryTokenStore[T]) Get(key string) (*models.Token[T], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokens[key], nil
+}
+
+// Put 保存token，保存的是传入的对象本身
+func (s *MemoryTokenStore[T]) Put(key string, t *models.Token[T]) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unindex(key)
+	s.tokens[key] = t
+	idx := tokenIndex{t.TenantID, t.UserID, t.GroupID}
+	s.index[key] = idx
+	addIndex(s.byUser, indexKey{idx.tenant, idx.user}, key)
+	addIndex(s.byGroup, indexKey{idx.tenant, idx.group}, key)
+	return nil
+}
+
+// Delete 删除token
+func (s *MemoryTokenStore[T]) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unindex(key)
+	delete(s.tokens, key)
+	return nil
+}
+
+// Touch 更新最后访问时间
+func (s *MemoryTokenStore[T]) Touch(key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t := s.tokens[key]; t != nil {
+		t.LastAccessTime = at
+	}
+	return nil
+}
+
+// Range 遍历所有token
+func (s *MemoryTokenStore[T]) Range(fn func(key string, t *models.Token[T]) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, t := range s.tokens {
+		if !fn(key, t) {
+			break
+		}
+	}
+	return nil
+}
+
+// KeysByUser 获取租户内指定用户的所有token键
+func (s *MemoryTokenStore[T]) KeysByUser(tenantID string, userID uint) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return indexKeys(s.byUser[indexKey{tenantID, userID}]), nil
+}
+
+// KeysByGroup 获取租户内指定用户组的所有token键
+func (s *MemoryTokenStore[T]) KeysByGroup(tenantID string, groupID uint) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return indexKeys(s.byGroup[indexKey{tenantID, groupID}]), nil
+}
+
+// Len 获取token数量
+func (s *MemoryTokenStore[T]) Len() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tokens), nil
+}
+
+// unindex 从二级索引中移除token（调用方需持有s.mu）
+func (s *MemoryTokenStore[T]) unindex(key string) {
+	idx, ok := s.index[key]
+	if !ok {
+		return
+	}
+	delete(s.index, key)
+	removeIndex(s.byUser, indexKey{idx.tenant, idx.user}, key)
+	removeIndex(s.byGroup, indexKey{idx.tenant, idx.group}, key)
+}
+
+// addIndex 向二级索引中加入token键
+func addIndex(m map[indexKey]map[string]struct{}, k indexKey, key string) {
+	set := m[k]
+	if set == nil {
+		set = make(map[string]struct{})
+		m[k] = set
+	}
+	set[key] = struct{}{}
+}
+
+// removeIndex 从二级索引中移除token键，集合为空时一并删除
+func removeIndex(m map[indexKey]map[string]struct{}, k indexKey, key string) {
+	if set := m[k]; set != nil {
+		delete(set, key)
+		if len(set) == 0 {
+			delete(m, k)
+		}
+	}
+}
+
+// indexKeys 把索引集合转换为切片
+func indexKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 审计事件类型
+const (
+	// AuditElevate 临时提权
+	AuditElevate = "elevate"
+	// AuditElevationRevoked 提权被提前撤销
+	AuditElevationRevoked = "elevation_revoked"
+	// AuditElevationExpired 提权到期自动恢复
+	AuditElevationExpired = "elevation_expired"
+)
+
+// AuditEvent 审计事件
+type AuditEvent struct {
+	// 事件序号，从1开始递增
+	Seq uint64 `json:"seq"`
+	// 发生时间
+	Time time.Time `json:"time"`
+	// 事件类型
+	Action string `json:"action"`
+	// 租户ID
+	TenantID string `json:"tenantId,omitempty"`
+	// 用户ID
+	UserID uint `json:"userId"`
+	// token指纹，不记录token原文
+	TokenID string `json:"tokenId"`
+	// token原本所属的用户组ID
+	GroupID uint `json:"groupId"`
+	// 提权的目标用户组ID
+	TargetGroupID uint `json:"targetGroupId,omitempty"`
+	// 原因
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuditSink 审计事件的输出接口，如写入日志或数据库
+// Record在事件发生后同步调用（不持有管理器的锁），实现应尽量快速
+type AuditSink interface {
+	Record(e AuditEvent)
+}
@@ -0,0 +1,107 @@
+package models
+
+// AuthVerdict 自定义鉴权器的判定结果
+type AuthVerdict int
+
+const (
+	// VerdictAbstain 不表态，继续执行后续检查
+	VerdictAbstain AuthVerdict = iota
+	// VerdictAllow 放行，跳过同阶段剩余的鉴权器以及之后的所有检查
+	VerdictAllow
+	// VerdictDeny 拒绝，立即结束鉴权
+	VerdictDeny
+)
+
+// String 返回判定结果的名称
+func (v AuthVerdict) String() string {
+	switch v {
+	case VerdictAllow:
+		return "allow"
+	case VerdictDeny:
+		return "deny"
+	default:
+		return "abstain"
+	}
+}
+
+// AuthStage 自定义鉴权器的执行阶段
+type AuthStage int
+
+const (
+	// AuthStagePreRule 在Token、IP和用户组检查通过后、API规则匹配之前执行
+	AuthStagePreRule AuthStage = iota
+	// AuthStagePostRule 在API规则及其附加条件都允许访问之后执行
+	AuthStagePostRule
+)
+
+// String 返回执行阶段的名称
+func (s AuthStage) String() string {
+	if s == AuthStagePostRule {
+		return "post_rule"
+	}
+	return "pre_rule"
+}
+
+// AuthContext 传给自定义鉴权器的请求上下文
+type AuthContext[T any] struct {
+	// token字符串
+	Key string
+	// token信息副本，修改它不会影响管理器中的token
+	Token Token[T]
+	// 用户数据，与Token.UserData相同
+	UserData T
+	// token所属租户ID
+	TenantID string
+	// token所属用户组，只读
+	Group *Group
+	// 请求的API地址
+	API string
+	// 解析后的请求路径段
+	PathSegments []string
+	// 请求方法，如"GET"，调用Auth时为空
+	Method string
+	// 客户端IP地址
+	IP string
+	// 最终生效的规则，只在AuthStagePostRule阶段设置
+	Rule *ApiRule
+}
+
+// Authorizer 自定义鉴权器，用于在内置鉴权流程中插入功能开关、资源级ACL、租户权益等检查
+// 鉴权器在不持有管理器锁的情况下执行，可以安全地调用管理器的其他方法；
+// Explain同样会调用鉴权器，鉴权器不能有副作用
+type Authorizer[T any] interface {
+	// 鉴权器名称，用于Explain输出
+	Name() string
+	// 执行检查；返回非nil错误时视为拒绝，Auth原样返回该错误
+	Authorize(ctx *AuthContext[T]) (AuthVerdict, error)
+}
+
+// AuthorizerFunc 使用函数实现Authorizer
+type AuthorizerFunc[T any] struct {
+	// 鉴权器名称
+	ID string
+	// 检查函数
+	Fn func(ctx *AuthContext[T]) (AuthVerdict, error)
+}
+
+// Name 实现Authorizer接口
+func (f AuthorizerFunc[T]) Name() string {
+	return f.ID
+}
+
+// Authorize 实现Authorizer接口
+func (f AuthorizerFunc[T]) Authorize(ctx *AuthContext[T]) (AuthVerdict, error) {
+	return f.Fn(ctx)
+}
+
+// AuthorizerResult 自定义鉴权器在一次鉴权中的执行结果
+type AuthorizerResult struct {
+	// 鉴权器名称
+	Name string `json:"name"`
+	// 执行阶段："pre_rule"或"post_rule"
+	Stage string `json:"stage"`
+	// 判定结果："abstain"、"allow"或"deny"
+	Verdict string `json:"verdict"`
+	// 鉴权器返回的错误信息
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// ChangeOp 管理器状态变更的类型
+type ChangeOp string
+
+const (
+	// ChangeRevoke token被删除（注销、撤销、踢下线等），过期token被清理时不产生变更
+	ChangeRevoke ChangeOp = "revoke"
+	// ChangeSetGroup 用户组被新增或替换
+	ChangeSetGroup ChangeOp = "group"
+	// ChangeDelGroup 用户组被删除（其下token的删除作为单独的ChangeRevoke）
+	ChangeDelGroup ChangeOp = "ungroup"
+)
+
+// Change 需要在多个管理器实例之间同步的状态变更
+type Change struct {
+	// 变更类型
+	Op ChangeOp `json:"op"`
+	// 租户ID
+	TenantID string `json:"tenant,omitempty"`
+	// 被删除的token键（ChangeRevoke）
+	Key string `json:"key,omitempty"`
+	// 被删除的token原本的过期时间，零值表示永不过期（ChangeRevoke）
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	// 新的用户组配置（ChangeSetGroup）
+	Group *GroupRaw `json:"group,omitempty"`
+	// 被删除的用户组ID（ChangeDelGroup）
+	GroupID uint `json:"groupId,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "encoding/json"
+
+// Codec 用户数据的编解码接口，持久化token时用于序列化UserData
+type Codec[T any] interface {
+	// 编码用户数据
+	Marshal(v T) ([]byte, error)
+	// 解码用户数据
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec 使用encoding/json的编解码器，是默认的编解码器
+type JSONCodec[T any] struct{}
+
+// Marshal 编码用户数据
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal 解码用户数据
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
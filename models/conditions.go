@@ -0,0 +1,292 @@
+package models
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// weekdayNames 星期名称到time.Weekday的映射
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// TimeWindow 访问时间窗口条件
+// 各字段为空时表示该维度不限制；结束时间早于开始时间表示跨越午夜（如"22:00"到"06:00"）
+type TimeWindow struct {
+	// 允许的星期，如["mon","tue"]，为空表示每天
+	Weekdays []string `json:"weekdays,omitempty" yaml:"weekdays,omitempty"`
+	// 每日开始时间（含），格式"15:04"
+	Start string `json:"start,omitempty" yaml:"start,omitempty"`
+	// 每日结束时间（不含），格式"15:04"，可以为"24:00"
+	End string `json:"end,omitempty" yaml:"end,omitempty"`
+	// 开始日期（含），格式"2006-01-02"
+	StartDate string `json:"startDate,omitempty" yaml:"startDate,omitempty"`
+	// 结束日期（含），格式"2006-01-02"
+	EndDate string `json:"endDate,omitempty" yaml:"endDate,omitempty"`
+	// IANA时区，如"Asia/Shanghai"，为空时使用管理器配置的时区
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+
+	// 以下为Compile后的结果
+	compiled bool
+	invalid  bool
+	loc      *time.Location
+	days     uint8
+	startMin int
+	endMin   int
+	fromDate string
+	toDate   string
+}
+
+// RuleCondition 单条API规则的附加条件，只在该规则为最终生效的允许规则时检查
+type RuleCondition struct {
+	// 规则生效的时间窗口，配置多个时满足任意一个即可
+	TimeWindows []TimeWindow `json:"timeWindows,omitempty" yaml:"timeWindows,omitempty"`
+	// 允许访问该规则的网段（CIDR或单个IP），为空表示不限制
+	AllowCIDRs []string `json:"allowCidrs,omitempty" yaml:"allowCidrs,omitempty"`
+	// 禁止访问该规则的网段（CIDR或单个IP），优先于AllowCIDRs
+	DenyCIDRs []string `json:"denyCidrs,omitempty" yaml:"denyCidrs,omitempty"`
+	// 该规则的限流，为nil表示不限制
+	RateLimit *RateLimit `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+	// 由AllowCIDRs和DenyCIDRs编译而成的网络限制
+	Network *NetworkPolicy `json:"-" yaml:"-"`
+}
+
+// NetworkPolicy IP网络访问限制，命中Deny时拒绝；Allow不为空时必须命中Allow
+type NetworkPolicy struct {
+	// 允许的网段
+	Allow []netip.Prefix `json:"allow,omitempty" yaml:"allow,omitempty"`
+	// 禁止的网段
+	Deny []netip.Prefix `json:"deny,omitempty" yaml:"deny,omitempty"`
+}
+
+/**
+ * ParseNetworkPolicy 解析网段列表为网络限制
+ * @param {[]string} allow 允许的网段（CIDR或单个IP）
+ * @param {[]string} deny 禁止的网段（CIDR或单个IP）
+ * @returns {*NetworkPolicy, error} 网络限制和错误，两个列表都为空时返回nil
+ */
+func ParseNetworkPolicy(allow, deny []string) (*NetworkPolicy, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	p := &NetworkPolicy{}
+	var err error
+	if p.Allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if p.Deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+/**
+ * Permits 判断IP地址是否满足网络限制
+ * @param {string} ip IP地址字符串
+ * @returns {bool} 是否允许，无法解析的地址一律拒绝
+ */
+func (p *NetworkPolicy) Permits(ip string) bool {
+	if p == nil {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range p.Deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, prefix := range p.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * parsePrefixes 解析网段列表，单个IP按主机网段处理
+ * @param {[]string} items 网段字符串列表
+ * @returns {[]netip.Prefix, error} 网段列表和错误
+ */
+func parsePrefixes(items []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, errors.New("网段格式错误: " + item)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, errors.New("IP地址格式错误: " + item)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+/**
+ * Compile 校验并预处理时间窗口配置
+ * 校验失败的窗口在Contains中永远返回false（失败即拒绝）
+ * @returns {error} 配置错误
+ */
+func (w *TimeWindow) Compile() error {
+	w.compiled = true
+	w.invalid = true
+	w.days = 0
+	for _, name := range w.Weekdays {
+		day, ok := weekdayNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return errors.New("无法识别的星期: " + name)
+		}
+		w.days |= 1 << uint(day)
+	}
+
+	w.startMin, w.endMin = 0, 24*60
+	if w.Start != "" {
+		m, err := parseClock(w.Start)
+		if err != nil {
+			return err
+		}
+		w.startMin = m
+	}
+	if w.End != "" {
+		m, err := parseClock(w.End)
+		if err != nil {
+			return err
+		}
+		w.endMin = m
+	}
+	if w.startMin == w.endMin {
+		return errors.New("时间窗口的开始时间与结束时间不能相同")
+	}
+
+	for _, d := range []string{w.StartDate, w.EndDate} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, d); err != nil {
+			return errors.New("日期格式错误，应为YYYY-MM-DD: " + d)
+		}
+	}
+	if w.StartDate != "" && w.EndDate != "" && w.StartDate > w.EndDate {
+		return errors.New("时间窗口的开始日期晚于结束日期")
+	}
+	w.fromDate, w.toDate = w.StartDate, w.EndDate
+
+	w.loc = nil
+	if w.Timezone != "" {
+		loc, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return errors.New("无法识别的时区: " + w.Timezone)
+		}
+		w.loc = loc
+	}
+
+	w.invalid = false
+	return nil
+}
+
+/**
+ * Contains 判断时间点是否落在时间窗口内
+ * 窗口未指定时区时，直接使用t自身的时区
+ * @param {time.Time} t 时间点
+ * @returns {bool} 是否在窗口内
+ */
+func (w *TimeWindow) Contains(t time.Time) bool {
+	if !w.compiled {
+		// 未编译的窗口在副本上编译，避免并发读取时修改共享状态
+		c := *w
+		c.Compile()
+		return c.Contains(t)
+	}
+	if w.invalid {
+		return false
+	}
+	if w.loc != nil {
+		t = t.In(w.loc)
+	}
+
+	// 跨越午夜的窗口，午夜之后的部分归属于前一天
+	day := t
+	minute := t.Hour()*60 + t.Minute()
+	if w.startMin < w.endMin {
+		if minute < w.startMin || minute >= w.endMin {
+			return false
+		}
+	} else {
+		switch {
+		case minute >= w.startMin:
+		case minute < w.endMin:
+			day = t.AddDate(0, 0, -1)
+		default:
+			return false
+		}
+	}
+
+	if w.days != 0 && w.days&(1<<uint(day.Weekday())) == 0 {
+		return false
+	}
+	date := day.Format(time.DateOnly)
+	if w.fromDate != "" && date < w.fromDate {
+		return false
+	}
+	if w.toDate != "" && date > w.toDate {
+		return false
+	}
+	return true
+}
+
+/**
+ * InTimeWindows 判断时间点是否落在任意一个时间窗口内，窗口为空表示不限制
+ * @param {[]TimeWindow} windows 时间窗口列表
+ * @param {time.Time} t 时间点
+ * @returns {bool} 是否允许
+ */
+func InTimeWindows(windows []TimeWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for i := range windows {
+		if windows[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * parseClock 解析"15:04"格式的时刻为当日分钟数，支持"24:00"
+ * @param {string} s 时刻字符串
+ * @returns {int, error} 分钟数和错误
+ */
+func parseClock(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	c, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.New("时刻格式错误，应为HH:MM: " + s)
+	}
+	return c.Hour()*60 + c.Minute(), nil
+}
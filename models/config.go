@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Config 定义了Token管理器的配置
 type Config struct {
 	// Language：错误信息语言类型，"zh"为中文，其他为英文
@@ -10,6 +12,12 @@ type Config struct {
 	Delimiter string
 	// TokenRenewTime：Token续期时间，单位秒，默认10分钟
 	TokenRenewTime int64
+	// Location：时间窗口条件默认使用的时区
+	Location *time.Location
+	// StrictPaths：是否对请求路径进行严格规范化
+	StrictPaths bool
+	// CaseInsensitivePaths：严格模式下是否忽略路径大小写
+	CaseInsensitivePaths bool
 }
 
 type ConfigRaw struct {
@@ -21,4 +29,10 @@ type ConfigRaw struct {
 	MaxTokens int `json:"maxTokens"`
 	// TokenRenewTime：Token续期时间，单位秒，默认10分钟
 	TokenRenewTime string `json:"tokenRenewTime"`
+	// Timezone：时间窗口条件默认使用的IANA时区，如"Asia/Shanghai"，为空时使用本地时区
+	Timezone string `json:"timezone"`
+	// StrictPaths：严格路径模式，鉴权前消解"."和".."段，并拒绝编码斜杠、重复编码、分号参数等有歧义的路径
+	StrictPaths bool `json:"strictPaths"`
+	// CaseInsensitivePaths：忽略路径大小写，规则和请求路径都转换为小写后匹配，需要同时开启StrictPaths
+	CaseInsensitivePaths bool `json:"caseInsensitivePaths"`
 }
\ No newline at end of file
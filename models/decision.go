@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// CheckResult 鉴权流程中单项检查的结果
+type CheckResult struct {
+	// 是否通过检查
+	Passed bool `json:"passed"`
+	// 未通过时的错误键值
+	ErrorKey string `json:"errorKey,omitempty"`
+}
+
+// ConditionResult 附加条件的检查结果
+type ConditionResult struct {
+	// 条件所属范围："group"表示用户组条件，"rule"表示生效规则上的条件
+	Scope string `json:"scope"`
+	// 条件类型，如"time_window"
+	Kind string `json:"kind"`
+	// 是否满足条件
+	Passed bool `json:"passed"`
+	// 未满足时的错误键值
+	ErrorKey string `json:"errorKey,omitempty"`
+}
+
+// RuleMatch 候选规则的匹配情况
+type RuleMatch struct {
+	// 规则在用户组规则列表中的下标
+	Index int `json:"index"`
+	// 规则本身
+	Rule ApiRule `json:"rule"`
+	// 从左向右连续匹配的路径段数
+	MatchLength int `json:"matchLength"`
+	// 规则路径是否为请求路径的完整前缀
+	Matched bool `json:"matched"`
+}
+
+// AuthDecision 鉴权决策详情，描述Auth每一步的判断依据
+type AuthDecision struct {
+	// 请求的API地址
+	API string `json:"api"`
+	// 请求方法，未指定时为空
+	Method string `json:"method,omitempty"`
+	// 解析后的请求路径段
+	PathSegments []string `json:"pathSegments"`
+	// 未配置任何用户组时鉴权被禁用，直接放行
+	AuthDisabled bool `json:"authDisabled"`
+	// Token检查结果（存在性与有效期）
+	TokenCheck CheckResult `json:"tokenCheck"`
+	// 客户端绑定检查结果（IP是否与Token一致）
+	BindingCheck CheckResult `json:"bindingCheck"`
+	// Token所属租户ID
+	TenantID string `json:"tenantId,omitempty"`
+	// 使用的用户组ID，临时提权期间为提权的目标用户组
+	GroupID uint `json:"groupId"`
+	// 临时提权期间token原本所属的用户组ID，未提权时为0
+	ElevatedFrom uint `json:"elevatedFrom,omitempty"`
+	// 使用的用户组名称
+	GroupName string `json:"groupName"`
+	// 用户组是否存在
+	GroupFound bool `json:"groupFound"`
+	// 附加条件的检查结果，按检查顺序排列
+	Conditions []ConditionResult `json:"conditions,omitempty"`
+	// 参与匹配的候选规则
+	Candidates []RuleMatch `json:"candidates"`
+	// 最终生效的规则，为nil表示没有任何规则匹配
+	Winner *RuleMatch `json:"winner,omitempty"`
+	// 自定义鉴权器的执行结果，按执行顺序排列
+	Authorizers []AuthorizerResult `json:"authorizers,omitempty"`
+	// 被限流时建议的重试等待时间
+	RetryAfter time.Duration `json:"retryAfter,omitempty"`
+	// 最终结果：true表示允许访问
+	Allowed bool `json:"allowed"`
+	// 拒绝时的错误键值
+	ErrorKey string `json:"errorKey,omitempty"`
+	// 拒绝时的错误信息（与Auth返回的错误一致）
+	Reason string `json:"reason,omitempty"`
+}
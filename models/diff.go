@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PolicyDiff 两套用户组配置之间的差异
+type PolicyDiff struct {
+	// 新增的用户组
+	Added []GroupDiff `json:"added,omitempty"`
+	// 删除的用户组
+	Removed []GroupDiff `json:"removed,omitempty"`
+	// 发生变化的用户组
+	Changed []GroupDiff `json:"changed,omitempty"`
+}
+
+// GroupDiff 单个用户组的差异
+type GroupDiff struct {
+	// 组ID
+	ID uint `json:"id"`
+	// 组名称（删除的用户组为旧名称，其他为新名称）
+	Name string `json:"name"`
+	// 配置项的变化
+	Fields []FieldChange `json:"fields,omitempty"`
+	// 访问结果发生变化的样例路径
+	Access []AccessChange `json:"access,omitempty"`
+}
+
+// FieldChange 配置项的变化
+type FieldChange struct {
+	// 配置项名称，如"tokenExpire"
+	Field string `json:"field"`
+	// 旧值
+	Old string `json:"old"`
+	// 新值
+	New string `json:"new"`
+}
+
+// AccessChange 样例路径访问结果的变化
+type AccessChange struct {
+	// 样例路径
+	Path string `json:"path"`
+	// 变更前是否允许
+	Old bool `json:"old"`
+	// 变更后是否允许
+	New bool `json:"new"`
+}
+
+// Empty 判断是否没有任何差异
+func (d *PolicyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String 输出便于人工审阅的文本格式
+func (d *PolicyDiff) String() string {
+	if d.Empty() {
+		return "no changes\n"
+	}
+	var b strings.Builder
+	for _, section := range []struct {
+		mark  string
+		diffs []GroupDiff
+	}{{"+", d.Added}, {"-", d.Removed}, {"~", d.Changed}} {
+		for _, g := range section.diffs {
+			fmt.Fprintf(&b, "%s group %d (%s)\n", section.mark, g.ID, g.Name)
+			for _, f := range g.Fields {
+				fmt.Fprintf(&b, "    %s: %q -> %q\n", f.Field, f.Old, f.New)
+			}
+			for _, a := range g.Access {
+				fmt.Fprintf(&b, "    access %s: %s -> %s\n", a.Path, accessWord(a.Old), accessWord(a.New))
+			}
+		}
+	}
+	return b.String()
+}
+
+// accessWord 访问结果的文字表示
+func accessWord(allowed bool) string {
+	if allowed {
+		return "allow"
+	}
+	return "deny"
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Elevation 临时提权记录，有效期内Auth使用目标用户组鉴权
+type Elevation struct {
+	// 提权ID，即token指纹，用于查询和撤销
+	ID string `json:"id"`
+	// 租户ID
+	TenantID string `json:"tenantId,omitempty"`
+	// 用户ID
+	UserID uint `json:"userId"`
+	// token原本所属的用户组ID
+	OriginalGroupID uint `json:"originalGroupId"`
+	// 提权的目标用户组ID
+	GroupID uint `json:"groupId"`
+	// 提权原因
+	Reason string `json:"reason"`
+	// 开始时间
+	StartedAt time.Time `json:"startedAt"`
+	// 到期时间，到期后自动恢复为原用户组
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Active 判断提权在指定时间是否仍然有效
+func (e *Elevation) Active(now time.Time) bool {
+	return e != nil && now.Before(e.ExpiresAt)
+}
@@ -6,6 +6,8 @@ type ApiRule struct {
 	Path []string `json:"path"`
 	// 规则：true表示允许，false表示禁止
 	Rule bool `json:"rule"`
+	// 附加条件，为nil表示无条件
+	Conditions *RuleCondition `json:"conditions,omitempty"`
 }
 // Group 用户组配置
 type Group struct {
@@ -17,6 +19,16 @@ type Group struct {
 	ExpireSeconds int64 `json:"tokenExpireSeconds"`
 	// 允许多设备登录。为true时允许同一用户在多个设备上登录，不校验IP；为false时只允许在一个设备上登录，会校验IP
 	AllowMultipleLogin bool `json:"allowMultipleLogin"`
+	// 访问时间窗口，为空表示不限制；配置多个时满足任意一个即可
+	TimeWindows []TimeWindow `json:"timeWindows,omitempty"`
+	// 客户端网络限制，为nil表示不限制
+	Network *NetworkPolicy `json:"network,omitempty"`
+	// 用户组级别的限流，为nil表示不限制
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// 用量配额，按用户计数
+	Quotas []Quota `json:"quotas,omitempty"`
+	// 由ApiRules编译而成的前缀树，修改ApiRules后需要重新编译
+	Trie *RuleTrie `json:"-"`
 }
 
 // 用户组原型
@@ -33,4 +45,16 @@ type GroupRaw struct {
 	TokenExpire string `json:"tokenExpire"`
 	// 允许多设备登录。为1时允许同一用户在多个设备上登录，不校验IP；为false时只允许在一个设备上登录，会校验IP
 	AllowMultipleLogin int `json:"allowMultipleLogin"`
+	// 访问时间窗口，为空表示不限制；配置多个时满足任意一个即可
+	TimeWindows []TimeWindow `json:"timeWindows,omitempty"`
+	// 允许使用该用户组的网段（CIDR或单个IP），为空表示不限制
+	AllowCIDRs []string `json:"allowCidrs,omitempty"`
+	// 禁止使用该用户组的网段（CIDR或单个IP），优先于AllowCIDRs
+	DenyCIDRs []string `json:"denyCidrs,omitempty"`
+	// 用户组级别的限流，对该组的所有请求生效，为nil表示不限制
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+	// 用量配额，按用户计数，同一用户的所有token共享；一次请求命中的所有配额都会被消耗
+	Quotas []Quota `json:"quotas,omitempty"`
+	// 单条API规则的附加条件，键为AllowedAPIs或DeniedAPIs中出现的路径
+	RuleConditions map[string]RuleCondition `json:"ruleConditions,omitempty"`
 }
@@ -0,0 +1,29 @@
+package models
+
+// LintSeverity 检查结果的严重程度
+type LintSeverity string
+
+const (
+	// LintError 错误：策略的行为与书写意图明显不符，或者无法生效
+	LintError LintSeverity = "error"
+	// LintWarning 警告：存在冗余或容易误解的规则
+	LintWarning LintSeverity = "warning"
+	// LintInfo 提示：行为正确但值得确认
+	LintInfo LintSeverity = "info"
+)
+
+// LintFinding 策略检查发现的一个问题
+type LintFinding struct {
+	// 稳定的问题编码，如"WT001"
+	Code string `json:"code"`
+	// 严重程度
+	Severity LintSeverity `json:"severity"`
+	// 用户组ID
+	GroupID uint `json:"groupId"`
+	// 用户组名称
+	GroupName string `json:"groupName"`
+	// 相关的规则路径，用户组级别的问题为空
+	Rule string `json:"rule,omitempty"`
+	// 问题说明
+	Message string `json:"message"`
+}
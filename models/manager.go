@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // IManager token管理器接口
 type IManager[T any] interface {
 	// token管理
@@ -10,6 +12,7 @@ type IManager[T any] interface {
 	DelTokensByUserID(userID uint) error
 	DelTokensByGroupID(groupID uint) error
 	UpdateToken(key string, token *Token[T]) error
+	PatchToken(key string, expectedVersion uint64, patch TokenPatch[T]) (*Token[T], error)
 	CleanExpiredTokens()
 
 	// 批量操作
@@ -22,6 +25,10 @@ type IManager[T any] interface {
 	// 身份验证
 	Auth(key string, clientIp string, api string) error
 	BatchAuth(key string, clientIp string, apis []string) []bool
+	Explain(key string, clientIp string, api string) *AuthDecision
+	AuthWithMethod(key string, clientIp string, method string, api string) error
+	ExplainWithMethod(key string, clientIp string, method string, api string) *AuthDecision
+	UseAuthorizer(stage AuthStage, a Authorizer[T]) error
 
 	// 用户组管理
 	GetGroup(groupID uint) (*Group, error)
@@ -33,7 +40,77 @@ type IManager[T any] interface {
 	// 统计信息
 	GetStats() Stats
 
+	// 用量配额
+	SetQuotaStore(store QuotaStore) error
+	GetQuotaUsage(groupID uint, userID uint) ([]QuotaUsage, error)
+	ResetQuota(userID uint, name string) error
+
+	// 临时提权
+	Elevate(key string, targetGroupID uint, duration time.Duration, reason string) (*Elevation, error)
+	RevokeElevation(id string, reason string) error
+	ListElevations() []Elevation
+	RevertExpiredElevations() int
+	StartElevationSweeper(interval time.Duration) func()
+
+	// 审计
+	SetAuditSink(sink AuditSink)
+	AuditEvents() []AuditEvent
+
 	// 用户数据管理
 	SetUserData(key string, data T) error
 	GetUserData(key string) (T, error)
+	UpdateUserData(key string, mutator func(data *T) error) error
+
+	// 用户级别的共享数据，同一用户的所有token共享，最后一个token删除时释放
+	GetSharedData(userID uint) (T, error)
+	UpdateSharedData(userID uint, mutator func(data *T) error) error
+
+	// 持久化
+	SetCodec(codec Codec[T])
+	SaveSnapshot(path string) error
+	LoadSnapshot(path string) error
+	StartAutosave(path string, interval time.Duration, onError func(err error)) func()
+	OpenJournal(dir string, compactSize int64) error
+	Compact() error
+	CloseJournal() error
+	RotateEncryptionKey(newPassword string) <-chan error
+
+	// 多租户
+	Tenant(tenantID string) ITenantManager[T]
+}
+
+// ITenantManager 单个租户范围内的管理接口，用户组和token只在该租户内可见
+// 按token键操作的方法（Auth、GetToken、DelToken等）不区分租户，直接使用IManager上的方法
+type ITenantManager[T any] interface {
+	// 租户ID
+	ID() string
+	// 租户内最大token数量，0表示不单独限制；写入预写日志失败时返回错误
+	SetMaxTokens(max int) error
+
+	// token管理
+	AddToken(userID uint, groupID uint, clientIp string) (string, error)
+	DelTokensByUserID(userID uint) error
+	DelTokensByGroupID(groupID uint) error
+	BatchDeleteTokensByUserIDs(userIDs []uint) error
+	BatchDeleteTokensByGroupIDs(groupIDs []uint) error
+	GetTokensByUserID(userID uint) []*Token[T]
+	GetTokensByGroupID(groupID uint) []*Token[T]
+
+	// 用户组管理
+	GetGroup(groupID uint) (*Group, error)
+	AddGroup(group *GroupRaw) error
+	DelGroup(groupID uint) error
+	UpdateGroup(groupID uint, group *GroupRaw) error
+	UpdateAllGroup(groups []GroupRaw) error
+
+	// 用量配额
+	GetQuotaUsage(groupID uint, userID uint) ([]QuotaUsage, error)
+	ResetQuota(userID uint, name string) error
+
+	// 用户级别的共享数据
+	GetSharedData(userID uint) (T, error)
+	UpdateSharedData(userID uint, mutator func(data *T) error) error
+
+	// 统计信息
+	GetStats() Stats
 }
\ No newline at end of file
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PolicySchemaVersion 当前支持的策略文件格式版本
+const PolicySchemaVersion = 1
+
+// Policy 声明式策略文件，可以用JSON或YAML编写并纳入版本管理
+type Policy struct {
+	// 策略文件格式版本
+	SchemaVersion int `json:"schemaVersion" yaml:"schemaVersion"`
+	// 元数据，如负责人、说明、变更单号等
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// 过期设置
+	Expiry PolicyExpiry `json:"expiry,omitempty" yaml:"expiry,omitempty"`
+	// 用户组列表
+	Groups []PolicyGroup `json:"groups" yaml:"groups"`
+}
+
+// PolicyExpiry 策略文件中的过期设置
+type PolicyExpiry struct {
+	// 用户组未设置tokenExpire时使用的默认Token过期时间，如"2h"
+	DefaultTokenExpire string `json:"defaultTokenExpire,omitempty" yaml:"defaultTokenExpire,omitempty"`
+}
+
+// PolicyGroup 策略文件中的用户组，API规则以数组形式书写
+type PolicyGroup struct {
+	// 组ID
+	ID uint `json:"id" yaml:"id"`
+	// 组名称
+	Name string `json:"name" yaml:"name"`
+	// 允许访问的API列表
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	// 禁止访问的API列表
+	Deny []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+	// Token过期时间，为空时使用expiry.defaultTokenExpire
+	TokenExpire string `json:"tokenExpire,omitempty" yaml:"tokenExpire,omitempty"`
+	// 是否允许多设备登录
+	AllowMultipleLogin bool `json:"allowMultipleLogin,omitempty" yaml:"allowMultipleLogin,omitempty"`
+	// 访问时间窗口
+	TimeWindows []TimeWindow `json:"timeWindows,omitempty" yaml:"timeWindows,omitempty"`
+	// 允许使用该用户组的网段
+	AllowCIDRs []string `json:"allowCidrs,omitempty" yaml:"allowCidrs,omitempty"`
+	// 禁止使用该用户组的网段
+	DenyCIDRs []string `json:"denyCidrs,omitempty" yaml:"denyCidrs,omitempty"`
+	// 用户组级别的限流
+	RateLimit *RateLimit `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+	// 用量配额
+	Quotas []Quota `json:"quotas,omitempty" yaml:"quotas,omitempty"`
+	// 单条API规则的附加条件，键为allow或deny中出现的路径
+	RuleConditions map[string]RuleCondition `json:"ruleConditions,omitempty" yaml:"ruleConditions,omitempty"`
+}
+
+// PolicyError 策略文件中的一处错误，带有行号和字段位置
+type PolicyError struct {
+	// 行号，从1开始，0表示无法定位
+	Line int `json:"line"`
+	// 字段路径，如"groups[1].allow[0]"
+	Field string `json:"field"`
+	// 错误说明
+	Message string `json:"message"`
+}
+
+// Error 实现error接口
+func (e *PolicyError) Error() string {
+	var b strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Field != "" {
+		b.WriteString(e.Field)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// PolicyErrors 策略文件校验发现的全部错误
+type PolicyErrors []*PolicyError
+
+// Error 实现error接口，每行一个错误
+func (es PolicyErrors) Error() string {
+	lines := make([]string, len(es))
+	for i, e := range es {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
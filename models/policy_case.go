@@ -0,0 +1,35 @@
+package models
+
+// PolicyTestSuite 策略测试用例文件，与策略文件放在一起，在CI中校验
+type PolicyTestSuite struct {
+	// 文件格式版本，与策略文件相同
+	SchemaVersion int `json:"schemaVersion" yaml:"schemaVersion"`
+	// 测试用例
+	Cases []PolicyTestCase `json:"cases" yaml:"cases"`
+}
+
+// PolicyTestCase 一条访问预期，如"用户组2 GET /api/admin/users → deny"
+type PolicyTestCase struct {
+	// 用例名称，为空时使用"group 方法 路径"
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// 用户组ID
+	Group uint `json:"group" yaml:"group"`
+	// HTTP方法，仅用于描述，当前的规则匹配与方法无关
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// 请求路径
+	Path string `json:"path" yaml:"path"`
+	// 预期结果："allow"或"deny"
+	Expect string `json:"expect" yaml:"expect"`
+}
+
+// PolicyTestResult 单条用例的执行结果
+type PolicyTestResult struct {
+	// 用例
+	Case PolicyTestCase `json:"case"`
+	// 是否通过
+	Passed bool `json:"passed"`
+	// 实际结果："allow"或"deny"
+	Actual string `json:"actual"`
+	// 决策详情，只在用例失败时提供；用例不涉及Token，TokenCheck与BindingCheck不使用
+	Detail *AuthDecision `json:"detail,omitempty"`
+}
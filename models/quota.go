@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// 配额周期，按管理器配置的时区计算自然日、自然周（周一开始）和自然月
+const (
+	// QuotaDaily 每天
+	QuotaDaily = "day"
+	// QuotaWeekly 每周
+	QuotaWeekly = "week"
+	// QuotaMonthly 每月
+	QuotaMonthly = "month"
+)
+
+// Quota 用量配额，如{API: "/api/search", Limit: 10000, Period: "month"}表示每月最多调用10000次
+type Quota struct {
+	// 配额名称，同一用户组内唯一，查询和重置时使用；为空时使用API
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// 计入配额的API前缀，为空表示该用户组的所有API
+	API string `json:"api,omitempty" yaml:"api,omitempty"`
+	// 每个周期允许的调用次数
+	Limit int64 `json:"limit" yaml:"limit"`
+	// 周期："day"、"week"或"month"
+	Period string `json:"period" yaml:"period"`
+	// 由API解析而成的路径段
+	Path []string `json:"-" yaml:"-"`
+}
+
+// QuotaUsage 用户在某个配额上的用量
+type QuotaUsage struct {
+	// 配额名称
+	Name string `json:"name"`
+	// 计入配额的API前缀
+	API string `json:"api"`
+	// 周期
+	Period string `json:"period"`
+	// 每个周期允许的调用次数
+	Limit int64 `json:"limit"`
+	// 本周期已使用次数
+	Used int64 `json:"used"`
+	// 本周期剩余次数
+	Remaining int64 `json:"remaining"`
+	// 下次重置时间
+	ResetAt time.Time `json:"resetAt"`
+}
+
+// QuotaCounter 单个用户在单个配额上的计数，用于持久化
+type QuotaCounter struct {
+	// 租户ID
+	TenantID string `json:"tenantId,omitempty"`
+	// 用户ID
+	UserID uint `json:"userId"`
+	// 配额名称
+	Name string `json:"name"`
+	// 计数所属周期的开始时间
+	PeriodStart time.Time `json:"periodStart"`
+	// 计数所属周期的结束时间（不含），之后计数作废
+	PeriodEnd time.Time `json:"periodEnd"`
+	// 本周期已使用次数
+	Used int64 `json:"used"`
+}
+
+// QuotaStore 配额计数的持久化接口，使计数在进程重启后仍然有效
+// Save和Delete在鉴权过程中同步调用，实现应尽量快速（如写入缓冲区后异步落盘）；返回的错误不会影响鉴权结果
+type QuotaStore interface {
+	// 读取所有已保存的计数，在SetQuotaStore时调用一次
+	Load() ([]QuotaCounter, error)
+	// 保存一个计数
+	Save(c QuotaCounter) error
+	// 删除一个计数（重置配额时调用）
+	Delete(c QuotaCounter) error
+}
+
+// QuotaExceededError 配额用尽时Auth返回的错误，可以用errors.As获取配额名称和重置时间
+type QuotaExceededError struct {
+	// 配额名称
+	Name string
+	// 下次重置时间
+	ResetAt time.Time
+	// 错误信息
+	Message string
+}
+
+// Error 实现error接口
+func (e *QuotaExceededError) Error() string {
+	return e.Message
+}
+
+/**
+ * Key 返回配额名称，未设置Name时使用API
+ * @returns {string} 配额名称
+ */
+func (q *Quota) Key() string {
+	if q.Name != "" {
+		return q.Name
+	}
+	return q.API
+}
+
+/**
+ * Validate 校验配额配置
+ * @returns {error} 配置错误
+ */
+func (q *Quota) Validate() error {
+	if q.Limit <= 0 {
+		return errors.New("配额的limit必须大于0")
+	}
+	if q.Name == "" && q.API == "" {
+		return errors.New("配额的name和api不能同时为空")
+	}
+	switch q.Period {
+	case QuotaDaily, QuotaWeekly, QuotaMonthly:
+		return nil
+	default:
+		return errors.New("无法识别的配额周期: " + q.Period)
+	}
+}
+
+/**
+ * QuotaPeriod 计算时间点所在配额周期的开始和结束时间
+ * @param {string} period 周期
+ * @param {time.Time} t 时间点，使用其自身的时区
+ * @returns {time.Time, time.Time} 周期开始时间（含）和结束时间（不含）
+ */
+func QuotaPeriod(period string, t time.Time) (time.Time, time.Time) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case QuotaWeekly:
+		// 以周一为一周的开始
+		offset := (int(day.Weekday()) + 6) % 7
+		start := day.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7)
+	case QuotaMonthly:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return day, day.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 限流维度
+const (
+	// RateLimitByUser 按用户限流，同一用户的所有token共享配额（默认）
+	RateLimitByUser = "user"
+	// RateLimitByToken 按token限流
+	RateLimitByToken = "token"
+	// RateLimitByIP 按客户端IP限流
+	RateLimitByIP = "ip"
+)
+
+// RateLimit 令牌桶限流配置，如{Requests: 60, Per: "1m"}表示每分钟60次
+type RateLimit struct {
+	// 每个周期补充的请求数
+	Requests int `json:"requests" yaml:"requests"`
+	// 周期，如"1s"、"1m"、"1h"、"1d"
+	Per string `json:"per" yaml:"per"`
+	// 桶容量，即允许的突发请求数，为0时等于Requests
+	Burst int `json:"burst,omitempty" yaml:"burst,omitempty"`
+	// 限流维度："user"、"token"或"ip"，为空时按用户限流
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+
+	// 以下为Compile后的结果
+	compiled bool
+	invalid  bool
+	rate     float64
+	capacity float64
+}
+
+// RateLimitError 请求被限流时Auth返回的错误，可以用errors.As获取重试等待时间
+type RateLimitError struct {
+	// 触发限流的范围："group"或"rule"
+	Scope string
+	// 建议的重试等待时间
+	RetryAfter time.Duration
+	// 错误信息
+	Message string
+}
+
+// Error 实现error接口
+func (e *RateLimitError) Error() string {
+	return e.Message
+}
+
+/**
+ * Compile 校验并预处理限流配置
+ * 校验失败的配置在限流时拒绝所有请求（失败即拒绝）
+ * @returns {error} 配置错误
+ */
+func (r *RateLimit) Compile() error {
+	r.compiled = true
+	r.invalid = true
+	if r.Requests <= 0 {
+		return errors.New("限流的requests必须大于0")
+	}
+	if r.Burst < 0 {
+		return errors.New("限流的burst不能小于0")
+	}
+	switch r.Key {
+	case "", RateLimitByUser, RateLimitByToken, RateLimitByIP:
+	default:
+		return errors.New("无法识别的限流维度: " + r.Key)
+	}
+	per, err := parsePeriod(r.Per)
+	if err != nil {
+		return err
+	}
+	r.rate = float64(r.Requests) / per.Seconds()
+	r.capacity = float64(r.Requests)
+	if r.Burst > 0 {
+		r.capacity = float64(r.Burst)
+	}
+	r.invalid = false
+	return nil
+}
+
+/**
+ * Compiled 返回编译后的副本，原配置不会被修改
+ * @returns {*RateLimit} 编译后的限流配置，r为nil时返回nil
+ */
+func (r *RateLimit) Compiled() *RateLimit {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Compile()
+	return &c
+}
+
+/**
+ * KeyKind 返回限流维度，未设置时为RateLimitByUser
+ * @returns {string} 限流维度
+ */
+func (r *RateLimit) KeyKind() string {
+	if r.Key == "" {
+		return RateLimitByUser
+	}
+	return r.Key
+}
+
+/**
+ * Bucket 返回令牌桶参数
+ * @returns {float64, float64, bool} 每秒补充的令牌数、桶容量、配置是否有效
+ */
+func (r *RateLimit) Bucket() (float64, float64, bool) {
+	if !r.compiled {
+		c := *r
+		c.Compile()
+		return c.rate, c.capacity, !c.invalid
+	}
+	return r.rate, r.capacity, !r.invalid
+}
+
+/**
+ * parsePeriod 解析限流周期，支持Go的时长格式和"d"（天）
+ * @param {string} s 周期字符串
+ * @returns {time.Duration, error} 周期和错误
+ */
+func parsePeriod(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var d time.Duration
+	var err error
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		var days int
+		days, err = strconv.Atoi(n)
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, errors.New("限流周期格式错误: " + s)
+	}
+	return d, nil
+}
@@ -0,0 +1,112 @@
+package models
+
+import "strings"
+
+// RuleTrie 由用户组的ApiRules编译而成的路径段前缀树
+// 每个节点对应一个路径段，节点上记录以该节点结尾的规则下标，
+// 匹配时沿请求路径逐段下行，最后经过的带规则节点即为最长匹配。
+// 路径段按字面量比较，"*"与其他路径段一样没有通配含义
+type RuleTrie struct {
+	root ruleNode
+}
+
+// ruleNode 前缀树节点
+type ruleNode struct {
+	// 路径段子节点
+	children map[string]*ruleNode
+	// 以该节点结尾的规则在ApiRules中的下标，-1表示没有规则
+	rule int
+}
+
+/**
+ * NewRuleTrie 将已排序的规则数组编译为前缀树
+ * 同一路径存在多条规则时，保留数组中最靠前的一条，与HasPermission的行为一致
+ * @param {[]ApiRule} rules API规则数组
+ * @returns {*RuleTrie} 编译后的前缀树
+ */
+func NewRuleTrie(rules []ApiRule) *RuleTrie {
+	t := &RuleTrie{root: ruleNode{rule: -1}}
+	for i, r := range rules {
+		// 空路径规则永远不会成为最长匹配
+		if len(r.Path) == 0 {
+			continue
+		}
+		n := &t.root
+		for _, seg := range r.Path {
+			n = n.child(seg, true)
+		}
+		if n.rule < 0 {
+			n.rule = i
+		}
+	}
+	return t
+}
+
+/**
+ * child 获取路径段对应的子节点
+ * @param {string} seg 路径段
+ * @param {bool} create 不存在时是否创建
+ * @returns {*ruleNode} 子节点，不存在且不创建时返回nil
+ */
+func (n *ruleNode) child(seg string, create bool) *ruleNode {
+	c := n.children[seg]
+	if c == nil && create {
+		if n.children == nil {
+			n.children = make(map[string]*ruleNode)
+		}
+		c = &ruleNode{rule: -1}
+		n.children[seg] = c
+	}
+	return c
+}
+
+/**
+ * MatchSegments 使用已解析的路径段进行最长前缀匹配
+ * @param {[]string} segments 请求路径段
+ * @returns {int} 命中规则在ApiRules中的下标，-1表示没有匹配
+ * @returns {int} 命中规则的路径段数
+ */
+func (t *RuleTrie) MatchSegments(segments []string) (int, int) {
+	best, length := -1, 0
+	n := &t.root
+	for i, seg := range segments {
+		if n = n.child(seg, false); n == nil {
+			break
+		}
+		if n.rule >= 0 {
+			best, length = n.rule, i+1
+		}
+	}
+	return best, length
+}
+
+/**
+ * MatchPath 直接在路径字符串上进行最长前缀匹配，不产生内存分配
+ * 路径段的切分方式与utility.ParsePathToSegments相同：按"/"分割，去除空白，跳过空段
+ * @param {string} path 已解码的路径字符串（不含协议、主机、查询参数）
+ * @returns {int} 命中规则在ApiRules中的下标，-1表示没有匹配
+ * @returns {int} 命中规则的路径段数
+ */
+func (t *RuleTrie) MatchPath(path string) (int, int) {
+	best, length, depth := -1, 0, 0
+	n := &t.root
+	for path != "" {
+		var seg string
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			seg, path = path[:i], path[i+1:]
+		} else {
+			seg, path = path, ""
+		}
+		if seg = strings.TrimSpace(seg); seg == "" {
+			continue
+		}
+		if n = n.child(seg, false); n == nil {
+			break
+		}
+		depth++
+		if n.rule >= 0 {
+			best, length = n.rule, depth
+		}
+	}
+	return best, length
+}
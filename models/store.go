@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// TokenStore token存储接口，管理器的所有token读写都通过它完成
+// 管理器保证写操作（Put、Delete、Touch）互斥执行，且不与读操作同时进行；读操作之间可能并发执行
+// Get和Range返回的token可以是存储内部的对象，管理器只读取它们，修改后总是调用Put写回
+type TokenStore[T any] interface {
+	// 获取token，不存在时返回nil, nil
+	Get(key string) (*Token[T], error)
+	// 保存token，已存在时整体替换（包括租户、用户和用户组的索引）
+	Put(key string, t *Token[T]) error
+	// 删除token，不存在时不返回错误
+	Delete(key string) error
+	// 更新最后访问时间；访问时间更新频繁，单独提供以便实现合并写入。token不存在时不返回错误
+	Touch(key string, at time.Time) error
+	// 遍历所有token，fn返回false时停止遍历；遍历期间不会修改存储
+	Range(fn func(key string, t *Token[T]) bool) error
+	// 获取租户内指定用户的所有token键
+	KeysByUser(tenantID string, userID uint) ([]string, error)
+	// 获取租户内指定用户组的所有token键
+	KeysByGroup(tenantID string, groupID uint) ([]string, error)
+	// 获取token数量
+	Len() (int, error)
+}
+
+// GroupStore 可选接口，token存储同时实现它时，用户组也保存在存储中，管理器初始化时加载已保存的用户组
+// 管理器保证写操作（PutGroup、DeleteGroup）互斥执行
+type GroupStore interface {
+	// 保存用户组，已存在时整体替换
+	PutGroup(tenantID string, raw GroupRaw) error
+	// 删除用户组，不存在时不返回错误
+	DeleteGroup(tenantID string, groupID uint) error
+	// 获取所有租户保存的用户组
+	Groups() (map[string][]GroupRaw, error)
+}
+
+// DBError 数据库存储返回的错误，可以用errors.As获取错误键，用errors.Unwrap获取驱动的原始错误
+type DBError struct {
+	// 错误键，为error_utils中的db_*之一
+	Key string
+	// 错误信息
+	Message string
+	// 驱动返回的原始错误
+	Err error
+}
+
+// Error 实现error接口
+func (e *DBError) Error() string {
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap 返回驱动的原始错误
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// TxStore 可选接口，token存储支持事务时，管理器一次删除多个token（批量删除、删除用户组、清理过期token）在一个事务中完成
+// 事务期间的读操作能读到事务中的写入；管理器持有写锁，同一时间最多只有一个事务
+type TxStore interface {
+	// 开始事务，之后的写操作在Commit时一起生效
+	Begin() error
+	// 提交事务，所有写操作要么全部生效，要么全部不生效
+	Commit() error
+	// 回滚事务，丢弃所有写操作
+	Rollback() error
+}
+
+// ExpiryIndex 可选接口，token存储按过期时间建立索引时，清理过期token只需读取已过期的部分，不必遍历所有token
+type ExpiryIndex interface {
+	// 获取在指定时间之前过期的token键，永不过期的token不会返回
+	ExpiredKeys(before time.Time) ([]string, error)
+}
@@ -20,6 +20,46 @@ type Token[T any] struct {
 	UserData T `json:"userData"`
 	// Token所属用户的IP地址
 	IP string `json:"ip"`
+	// Token所属租户ID，为空表示默认租户
+	TenantID string `json:"tenantId,omitempty"`
+	// 临时提权，为nil表示未提权；有效期内鉴权使用提权的目标用户组
+	Elevation *Elevation `json:"elevation,omitempty"`
+	// 版本号，新建时为1，每次修改token内容时加1（访问时间的更新不计入），用于PatchToken的乐观并发控制
+	Version uint64 `json:"version"`
+}
+
+// Cloner 用户数据可以实现的深拷贝接口
+// 管理器返回token和用户数据时使用Clone生成互不共享的副本；未实现时使用反射深拷贝
+type Cloner[T any] interface {
+	Clone() T
+}
+
+// TokenPatch PatchToken允许修改的字段，为nil的字段保持不变
+// UserID、LoginTime和TenantID决定了token的归属，不允许修改
+type TokenPatch[T any] struct {
+	// 用户组ID，必须是token所属租户内已存在的用户组，且允许token的IP访问
+	GroupID *uint
+	// 过期秒数，不能小于0
+	ExpireSeconds *int64
+	// 用户数据
+	UserData *T
+	// 绑定的IP地址，必须是合法的IP且在用户组允许的网络内
+	IP *string
+}
+
+// VersionConflictError token版本与期望不一致时PatchToken返回的错误，可以用errors.As获取当前版本
+type VersionConflictError struct {
+	// 调用方期望的版本
+	Expected uint64
+	// token当前的版本
+	Actual uint64
+	// 错误信息
+	Message string
+}
+
+// Error 实现error接口
+func (e *VersionConflictError) Error() string {
+	return e.Message
 }
 
 // IsExpired 检查token是否过期
@@ -0,0 +1,251 @@
+package wt
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// tokenRecord token的持久化格式，用户数据由编解码器单独编码
+type tokenRecord struct {
+	Key            string            `json:"key"`
+	TenantID       string            `json:"tenantId,omitempty"`
+	UserID         uint              `json:"userId"`
+	GroupID        uint              `json:"groupId"`
+	LoginTime      time.Time         `json:"loginTime"`
+	ExpireSeconds  int64             `json:"expireSeconds"`
+	LastAccessTime time.Time         `json:"lastAccessTime"`
+	IP             string            `json:"ip"`
+	Elevation      *models.Elevation `json:"elevation,omitempty"`
+	Version        uint64            `json:"version"`
+	UserData       []byte            `json:"userData,omitempty"`
+}
+
+// sharedRecord 用户共享数据的持久化格式，数据由编解码器单独编码
+type sharedRecord struct {
+	TenantID string `json:"tenantId,omitempty"`
+	UserID   uint   `json:"userId"`
+	Data     []byte `json:"data,omitempty"`
+}
+
+// persistedState 从快照和日志中恢复出的状态，用于替换管理器中的内容
+type persistedState[T any] struct {
+	// groups 各租户的用户组原始配置
+	groups map[string]map[uint]models.GroupRaw
+	// tenantMax 各租户的最大token数量
+	tenantMax map[string]int
+	// tokens 所有token，可能包含已过期的token
+	tokens map[string]*models.Token[T]
+	// shared 用户的共享数据，只对仍有token的用户生效
+	shared map[userKey]T
+	// expired 累计的过期token数量
+	expired int
+	// foldedJournal 快照已合并的预写日志标识
+	foldedJournal string
+	// foldedRecords 快照合并了该日志的前多少条记录，为nil表示全部记录
+	foldedRecords *uint64
+}
+
+// newPersistedState 创建空的持久化状态
+func newPersistedState[T any]() *persistedState[T] {
+	return &persistedState[T]{
+		groups:    make(map[string]map[uint]models.GroupRaw),
+		tenantMax: make(map[string]int),
+		tokens:    make(map[string]*models.Token[T]),
+		shared:    make(map[userKey]T),
+	}
+}
+
+// deleteToken 删除token，用户没有其他token时同时删除共享数据，与管理器释放用户状态的时机一致
+func (s *persistedState[T]) deleteToken(key string) {
+	t := s.tokens[key]
+	delete(s.tokens, key)
+	if t == nil {
+		return
+	}
+	for _, other := range s.tokens {
+		if other.TenantID == t.TenantID && other.UserID == t.UserID {
+			return
+		}
+	}
+	delete(s.shared, userKey{t.TenantID, t.UserID})
+}
+
+// setGroup 新增或替换用户组
+func (s *persistedState[T]) setGroup(tenantID string, raw models.GroupRaw) {
+	if s.groups[tenantID] == nil {
+		s.groups[tenantID] = make(map[uint]models.GroupRaw)
+	}
+	s.groups[tenantID][raw.ID] = raw
+}
+
+/**
+ * encodeTokenRecord 把token转换为持久化格式
+ * @param {string} key token键
+ * @param {*models.Token[T]} t token信息
+ * @returns {tokenRecord, error} 持久化记录和用户数据的编码错误
+ */
+func (tm *Manager[T]) encodeTokenRecord(key string, t *models.Token[T]) (tokenRecord, error) {
+	data, err := tm.codec.Marshal(t.UserData)
+	if err != nil {
+		return tokenRecord{}, err
+	}
+	return tokenRecord{
+		Key:            key,
+		TenantID:       t.TenantID,
+		UserID:         t.UserID,
+		GroupID:        t.GroupID,
+		LoginTime:      t.LoginTime,
+		ExpireSeconds:  t.ExpireSeconds,
+		LastAccessTime: t.LastAccessTime,
+		IP:             t.IP,
+		Elevation:      t.Elevation,
+		Version:        t.Version,
+		UserData:       data,
+	}, nil
+}
+
+/**
+ * decodeTokenRecord 从持久化格式还原token
+ * @param {tokenRecord} r 持久化记录
+ * @returns {*models.Token[T], error} token信息和用户数据的解码错误
+ */
+func (tm *Manager[T]) decodeTokenRecord(r tokenRecord) (*models.Token[T], error) {
+	t := &models.Token[T]{
+		UserID:         r.UserID,
+		GroupID:        r.GroupID,
+		LoginTime:      r.LoginTime,
+		ExpireSeconds:  r.ExpireSeconds,
+		LastAccessTime: r.LastAccessTime,
+		IP:             r.IP,
+		TenantID:       r.TenantID,
+		Elevation:      r.Elevation,
+		Version:        r.Version,
+	}
+	if len(r.UserData) > 0 {
+		data, err := tm.codec.Unmarshal(r.UserData)
+		if err != nil {
+			return nil, err
+		}
+		t.UserData = data
+	}
+	return t, nil
+}
+
+/**
+ * encodeSharedRecord 把用户的共享数据转换为持久化格式
+ * @param {userKey} k 用户
+ * @param {T} data 共享数据
+ * @returns {sharedRecord, error} 持久化记录和编码错误
+ */
+func (tm *Manager[T]) encodeSharedRecord(k userKey, data T) (sharedRecord, error) {
+	raw, err := tm.codec.Marshal(data)
+	if err != nil {
+		return sharedRecord{}, err
+	}
+	return sharedRecord{TenantID: k.tenant, UserID: k.user, Data: raw}, nil
+}
+
+/**
+ * decodeSharedRecord 从持久化格式还原用户的共享数据
+ * @param {sharedRecord} r 持久化记录
+ * @returns {userKey, T, error} 用户、共享数据和解码错误
+ */
+func (tm *Manager[T]) decodeSharedRecord(r sharedRecord) (userKey, T, error) {
+	k := userKey{r.TenantID, r.UserID}
+	var data T
+	if len(r.Data) > 0 {
+		var err error
+		if data, err = tm.codec.Unmarshal(r.Data); err != nil {
+			return k, data, err
+		}
+	}
+	return k, data, nil
+}
+
+/**
+ * SetCodec 设置持久化时用户数据的编解码器，默认使用JSON
+ * @param {models.Codec[T]} codec 编解码器，为nil时恢复为JSON
+ */
+func (tm *Manager[T]) SetCodec(codec models.Codec[T]) {
+	if codec == nil {
+		codec = models.JSONCodec[T]{}
+	}
+	tm.lock()
+	defer tm.unlock()
+	tm.codec = codec
+}
+
+/**
+ * writeFileAtomic 原子地写入文件：先写入同目录下的临时文件并同步到磁盘，再重命名覆盖目标文件
+ * 写入过程中崩溃时目标文件保持原样
+ * @param {string} path 目标文件路径
+ * @param {[]byte} data 文件内容
+ * @returns {error} 写入错误
+ */
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := writeTempFile(path, data)
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+/**
+ * writeTempFile 把内容写入目标文件同目录下的临时文件并同步到磁盘
+ * @param {string} path 目标文件路径
+ * @param {[]byte} data 文件内容
+ * @returns {string, error} 临时文件路径和写入错误，出错时临时文件已删除
+ */
+func writeTempFile(path string, data []byte) (string, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, DIR_PERM); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	// 任何一步失败都删除临时文件
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+	if err := tmp.Chmod(FILE_PERM); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	committed = true
+	return tmp.Name(), nil
+}
+
+// replaceFile 把已同步的临时文件重命名为目标文件，并同步所在目录
+func replaceFile(tmp, path string) error {
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	// 同步目录，确保重命名本身也已落盘；部分平台不支持同步目录，忽略错误
+	if d, err := os.Open(filepath.Dir(path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
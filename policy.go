@@ -0,0 +1,495 @@
+package wt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyFormat 策略文件格式
+type PolicyFormat string
+
+const (
+	// PolicyFormatJSON JSON格式
+	PolicyFormatJSON PolicyFormat = "json"
+	// PolicyFormatYAML YAML格式
+	PolicyFormatYAML PolicyFormat = "yaml"
+)
+
+var (
+	// identifierPattern 可以用"."连接的字段名
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// yamlLinePattern YAML错误信息中的行号
+	yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+	// jsonUnknownFieldPattern JSON未知字段错误中的字段名
+	jsonUnknownFieldPattern = regexp.MustCompile(`unknown field "([^"]*)"`)
+)
+
+/**
+ * LoadPolicy 读取并校验策略文件，自动识别JSON和YAML格式
+ * 校验失败时返回models.PolicyErrors，其中每个错误都带有行号和字段位置
+ * @param {io.Reader} r 策略文件内容
+ * @returns {*models.Policy, error} 策略和错误
+ */
+func LoadPolicy(r io.Reader) (*models.Policy, error) {
+	p := &models.Policy{}
+	data, err := decodePolicyDocument(r, p)
+	if err != nil {
+		return nil, err
+	}
+	if errs := validatePolicy(p, policyLocations(data)); len(errs) > 0 {
+		return nil, errs
+	}
+	return p, nil
+}
+
+/**
+ * decodePolicyDocument 读取JSON或YAML文档并严格解码（不允许未知字段）
+ * @param {io.Reader} r 文档内容
+ * @param {any} v 解码目标
+ * @returns {[]byte, error} 原始内容和带行号的解码错误
+ */
+func decodePolicyDocument(r io.Reader, v any) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, models.PolicyErrors{{Message: "文件内容为空"}}
+	}
+
+	if detectPolicyFormat(data) == PolicyFormatJSON {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v); err != nil {
+			return nil, jsonPolicyError(data, err)
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(v); err != nil {
+			return nil, yamlPolicyError(err)
+		}
+	}
+	return data, nil
+}
+
+/**
+ * ValidatePolicy 校验策略内容，复用ValidateGroupRaw的用户组校验
+ * 直接构造的策略没有行号，返回的错误只带字段位置
+ * @param {*models.Policy} p 策略
+ * @returns {error} 校验错误，类型为models.PolicyErrors
+ */
+func ValidatePolicy(p *models.Policy) error {
+	if errs := validatePolicy(p, nil); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+/**
+ * PolicyGroups 将策略转换为管理器使用的用户组配置
+ * @param {*models.Policy} p 策略
+ * @param {string} delimiter API分隔符，需与ConfigRaw.Delimiter一致
+ * @returns {[]models.GroupRaw, error} 用户组配置和错误
+ */
+func PolicyGroups(p *models.Policy, delimiter string) ([]models.GroupRaw, error) {
+	groups := make([]models.GroupRaw, 0, len(p.Groups))
+	for i, pg := range p.Groups {
+		for _, list := range [][]string{pg.Allow, pg.Deny} {
+			for _, api := range list {
+				if strings.Contains(api, delimiter) {
+					return nil, &models.PolicyError{
+						Field:   fmt.Sprintf("groups[%d]", i),
+						Message: fmt.Sprintf("路径%q包含分隔符%q", api, delimiter),
+					}
+				}
+			}
+		}
+		groups = append(groups, policyGroupToRaw(pg, p.Expiry, delimiter))
+	}
+	return groups, nil
+}
+
+/**
+ * PolicyFromGroups 将用户组配置导出为策略
+ * @param {[]models.GroupRaw} groups 用户组配置
+ * @param {string} delimiter API分隔符
+ * @returns {*models.Policy} 策略
+ */
+func PolicyFromGroups(groups []models.GroupRaw, delimiter string) *models.Policy {
+	p := &models.Policy{SchemaVersion: models.PolicySchemaVersion}
+	for _, raw := range groups {
+		p.Groups = append(p.Groups, models.PolicyGroup{
+			ID:                 raw.ID,
+			Name:               raw.Name,
+			Allow:              splitAPIs(raw.AllowedAPIs, delimiter),
+			Deny:               splitAPIs(raw.DeniedAPIs, delimiter),
+			TokenExpire:        raw.TokenExpire,
+			AllowMultipleLogin: raw.AllowMultipleLogin == 1,
+			TimeWindows:        raw.TimeWindows,
+			AllowCIDRs:         raw.AllowCIDRs,
+			DenyCIDRs:          raw.DenyCIDRs,
+			RateLimit:          raw.RateLimit,
+			Quotas:             raw.Quotas,
+			RuleConditions:     raw.RuleConditions,
+		})
+	}
+	return p
+}
+
+/**
+ * ExportPolicy 将策略写出为JSON或YAML
+ * @param {io.Writer} w 输出目标
+ * @param {*models.Policy} p 策略
+ * @param {PolicyFormat} format 输出格式
+ * @returns {error} 写出错误
+ */
+func ExportPolicy(w io.Writer, p *models.Policy, format PolicyFormat) error {
+	switch format {
+	case PolicyFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case PolicyFormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return errors.New("不支持的策略格式: " + string(format))
+	}
+}
+
+/**
+ * validatePolicy 校验策略内容
+ * @param {*models.Policy} p 策略
+ * @param {map[string]int} locs 字段路径到行号的映射，可以为nil
+ * @returns {models.PolicyErrors} 全部错误
+ */
+func validatePolicy(p *models.Policy, locs map[string]int) models.PolicyErrors {
+	var errs models.PolicyErrors
+	report := func(field, format string, args ...any) {
+		errs = append(errs, &models.PolicyError{Line: locs[field], Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case p.SchemaVersion == 0:
+		report("schemaVersion", "缺少schemaVersion")
+	case p.SchemaVersion > models.PolicySchemaVersion:
+		report("schemaVersion", "不支持的schemaVersion %d，当前最高支持%d", p.SchemaVersion, models.PolicySchemaVersion)
+	}
+	if p.Expiry.DefaultTokenExpire != "" {
+		if err := validateTokenRenewTime(p.Expiry.DefaultTokenExpire); err != nil {
+			report("expiry.defaultTokenExpire", "%s", err.Error())
+		}
+	}
+
+	seen := make(map[uint]int)
+	for i, g := range p.Groups {
+		base := fmt.Sprintf("groups[%d]", i)
+		before := len(errs)
+		if g.ID == 0 {
+			report(base+".id", "用户组ID不能为0")
+		} else if first, dup := seen[g.ID]; dup {
+			report(base+".id", "用户组ID %d 与groups[%d]重复", g.ID, first)
+		} else {
+			seen[g.ID] = i
+		}
+		if strings.TrimSpace(g.Name) == "" {
+			report(base+".name", "用户组名称不能为空")
+		}
+		if g.TokenExpire != "" {
+			if err := validateTokenRenewTime(g.TokenExpire); err != nil {
+				report(base+".tokenExpire", "%s", err.Error())
+			}
+		}
+
+		rules := make(map[string]bool)
+		for _, list := range []struct {
+			name  string
+			paths []string
+		}{{"allow", g.Allow}, {"deny", g.Deny}} {
+			for j, api := range list.paths {
+				field := fmt.Sprintf("%s.%s[%d]", base, list.name, j)
+				segments := utility.ParsePathToSegments(api)
+				switch {
+				case len(segments) == 0:
+					report(field, "API路径为空")
+				case strings.ContainsAny(strings.TrimSpace(api), " \t\r\n"):
+					report(field, "API路径%q不能包含空白字符", api)
+				default:
+					rules[strings.Join(segments, "/")] = true
+				}
+			}
+		}
+
+		validateCIDRs(report, base+".allowCidrs", g.AllowCIDRs)
+		validateCIDRs(report, base+".denyCidrs", g.DenyCIDRs)
+		validateWindows(report, base+".timeWindows", g.TimeWindows)
+		validateRateLimit(report, base+".rateLimit", g.RateLimit)
+		quotaNames := make(map[string]bool, len(g.Quotas))
+		for j, q := range g.Quotas {
+			field := fmt.Sprintf("%s.quotas[%d]", base, j)
+			if err := q.Validate(); err != nil {
+				report(field, "%s", err.Error())
+			} else if quotaNames[q.Key()] {
+				report(field, "配额名称%q重复", q.Key())
+			}
+			quotaNames[q.Key()] = true
+		}
+		apis := make([]string, 0, len(g.RuleConditions))
+		for api := range g.RuleConditions {
+			apis = append(apis, api)
+		}
+		sort.Strings(apis)
+		for _, api := range apis {
+			cond := g.RuleConditions[api]
+			field := fieldPath(base+".ruleConditions", api)
+			if !rules[strings.Join(utility.ParsePathToSegments(api), "/")] {
+				report(field, "附加条件引用的路径%q不在allow或deny中", api)
+			}
+			validateCIDRs(report, field+".allowCidrs", cond.AllowCIDRs)
+			validateCIDRs(report, field+".denyCidrs", cond.DenyCIDRs)
+			validateWindows(report, field+".timeWindows", cond.TimeWindows)
+			validateRateLimit(report, field+".rateLimit", cond.RateLimit)
+		}
+
+		// 最后复用ValidateGroupRaw兜底，保证策略可以被InitTM接受
+		if len(errs) == before {
+			if err := ValidateGroupRaw(policyGroupToRaw(g, p.Expiry, DEFAULT_DELIMITER)); err != nil {
+				report(base, "%s", err.Error())
+			}
+		}
+	}
+	return errs
+}
+
+/**
+ * validateCIDRs 逐项校验网段列表
+ * @param {func} report 错误记录函数
+ * @param {string} field 字段路径
+ * @param {[]string} items 网段列表
+ */
+func validateCIDRs(report func(field, format string, args ...any), field string, items []string) {
+	for j, item := range items {
+		if _, err := models.ParseNetworkPolicy([]string{item}, nil); err != nil {
+			report(fmt.Sprintf("%s[%d]", field, j), "%s", err.Error())
+		}
+	}
+}
+
+/**
+ * validateWindows 逐项校验时间窗口
+ * @param {func} report 错误记录函数
+ * @param {string} field 字段路径
+ * @param {[]models.TimeWindow} windows 时间窗口列表
+ */
+func validateWindows(report func(field, format string, args ...any), field string, windows []models.TimeWindow) {
+	for j, w := range windows {
+		if err := w.Compile(); err != nil {
+			report(fmt.Sprintf("%s[%d]", field, j), "%s", err.Error())
+		}
+	}
+}
+
+/**
+ * validateRateLimit 校验限流配置
+ * @param {func} report 错误记录函数
+ * @param {string} field 字段路径
+ * @param {*models.RateLimit} limit 限流配置，为nil时不校验
+ */
+func validateRateLimit(report func(field, format string, args ...any), field string, limit *models.RateLimit) {
+	if limit == nil {
+		return
+	}
+	if err := limit.Compiled().Compile(); err != nil {
+		report(field, "%s", err.Error())
+	}
+}
+
+/**
+ * policyGroupToRaw 将策略中的用户组转换为GroupRaw
+ * @param {models.PolicyGroup} g 策略中的用户组
+ * @param {models.PolicyExpiry} expiry 过期设置
+ * @param {string} delimiter API分隔符
+ * @returns {models.GroupRaw} 用户组配置
+ */
+func policyGroupToRaw(g models.PolicyGroup, expiry models.PolicyExpiry, delimiter string) models.GroupRaw {
+	raw := models.GroupRaw{
+		ID:             g.ID,
+		Name:           g.Name,
+		AllowedAPIs:    strings.Join(g.Allow, delimiter),
+		DeniedAPIs:     strings.Join(g.Deny, delimiter),
+		TokenExpire:    g.TokenExpire,
+		TimeWindows:    g.TimeWindows,
+		AllowCIDRs:     g.AllowCIDRs,
+		DenyCIDRs:      g.DenyCIDRs,
+		RateLimit:      g.RateLimit,
+		Quotas:         g.Quotas,
+		RuleConditions: g.RuleConditions,
+	}
+	if raw.TokenExpire == "" {
+		raw.TokenExpire = expiry.DefaultTokenExpire
+	}
+	if g.AllowMultipleLogin {
+		raw.AllowMultipleLogin = 1
+	}
+	return raw
+}
+
+/**
+ * splitAPIs 按分隔符拆分API列表，去除空项
+ * @param {string} apis 分隔符连接的API列表
+ * @param {string} delimiter 分隔符
+ * @returns {[]string} API数组
+ */
+func splitAPIs(apis string, delimiter string) []string {
+	var result []string
+	for _, api := range splitRuleAPIs(apis, delimiter) {
+		if api = strings.TrimSpace(api); api != "" {
+			result = append(result, api)
+		}
+	}
+	return result
+}
+
+/**
+ * detectPolicyFormat 根据首个非空白字符判断策略文件格式
+ * @param {[]byte} data 文件内容
+ * @returns {PolicyFormat} 文件格式
+ */
+func detectPolicyFormat(data []byte) PolicyFormat {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return PolicyFormatJSON
+	}
+	return PolicyFormatYAML
+}
+
+/**
+ * fieldPath 拼接字段路径，非标识符的键使用["key"]形式
+ * @param {string} parent 上级路径
+ * @param {string} key 键
+ * @returns {string} 字段路径
+ */
+func fieldPath(parent, key string) string {
+	if identifierPattern.MatchString(key) {
+		if parent == "" {
+			return key
+		}
+		return parent + "." + key
+	}
+	return parent + "[" + strconv.Quote(key) + "]"
+}
+
+/**
+ * policyLocations 解析文件得到字段路径到行号的映射（JSON按YAML的超集解析）
+ * @param {[]byte} data 文件内容
+ * @returns {map[string]int} 字段路径到行号的映射，解析失败时返回空映射
+ */
+func policyLocations(data []byte) map[string]int {
+	locs := make(map[string]int)
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return locs
+	}
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				child := fieldPath(path, n.Content[i].Value)
+				locs[child] = n.Content[i].Line
+				walk(n.Content[i+1], child)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				locs[child] = c.Line
+				walk(c, child)
+			}
+		}
+	}
+	walk(&root, "")
+	return locs
+}
+
+/**
+ * jsonPolicyError 将JSON解码错误转换为带行号的策略错误
+ * @param {[]byte} data 文件内容
+ * @param {error} err 解码错误
+ * @returns {models.PolicyErrors} 策略错误
+ */
+func jsonPolicyError(data []byte, err error) models.PolicyErrors {
+	pe := &models.PolicyError{Message: err.Error()}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		pe.Line = lineAtOffset(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		pe.Line = lineAtOffset(data, typeErr.Offset)
+		pe.Field = typeErr.Field
+	default:
+		if m := jsonUnknownFieldPattern.FindStringSubmatch(err.Error()); m != nil {
+			pe.Field = m[1]
+			if idx := bytes.Index(data, []byte(strconv.Quote(m[1]))); idx >= 0 {
+				pe.Line = lineAtOffset(data, int64(idx))
+			}
+		}
+	}
+	return models.PolicyErrors{pe}
+}
+
+/**
+ * yamlPolicyError 将YAML解码错误转换为带行号的策略错误
+ * @param {error} err 解码错误
+ * @returns {models.PolicyErrors} 策略错误
+ */
+func yamlPolicyError(err error) models.PolicyErrors {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	errs := make(models.PolicyErrors, 0, len(messages))
+	for _, msg := range messages {
+		pe := &models.PolicyError{Message: msg}
+		if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+			pe.Line, _ = strconv.Atoi(m[1])
+			pe.Message = m[2]
+		}
+		errs = append(errs, pe)
+	}
+	return errs
+}
+
+/**
+ * lineAtOffset 计算字节偏移所在的行号
+ * @param {[]byte} data 文件内容
+ * @param {int64} offset 字节偏移
+ * @returns {int} 行号，从1开始
+ */
+func lineAtOffset(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,169 @@
+package wt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+const (
+	// ExpectAllow 预期允许访问
+	ExpectAllow = "allow"
+	// ExpectDeny 预期拒绝访问
+	ExpectDeny = "deny"
+)
+
+/**
+ * LoadPolicyTests 读取策略测试用例文件（JSON或YAML）
+ * @param {io.Reader} r 文件内容
+ * @returns {*models.PolicyTestSuite, error} 测试用例和错误
+ */
+func LoadPolicyTests(r io.Reader) (*models.PolicyTestSuite, error) {
+	suite := &models.PolicyTestSuite{}
+	data, err := decodePolicyDocument(r, suite)
+	if err != nil {
+		return nil, err
+	}
+
+	locs := policyLocations(data)
+	var errs models.PolicyErrors
+	report := func(field, format string, args ...any) {
+		errs = append(errs, &models.PolicyError{Line: locs[field], Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if suite.SchemaVersion == 0 || suite.SchemaVersion > models.PolicySchemaVersion {
+		report("schemaVersion", "不支持的schemaVersion %d", suite.SchemaVersion)
+	}
+	for i, c := range suite.Cases {
+		base := fmt.Sprintf("cases[%d]", i)
+		if c.Group == 0 {
+			report(base+".group", "用户组ID不能为0")
+		}
+		if strings.TrimSpace(c.Path) == "" {
+			report(base+".path", "请求路径不能为空")
+		}
+		if c.Expect != ExpectAllow && c.Expect != ExpectDeny {
+			report(base+".expect", "expect只能是%q或%q", ExpectAllow, ExpectDeny)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return suite, nil
+}
+
+/**
+ * RunPolicyTests 使用ConvGroup和utility.HasPermission逐条校验访问预期
+ * @param {[]models.GroupRaw} groups 用户组配置
+ * @param {models.ConfigRaw} config 管理器配置，使用其中的Delimiter（为空时为DEFAULT_DELIMITER）和Language
+ * @param {[]models.PolicyTestCase} cases 测试用例
+ * @returns {[]models.PolicyTestResult} 每条用例的结果，失败的用例附带决策详情
+ */
+func RunPolicyTests(groups []models.GroupRaw, config models.ConfigRaw, cases []models.PolicyTestCase) []models.PolicyTestResult {
+	delimiter := config.Delimiter
+	if delimiter == "" {
+		delimiter = DEFAULT_DELIMITER
+	}
+	compiled := make(map[uint]*models.Group, len(groups))
+	for _, raw := range groups {
+		compiled[raw.ID] = ConvGroup(raw, delimiter)
+	}
+
+	results := make([]models.PolicyTestResult, 0, len(cases))
+	for _, c := range cases {
+		if c.Name == "" {
+			c.Name = strings.Join(strings.Fields(fmt.Sprintf("group %d %s %s", c.Group, c.Method, c.Path)), " ")
+		}
+		g := compiled[c.Group]
+		allowed := g != nil && utility.HasPermission(c.Path, g.ApiRules)
+		result := models.PolicyTestResult{Case: c, Actual: ExpectDeny}
+		if allowed {
+			result.Actual = ExpectAllow
+		}
+		result.Passed = result.Actual == c.Expect
+		if !result.Passed {
+			result.Detail = explainGroup(config.Language, c.Group, g, c.Path)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+/**
+ * FormatPolicyTestResults 将测试结果输出为文本，并在存在失败用例时返回错误
+ * @param {io.Writer} w 输出目标
+ * @param {[]models.PolicyTestResult} results 测试结果
+ * @returns {error} 存在失败用例时返回错误
+ */
+func FormatPolicyTestResults(w io.Writer, results []models.PolicyTestResult) error {
+	failed := 0
+	for _, r := range results {
+		if r.Passed {
+			fmt.Fprintf(w, "PASS %s\n", r.Case.Name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL %s: expected %s, got %s\n", r.Case.Name, r.Case.Expect, r.Actual)
+		d := r.Detail
+		if d == nil {
+			continue
+		}
+		fmt.Fprintf(w, "    reason: %s\n", d.Reason)
+		if !d.GroupFound {
+			fmt.Fprintf(w, "    group %d not found\n", d.GroupID)
+			continue
+		}
+		fmt.Fprintf(w, "    group %d (%s), path segments %v\n", d.GroupID, d.GroupName, d.PathSegments)
+		for _, m := range d.Candidates {
+			if m.Matched {
+				fmt.Fprintf(w, "    candidate /%s rule=%s length=%d\n", strings.Join(m.Rule.Path, "/"), ruleWord(m.Rule.Rule), m.MatchLength)
+			}
+		}
+		if d.Winner == nil {
+			fmt.Fprintf(w, "    no rule matched, denied by default\n")
+		} else {
+			fmt.Fprintf(w, "    winner /%s rule=%s length=%d\n", strings.Join(d.Winner.Rule.Path, "/"), ruleWord(d.Winner.Rule.Rule), d.Winner.MatchLength)
+		}
+	}
+	fmt.Fprintf(w, "%d passed, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d policy test(s) failed", failed)
+	}
+	return nil
+}
+
+/**
+ * explainGroup 生成单个用户组对请求路径的决策详情
+ * @param {string} language 决策原因使用的语言
+ * @param {uint} groupID 用户组ID
+ * @param {*models.Group} g 用户组，为nil表示不存在
+ * @param {string} api 请求路径
+ * @returns {*models.AuthDecision} 决策详情
+ */
+func explainGroup(language string, groupID uint, g *models.Group, api string) *models.AuthDecision {
+	d := &models.AuthDecision{API: api, GroupID: groupID}
+	if g == nil {
+		d.ErrorKey = "group_not_found"
+		d.Reason = getErrorMessage(language, d.ErrorKey)
+		return d
+	}
+	d.GroupFound = true
+	d.GroupName = g.Name
+	d.PathSegments, d.Candidates, d.Winner = utility.ExplainPermission(api, g.ApiRules)
+	d.Allowed = d.Winner != nil && d.Winner.Rule.Rule
+	if !d.Allowed {
+		d.ErrorKey = "unauthorized"
+		d.Reason = getErrorMessage(language, d.ErrorKey)
+	}
+	return d
+}
+
+// ruleWord 规则效果的文字表示
+func ruleWord(allow bool) string {
+	if allow {
+		return ExpectAllow
+	}
+	return ExpectDeny
+}
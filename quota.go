@@ -0,0 +1,262 @@
+package wt
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// quotaKey 配额计数的键，同一用户的所有token共享计数
+type quotaKey struct {
+	tenant string
+	user   uint
+	name   string
+}
+
+// quotaPruneInterval 清理过期周期计数的最小间隔
+const quotaPruneInterval = time.Hour
+
+// quotaTracker 配额计数器
+type quotaTracker struct {
+	mu       sync.Mutex
+	counters map[quotaKey]*models.QuotaCounter
+	// store 持久化接口，为nil表示只在内存中计数
+	store models.QuotaStore
+	// pruned 上次清理过期周期计数的时间
+	pruned time.Time
+}
+
+/**
+ * newQuotaTracker 创建配额计数器
+ * @returns {*quotaTracker} 配额计数器
+ */
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{counters: make(map[quotaKey]*models.QuotaCounter)}
+}
+
+/**
+ * used 获取本周期的已用次数（调用方需持有q.mu）
+ * @param {quotaKey} k 计数键
+ * @param {time.Time} start 本周期开始时间
+ * @returns {int64} 已用次数，计数属于之前的周期时返回0
+ */
+func (q *quotaTracker) used(k quotaKey, start time.Time) int64 {
+	c := q.counters[k]
+	if c == nil || !c.PeriodStart.Equal(start) {
+		return 0
+	}
+	return c.Used
+}
+
+/**
+ * checkLocked 检查配额是否用尽，不消耗（调用方需持有q.mu）
+ * @param {string} tenant 租户ID
+ * @param {uint} user 用户ID
+ * @param {[]*models.Quota} quotas 本次请求命中的配额
+ * @param {time.Time} now 当前时间
+ * @returns {*models.Quota, time.Time} 用尽的配额及其重置时间，未用尽时返回nil
+ */
+func (q *quotaTracker) checkLocked(tenant string, user uint, quotas []*models.Quota, now time.Time) (*models.Quota, time.Time) {
+	for _, quota := range quotas {
+		start, end := models.QuotaPeriod(quota.Period, now)
+		if q.used(quotaKey{tenant, user, quota.Key()}, start) >= quota.Limit {
+			return quota, end
+		}
+	}
+	return nil, time.Time{}
+}
+
+/**
+ * consumeLocked 每个配额计数加一，必须在checkLocked通过后调用（调用方需持有q.mu）
+ * @param {string} tenant 租户ID
+ * @param {uint} user 用户ID
+ * @param {[]*models.Quota} quotas 本次请求命中的配额
+ * @param {time.Time} now 当前时间
+ */
+func (q *quotaTracker) consumeLocked(tenant string, user uint, quotas []*models.Quota, now time.Time) {
+	for _, quota := range quotas {
+		start, end := models.QuotaPeriod(quota.Period, now)
+		k := quotaKey{tenant, user, quota.Key()}
+		c := q.counters[k]
+		if c == nil || !c.PeriodStart.Equal(start) {
+			c = &models.QuotaCounter{TenantID: tenant, UserID: user, Name: k.name, PeriodStart: start, PeriodEnd: end}
+			q.counters[k] = c
+		}
+		c.Used++
+		if q.store != nil {
+			// 持久化失败不影响鉴权结果，由存储实现自行重试或记录
+			q.store.Save(*c)
+		}
+	}
+	q.pruneLocked(now)
+}
+
+/**
+ * pruneLocked 删除已过期周期的计数，每quotaPruneInterval最多执行一次（调用方需持有q.mu）
+ * 过期周期的计数在查询时视为0，删除后结果不变；没有记录周期结束时间的计数（旧版本保存的）在最长周期之后删除
+ * @param {time.Time} now 当前时间
+ */
+func (q *quotaTracker) pruneLocked(now time.Time) {
+	if now.Sub(q.pruned) < quotaPruneInterval {
+		return
+	}
+	q.pruned = now
+	for k, c := range q.counters {
+		end := c.PeriodEnd
+		if end.IsZero() {
+			end = c.PeriodStart.AddDate(0, 1, 1)
+		}
+		if now.Before(end) {
+			continue
+		}
+		delete(q.counters, k)
+		if q.store != nil {
+			q.store.Delete(*c)
+		}
+	}
+}
+
+/**
+ * usage 获取用户在各配额上的用量
+ * @param {string} tenant 租户ID
+ * @param {uint} user 用户ID
+ * @param {[]models.Quota} quotas 用户组定义的配额
+ * @param {time.Time} now 当前时间
+ * @returns {[]models.QuotaUsage} 用量列表
+ */
+func (q *quotaTracker) usage(tenant string, user uint, quotas []models.Quota, now time.Time) []models.QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := make([]models.QuotaUsage, 0, len(quotas))
+	for _, quota := range quotas {
+		start, end := models.QuotaPeriod(quota.Period, now)
+		used := q.used(quotaKey{tenant, user, quota.Key()}, start)
+		result = append(result, models.QuotaUsage{
+			Name:      quota.Key(),
+			API:       quota.API,
+			Period:    quota.Period,
+			Limit:     quota.Limit,
+			Used:      used,
+			Remaining: max(quota.Limit-used, 0),
+			ResetAt:   end,
+		})
+	}
+	return result
+}
+
+/**
+ * reset 清零用户的配额计数
+ * @param {string} tenant 租户ID
+ * @param {uint} user 用户ID
+ * @param {string} name 配额名称，为空时清零该用户的所有配额
+ */
+func (q *quotaTracker) reset(tenant string, user uint, name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for k, c := range q.counters {
+		if k.tenant != tenant || k.user != user || (name != "" && k.name != name) {
+			continue
+		}
+		delete(q.counters, k)
+		if q.store != nil {
+			q.store.Delete(*c)
+		}
+	}
+}
+
+/**
+ * SetQuotaStore 设置配额计数的持久化接口，并从中恢复已保存的计数
+ * @param {models.QuotaStore} store 持久化接口，为nil表示只在内存中计数
+ * @returns {error} 读取已保存计数时的错误，出错时不替换当前的持久化接口
+ */
+func (tm *Manager[T]) SetQuotaStore(store models.QuotaStore) error {
+	var saved []models.QuotaCounter
+	if store != nil {
+		var err error
+		if saved, err = store.Load(); err != nil {
+			return err
+		}
+	}
+	q := tm.quotas
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.store = store
+	for _, c := range saved {
+		q.counters[quotaKey{c.TenantID, c.UserID, c.Name}] = &c
+	}
+	return nil
+}
+
+/**
+ * GetQuotaUsage 获取默认租户下用户在指定用户组各配额上的用量
+ * @param {uint} groupID 用户组ID
+ * @param {uint} userID 用户ID
+ * @returns {[]models.QuotaUsage, error} 用量列表和错误信息
+ */
+func (tm *Manager[T]) GetQuotaUsage(groupID uint, userID uint) ([]models.QuotaUsage, error) {
+	return tm.getQuotaUsage(DEFAULT_TENANT, groupID, userID)
+}
+
+/**
+ * ResetQuota 清零默认租户下用户的配额计数
+ * @param {uint} userID 用户ID
+ * @param {string} name 配额名称，为空时清零该用户的所有配额
+ * @returns {error} 操作结果错误信息
+ */
+func (tm *Manager[T]) ResetQuota(userID uint, name string) error {
+	return tm.resetQuota(DEFAULT_TENANT, userID, name)
+}
+
+// getQuotaUsage 获取指定租户下用户在用户组各配额上的用量
+func (tm *Manager[T]) getQuotaUsage(tenantID string, groupID uint, userID uint) ([]models.QuotaUsage, error) {
+	if userID == 0 {
+		return nil, errors.New(getErrorMessage(tm.config.Language, "user_invalid"))
+	}
+	tm.rLock()
+	g := tm.groups[tenantID][groupID]
+	now := tm.now()
+	tm.rUnlock()
+	if g == nil {
+		return nil, errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
+	}
+	return tm.quotas.usage(tenantID, userID, g.Quotas, now), nil
+}
+
+// resetQuota 清零指定租户下用户的配额计数
+func (tm *Manager[T]) resetQuota(tenantID string, userID uint, name string) error {
+	if userID == 0 {
+		return errors.New(getErrorMessage(tm.config.Language, "user_invalid"))
+	}
+	tm.quotas.reset(tenantID, userID, name)
+	return nil
+}
+
+/**
+ * matchQuotas 找出请求路径命中的配额
+ * @param {[]models.Quota} quotas 用户组定义的配额
+ * @param {[]string} segments 请求路径段
+ * @returns {[]*models.Quota} 命中的配额
+ */
+func matchQuotas(quotas []models.Quota, segments []string) []*models.Quota {
+	var matched []*models.Quota
+	for i := range quotas {
+		path := quotas[i].Path
+		if len(path) > len(segments) {
+			continue
+		}
+		hit := true
+		for j := range path {
+			if path[j] != segments[j] {
+				hit = false
+				break
+			}
+		}
+		if hit {
+			matched = append(matched, &quotas[i])
+		}
+	}
+	return matched
+}
@@ -0,0 +1,190 @@
+package wt
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// rateSweepInterval 清理已回满的共享令牌桶的最小间隔
+const rateSweepInterval = time.Minute
+
+// rateLimiter 令牌桶限流器
+// 按token限流的桶随token删除而释放；按用户或IP限流的桶与token无关，重新登录不会重置，
+// 回满到容量后与新建的桶没有区别，由定期清理释放
+type rateLimiter struct {
+	mu sync.Mutex
+	// buckets 以桶ID为键的令牌桶
+	buckets map[string]*rateBucket
+	// holders token键到其按token限流的桶ID列表
+	holders map[string][]string
+	// swept 上次清理共享令牌桶的时间
+	swept time.Time
+}
+
+// rateBucket 单个令牌桶
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+	// rate 每秒补充的令牌数
+	rate float64
+	// capacity 桶容量
+	capacity float64
+	// perToken 是否按token限流
+	perToken bool
+}
+
+// rateRequest 一次鉴权需要检查的限流项
+type rateRequest struct {
+	// scope 限流范围："group"或"rule"
+	scope string
+	// id 桶ID，由范围、用户组和限流维度的取值组成
+	id    string
+	limit *models.RateLimit
+}
+
+/**
+ * newRateLimiter 创建限流器
+ * @returns {*rateLimiter} 限流器
+ */
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[string]*rateBucket),
+		holders: make(map[string][]string),
+	}
+}
+
+/**
+ * checkLocked 检查所有限流项，不消耗令牌（调用方需持有mu）
+ * @param {[]rateRequest} reqs 限流项
+ * @param {time.Time} now 当前时间
+ * @returns {[]float64, *rateRequest, time.Duration} 各桶当前的令牌数，以及超限的限流项和建议的重试等待时间，未超限时为nil
+ */
+func (l *rateLimiter) checkLocked(reqs []rateRequest, now time.Time) ([]float64, *rateRequest, time.Duration) {
+	levels := make([]float64, len(reqs))
+	for i := range reqs {
+		rate, capacity, ok := reqs[i].limit.Bucket()
+		if !ok {
+			// 配置错误时拒绝所有请求
+			return nil, &reqs[i], 0
+		}
+		level := capacity
+		if b := l.buckets[reqs[i].id]; b != nil {
+			level = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+		}
+		if level < 1 {
+			retry := time.Duration(math.Ceil((1 - level) / rate * float64(time.Second)))
+			return nil, &reqs[i], retry
+		}
+		levels[i] = level
+	}
+	return levels, nil, 0
+}
+
+/**
+ * consumeLocked 从每个桶消耗一个令牌，必须在checkLocked通过后调用（调用方需持有mu）
+ * @param {string} tokenKey 发起请求的token键
+ * @param {[]rateRequest} reqs 限流项
+ * @param {[]float64} levels checkLocked返回的各桶令牌数
+ * @param {time.Time} now 当前时间
+ */
+func (l *rateLimiter) consumeLocked(tokenKey string, reqs []rateRequest, levels []float64, now time.Time) {
+	for i := range reqs {
+		rate, capacity, _ := reqs[i].limit.Bucket()
+		b := l.buckets[reqs[i].id]
+		if b == nil {
+			b = &rateBucket{perToken: reqs[i].limit.KeyKind() == models.RateLimitByToken}
+			l.buckets[reqs[i].id] = b
+			if b.perToken {
+				l.holders[tokenKey] = append(l.holders[tokenKey], reqs[i].id)
+			}
+		}
+		b.tokens = levels[i] - 1
+		b.last = now
+		b.rate = rate
+		b.capacity = capacity
+	}
+	l.sweepLocked(now)
+}
+
+/**
+ * forget 释放token持有的按token限流的令牌桶，按用户或IP限流的桶不受影响
+ * @param {string} tokenKey token键
+ * @param {time.Time} now 当前时间，用于清理已回满的共享令牌桶
+ */
+func (l *rateLimiter) forget(tokenKey string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range l.holders[tokenKey] {
+		delete(l.buckets, id)
+	}
+	delete(l.holders, tokenKey)
+	l.sweepLocked(now)
+}
+
+/**
+ * sweepLocked 删除已回满到容量的共享令牌桶，每rateSweepInterval最多执行一次（调用方需持有mu）
+ * @param {time.Time} now 当前时间
+ */
+func (l *rateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.swept) < rateSweepInterval {
+		return
+	}
+	l.swept = now
+	for id, b := range l.buckets {
+		if !b.perToken && b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.capacity {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+/**
+ * size 获取当前令牌桶数量
+ * @returns {int} 令牌桶数量
+ */
+func (l *rateLimiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+/**
+ * rateBucketID 生成令牌桶ID
+ * @param {string} scope 限流范围前缀，如"g:<组ID>"
+ * @param {*models.RateLimit} limit 限流配置
+ * @param {string} key token键
+ * @param {*models.Token[T]} t token信息
+ * @param {string} clientIp 客户端IP地址
+ * @returns {string} 令牌桶ID
+ */
+func rateBucketID[T any](scope string, limit *models.RateLimit, key string, t *models.Token[T], clientIp string) string {
+	var b strings.Builder
+	b.WriteString(t.TenantID)
+	b.WriteByte('|')
+	b.WriteString(scope)
+	b.WriteByte('|')
+	switch limit.KeyKind() {
+	case models.RateLimitByToken:
+		b.WriteString("token:")
+		b.WriteString(key)
+	case models.RateLimitByIP:
+		b.WriteString("ip:")
+		b.WriteString(clientIp)
+	default:
+		b.WriteString("user:")
+		b.WriteString(strconv.FormatUint(uint64(t.UserID), 10))
+	}
+	return b.String()
+}
+
+/**
+ * RateLimiterSize 获取当前的令牌桶数量，用于监控限流状态是否及时释放
+ * @returns {int} 令牌桶数量
+ */
+func (tm *Manager[T]) RateLimiterSize() int {
+	return tm.limiter.size()
+}
@@ -0,0 +1,174 @@
+package redisstore
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+// DEFAULT_TIMEOUT 默认的连接和命令超时时间
+const DEFAULT_TIMEOUT = 5 * time.Second
+
+// DEFAULT_POOL_SIZE 默认保留的空闲连接数量
+const DEFAULT_POOL_SIZE = 8
+
+// Client 最小化的RESP客户端，带有空闲连接池，可以并发使用
+type Client struct {
+	// addr 服务器地址
+	addr string
+	// timeout 连接和每次请求的超时时间
+	timeout time.Duration
+	// mu 保护idle和closed
+	mu sync.Mutex
+	// idle 空闲连接
+	idle []*conn
+	// closed 客户端是否已关闭
+	closed bool
+}
+
+// conn 一条到服务器的连接
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+/**
+ * NewClient 创建RESP客户端，连接在第一次使用时建立
+ * @param {string} addr 服务器地址，如"127.0.0.1:6379"
+ * @param {time.Duration} timeout 连接和每次请求的超时时间，小于等于0时使用DEFAULT_TIMEOUT
+ * @returns {*Client} 客户端
+ */
+func NewClient(addr string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+	return &Client{addr: addr, timeout: timeout}
+}
+
+/**
+ * Do 执行一条命令
+ * @param {...string} args 命令和参数
+ * @returns {any, error} 回复（格式见readReply），服务器返回错误回复时作为Error类型的错误返回
+ */
+func (c *Client) Do(args ...string) (any, error) {
+	replies, err := c.Pipeline([][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(Error); ok {
+		return nil, e
+	}
+	return replies[0], nil
+}
+
+/**
+ * Pipeline 在同一条连接上一次发送多条命令，再依次读取回复
+ * 同一次调用中的命令按顺序执行，因此可以包含WATCH、MULTI和EXEC
+ * @param {[][]string} cmds 命令列表
+ * @returns {[]any, error} 每条命令的回复，错误回复以Error值的形式出现在对应位置
+ */
+func (c *Client) Pipeline(cmds [][]string) ([]any, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.pipeline(cmds, c.timeout)
+	if err != nil {
+		// 连接状态未知，不再复用
+		cn.nc.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+/**
+ * Close 关闭客户端和所有空闲连接，正在使用的连接用完后关闭
+ * @returns {error} 总是返回nil
+ */
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.nc.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// get 取出一条空闲连接，没有时新建
+func (c *Client) get() (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	nc, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+}
+
+// put 归还连接，连接池已满或客户端已关闭时关闭连接
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= DEFAULT_POOL_SIZE {
+		cn.nc.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// pipeline 发送多条命令并读取同样数量的回复
+func (cn *conn) pipeline(cmds [][]string, timeout time.Duration) ([]any, error) {
+	cn.nc.SetDeadline(time.Now().Add(timeout))
+	for _, args := range cmds {
+		if err := writeCommand(cn.w, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(cmds))
+	for i := range replies {
+		reply, err := readReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+/**
+ * session 在同一条连接上执行多次往返，WATCH等依赖连接状态的命令需要使用
+ * fn返回错误时连接被关闭，服务器会随之丢弃WATCH和事务状态
+ * @param {func(*conn) error} fn 使用连接的函数
+ * @returns {error} fn返回的错误或连接错误
+ */
+func (c *Client) session(fn func(cn *conn) error) error {
+	cn, err := c.get()
+	if err != nil {
+		return err
+	}
+	if err := fn(cn); err != nil {
+		cn.nc.Close()
+		return err
+	}
+	c.put(cn)
+	return nil
+}
@@ -0,0 +1,121 @@
+package redisstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error 服务器返回的错误回复，如"WRONGTYPE ..."
+type Error string
+
+// Error 实现error接口
+func (e Error) Error() string {
+	return string(e)
+}
+
+// errProtocol 回复不符合RESP协议
+var errProtocol = errors.New("RESP协议错误")
+
+// writeCommand 以RESP数组的形式写入一条命令
+func writeCommand(w *bufio.Writer, args []string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n", len(arg))
+		w.WriteString(arg)
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * readReply 读取一条回复
+ * 简单字符串和批量字符串返回string，整数返回int64，空批量字符串和空数组返回nil，
+ * 数组返回[]any，错误回复返回Error（作为值而不是错误，便于在事务结果中逐条检查）
+ * @param {*bufio.Reader} r 读取器
+ * @returns {any, error} 回复和读取错误
+ */
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errProtocol
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, errProtocol
+	}
+}
+
+// readLine 读取一行并去掉结尾的\r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// readCommand 读取客户端发送的命令（服务器端使用），只支持RESP数组形式
+func readCommand(r *bufio.Reader) ([]string, error) {
+	reply, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) == 0 {
+		return nil, errProtocol
+	}
+	args := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, errProtocol
+		}
+		args[i] = s
+	}
+	return args, nil
+}
@@ -0,0 +1,499 @@
+package redisstore
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server 进程内的RESP服务器，实现Store用到的命令子集，用于测试，不需要真实的Redis
+// 支持哈希、有序集合、键过期以及WATCH/MULTI/EXEC事务，数据只保存在内存中
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	// mu 保护以下所有字段，每条命令（包括整个EXEC）在锁内原子执行
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	zsets    map[string]map[string]float64
+	expires  map[string]time.Time
+	versions map[string]uint64
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// status 简单字符串回复，如"+OK"
+type status string
+
+// session 服务器端的连接状态
+type session struct {
+	watched map[string]uint64
+	multi   bool
+	queue   [][]string
+}
+
+/**
+ * NewServer 在127.0.0.1的随机端口上启动进程内RESP服务器
+ * @returns {*Server, error} 服务器和监听错误
+ */
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		hashes:   make(map[string]map[string]string),
+		zsets:    make(map[string]map[string]float64),
+		expires:  make(map[string]time.Time),
+		versions: make(map[string]uint64),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 服务器地址，传给NewClient
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close 关闭服务器和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+// serve 接受连接
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+// handle 处理一条连接上的所有命令
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	sess := &session{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		writeReply(w, s.dispatch(sess, args))
+		// 客户端流水线发送的命令都处理完后再发送
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dispatch 处理连接级别的命令（事务），其他命令交给exec
+func (s *Server) dispatch(sess *session, args []string) any {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "MULTI":
+		if sess.multi {
+			return Error("ERR MULTI calls can not be nested")
+		}
+		sess.multi = true
+		sess.queue = nil
+		return status("OK")
+	case "DISCARD":
+		if !sess.multi {
+			return Error("ERR DISCARD without MULTI")
+		}
+		sess.multi, sess.queue, sess.watched = false, nil, nil
+		return status("OK")
+	case "EXEC":
+		if !sess.multi {
+			return Error("ERR EXEC without MULTI")
+		}
+		queue, watched := sess.queue, sess.watched
+		sess.multi, sess.queue, sess.watched = false, nil, nil
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for key, v := range watched {
+			s.expireLocked(key)
+			if s.versions[key] != v {
+				return nil
+			}
+		}
+		results := make([]any, len(queue))
+		for i, cmd := range queue {
+			results[i] = s.execLocked(cmd)
+		}
+		return results
+	case "WATCH":
+		if sess.multi {
+			return Error("ERR WATCH inside MULTI is not allowed")
+		}
+		if sess.watched == nil {
+			sess.watched = make(map[string]uint64)
+		}
+		s.mu.Lock()
+		for _, key := range args[1:] {
+			s.expireLocked(key)
+			sess.watched[key] = s.versions[key]
+		}
+		s.mu.Unlock()
+		return status("OK")
+	case "UNWATCH":
+		sess.watched = nil
+		return status("OK")
+	}
+
+	if sess.multi {
+		if _, ok := commands[name]; !ok {
+			return Error("ERR unknown command '" + args[0] + "'")
+		}
+		sess.queue = append(sess.queue, args)
+		return status("QUEUED")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.execLocked(args)
+}
+
+// commands 支持的数据命令及其最少参数个数（包括命令名）
+var commands = map[string]int{
+	"PING": 1, "DEL": 2, "EXISTS": 2, "PEXPIREAT": 3, "PERSIST": 2, "PTTL": 2, "FLUSHALL": 1,
+	"HSET": 4, "HGETALL": 2, "HMGET": 3,
+	"ZADD": 4, "ZREM": 3, "ZRANGEBYSCORE": 4, "ZCOUNT": 4, "ZREMRANGEBYSCORE": 4,
+}
+
+// execLocked 执行一条数据命令（调用方需持有s.mu）
+func (s *Server) execLocked(args []string) any {
+	name := strings.ToUpper(args[0])
+	minArgs, ok := commands[name]
+	if !ok {
+		return Error("ERR unknown command '" + args[0] + "'")
+	}
+	if len(args) < minArgs {
+		return Error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+	}
+	key := ""
+	if len(args) > 1 {
+		key = args[1]
+		if name != "DEL" && name != "EXISTS" {
+			s.expireLocked(key)
+		}
+	}
+
+	switch name {
+	case "PING":
+		return status("PONG")
+	case "FLUSHALL":
+		for k := range s.hashes {
+			s.deleteLocked(k)
+		}
+		for k := range s.zsets {
+			s.deleteLocked(k)
+		}
+		return status("OK")
+	case "DEL", "EXISTS":
+		var n int64
+		for _, k := range args[1:] {
+			s.expireLocked(k)
+			if s.existsLocked(k) {
+				n++
+				if name == "DEL" {
+					s.deleteLocked(k)
+				}
+			}
+		}
+		return n
+	case "PEXPIREAT":
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return Error("ERR value is not an integer or out of range")
+		}
+		if !s.existsLocked(key) {
+			return int64(0)
+		}
+		s.expires[key] = time.UnixMilli(ms)
+		s.versions[key]++
+		s.expireLocked(key)
+		return int64(1)
+	case "PERSIST":
+		if _, ok := s.expires[key]; !ok {
+			return int64(0)
+		}
+		delete(s.expires, key)
+		s.versions[key]++
+		return int64(1)
+	case "PTTL":
+		if !s.existsLocked(key) {
+			return int64(-2)
+		}
+		at, ok := s.expires[key]
+		if !ok {
+			return int64(-1)
+		}
+		return time.Until(at).Milliseconds()
+	}
+
+	if strings.HasPrefix(name, "H") {
+		if _, ok := s.zsets[key]; ok {
+			return errWrongType
+		}
+		return s.hashLocked(name, key, args[2:])
+	}
+	if _, ok := s.hashes[key]; ok {
+		return errWrongType
+	}
+	return s.zsetLocked(name, key, args[2:])
+}
+
+// errWrongType 对错误类型的键执行命令
+const errWrongType = Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// hashLocked 执行哈希命令
+func (s *Server) hashLocked(name, key string, args []string) any {
+	h := s.hashes[key]
+	switch name {
+	case "HSET":
+		if len(args)%2 != 0 {
+			return Error("ERR wrong number of arguments for 'hset' command")
+		}
+		if h == nil {
+			h = make(map[string]string)
+			s.hashes[key] = h
+		}
+		var added int64
+		for i := 0; i < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				added++
+			}
+			h[args[i]] = args[i+1]
+		}
+		s.versions[key]++
+		return added
+	case "HGETALL":
+		fields := make([]string, 0, len(h))
+		for f := range h {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		items := make([]any, 0, len(h)*2)
+		for _, f := range fields {
+			items = append(items, f, h[f])
+		}
+		return items
+	default: // HMGET
+		items := make([]any, len(args))
+		for i, f := range args {
+			if v, ok := h[f]; ok {
+				items[i] = v
+			}
+		}
+		return items
+	}
+}
+
+// zsetLocked 执行有序集合命令
+func (s *Server) zsetLocked(name, key string, args []string) any {
+	z := s.zsets[key]
+	switch name {
+	case "ZADD":
+		if len(args)%2 != 0 {
+			return Error("ERR syntax error")
+		}
+		if z == nil {
+			z = make(map[string]float64)
+			s.zsets[key] = z
+		}
+		var added int64
+		for i := 0; i < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || math.IsNaN(score) {
+				return Error("ERR value is not a valid float")
+			}
+			if _, ok := z[args[i+1]]; !ok {
+				added++
+			}
+			z[args[i+1]] = score
+		}
+		s.versions[key]++
+		return added
+	case "ZREM":
+		var removed int64
+		for _, m := range args {
+			if _, ok := z[m]; ok {
+				delete(z, m)
+				removed++
+			}
+		}
+		if removed > 0 {
+			s.versions[key]++
+			if len(z) == 0 {
+				delete(s.zsets, key)
+			}
+		}
+		return removed
+	}
+
+	// ZRANGEBYSCORE、ZCOUNT、ZREMRANGEBYSCORE
+	min, err := parseBound(args[0])
+	if err != nil {
+		return err
+	}
+	max, err := parseBound(args[1])
+	if err != nil {
+		return err
+	}
+	members := make([]string, 0, len(z))
+	for m, score := range z {
+		if min.below(score) && max.above(score) {
+			members = append(members, m)
+		}
+	}
+	switch name {
+	case "ZCOUNT":
+		return int64(len(members))
+	case "ZREMRANGEBYSCORE":
+		for _, m := range members {
+			delete(z, m)
+		}
+		if len(members) > 0 {
+			s.versions[key]++
+			if len(z) == 0 {
+				delete(s.zsets, key)
+			}
+		}
+		return int64(len(members))
+	default: // ZRANGEBYSCORE
+		sort.Slice(members, func(i, j int) bool {
+			if z[members[i]] != z[members[j]] {
+				return z[members[i]] < z[members[j]]
+			}
+			return members[i] < members[j]
+		})
+		items := make([]any, len(members))
+		for i, m := range members {
+			items[i] = m
+		}
+		return items
+	}
+}
+
+// bound 分值范围的一端，exclusive表示以"("开头的开区间
+type bound struct {
+	value     float64
+	exclusive bool
+}
+
+// below 分值是否不小于下界
+func (b bound) below(score float64) bool {
+	if b.exclusive {
+		return score > b.value
+	}
+	return score >= b.value
+}
+
+// above 分值是否不大于上界
+func (b bound) above(score float64) bool {
+	if b.exclusive {
+		return score < b.value
+	}
+	return score <= b.value
+}
+
+// parseBound 解析分值范围，支持"-inf"、"+inf"和"("前缀
+func parseBound(arg string) (bound, error) {
+	var b bound
+	if strings.HasPrefix(arg, "(") {
+		b.exclusive = true
+		arg = arg[1:]
+	}
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(v) {
+		return b, Error("ERR min or max is not a float")
+	}
+	b.value = v
+	return b, nil
+}
+
+// existsLocked 键是否存在
+func (s *Server) existsLocked(key string) bool {
+	_, h := s.hashes[key]
+	_, z := s.zsets[key]
+	return h || z
+}
+
+// deleteLocked 删除键
+func (s *Server) deleteLocked(key string) {
+	delete(s.hashes, key)
+	delete(s.zsets, key)
+	delete(s.expires, key)
+	s.versions[key]++
+}
+
+// expireLocked 删除已到期的键
+func (s *Server) expireLocked(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		s.deleteLocked(key)
+	}
+}
+
+// writeReply 按RESP格式写入一条回复
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case Error:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unsupported reply %T\r\n", v)
+	}
+}
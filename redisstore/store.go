@@ -0,0 +1,418 @@
+// Package redisstore 提供基于RESP协议（Redis及兼容服务）的token存储，多个实例共用同一个Redis时可以共享登录状态
+//
+// 数据布局（prefix默认为"wt:"）：
+//
+//	{prefix}token:{key}              哈希，保存token的各个字段，过期时间由LoginTime和ExpireSeconds计算
+//	{prefix}tokens                   有序集合，所有token键，分值为过期时间（毫秒时间戳，永不过期为+inf）
+//	{prefix}user:{userID}:{tenant}   有序集合，用户的token键，分值同上
+//	{prefix}group:{groupID}:{tenant} 有序集合，用户组的token键，分值同上
+//
+// token由Redis按TTL自动删除后，索引中的键按分值过滤，并在之后的写入时清理。
+// 多个实例共享的只有token本身；管理器的统计信息和用户级别的共享数据仍保存在各个实例内，
+// 只反映实例启动时存储中的token和经由本实例的变更
+package redisstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// DEFAULT_PREFIX 默认的键前缀
+const DEFAULT_PREFIX = "wt:"
+
+// MAX_RETRIES 其他实例并发修改同一个token时，写操作的最大重试次数
+const MAX_RETRIES = 10
+
+// RANGE_BATCH_SIZE 遍历时每批读取的token数量
+const RANGE_BATCH_SIZE = 100
+
+// ErrConflict 其他实例持续修改同一个token，重试次数已用尽
+var ErrConflict = errors.New("并发修改冲突，重试次数已用尽")
+
+// Options 存储选项
+type Options[T any] struct {
+	// Prefix 所有键的前缀，多个应用共用一个Redis时用于区分，为空时使用DEFAULT_PREFIX
+	Prefix string
+	// Codec 用户数据的编解码器，为nil时使用JSON
+	Codec models.Codec[T]
+}
+
+// Store 基于RESP协议的token存储
+type Store[T any] struct {
+	client *Client
+	prefix string
+	codec  models.Codec[T]
+}
+
+/**
+ * New 创建基于RESP协议的token存储
+ * @param {*Client} client RESP客户端
+ * @param {Options[T]} opts 存储选项
+ * @returns {*Store[T]} token存储
+ */
+func New[T any](client *Client, opts Options[T]) *Store[T] {
+	if opts.Prefix == "" {
+		opts.Prefix = DEFAULT_PREFIX
+	}
+	if opts.Codec == nil {
+		opts.Codec = models.JSONCodec[T]{}
+	}
+	return &Store[T]{client: client, prefix: opts.Prefix, codec: opts.Codec}
+}
+
+// Get 获取token，每次返回新解码的对象
+func (s *Store[T]) Get(key string) (*models.Token[T], error) {
+	reply, err := s.client.Do("HGETALL", s.tokenKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(reply)
+}
+
+// Put 保存token，在同一个事务中替换哈希、设置过期时间并更新索引
+func (s *Store[T]) Put(key string, t *models.Token[T]) error {
+	fields, err := s.encode(t)
+	if err != nil {
+		return err
+	}
+	tk := s.tokenKey(key)
+	score := expireScore(t)
+	userIdx := s.userKey(t.TenantID, t.UserID)
+	groupIdx := s.groupKey(t.TenantID, t.GroupID)
+
+	return s.update(tk, func(old []any) [][]string {
+		cmds := s.unindexCmds(key, old)
+		cmds = append(cmds,
+			[]string{"DEL", tk},
+			append([]string{"HSET", tk}, fields...),
+		)
+		if t.ExpireSeconds != 0 {
+			cmds = append(cmds, []string{"PEXPIREAT", tk, score})
+		}
+		// 顺便清理索引中已经过期的键
+		expired := "(" + nowScore()
+		for _, idx := range []string{s.allKey(), userIdx, groupIdx} {
+			cmds = append(cmds,
+				[]string{"ZADD", idx, score, key},
+				[]string{"ZREMRANGEBYSCORE", idx, "-inf", expired},
+			)
+		}
+		return cmds
+	})
+}
+
+// Delete 删除token及其索引
+func (s *Store[T]) Delete(key string) error {
+	tk := s.tokenKey(key)
+	return s.update(tk, func(old []any) [][]string {
+		return append(s.unindexCmds(key, old), []string{"DEL", tk})
+	})
+}
+
+// Touch 更新最后访问时间，token不存在时不会创建
+func (s *Store[T]) Touch(key string, at time.Time) error {
+	tk := s.tokenKey(key)
+	return s.update(tk, func(old []any) [][]string {
+		if old[0] == nil {
+			return nil
+		}
+		return [][]string{{"HSET", tk, "access", at.Format(time.RFC3339Nano)}}
+	})
+}
+
+// Range 遍历所有未过期的token，分批读取
+func (s *Store[T]) Range(fn func(key string, t *models.Token[T]) bool) error {
+	keys, err := s.rangeIndex(s.allKey())
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += RANGE_BATCH_SIZE {
+		batch := keys[start:min(start+RANGE_BATCH_SIZE, len(keys))]
+		cmds := make([][]string, len(batch))
+		for i, key := range batch {
+			cmds[i] = []string{"HGETALL", s.tokenKey(key)}
+		}
+		replies, err := s.client.Pipeline(cmds)
+		if err != nil {
+			return err
+		}
+		for i, reply := range replies {
+			if e, ok := reply.(Error); ok {
+				return e
+			}
+			t, err := s.decode(reply)
+			if err != nil {
+				return err
+			}
+			// 读取期间已被删除或过期
+			if t == nil {
+				continue
+			}
+			if !fn(batch[i], t) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// KeysByUser 获取租户内指定用户的所有未过期token键
+func (s *Store[T]) KeysByUser(tenantID string, userID uint) ([]string, error) {
+	return s.rangeIndex(s.userKey(tenantID, userID))
+}
+
+// KeysByGroup 获取租户内指定用户组的所有未过期token键
+func (s *Store[T]) KeysByGroup(tenantID string, groupID uint) ([]string, error) {
+	return s.rangeIndex(s.groupKey(tenantID, groupID))
+}
+
+// Len 获取未过期的token数量
+func (s *Store[T]) Len() (int, error) {
+	reply, err := s.client.Do("ZCOUNT", s.allKey(), nowScore(), "+inf")
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("ZCOUNT: 意外的回复%T", reply)
+	}
+	return int(n), nil
+}
+
+/**
+ * update 用乐观锁修改一个token：WATCH后读取原有的租户、用户和用户组，再在事务中执行build生成的命令
+ * 其他实例在此期间修改了该token时重试
+ * @param {string} tk token哈希的键
+ * @param {func([]any) [][]string} build 根据原有字段（tenant、user、group，不存在时为nil）生成事务中的命令，返回空时不执行
+ * @returns {error} 执行错误
+ */
+func (s *Store[T]) update(tk string, build func(old []any) [][]string) error {
+	return s.client.session(func(cn *conn) error {
+		for attempt := 0; attempt < MAX_RETRIES; attempt++ {
+			replies, err := cn.pipeline([][]string{
+				{"WATCH", tk},
+				{"HMGET", tk, "tenant", "user", "group"},
+			}, s.client.timeout)
+			if err != nil {
+				return err
+			}
+			if err := replyError(replies); err != nil {
+				return err
+			}
+			old, ok := replies[1].([]any)
+			if !ok || len(old) != 3 {
+				return fmt.Errorf("HMGET: 意外的回复%T", replies[1])
+			}
+
+			cmds := build(old)
+			if len(cmds) == 0 {
+				_, err := cn.pipeline([][]string{{"UNWATCH"}}, s.client.timeout)
+				return err
+			}
+			cmds = append(append([][]string{{"MULTI"}}, cmds...), []string{"EXEC"})
+			if replies, err = cn.pipeline(cmds, s.client.timeout); err != nil {
+				return err
+			}
+			if err := replyError(replies); err != nil {
+				return err
+			}
+			result := replies[len(replies)-1]
+			if result == nil {
+				// WATCH的键已被修改，事务没有执行；随机等待（指数退避）后重试，避免多个实例同步冲突
+				time.Sleep(time.Duration(rand.Int64N(int64(time.Millisecond) << attempt)))
+				continue
+			}
+			if items, ok := result.([]any); ok {
+				return replyError(items)
+			}
+			return nil
+		}
+		return ErrConflict
+	})
+}
+
+// unindexCmds 生成从索引中移除token键的命令，old为token原有的tenant、user、group字段
+func (s *Store[T]) unindexCmds(key string, old []any) [][]string {
+	cmds := [][]string{{"ZREM", s.allKey(), key}}
+	tenant, _ := old[0].(string)
+	user, userOK := old[1].(string)
+	group, groupOK := old[2].(string)
+	if userOK {
+		cmds = append(cmds, []string{"ZREM", s.prefix + "user:" + user + ":" + tenant, key})
+	}
+	if groupOK {
+		cmds = append(cmds, []string{"ZREM", s.prefix + "group:" + group + ":" + tenant, key})
+	}
+	return cmds
+}
+
+// rangeIndex 获取索引中未过期的token键
+func (s *Store[T]) rangeIndex(idx string) ([]string, error) {
+	reply, err := s.client.Do("ZRANGEBYSCORE", idx, nowScore(), "+inf")
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("ZRANGEBYSCORE: 意外的回复%T", reply)
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		if key, ok := item.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// tokenKey token哈希的键
+func (s *Store[T]) tokenKey(key string) string {
+	return s.prefix + "token:" + key
+}
+
+// allKey 所有token键的索引
+func (s *Store[T]) allKey() string {
+	return s.prefix + "tokens"
+}
+
+// userKey 用户索引的键，用户ID在前，租户ID中包含冒号也不会与其他索引冲突
+func (s *Store[T]) userKey(tenantID string, userID uint) string {
+	return s.prefix + "user:" + strconv.FormatUint(uint64(userID), 10) + ":" + tenantID
+}
+
+// groupKey 用户组索引的键
+func (s *Store[T]) groupKey(tenantID string, groupID uint) string {
+	return s.prefix + "group:" + strconv.FormatUint(uint64(groupID), 10) + ":" + tenantID
+}
+
+/**
+ * encode 把token编码为哈希字段
+ * @param {*models.Token[T]} t token信息
+ * @returns {[]string, error} 字段名和值交替排列的列表，以及编码错误
+ */
+func (s *Store[T]) encode(t *models.Token[T]) ([]string, error) {
+	data, err := s.codec.Marshal(t.UserData)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{
+		"tenant", t.TenantID,
+		"user", strconv.FormatUint(uint64(t.UserID), 10),
+		"group", strconv.FormatUint(uint64(t.GroupID), 10),
+		"login", t.LoginTime.Format(time.RFC3339Nano),
+		"expire", strconv.FormatInt(t.ExpireSeconds, 10),
+		"access", t.LastAccessTime.Format(time.RFC3339Nano),
+		"ip", t.IP,
+		"version", strconv.FormatUint(t.Version, 10),
+		"data", string(data),
+	}
+	if t.Elevation != nil {
+		e, err := json.Marshal(t.Elevation)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, "elevation", string(e))
+	}
+	return fields, nil
+}
+
+/**
+ * decode 从HGETALL的回复解码token
+ * @param {any} reply HGETALL的回复
+ * @returns {*models.Token[T], error} token信息，哈希不存在时返回nil, nil
+ */
+func (s *Store[T]) decode(reply any) (*models.Token[T], error) {
+	items, ok := reply.([]any)
+	if !ok {
+		return nil, fmt.Errorf("HGETALL: 意外的回复%T", reply)
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	fields := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		k, _ := items[i].(string)
+		v, _ := items[i+1].(string)
+		fields[k] = v
+	}
+
+	t := &models.Token[T]{TenantID: fields["tenant"], IP: fields["ip"]}
+	var err error
+	parse := func(name string, fn func(v string) error) {
+		if err == nil {
+			if e := fn(fields[name]); e != nil {
+				err = fmt.Errorf("字段%s: %w", name, e)
+			}
+		}
+	}
+	parse("user", func(v string) error {
+		n, e := strconv.ParseUint(v, 10, 0)
+		t.UserID = uint(n)
+		return e
+	})
+	parse("group", func(v string) error {
+		n, e := strconv.ParseUint(v, 10, 0)
+		t.GroupID = uint(n)
+		return e
+	})
+	parse("login", func(v string) (e error) {
+		t.LoginTime, e = time.Parse(time.RFC3339Nano, v)
+		return
+	})
+	parse("expire", func(v string) (e error) {
+		t.ExpireSeconds, e = strconv.ParseInt(v, 10, 64)
+		return
+	})
+	parse("access", func(v string) (e error) {
+		t.LastAccessTime, e = time.Parse(time.RFC3339Nano, v)
+		return
+	})
+	parse("version", func(v string) (e error) {
+		t.Version, e = strconv.ParseUint(v, 10, 64)
+		return
+	})
+	parse("data", func(v string) (e error) {
+		t.UserData, e = s.codec.Unmarshal([]byte(v))
+		return
+	})
+	if v, ok := fields["elevation"]; ok {
+		parse("elevation", func(string) error {
+			t.Elevation = &models.Elevation{}
+			return json.Unmarshal([]byte(v), t.Elevation)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// expireScore token过期时间的分值，永不过期为+inf
+func expireScore[T any](t *models.Token[T]) string {
+	if t.ExpireSeconds == 0 {
+		return "+inf"
+	}
+	at := t.LoginTime.Add(time.Duration(t.ExpireSeconds) * time.Second)
+	return strconv.FormatInt(at.UnixMilli(), 10)
+}
+
+// nowScore 当前时间的分值
+func nowScore() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
+
+// replyError 返回回复列表中的第一个错误回复
+func replyError(replies []any) error {
+	for _, r := range replies {
+		if e, ok := r.(Error); ok {
+			return e
+		}
+	}
+	return nil
+}
@@ -1,13 +1,17 @@
 package wt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
+	"sync"
+
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -15,8 +19,10 @@ import (
  * SecurityManager 安全管理器
  */
 type SecurityManager struct {
-	key  []byte // 加密密钥
-	salt []byte // 盐值
+	mu       sync.RWMutex // 保护密钥轮换
+	key      []byte       // 加密密钥
+	salt     []byte       // 盐值
+	previous [][]byte     // 轮换前的密钥，用于读取还没有重新加密的文件，最多MAX_PREVIOUS_KEYS个
 }
 
 /**
@@ -57,9 +63,96 @@ func (sm *SecurityManager) RotateKey(newPassword string) {
 	// 生成新的密钥
 	newKey := pbkdf2.Key([]byte(newPassword), newSalt, 10000, 32, sha256.New)
 	
-	// 原子性更新密钥和盐值
+	// 原子性更新密钥和盐值，旧密钥保留在密钥环中，最多保留MAX_PREVIOUS_KEYS个
+	sm.mu.Lock()
+	sm.previous = append(sm.previous, sm.key)
+	if n := len(sm.previous) - MAX_PREVIOUS_KEYS; n > 0 {
+		sm.previous = append([][]byte(nil), sm.previous[n:]...)
+	}
 	sm.key = newKey
 	sm.salt = newSalt
+	sm.mu.Unlock()
+}
+
+/**
+ * RetirePreviousKeys 丢弃轮换前的密钥，此后只能读取使用当前密钥加密的文件
+ * 确认所有需要保留的快照都已用新密钥重新保存后调用，旧密钥不必等到超出MAX_PREVIOUS_KEYS才从内存中移除
+ */
+func (sm *SecurityManager) RetirePreviousKeys() {
+	sm.mu.Lock()
+	sm.previous = nil
+	sm.mu.Unlock()
+}
+
+/**
+ * KeyID 获取当前密钥的标识，用于判断加密文件使用的是哪个密钥，不会泄露密钥本身
+ * @returns {string} 十六进制的密钥标识
+ */
+func (sm *SecurityManager) KeyID() string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return hex.EncodeToString(keyID(sm.key))
+}
+
+/**
+ * Salt 获取当前密钥的盐值
+ * 重启后需要用相同的密码和盐值（NewSecurityManagerWithSalt）才能解密之前持久化的文件
+ * @returns {[]byte} 盐值副本
+ */
+func (sm *SecurityManager) Salt() []byte {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return append([]byte(nil), sm.salt...)
+}
+
+/**
+ * aead 创建当前密钥的AES-GCM实例
+ * @returns {cipher.AEAD, []byte, error} AES-GCM实例、密钥标识和错误
+ */
+func (sm *SecurityManager) aead() (cipher.AEAD, []byte, error) {
+	sm.mu.RLock()
+	key := sm.key
+	sm.mu.RUnlock()
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return gcm, keyID(key), nil
+}
+
+/**
+ * aeadFor 在当前密钥和轮换前的密钥中查找密钥标识对应的密钥，创建AES-GCM实例
+ * @param {[]byte} id 文件头中的密钥标识
+ * @returns {cipher.AEAD, bool, error} AES-GCM实例、是否找到和错误
+ */
+func (sm *SecurityManager) aeadFor(id []byte) (cipher.AEAD, bool, error) {
+	sm.mu.RLock()
+	keys := append([][]byte{sm.key}, sm.previous...)
+	sm.mu.RUnlock()
+
+	for _, key := range keys {
+		if bytes.Equal(keyID(key), id) {
+			gcm, err := newGCM(key)
+			return gcm, err == nil, err
+		}
+	}
+	return nil, false, nil
+}
+
+// newGCM 由密钥创建AES-GCM实例
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyID 由密钥计算密钥标识
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("wt-key-id:"), key...))
+	return sum[:KEY_ID_SIZE]
 }
 
 /**
@@ -68,12 +161,7 @@ func (sm *SecurityManager) RotateKey(newPassword string) {
  * @returns {string, error} 加密后的token和错误
  */
 func (sm *SecurityManager) EncryptToken(plaintext string) (string, error) {
-	block, err := aes.NewCipher(sm.key)
-	if err != nil {
-		return "", err
-	}
-
-	gcm, err := cipher.NewGCM(block)
+	gcm, _, err := sm.aead()
 	if err != nil {
 		return "", err
 	}
@@ -98,12 +186,7 @@ func (sm *SecurityManager) DecryptToken(ciphertext string) (string, error) {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(sm.key)
-	if err != nil {
-		return "", err
-	}
-
-	gcm, err := cipher.NewGCM(block)
+	gcm, _, err := sm.aead()
 	if err != nil {
 		return "", err
 	}
@@ -128,7 +211,9 @@ func (sm *SecurityManager) DecryptToken(ciphertext string) (string, error) {
  * @returns {string} 哈希值
  */
 func (sm *SecurityManager) HashSensitiveData(data string) string {
+	sm.mu.RLock()
 	hash := sha256.Sum256([]byte(data + string(sm.key)))
+	sm.mu.RUnlock()
 	return base64.URLEncoding.EncodeToString(hash[:])
 }
 
@@ -0,0 +1,113 @@
+package wt
+
+import (
+	"errors"
+
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+// userKey 用户级别状态的键，同一用户ID在不同租户下视为不同用户
+type userKey struct {
+	tenant string
+	user   uint
+}
+
+// userState 用户级别的状态，随用户的第一个token创建，最后一个token删除时释放
+type userState[T any] struct {
+	// tokens 该用户当前的token数量
+	tokens int
+	// data 用户的所有token共享的数据，如偏好设置、购物车
+	data T
+}
+
+/**
+ * attachUserLocked 登记token所属的用户（调用方需持有写锁）
+ * @param {*models.Token[T]} t token信息
+ */
+func (tm *Manager[T]) attachUserLocked(t *models.Token[T]) {
+	k := userKey{t.TenantID, t.UserID}
+	u := tm.users[k]
+	if u == nil {
+		u = &userState[T]{}
+		tm.users[k] = u
+	}
+	u.tokens++
+}
+
+/**
+ * detachUserLocked 注销token所属的用户，用户没有其他token时释放共享数据（调用方需持有写锁）
+ * @param {*models.Token[T]} t token信息
+ */
+func (tm *Manager[T]) detachUserLocked(t *models.Token[T]) {
+	k := userKey{t.TenantID, t.UserID}
+	if u := tm.users[k]; u != nil {
+		u.tokens--
+		if u.tokens <= 0 {
+			delete(tm.users, k)
+		}
+	}
+}
+
+/**
+ * GetSharedData 获取默认租户下用户的共享数据，同一用户的所有token共享这份数据
+ * @param {uint} userID 用户ID
+ * @returns {T, error} 共享数据和错误信息，用户没有任何token时返回错误
+ */
+func (tm *Manager[T]) GetSharedData(userID uint) (T, error) {
+	return tm.getSharedData(DEFAULT_TENANT, userID)
+}
+
+/**
+ * UpdateSharedData 在管理器锁内修改默认租户下用户的共享数据
+ * mutator收到的是共享数据的副本，返回错误时副本被丢弃；执行期间持有写锁，不能在其中调用管理器的其他方法
+ * @param {uint} userID 用户ID
+ * @param {func(*T) error} mutator 修改函数
+ * @returns {error} 操作结果错误信息，用户没有任何token时返回错误，mutator返回的错误原样返回
+ */
+func (tm *Manager[T]) UpdateSharedData(userID uint, mutator func(data *T) error) error {
+	return tm.updateSharedData(DEFAULT_TENANT, userID, mutator)
+}
+
+// getSharedData 获取指定租户下用户的共享数据
+func (tm *Manager[T]) getSharedData(tenantID string, userID uint) (T, error) {
+	var zero T
+	if userID == 0 {
+		return zero, errors.New(getErrorMessage(tm.config.Language, "user_invalid"))
+	}
+	tm.rLock()
+	defer tm.rUnlock()
+	u := tm.users[userKey{tenantID, userID}]
+	if u == nil {
+		return zero, errors.New(getErrorMessage(tm.config.Language, "not_login"))
+	}
+	return utility.DeepCopy(u.data), nil
+}
+
+// updateSharedData 修改指定租户下用户的共享数据
+func (tm *Manager[T]) updateSharedData(tenantID string, userID uint, mutator func(data *T) error) error {
+	if userID == 0 {
+		return errors.New(getErrorMessage(tm.config.Language, "user_invalid"))
+	}
+	if mutator == nil {
+		return errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+	tm.lock()
+	defer tm.unlock()
+	k := userKey{tenantID, userID}
+	u := tm.users[k]
+	if u == nil {
+		return errors.New(getErrorMessage(tm.config.Language, "not_login"))
+	}
+	data := utility.DeepCopy(u.data)
+	if err := mutator(&data); err != nil {
+		return err
+	}
+	// 已打开预写日志时先写入日志，写入失败时共享数据保持不变
+	if err := tm.journalSharedLocked(k, data); err != nil {
+		return err
+	}
+	u.data = data
+	tm.compactIfNeededLocked()
+	return nil
+}
@@ -0,0 +1,496 @@
+package wt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+// 快照文件的错误，可以用errors.Is判断具体原因
+var (
+	// ErrSnapshotCorrupt 快照文件被截断、校验和不匹配或内容无法解析
+	ErrSnapshotCorrupt = errors.New("快照文件已损坏")
+	// ErrSnapshotVersion 快照文件的格式版本不受支持，通常由更新版本的程序写入
+	ErrSnapshotVersion = errors.New("不支持的快照格式版本")
+)
+
+// 快照文件格式：
+//
+//	magic(4) | version(2) | flags(2) | bodyLen(8) | body(bodyLen) | sha256(32)
+//
+// 整数均为大端序，校验和覆盖之前的所有字节。flags包含fileFlagEncrypted时，body为
+// keyID(KEY_ID_SIZE) | nonce | AES-GCM密文，附加认证数据为文件头和keyID
+const (
+	// snapshotMagic 快照文件头标识
+	snapshotMagic = "WTSN"
+	// snapshotVersion 当前的快照格式版本
+	snapshotVersion = 1
+	// snapshotHeaderSize 文件头长度
+	snapshotHeaderSize = 4 + 2 + 2 + 8
+)
+
+// snapshotBody 快照内容
+type snapshotBody struct {
+	CreatedAt       time.Time                    `json:"createdAt"`
+	Groups          map[string][]models.GroupRaw `json:"groups"`
+	TenantMaxTokens map[string]int               `json:"tenantMaxTokens,omitempty"`
+	Stats           models.Stats                 `json:"stats"`
+	Tokens          []tokenRecord                `json:"tokens"`
+	SharedData      []sharedRecord               `json:"sharedData,omitempty"`
+	// FoldedJournal 压缩时合并的预写日志标识
+	FoldedJournal string `json:"foldedJournal,omitempty"`
+	// FoldedRecords 合并了该日志的前多少条记录，较早版本写入的快照没有该字段，表示合并了全部记录
+	FoldedRecords *uint64 `json:"foldedRecords,omitempty"`
+}
+
+/**
+ * SaveSnapshot 把token、用户组、用户的共享数据和统计信息保存到快照文件
+ * 先写入临时文件并同步到磁盘再重命名，写入中途失败时原有的快照文件保持不变
+ * @param {string} path 快照文件路径
+ * @returns {error} 编码或写入错误
+ */
+func (tm *Manager[T]) SaveSnapshot(path string) error {
+	tm.rLock()
+	data, err := tm.encodeSnapshotLocked(nil)
+	tm.rUnlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+/**
+ * LoadSnapshot 从快照文件恢复token、用户组、用户的共享数据和统计信息，替换管理器中的现有内容
+ * 已过期的token不会被加载；文件损坏时返回ErrSnapshotCorrupt，管理器保持不变
+ * 已打开日志时，加载的内容会立即压缩为日志目录中的新快照
+ * @param {string} path 快照文件路径
+ * @returns {error} 读取或解析错误
+ */
+func (tm *Manager[T]) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tm.lock()
+	defer tm.unlock()
+	state, err := tm.decodeSnapshotLocked(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := tm.restoreLocked(state); err != nil {
+		return err
+	}
+	if tm.journal != nil {
+		return tm.compactLocked()
+	}
+	return nil
+}
+
+/**
+ * StartAutosave 启动后台任务，定期保存快照
+ * @param {string} path 快照文件路径
+ * @param {time.Duration} interval 保存间隔
+ * @param {func(error)} onError 保存失败时的回调，可以为nil
+ * @returns {func()} 停止后台任务的函数，停止前会再保存一次，可以重复调用
+ */
+func (tm *Manager[T]) StartAutosave(path string, interval time.Duration, onError func(err error)) func() {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	save := func() {
+		if err := tm.SaveSnapshot(path); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				save()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			save()
+		})
+	}
+}
+
+/**
+ * snapshotBodyLocked 收集快照内容（调用方需持有锁）
+ * @param {*journal} folded 压缩时合并的预写日志，其他情况为nil
+ * @returns {snapshotBody, error} 快照内容和编码错误
+ */
+func (tm *Manager[T]) snapshotBodyLocked(folded *journal) (snapshotBody, error) {
+	body := snapshotBody{
+		CreatedAt:       time.Now(),
+		Groups:          make(map[string][]models.GroupRaw, len(tm.groupRaws)),
+		TenantMaxTokens: make(map[string]int, len(tm.tenantMaxTokens)),
+		Stats:           tm.stats,
+		Tokens:          make([]tokenRecord, 0, tm.stats.TotalTokens),
+	}
+	if folded != nil {
+		records := folded.seq
+		body.FoldedJournal = folded.id()
+		body.FoldedRecords = &records
+	}
+	for tenantID, raws := range tm.groupRaws {
+		groups := make([]models.GroupRaw, 0, len(raws))
+		for _, raw := range raws {
+			groups = append(groups, raw)
+		}
+		sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+		body.Groups[tenantID] = groups
+	}
+	for tenantID, max := range tm.tenantMaxTokens {
+		body.TenantMaxTokens[tenantID] = max
+	}
+
+	var encodeErr error
+	err := tm.store.Range(func(key string, t *models.Token[T]) bool {
+		if t == nil {
+			return true
+		}
+		r, err := tm.encodeTokenRecord(key, t)
+		if err != nil {
+			encodeErr = err
+			return false
+		}
+		body.Tokens = append(body.Tokens, r)
+		return true
+	})
+	if err != nil {
+		return body, tm.storeError(err)
+	}
+	if encodeErr != nil {
+		return body, encodeErr
+	}
+	sort.Slice(body.Tokens, func(i, j int) bool { return body.Tokens[i].Key < body.Tokens[j].Key })
+
+	body.SharedData = make([]sharedRecord, 0, len(tm.users))
+	for k, u := range tm.users {
+		r, err := tm.encodeSharedRecord(k, u.data)
+		if err != nil {
+			return body, err
+		}
+		body.SharedData = append(body.SharedData, r)
+	}
+	sort.Slice(body.SharedData, func(i, j int) bool {
+		a, b := body.SharedData[i], body.SharedData[j]
+		if a.TenantID != b.TenantID {
+			return a.TenantID < b.TenantID
+		}
+		return a.UserID < b.UserID
+	})
+	return body, nil
+}
+
+/**
+ * encodeSnapshotLocked 生成完整的快照文件内容（调用方需持有锁）
+ * @param {*journal} folded 压缩时合并的预写日志，其他情况为nil
+ * @returns {[]byte, error} 快照文件内容和编码错误
+ */
+func (tm *Manager[T]) encodeSnapshotLocked(folded *journal) ([]byte, error) {
+	body, err := tm.snapshotBodyLocked(folded)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	aead, keyID, err := tm.sealerLocked()
+	if err != nil {
+		return nil, err
+	}
+	return encodeSnapshotFile(data, aead, keyID)
+}
+
+/**
+ * decodeSnapshotLocked 校验并解析快照文件内容（调用方需持有锁，用户数据使用当前的编解码器）
+ * @param {[]byte} data 快照文件内容
+ * @returns {*persistedState[T], error} 解析出的状态，文件损坏时返回ErrSnapshotCorrupt
+ */
+func (tm *Manager[T]) decodeSnapshotLocked(data []byte) (*persistedState[T], error) {
+	flags, raw, err := decodeSnapshotFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if flags&fileFlagEncrypted != 0 {
+		if raw, err = tm.openSnapshotBodyLocked(data[:snapshotHeaderSize], raw); err != nil {
+			return nil, err
+		}
+	}
+	var body snapshotBody
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+
+	state := newPersistedState[T]()
+	state.expired = body.Stats.ExpiredTokens
+	state.foldedJournal = body.FoldedJournal
+	state.foldedRecords = body.FoldedRecords
+	for tenantID, groups := range body.Groups {
+		for _, g := range groups {
+			if err := tm.validateGroup(g); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+			}
+			state.setGroup(tenantID, g)
+		}
+	}
+	for tenantID, max := range body.TenantMaxTokens {
+		state.tenantMax[tenantID] = max
+	}
+	for _, r := range body.Tokens {
+		t, err := tm.decodeTokenRecord(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		state.tokens[r.Key] = t
+	}
+	for _, r := range body.SharedData {
+		k, data, err := tm.decodeSharedRecord(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		state.shared[k] = data
+	}
+	return state, nil
+}
+
+/**
+ * restoreLocked 用持久化的状态替换管理器中的用户组和token（调用方需持有写锁）
+ * 先构建并验证新的用户组、读取现有的token，出错时管理器和存储都保持不变；存储支持事务时token的替换在一个事务中完成，
+ * 写入存储成功后才整体替换内存中的状态。保留下来的token的限流状态不受影响，状态中没有共享数据的用户保留现有的共享数据。恢复过程本身不写入日志，也不通知变更
+ * @param {*persistedState[T]} state 持久化的状态
+ * @returns {error} 验证或存储错误
+ */
+func (tm *Manager[T]) restoreLocked(state *persistedState[T]) error {
+	groups := map[string]map[uint]*models.Group{DEFAULT_TENANT: {}}
+	groupRaws := make(map[string]map[uint]models.GroupRaw, len(state.groups))
+	for tenantID, raws := range state.groups {
+		for _, raw := range raws {
+			if err := tm.validateGroup(raw); err != nil {
+				return err
+			}
+			if groups[tenantID] == nil {
+				groups[tenantID] = make(map[uint]*models.Group)
+			}
+			groups[tenantID][raw.ID] = tm.convGroup(raw)
+			if groupRaws[tenantID] == nil {
+				groupRaws[tenantID] = make(map[uint]models.GroupRaw)
+			}
+			groupRaws[tenantID][raw.ID] = utility.DeepCopy(raw)
+		}
+	}
+	existing, err := tm.tokensWhereLocked(nil)
+	if err != nil {
+		return err
+	}
+	tokens := make(map[string]*models.Token[T], len(state.tokens))
+	skipped := 0
+	for key, t := range state.tokens {
+		if t.IsExpired() {
+			skipped++
+			continue
+		}
+		tokens[key] = t
+	}
+
+	// 存储保存用户组时先写入新的用户组再删除多余的，中途失败时存储中的用户组只多不少
+	if tm.groupStore != nil {
+		for tenantID, raws := range groupRaws {
+			for _, raw := range raws {
+				if err := tm.groupStore.PutGroup(tenantID, raw); err != nil {
+					return tm.storeError(err)
+				}
+			}
+		}
+		for tenantID, raws := range tm.groupRaws {
+			for groupID := range raws {
+				if _, ok := groupRaws[tenantID][groupID]; ok {
+					continue
+				}
+				if err := tm.groupStore.DeleteGroup(tenantID, groupID); err != nil {
+					return tm.storeError(err)
+				}
+			}
+		}
+	}
+	// 先写入再删除，存储不支持事务时写入失败也不会删除任何现有的token
+	err = tm.storeTxLocked(func() error {
+		for key, t := range tokens {
+			if err := tm.store.Put(key, t); err != nil {
+				return tm.storeError(err)
+			}
+		}
+		for key := range existing {
+			if _, ok := tokens[key]; ok {
+				continue
+			}
+			if err := tm.store.Delete(key); err != nil {
+				return tm.storeError(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key := range existing {
+		if _, ok := tokens[key]; !ok {
+			tm.limiter.forget(key, tm.now())
+		}
+	}
+	users := make(map[userKey]*userState[T], len(tm.users))
+	for _, t := range tokens {
+		k := userKey{t.TenantID, t.UserID}
+		u := users[k]
+		if u == nil {
+			u = &userState[T]{}
+			// 快照和日志中没有该用户的共享数据时（如较早版本写入的快照）保留现有的共享数据
+			if data, ok := state.shared[k]; ok {
+				u.data = data
+			} else if old := tm.users[k]; old != nil {
+				u.data = old.data
+			}
+			users[k] = u
+		}
+		u.tokens++
+	}
+	tm.users = users
+	tm.groups = groups
+	tm.groupRaws = groupRaws
+	tm.tenantMaxTokens = make(map[string]int, len(state.tenantMax))
+	for tenantID, max := range state.tenantMax {
+		tm.tenantMaxTokens[tenantID] = max
+	}
+	tm.stats = models.Stats{
+		TotalTokens:    len(tokens),
+		ActiveTokens:   len(tokens),
+		ExpiredTokens:  state.expired + skipped,
+		LastUpdateTime: time.Now(),
+	}
+	return nil
+}
+
+/**
+ * openSnapshotBodyLocked 解密快照内容（调用方需持有锁）
+ * @param {[]byte} header 快照文件头
+ * @param {[]byte} body 加密的快照内容
+ * @returns {[]byte, error} 快照内容，密钥不一致时返回ErrEncryptionKey
+ */
+func (tm *Manager[T]) openSnapshotBodyLocked(header, body []byte) ([]byte, error) {
+	if len(body) < KEY_ID_SIZE {
+		return nil, fmt.Errorf("%w: 缺少密钥标识", ErrSnapshotCorrupt)
+	}
+	keyID := body[:KEY_ID_SIZE]
+	aead, err := tm.openerLocked(keyID)
+	if err != nil {
+		return nil, err
+	}
+	rest := body[KEY_ID_SIZE:]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: 密文长度不足", ErrSnapshotCorrupt)
+	}
+	ad := append(append([]byte(nil), header...), keyID...)
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 解密失败: %v", ErrSnapshotCorrupt, err)
+	}
+	return plain, nil
+}
+
+/**
+ * encodeSnapshotFile 为快照内容加上文件头和校验和，aead不为nil时加密快照内容
+ * @param {[]byte} body 快照内容
+ * @param {cipher.AEAD} aead AES-GCM实例，为nil时不加密
+ * @param {[]byte} keyID 密钥标识
+ * @returns {[]byte, error} 快照文件内容和错误
+ */
+func encodeSnapshotFile(body []byte, aead cipher.AEAD, keyID []byte) ([]byte, error) {
+	var flags uint16
+	bodyLen := len(body)
+	if aead != nil {
+		flags |= fileFlagEncrypted
+		bodyLen = KEY_ID_SIZE + aead.NonceSize() + len(body) + aead.Overhead()
+	}
+	header := make([]byte, snapshotHeaderSize)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[4:6], snapshotVersion)
+	binary.BigEndian.PutUint16(header[6:8], flags)
+	binary.BigEndian.PutUint64(header[8:16], uint64(bodyLen))
+
+	buf := make([]byte, 0, snapshotHeaderSize+bodyLen+sha256.Size)
+	buf = append(buf, header...)
+	if aead == nil {
+		buf = append(buf, body...)
+	} else {
+		// 每次写入都使用新的随机nonce
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		buf = append(buf, keyID...)
+		buf = append(buf, nonce...)
+		buf = aead.Seal(buf, nonce, body, append(header, keyID...))
+	}
+	sum := sha256.Sum256(buf)
+	return append(buf, sum[:]...), nil
+}
+
+/**
+ * decodeSnapshotFile 校验快照文件的格式和校验和
+ * @param {[]byte} data 快照文件内容
+ * @returns {uint16, []byte, error} 文件头标志、快照内容（加密时为密文）和错误
+ */
+func decodeSnapshotFile(data []byte) (uint16, []byte, error) {
+	if len(data) < snapshotHeaderSize+sha256.Size {
+		return 0, nil, fmt.Errorf("%w: 文件长度不足", ErrSnapshotCorrupt)
+	}
+	if string(data[:4]) != snapshotMagic {
+		return 0, nil, fmt.Errorf("%w: 文件头标识错误", ErrSnapshotCorrupt)
+	}
+	if v := binary.BigEndian.Uint16(data[4:6]); v != snapshotVersion {
+		return 0, nil, fmt.Errorf("%w: %d", ErrSnapshotVersion, v)
+	}
+	bodyLen := binary.BigEndian.Uint64(data[8:16])
+	if bodyLen != uint64(len(data)-snapshotHeaderSize-sha256.Size) {
+		return 0, nil, fmt.Errorf("%w: 文件长度与记录的长度不一致", ErrSnapshotCorrupt)
+	}
+	end := len(data) - sha256.Size
+	sum := sha256.Sum256(data[:end])
+	if !bytes.Equal(sum[:], data[end:]) {
+		return 0, nil, fmt.Errorf("%w: 校验和不匹配", ErrSnapshotCorrupt)
+	}
+	flags := binary.BigEndian.Uint16(data[6:8])
+	if flags&^fileFlagEncrypted != 0 {
+		return 0, nil, fmt.Errorf("%w: 未知的文件头标志%#x", ErrSnapshotVersion, flags)
+	}
+	return flags, data[snapshotHeaderSize:end], nil
+}
@@ -0,0 +1,63 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * dbError 把驱动返回的错误转换为*models.DBError，已转换的错误原样返回
+ * @param {string} key 无法识别具体原因时使用的错误键，对应执行的操作（db_query、db_insert等）
+ * @param {error} err 驱动返回的错误
+ * @returns {error} 转换后的错误
+ */
+func (s *Store[T]) dbError(key string, err error) error {
+	var dbErr *models.DBError
+	if errors.As(err, &dbErr) {
+		return err
+	}
+	key = classify(key, err)
+	return &models.DBError{Key: key, Message: wt.GetErrorMessage(s.language, key), Err: err}
+}
+
+/**
+ * classify 识别驱动错误的原因，先按标准错误判断，再按常见驱动（SQLite、MySQL、PostgreSQL）的错误信息判断
+ * @param {string} key 无法识别时使用的错误键
+ * @param {error} err 驱动返回的错误
+ * @returns {string} 错误键
+ */
+func classify(key string, err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "db_query_not_found"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "db_timeout"
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), netErr != nil:
+		return "db_connect"
+	case errors.Is(err, sql.ErrTxDone):
+		return "db_transaction"
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "deadlock"):
+		return "db_deadlock"
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "timed out"), strings.Contains(msg, "database is locked"):
+		return "db_timeout"
+	case strings.Contains(msg, "unique"), strings.Contains(msg, "duplicate"):
+		return "db_duplicate"
+	case strings.Contains(msg, "foreign key"):
+		return "db_foreign_key"
+	case strings.Contains(msg, "connection refused"), strings.Contains(msg, "bad connection"), strings.Contains(msg, "connection reset"):
+		return "db_connect"
+	}
+	return key
+}
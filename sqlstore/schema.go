@@ -0,0 +1,152 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migration 一次数据库结构变更，按版本号顺序执行，每个版本只执行一次
+type migration struct {
+	version    int64
+	statements []string
+}
+
+/**
+ * migrations 所有数据库结构变更，表名中的{p}替换为表名前缀
+ * 已发布的变更不能修改，新的结构变更追加新的版本
+ */
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE {p}tokens (
+				token_key VARCHAR(255) NOT NULL PRIMARY KEY,
+				tenant_id VARCHAR(255) NOT NULL,
+				user_id BIGINT NOT NULL,
+				group_id BIGINT NOT NULL,
+				login_time BIGINT NOT NULL,
+				expire_seconds BIGINT NOT NULL,
+				expires_at BIGINT,
+				last_access BIGINT NOT NULL,
+				ip VARCHAR(64) NOT NULL,
+				version BIGINT NOT NULL,
+				elevation TEXT,
+				user_data TEXT NOT NULL
+			)`,
+			`CREATE INDEX {p}tokens_user ON {p}tokens (tenant_id, user_id)`,
+			`CREATE INDEX {p}tokens_group ON {p}tokens (tenant_id, group_id)`,
+			`CREATE INDEX {p}tokens_expires ON {p}tokens (expires_at)`,
+			`CREATE TABLE {p}groups (
+				tenant_id VARCHAR(255) NOT NULL,
+				group_id BIGINT NOT NULL,
+				config TEXT NOT NULL,
+				PRIMARY KEY (tenant_id, group_id)
+			)`,
+		},
+	},
+}
+
+/**
+ * migrate 创建版本表并执行尚未执行的结构变更，每个版本在一个事务中执行
+ * 事务先插入版本记录再执行结构变更，多个实例同时启动时只有一个实例能插入成功，
+ * 其他实例因主键冲突失败（支持行锁的数据库中等待先插入的事务结束），确认该版本已执行后继续。
+ * 不支持事务性DDL的数据库（如MySQL）中途失败时，需要手动清理后重新执行
+ * @returns {error} 执行错误
+ */
+func (s *Store[T]) migrate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, s.sql(`CREATE TABLE IF NOT EXISTS {p}schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`)); err != nil {
+		return s.dbError("db_query", err)
+	}
+
+	applied := make(map[int64]bool)
+	rows, err := s.db.QueryContext(ctx, s.sql(`SELECT version FROM {p}schema_migrations`))
+	if err != nil {
+		return s.dbError("db_query", err)
+	}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return s.dbError("db_query", err)
+		}
+		applied[v] = true
+	}
+	if err := rows.Close(); err != nil {
+		return s.dbError("db_query", err)
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		err := s.withTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, s.sql(`INSERT INTO {p}schema_migrations (version, applied_at) VALUES (?, ?)`),
+				m.version, time.Now().UnixMilli())
+			if err != nil {
+				return s.dbError("db_insert", err)
+			}
+			for _, stmt := range m.statements {
+				if _, err := tx.ExecContext(ctx, s.sql(stmt)); err != nil {
+					return s.dbError("db_query", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			// 其他实例同时执行并已提交了该版本
+			if done, cerr := s.migrationApplied(ctx, m.version); cerr == nil && done {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationApplied 检查结构变更的版本是否已经执行
+func (s *Store[T]) migrationApplied(ctx context.Context, version int64) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, s.sql(`SELECT COUNT(*) FROM {p}schema_migrations WHERE version = ?`), version).Scan(&n)
+	if err != nil {
+		return false, s.dbError("db_query", err)
+	}
+	return n > 0, nil
+}
+
+/**
+ * sql 替换语句中的表名前缀，并把?占位符转换为驱动使用的格式
+ * 语句中不包含字符串常量，所有的?都是占位符
+ * @param {string} query 语句
+ * @returns {string} 转换后的语句
+ */
+func (s *Store[T]) sql(query string) string {
+	query = strings.ReplaceAll(query, "{p}", s.prefix)
+	if s.placeholder == nil {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(s.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// DollarPlaceholder PostgreSQL风格的占位符$1、$2……
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
@@ -0,0 +1,1016 @@
+// Package sqlfake 提供用于测试的内存数据库驱动，不需要cgo或外部数据库即可测试sqlstore
+//
+// 只支持sqlstore使用的SQL子集：
+//
+//	CREATE TABLE [IF NOT EXISTS] t (col type [PRIMARY KEY], ..., [PRIMARY KEY (cols)])
+//	CREATE [UNIQUE] INDEX [IF NOT EXISTS] name ON t (cols)
+//	INSERT INTO t (cols) VALUES (exprs)
+//	SELECT cols | COUNT(*) FROM t [WHERE conds] [ORDER BY cols] [LIMIT n]
+//	UPDATE t SET col = expr, ... [WHERE conds]
+//	DELETE FROM t [WHERE conds]
+//
+// 条件只支持用AND连接的col = expr、col < expr、col > expr和col IS [NOT] NULL，
+// 参数占位符可以是?或$n。事务之间串行执行，回滚时恢复到事务开始时的数据
+package sqlfake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DB 内存数据库，同一个DB打开的多个*sql.DB共享数据
+type DB struct {
+	// lock 串行执行语句和事务，事务持有它直到提交或回滚
+	lock sync.Mutex
+	// tables 所有数据表
+	tables map[string]*table
+	// indexes 所有索引名到表名的映射
+	indexes map[string]string
+
+	// mu 保护failures、counts和after
+	mu       sync.Mutex
+	failures []error
+	counts   map[string]int
+	after    func(query string)
+}
+
+// table 数据表，rows中的每一行与columns一一对应
+type table struct {
+	columns []string
+	primary []int
+	rows    [][]driver.Value
+}
+
+/**
+ * New 创建空的内存数据库
+ * @returns {*DB} 内存数据库
+ */
+func New() *DB {
+	return &DB{
+		tables:  make(map[string]*table),
+		indexes: make(map[string]string),
+		counts:  make(map[string]int),
+	}
+}
+
+// Open 创建使用该内存数据库的*sql.DB
+func (d *DB) Open() *sql.DB {
+	return sql.OpenDB(connector{d})
+}
+
+// FailNext 让接下来执行的语句依次返回指定的错误，用于模拟驱动错误
+func (d *DB) FailNext(errs ...error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures = append(d.failures, errs...)
+}
+
+// AfterStatement 设置每条语句执行后调用的函数，用于控制并发测试中语句的执行顺序
+// 事务外的语句调用时已经释放数据库锁；事务中的语句调用时事务仍持有锁，在其中阻塞会阻塞其他所有语句
+func (d *DB) AfterStatement(fn func(query string)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.after = fn
+}
+
+// Count 获取已成功执行的指定类型语句（SELECT、INSERT、UPDATE、DELETE、CREATE）的数量
+func (d *DB) Count(verb string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counts[strings.ToUpper(verb)]
+}
+
+// Indexes 获取表上的所有索引名，已排序
+func (d *DB) Indexes(tableName string) []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var names []string
+	for name, t := range d.indexes {
+		if t == tableName {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// nextFailure 取出下一个模拟的错误
+func (d *DB) nextFailure() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.failures) == 0 {
+		return nil
+	}
+	err := d.failures[0]
+	d.failures = d.failures[1:]
+	return err
+}
+
+// count 记录一条成功执行的语句
+func (d *DB) count(verb string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts[verb]++
+}
+
+// snapshot 复制所有数据，用于事务回滚（调用方需持有lock）
+func (d *DB) snapshot() (map[string]*table, map[string]string) {
+	tables := make(map[string]*table, len(d.tables))
+	for name, t := range d.tables {
+		c := &table{columns: t.columns, primary: t.primary, rows: make([][]driver.Value, len(t.rows))}
+		for i, row := range t.rows {
+			c.rows[i] = slices.Clone(row)
+		}
+		tables[name] = c
+	}
+	indexes := make(map[string]string, len(d.indexes))
+	for k, v := range d.indexes {
+		indexes[k] = v
+	}
+	return tables, indexes
+}
+
+// connector 实现driver.Connector
+type connector struct {
+	db *DB
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{db: c.db}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// fakeDriver 只能通过connector使用
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("sqlfake: 请使用DB.Open")
+}
+
+// conn 一个连接，tx不为nil时处于事务中
+type conn struct {
+	db *DB
+	tx *tx
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	st, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, st: st, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	if c.tx != nil {
+		c.tx.Rollback()
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("sqlfake: 不支持嵌套事务")
+	}
+	c.db.lock.Lock()
+	tables, indexes := c.db.snapshot()
+	c.tx = &tx{conn: c, tables: tables, indexes: indexes}
+	return c.tx, nil
+}
+
+// tx 事务，保存开始时的数据以便回滚
+type tx struct {
+	conn    *conn
+	tables  map[string]*table
+	indexes map[string]string
+}
+
+func (t *tx) Commit() error {
+	if t.conn.tx != t {
+		return sql.ErrTxDone
+	}
+	t.conn.tx = nil
+	t.conn.db.lock.Unlock()
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	if t.conn.tx != t {
+		return sql.ErrTxDone
+	}
+	t.conn.db.tables, t.conn.db.indexes = t.tables, t.indexes
+	t.conn.tx = nil
+	t.conn.db.lock.Unlock()
+	return nil
+}
+
+// stmt 解析后的语句
+type stmt struct {
+	conn  *conn
+	st    *statement
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	n, _, err := s.run(args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, rows, err := s.run(args)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &resultRows{}
+	}
+	return rows, nil
+}
+
+// run 执行语句，事务外的语句单独持有锁
+func (s *stmt) run(args []driver.Value) (int64, *resultRows, error) {
+	db := s.conn.db
+	if err := db.nextFailure(); err != nil {
+		return 0, nil, err
+	}
+	n, rows, err := s.exec(args)
+	db.mu.Lock()
+	after := db.after
+	db.mu.Unlock()
+	if after != nil {
+		after(s.query)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	db.count(s.st.verb)
+	return n, rows, nil
+}
+
+// exec 持有锁执行语句，事务中的语句使用事务已持有的锁
+func (s *stmt) exec(args []driver.Value) (int64, *resultRows, error) {
+	db := s.conn.db
+	if s.conn.tx == nil {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+	}
+	return s.st.exec(db, args)
+}
+
+// resultRows 查询结果，执行时已全部复制
+type resultRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *resultRows) Columns() []string {
+	return r.columns
+}
+
+func (r *resultRows) Close() error {
+	return nil
+}
+
+func (r *resultRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+// expr 表达式：参数、常量或NULL
+type expr struct {
+	param int
+	value driver.Value
+}
+
+// eval 计算表达式的值
+func (e expr) eval(args []driver.Value) (driver.Value, error) {
+	if e.param == 0 {
+		return e.value, nil
+	}
+	if e.param > len(args) {
+		return nil, fmt.Errorf("sqlfake: 缺少第%d个参数", e.param)
+	}
+	return args[e.param-1], nil
+}
+
+// cond 条件，op为=、<、>、IS NULL或IS NOT NULL
+type cond struct {
+	column string
+	op     string
+	value  expr
+}
+
+// statement 解析后的语句
+type statement struct {
+	verb        string
+	table       string
+	ifNotExists bool
+	// CREATE TABLE
+	columns []string
+	primary []string
+	// CREATE INDEX
+	index string
+	// INSERT、UPDATE
+	values []expr
+	// SELECT
+	count   bool
+	orderBy []string
+	limit   int
+	where   []cond
+}
+
+/**
+ * exec 执行语句（调用方需持有lock）
+ * @param {*DB} db 数据库
+ * @param {[]driver.Value} args 参数
+ * @returns {int64, *resultRows, error} 影响的行数、查询结果和错误
+ */
+func (st *statement) exec(db *DB, args []driver.Value) (int64, *resultRows, error) {
+	if st.verb == "CREATE" {
+		return 0, nil, st.create(db)
+	}
+	t := db.tables[st.table]
+	if t == nil {
+		return 0, nil, fmt.Errorf("no such table: %s", st.table)
+	}
+	match, err := st.matcher(t, args)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch st.verb {
+	case "INSERT":
+		row := make([]driver.Value, len(t.columns))
+		for i, name := range st.columns {
+			c, err := t.column(name)
+			if err != nil {
+				return 0, nil, err
+			}
+			if row[c], err = st.values[i].eval(args); err != nil {
+				return 0, nil, err
+			}
+		}
+		if len(t.primary) > 0 {
+			key := primaryKey(t, row)
+			for _, r := range t.rows {
+				if primaryKey(t, r) == key {
+					return 0, nil, fmt.Errorf("UNIQUE constraint failed: %s", st.table)
+				}
+			}
+		}
+		t.rows = append(t.rows, row)
+		return 1, nil, nil
+
+	case "DELETE":
+		n := len(t.rows)
+		t.rows = slices.DeleteFunc(t.rows, match)
+		return int64(n - len(t.rows)), nil, nil
+
+	case "UPDATE":
+		var n int64
+		for _, row := range t.rows {
+			if !match(row) {
+				continue
+			}
+			for i, name := range st.columns {
+				c, err := t.column(name)
+				if err != nil {
+					return 0, nil, err
+				}
+				if row[c], err = st.values[i].eval(args); err != nil {
+					return 0, nil, err
+				}
+			}
+			n++
+		}
+		return n, nil, nil
+	}
+
+	// SELECT
+	var selected [][]driver.Value
+	for _, row := range t.rows {
+		if match(row) {
+			selected = append(selected, row)
+		}
+	}
+	if st.count {
+		return 0, &resultRows{columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{int64(len(selected))}}}, nil
+	}
+	if len(st.orderBy) > 0 {
+		order := make([]int, len(st.orderBy))
+		for i, name := range st.orderBy {
+			if order[i], err = t.column(name); err != nil {
+				return 0, nil, err
+			}
+		}
+		slices.SortStableFunc(selected, func(a, b []driver.Value) int {
+			for _, c := range order {
+				if r := compare(a[c], b[c]); r != 0 {
+					return r
+				}
+			}
+			return 0
+		})
+	}
+	if st.limit > 0 && len(selected) > st.limit {
+		selected = selected[:st.limit]
+	}
+	cols := make([]int, len(st.columns))
+	for i, name := range st.columns {
+		if cols[i], err = t.column(name); err != nil {
+			return 0, nil, err
+		}
+	}
+	result := &resultRows{columns: st.columns}
+	for _, row := range selected {
+		out := make([]driver.Value, len(cols))
+		for i, c := range cols {
+			out[i] = row[c]
+		}
+		result.rows = append(result.rows, out)
+	}
+	return 0, result, nil
+}
+
+// create 执行CREATE TABLE或CREATE INDEX（调用方需持有lock）
+func (st *statement) create(db *DB) error {
+	if st.index != "" {
+		if _, exists := db.indexes[st.index]; exists {
+			if st.ifNotExists {
+				return nil
+			}
+			return fmt.Errorf("index %s already exists", st.index)
+		}
+		t := db.tables[st.table]
+		if t == nil {
+			return fmt.Errorf("no such table: %s", st.table)
+		}
+		for _, name := range st.columns {
+			if _, err := t.column(name); err != nil {
+				return err
+			}
+		}
+		db.indexes[st.index] = st.table
+		return nil
+	}
+
+	if _, exists := db.tables[st.table]; exists {
+		if st.ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("table %s already exists", st.table)
+	}
+	t := &table{columns: st.columns}
+	for _, name := range st.primary {
+		c, err := t.column(name)
+		if err != nil {
+			return err
+		}
+		t.primary = append(t.primary, c)
+	}
+	db.tables[st.table] = t
+	return nil
+}
+
+// matcher 生成判断一行是否满足WHERE条件的函数
+func (st *statement) matcher(t *table, args []driver.Value) (func(row []driver.Value) bool, error) {
+	type bound struct {
+		column int
+		op     string
+		value  driver.Value
+	}
+	conds := make([]bound, len(st.where))
+	for i, c := range st.where {
+		col, err := t.column(c.column)
+		if err != nil {
+			return nil, err
+		}
+		v, err := c.value.eval(args)
+		if err != nil {
+			return nil, err
+		}
+		conds[i] = bound{col, c.op, v}
+	}
+	return func(row []driver.Value) bool {
+		for _, c := range conds {
+			v := row[c.column]
+			switch c.op {
+			case "IS NULL":
+				if v != nil {
+					return false
+				}
+			case "IS NOT NULL":
+				if v == nil {
+					return false
+				}
+			default:
+				// 与SQL相同，NULL与任何值比较都不成立
+				if v == nil || c.value == nil {
+					return false
+				}
+				r := compare(v, c.value)
+				if (c.op == "=" && r != 0) || (c.op == "<" && r >= 0) || (c.op == ">" && r <= 0) {
+					return false
+				}
+			}
+		}
+		return true
+	}, nil
+}
+
+// column 获取列的位置
+func (t *table) column(name string) (int, error) {
+	if i := slices.Index(t.columns, name); i >= 0 {
+		return i, nil
+	}
+	return 0, fmt.Errorf("no such column: %s", name)
+}
+
+// primaryKey 主键的字符串表示
+func primaryKey(t *table, row []driver.Value) string {
+	parts := make([]string, len(t.primary))
+	for i, c := range t.primary {
+		parts[i] = fmt.Sprintf("%T:%v", row[c], row[c])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// compare 比较两个值，NULL最小，整数和浮点数按数值比较，其他按字符串比较
+func compare(a, b driver.Value) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(text(a), text(b))
+}
+
+// number 把整数和浮点数转换为float64
+func number(v driver.Value) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// text 把值转换为字符串
+func text(v driver.Value) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return fmt.Sprint(v)
+}
+
+// parser 语句解析器
+type parser struct {
+	tokens []string
+	pos    int
+	params int
+}
+
+/**
+ * parse 解析语句
+ * @param {string} query 语句
+ * @returns {*statement, error} 解析后的语句和语法错误
+ */
+func parse(query string) (*statement, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	st := &statement{verb: strings.ToUpper(p.next())}
+	switch st.verb {
+	case "CREATE":
+		err = p.parseCreate(st)
+	case "INSERT":
+		err = p.parseInsert(st)
+	case "SELECT":
+		err = p.parseSelect(st)
+	case "UPDATE":
+		err = p.parseUpdate(st)
+	case "DELETE":
+		err = p.parseDelete(st)
+	default:
+		err = fmt.Errorf("sqlfake: 不支持的语句%q", st.verb)
+	}
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("sqlfake: 语句末尾有多余的内容%q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, query)
+	}
+	return st, nil
+}
+
+// tokenize 把语句拆分为标识符、数字、字符串、参数和符号
+func tokenize(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			end := strings.IndexByte(query[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("sqlfake: 字符串没有结束")
+			}
+			tokens = append(tokens, query[i:i+end+2])
+			i += end + 2
+		case strings.IndexByte("(),=<>*?", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case c == '$' || c == '_' || c == '-' || isAlnum(c):
+			j := i + 1
+			for j < len(query) && (query[j] == '_' || isAlnum(query[j])) {
+				j++
+			}
+			tokens = append(tokens, query[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("sqlfake: 无法识别的字符%q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// isAlnum 是否为字母或数字
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// next 取出下一个单词，没有时返回空字符串
+func (p *parser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// peek 查看下一个单词是否为指定的关键字（不区分大小写），是则取出
+func (p *parser) peek(keyword string) bool {
+	if p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect 取出指定的关键字序列
+func (p *parser) expect(keywords ...string) error {
+	for _, k := range keywords {
+		if !p.peek(k) {
+			return fmt.Errorf("sqlfake: 缺少%s", k)
+		}
+	}
+	return nil
+}
+
+// ident 取出一个标识符
+func (p *parser) ident() (string, error) {
+	name := p.next()
+	if name == "" || !(name[0] == '_' || isAlnum(name[0])) {
+		return "", fmt.Errorf("sqlfake: 缺少标识符，得到%q", name)
+	}
+	return name, nil
+}
+
+// identList 取出括号中用逗号分隔的标识符
+func (p *parser) identList() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if p.peek(")") {
+			return names, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// expr 取出一个表达式：参数、数字、字符串或NULL
+func (p *parser) expr() (expr, error) {
+	tok := p.next()
+	switch {
+	case tok == "?":
+		p.params++
+		return expr{param: p.params}, nil
+	case strings.HasPrefix(tok, "$"):
+		n, err := strconv.Atoi(tok[1:])
+		if err != nil || n < 1 {
+			return expr{}, fmt.Errorf("sqlfake: 无效的参数%q", tok)
+		}
+		return expr{param: n}, nil
+	case strings.EqualFold(tok, "NULL"):
+		return expr{}, nil
+	case strings.HasPrefix(tok, "'"):
+		return expr{value: tok[1 : len(tok)-1]}, nil
+	}
+	n, err := strconv.ParseInt(tok, 10, 64)
+	if err != nil {
+		return expr{}, fmt.Errorf("sqlfake: 无效的表达式%q", tok)
+	}
+	return expr{value: n}, nil
+}
+
+// ifNotExists 解析可选的IF NOT EXISTS
+func (p *parser) ifNotExists() (bool, error) {
+	if !p.peek("IF") {
+		return false, nil
+	}
+	return true, p.expect("NOT", "EXISTS")
+}
+
+func (p *parser) parseCreate(st *statement) error {
+	var err error
+	if p.peek("UNIQUE") || p.peek("INDEX") {
+		p.peek("INDEX")
+		if st.ifNotExists, err = p.ifNotExists(); err != nil {
+			return err
+		}
+		if st.index, err = p.ident(); err != nil {
+			return err
+		}
+		if err := p.expect("ON"); err != nil {
+			return err
+		}
+		if st.table, err = p.ident(); err != nil {
+			return err
+		}
+		st.columns, err = p.identList()
+		return err
+	}
+
+	if err := p.expect("TABLE"); err != nil {
+		return err
+	}
+	if st.ifNotExists, err = p.ifNotExists(); err != nil {
+		return err
+	}
+	if st.table, err = p.ident(); err != nil {
+		return err
+	}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for {
+		if p.peek("PRIMARY") {
+			if err := p.expect("KEY"); err != nil {
+				return err
+			}
+			if st.primary, err = p.identList(); err != nil {
+				return err
+			}
+		} else {
+			name, err := p.ident()
+			if err != nil {
+				return err
+			}
+			st.columns = append(st.columns, name)
+			// 跳过类型和约束，只识别PRIMARY KEY
+			depth := 0
+			for p.pos < len(p.tokens) {
+				tok := p.tokens[p.pos]
+				if depth == 0 && (tok == "," || tok == ")") {
+					break
+				}
+				switch {
+				case tok == "(":
+					depth++
+				case tok == ")":
+					depth--
+				case strings.EqualFold(tok, "PRIMARY"):
+					st.primary = []string{name}
+				}
+				p.pos++
+			}
+		}
+		if p.peek(")") {
+			return nil
+		}
+		if err := p.expect(","); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) parseInsert(st *statement) error {
+	var err error
+	if err := p.expect("INTO"); err != nil {
+		return err
+	}
+	if st.table, err = p.ident(); err != nil {
+		return err
+	}
+	if st.columns, err = p.identList(); err != nil {
+		return err
+	}
+	if err := p.expect("VALUES", "("); err != nil {
+		return err
+	}
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return err
+		}
+		st.values = append(st.values, e)
+		if p.peek(")") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return err
+		}
+	}
+	if len(st.values) != len(st.columns) {
+		return errors.New("sqlfake: 列和值的数量不一致")
+	}
+	return nil
+}
+
+func (p *parser) parseSelect(st *statement) error {
+	var err error
+	if p.peek("COUNT") {
+		if err := p.expect("(", "*", ")"); err != nil {
+			return err
+		}
+		st.count = true
+	} else {
+		for {
+			name, err := p.ident()
+			if err != nil {
+				return err
+			}
+			st.columns = append(st.columns, name)
+			if !p.peek(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect("FROM"); err != nil {
+		return err
+	}
+	if st.table, err = p.ident(); err != nil {
+		return err
+	}
+	if err := p.parseWhere(st); err != nil {
+		return err
+	}
+	if p.peek("ORDER") {
+		if err := p.expect("BY"); err != nil {
+			return err
+		}
+		for {
+			name, err := p.ident()
+			if err != nil {
+				return err
+			}
+			st.orderBy = append(st.orderBy, name)
+			if !p.peek(",") {
+				break
+			}
+		}
+	}
+	if p.peek("LIMIT") {
+		if st.limit, err = strconv.Atoi(p.next()); err != nil || st.limit < 1 {
+			return errors.New("sqlfake: 无效的LIMIT")
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseUpdate(st *statement) error {
+	var err error
+	if st.table, err = p.ident(); err != nil {
+		return err
+	}
+	if err := p.expect("SET"); err != nil {
+		return err
+	}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if err := p.expect("="); err != nil {
+			return err
+		}
+		e, err := p.expr()
+		if err != nil {
+			return err
+		}
+		st.columns = append(st.columns, name)
+		st.values = append(st.values, e)
+		if !p.peek(",") {
+			break
+		}
+	}
+	return p.parseWhere(st)
+}
+
+func (p *parser) parseDelete(st *statement) error {
+	var err error
+	if err := p.expect("FROM"); err != nil {
+		return err
+	}
+	if st.table, err = p.ident(); err != nil {
+		return err
+	}
+	return p.parseWhere(st)
+}
+
+// parseWhere 解析可选的WHERE条件
+func (p *parser) parseWhere(st *statement) error {
+	if !p.peek("WHERE") {
+		return nil
+	}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		c := cond{column: name}
+		switch {
+		case p.peek("IS"):
+			c.op = "IS NULL"
+			if p.peek("NOT") {
+				c.op = "IS NOT NULL"
+			}
+			if err := p.expect("NULL"); err != nil {
+				return err
+			}
+		case p.peek("="), p.peek("<"), p.peek(">"):
+			c.op = p.tokens[p.pos-1]
+			if c.value, err = p.expr(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("sqlfake: 不支持的条件%q", p.next())
+		}
+		st.where = append(st.where, c)
+		if !p.peek("AND") {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,575 @@
+// Package sqlstore 提供基于database/sql的token存储，多个实例共用同一个关系数据库时可以共享登录状态和用户组
+//
+// 数据表（前缀默认为"wt_"）：
+//
+//	{prefix}tokens             token的各个字段，按用户、用户组和过期时间建立索引
+//	{prefix}groups             用户组的原始配置，按租户和用户组ID保存
+//	{prefix}schema_migrations  已执行的结构变更版本，Open时自动执行尚未执行的变更
+//
+// 最后访问时间的更新先在内存中合并，按时间间隔或数量分批写入，Close时写入剩余的部分，
+// 因此每次鉴权不会产生一次数据库写入；进程异常退出时最多丢失一个间隔内的访问时间。
+// 驱动返回的错误转换为*models.DBError，Key为error_utils中的db_*错误键。
+// 与redisstore相同，管理器的统计信息和用户级别的共享数据仍保存在各个实例内
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+// DEFAULT_PREFIX 默认的表名前缀
+const DEFAULT_PREFIX = "wt_"
+
+// DEFAULT_TIMEOUT 默认的单次数据库操作超时时间
+const DEFAULT_TIMEOUT = 5 * time.Second
+
+// DEFAULT_FLUSH_INTERVAL 默认的访问时间写入间隔
+const DEFAULT_FLUSH_INTERVAL = time.Second
+
+// DEFAULT_MAX_PENDING_TOUCHES 默认的待写入访问时间数量上限，达到上限时立即写入
+const DEFAULT_MAX_PENDING_TOUCHES = 1000
+
+// RANGE_BATCH_SIZE 遍历时每批读取的token数量
+const RANGE_BATCH_SIZE = 500
+
+// tokenColumns tokens表的所有列，读写时按此顺序
+const tokenColumns = "token_key, tenant_id, user_id, group_id, login_time, expire_seconds, expires_at, last_access, ip, version, elevation, user_data"
+
+// Options 存储选项
+type Options[T any] struct {
+	// Prefix 表名前缀，为空时使用DEFAULT_PREFIX
+	Prefix string
+	// Placeholder 生成第n个（从1开始）参数的占位符，为nil时使用?；PostgreSQL使用DollarPlaceholder
+	Placeholder func(n int) string
+	// Codec 用户数据的编解码器，为nil时使用JSON
+	Codec models.Codec[T]
+	// Language 错误信息的语言，与管理器配置相同
+	Language string
+	// Timeout 单次数据库操作的超时时间，为0时使用DEFAULT_TIMEOUT
+	Timeout time.Duration
+	// FlushInterval 访问时间的写入间隔，为0时使用DEFAULT_FLUSH_INTERVAL，为负数时不在后台写入
+	FlushInterval time.Duration
+	// MaxPendingTouches 待写入访问时间的数量上限，为0时使用DEFAULT_MAX_PENDING_TOUCHES
+	MaxPendingTouches int
+	// OnError 后台写入访问时间失败时调用，可以为nil
+	OnError func(err error)
+}
+
+// Store 基于database/sql的token存储，同时实现了models.GroupStore
+type Store[T any] struct {
+	db          *sql.DB
+	prefix      string
+	placeholder func(n int) string
+	codec       models.Codec[T]
+	language    string
+	timeout     time.Duration
+	maxPending  int
+	onError     func(err error)
+
+	// mu 保护pending和flushing
+	mu sync.Mutex
+	// pending 尚未写入的访问时间
+	pending map[string]time.Time
+	// flushing 正在写入的访问时间，写入完成前读取token时仍然以它为准
+	flushing map[string]time.Time
+	// flushMu 保证同一时间只有一次写入
+	flushMu sync.Mutex
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+/**
+ * Open 创建基于database/sql的token存储，执行尚未执行的结构变更并启动访问时间的后台写入
+ * 使用完毕后调用Close写入剩余的访问时间，db由调用方关闭
+ * @param {*sql.DB} db 数据库连接
+ * @param {Options[T]} opts 存储选项
+ * @returns {*Store[T], error} token存储和结构变更错误
+ */
+func Open[T any](db *sql.DB, opts Options[T]) (*Store[T], error) {
+	if opts.Prefix == "" {
+		opts.Prefix = DEFAULT_PREFIX
+	}
+	if opts.Codec == nil {
+		opts.Codec = models.JSONCodec[T]{}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_TIMEOUT
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = DEFAULT_FLUSH_INTERVAL
+	}
+	if opts.MaxPendingTouches <= 0 {
+		opts.MaxPendingTouches = DEFAULT_MAX_PENDING_TOUCHES
+	}
+	s := &Store[T]{
+		db:          db,
+		prefix:      opts.Prefix,
+		placeholder: opts.Placeholder,
+		codec:       opts.Codec,
+		language:    opts.Language,
+		timeout:     opts.Timeout,
+		maxPending:  opts.MaxPendingTouches,
+		onError:     opts.OnError,
+		pending:     make(map[string]time.Time),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	if opts.FlushInterval > 0 {
+		go s.flushLoop(opts.FlushInterval)
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// Close 停止后台写入并写入剩余的访问时间，重复调用时不做任何操作
+func (s *Store[T]) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		err = s.Flush()
+	})
+	return err
+}
+
+// Get 获取token，合并尚未写入的访问时间
+func (s *Store[T]) Get(key string) (*models.Token[T], error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, s.sql(`SELECT `+tokenColumns+` FROM {p}tokens WHERE token_key = ?`), key)
+	_, t, err := s.scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, s.dbError("db_query", err)
+	}
+	s.mu.Lock()
+	s.applyPendingLocked(key, t)
+	s.mu.Unlock()
+	return t, nil
+}
+
+// Put 保存token，在同一个事务中删除旧行并插入新行
+func (s *Store[T]) Put(key string, t *models.Token[T]) error {
+	args, err := s.encode(key, t)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.sql(`DELETE FROM {p}tokens WHERE token_key = ?`), key); err != nil {
+			return s.dbError("db_insert", err)
+		}
+		if _, err := tx.ExecContext(ctx, s.sql(`INSERT INTO {p}tokens (`+tokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`), args...); err != nil {
+			return s.dbError("db_insert", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// 新保存的访问时间取代尚未写入的访问时间
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete 删除token，不存在时不返回错误
+func (s *Store[T]) Delete(key string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, s.sql(`DELETE FROM {p}tokens WHERE token_key = ?`), key); err != nil {
+		return s.dbError("db_delete", err)
+	}
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// Touch 记录最后访问时间，先在内存中合并，待写入的数量达到上限时立即写入
+func (s *Store[T]) Touch(key string, at time.Time) error {
+	s.mu.Lock()
+	if prev, ok := s.pending[key]; !ok || at.After(prev) {
+		s.pending[key] = at
+	}
+	full := len(s.pending) >= s.maxPending
+	s.mu.Unlock()
+	if full {
+		return s.Flush()
+	}
+	return nil
+}
+
+/**
+ * Flush 在一个事务中写入所有尚未写入的访问时间，只会把访问时间向后更新
+ * 写入失败时访问时间放回待写入列表，下次写入时重试
+ * @returns {error} 数据库错误
+ */
+func (s *Store[T]) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	if len(batch) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	s.pending = make(map[string]time.Time)
+	s.flushing = batch
+	s.mu.Unlock()
+
+	ctx, cancel := s.context()
+	defer cancel()
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, s.sql(`UPDATE {p}tokens SET last_access = ? WHERE token_key = ? AND last_access < ?`))
+		if err != nil {
+			return s.dbError("db_update", err)
+		}
+		defer stmt.Close()
+		for key, at := range batch {
+			n := unixNano(at)
+			if _, err := stmt.ExecContext(ctx, n, key, n); err != nil {
+				return s.dbError("db_update", err)
+			}
+		}
+		return nil
+	})
+
+	s.mu.Lock()
+	s.flushing = nil
+	if err != nil {
+		for key, at := range batch {
+			if prev, ok := s.pending[key]; !ok || at.After(prev) {
+				s.pending[key] = at
+			}
+		}
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// Range 遍历所有token，按键分批读取，调用fn时不占用数据库连接
+func (s *Store[T]) Range(fn func(key string, t *models.Token[T]) bool) error {
+	query := s.sql(`SELECT ` + tokenColumns + ` FROM {p}tokens WHERE token_key > ? ORDER BY token_key LIMIT ` + strconv.Itoa(RANGE_BATCH_SIZE))
+	after := ""
+	for {
+		keys, tokens, err := s.rangeBatch(query, after)
+		if err != nil {
+			return err
+		}
+		for i, t := range tokens {
+			if !fn(keys[i], t) {
+				return nil
+			}
+		}
+		if len(keys) < RANGE_BATCH_SIZE {
+			return nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// KeysByUser 获取租户内指定用户的所有token键
+func (s *Store[T]) KeysByUser(tenantID string, userID uint) ([]string, error) {
+	return s.queryKeys(`SELECT token_key FROM {p}tokens WHERE tenant_id = ? AND user_id = ?`, tenantID, int64(userID))
+}
+
+// KeysByGroup 获取租户内指定用户组的所有token键
+func (s *Store[T]) KeysByGroup(tenantID string, groupID uint) ([]string, error) {
+	return s.queryKeys(`SELECT token_key FROM {p}tokens WHERE tenant_id = ? AND group_id = ?`, tenantID, int64(groupID))
+}
+
+// Len 获取token数量
+func (s *Store[T]) Len() (int, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	var n int
+	if err := s.db.QueryRowContext(ctx, s.sql(`SELECT COUNT(*) FROM {p}tokens`)).Scan(&n); err != nil {
+		return 0, s.dbError("db_query", err)
+	}
+	return n, nil
+}
+
+/**
+ * PurgeExpired 按过期时间索引删除在指定时间之前过期的token，供不运行管理器的维护任务定期清理
+ * 管理器不知道这里删除的token，运行中的管理器应使用CleanExpiredTokens以保持统计信息一致
+ * @param {time.Time} now 当前时间
+ * @returns {int, error} 删除的数量和数据库错误
+ */
+func (s *Store[T]) PurgeExpired(now time.Time) (int, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, s.sql(`DELETE FROM {p}tokens WHERE expires_at < ?`), now.UnixMilli())
+	if err != nil {
+		return 0, s.dbError("db_delete", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, s.dbError("db_delete", err)
+	}
+	return int(n), nil
+}
+
+// PutGroup 保存用户组，在同一个事务中删除旧行并插入新行
+func (s *Store[T]) PutGroup(tenantID string, raw models.GroupRaw) error {
+	config, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.sql(`DELETE FROM {p}groups WHERE tenant_id = ? AND group_id = ?`), tenantID, int64(raw.ID)); err != nil {
+			return s.dbError("db_insert", err)
+		}
+		if _, err := tx.ExecContext(ctx, s.sql(`INSERT INTO {p}groups (tenant_id, group_id, config) VALUES (?, ?, ?)`), tenantID, int64(raw.ID), string(config)); err != nil {
+			return s.dbError("db_insert", err)
+		}
+		return nil
+	})
+}
+
+// DeleteGroup 删除用户组，不存在时不返回错误
+func (s *Store[T]) DeleteGroup(tenantID string, groupID uint) error {
+	ctx, cancel := s.context()
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, s.sql(`DELETE FROM {p}groups WHERE tenant_id = ? AND group_id = ?`), tenantID, int64(groupID)); err != nil {
+		return s.dbError("db_delete", err)
+	}
+	return nil
+}
+
+// Groups 获取所有租户保存的用户组
+func (s *Store[T]) Groups() (map[string][]models.GroupRaw, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, s.sql(`SELECT tenant_id, config FROM {p}groups ORDER BY tenant_id, group_id`))
+	if err != nil {
+		return nil, s.dbError("db_query", err)
+	}
+	defer rows.Close()
+	groups := make(map[string][]models.GroupRaw)
+	for rows.Next() {
+		var tenantID, config string
+		if err := rows.Scan(&tenantID, &config); err != nil {
+			return nil, s.dbError("db_query", err)
+		}
+		var raw models.GroupRaw
+		if err := json.Unmarshal([]byte(config), &raw); err != nil {
+			return nil, err
+		}
+		groups[tenantID] = append(groups[tenantID], raw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, s.dbError("db_query", err)
+	}
+	return groups, nil
+}
+
+// flushLoop 按间隔在后台写入访问时间，直到Close
+func (s *Store[T]) flushLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil && s.onError != nil {
+				s.onError(err)
+			}
+		}
+	}
+}
+
+// context 创建单次数据库操作的超时上下文
+func (s *Store[T]) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.timeout)
+}
+
+/**
+ * withTx 在事务中执行fn，fn返回错误时回滚
+ * @param {context.Context} ctx 上下文
+ * @param {func(*sql.Tx) error} fn 事务中的操作，返回的错误原样返回
+ * @returns {error} 执行错误
+ */
+func (s *Store[T]) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return s.dbError("db_transaction", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return s.dbError("db_transaction", err)
+	}
+	return nil
+}
+
+// rangeBatch 读取键大于after的一批token，读取完毕后才返回，以便释放连接
+func (s *Store[T]) rangeBatch(query, after string) ([]string, []*models.Token[T], error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, after)
+	if err != nil {
+		return nil, nil, s.dbError("db_query", err)
+	}
+	defer rows.Close()
+	var keys []string
+	var tokens []*models.Token[T]
+	for rows.Next() {
+		key, t, err := s.scanToken(rows)
+		if err != nil {
+			return nil, nil, s.dbError("db_query", err)
+		}
+		keys = append(keys, key)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, s.dbError("db_query", err)
+	}
+	s.mu.Lock()
+	for i, t := range tokens {
+		s.applyPendingLocked(keys[i], t)
+	}
+	s.mu.Unlock()
+	return keys, tokens, nil
+}
+
+// queryKeys 执行返回token键的查询
+func (s *Store[T]) queryKeys(query string, args ...any) ([]string, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, s.sql(query), args...)
+	if err != nil {
+		return nil, s.dbError("db_query", err)
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, s.dbError("db_query", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, s.dbError("db_query", err)
+	}
+	return keys, nil
+}
+
+// applyPendingLocked 用尚未写入的访问时间更新读取到的token（调用方需持有mu）
+func (s *Store[T]) applyPendingLocked(key string, t *models.Token[T]) {
+	for _, m := range []map[string]time.Time{s.flushing, s.pending} {
+		if at, ok := m[key]; ok && at.After(t.LastAccessTime) {
+			t.LastAccessTime = at
+		}
+	}
+}
+
+/**
+ * encode 把token编码为tokens表各列的值，顺序与tokenColumns相同
+ * 时间保存为纳秒时间戳，过期时间保存为毫秒时间戳（永不过期为NULL），用户数据保存为编解码结果的base64
+ * @param {string} key token键
+ * @param {*models.Token[T]} t token信息
+ * @returns {[]any, error} 各列的值和编码错误
+ */
+func (s *Store[T]) encode(key string, t *models.Token[T]) ([]any, error) {
+	data, err := s.codec.Marshal(t.UserData)
+	if err != nil {
+		return nil, err
+	}
+	var expiresAt, elevation any
+	if t.ExpireSeconds != 0 {
+		expiresAt = t.LoginTime.Add(time.Duration(t.ExpireSeconds) * time.Second).UnixMilli()
+	}
+	if t.Elevation != nil {
+		e, err := json.Marshal(t.Elevation)
+		if err != nil {
+			return nil, err
+		}
+		elevation = string(e)
+	}
+	return []any{
+		key, t.TenantID, int64(t.UserID), int64(t.GroupID),
+		unixNano(t.LoginTime), t.ExpireSeconds, expiresAt, unixNano(t.LastAccessTime),
+		t.IP, int64(t.Version), elevation, base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+/**
+ * scanToken 从查询结果的一行解码token，列的顺序与tokenColumns相同
+ * @param {interface{ Scan(...any) error }} row 查询结果
+ * @returns {string, *models.Token[T], error} token键、token信息和错误，没有结果时返回sql.ErrNoRows
+ */
+func (s *Store[T]) scanToken(row interface{ Scan(dest ...any) error }) (string, *models.Token[T], error) {
+	var (
+		key, data                               string
+		userID, groupID, login, access, version int64
+		expiresAt                               sql.NullInt64
+		elevation                               sql.NullString
+		t                                       = &models.Token[T]{}
+	)
+	err := row.Scan(&key, &t.TenantID, &userID, &groupID, &login, &t.ExpireSeconds, &expiresAt, &access, &t.IP, &version, &elevation, &data)
+	if err != nil {
+		return "", nil, err
+	}
+	t.UserID = uint(userID)
+	t.GroupID = uint(groupID)
+	t.LoginTime = fromUnixNano(login)
+	t.LastAccessTime = fromUnixNano(access)
+	t.Version = uint64(version)
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if t.UserData, err = s.codec.Unmarshal(raw); err != nil {
+		return "", nil, err
+	}
+	if elevation.Valid {
+		t.Elevation = &models.Elevation{}
+		if err := json.Unmarshal([]byte(elevation.String), t.Elevation); err != nil {
+			return "", nil, err
+		}
+	}
+	return key, t, nil
+}
+
+// unixNano 时间的纳秒时间戳，零值时间为0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano 从纳秒时间戳还原时间，0还原为零值时间
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -19,6 +19,27 @@ func (tm *Manager[T]) GetStats() models.Stats {
 	return statsCopy
 }
 
+// tenantStats 统计指定租户的token数量
+// 租户统计由当前token实时计算，ExpiredTokens为已过期但尚未清理的token数量
+func (tm *Manager[T]) tenantStats(tenantID string) models.Stats {
+	tm.rLock()
+	defer tm.rUnlock()
+	stats := models.Stats{LastUpdateTime: tm.stats.LastUpdateTime}
+	tm.store.Range(func(_ string, t *models.Token[T]) bool {
+		if t == nil || t.TenantID != tenantID {
+			return true
+		}
+		stats.TotalTokens++
+		if t.IsExpired() {
+			stats.ExpiredTokens++
+		} else {
+			stats.ActiveTokens++
+		}
+		return true
+	})
+	return stats
+}
+
 // updateStatsCount 更新token统计数量
 // count为正数时增加统计数，为负数时减少统计数
 // isExpired参数用于指定是否为过期token的统计
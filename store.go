@@ -0,0 +1,111 @@
+package wt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * storeError 包装token存储返回的错误，保留原始错误以便errors.Is/As判断
+ * @param {error} err 存储返回的错误
+ * @returns {error} 包装后的错误
+ */
+func (tm *Manager[T]) storeError(err error) error {
+	return fmt.Errorf("%s: %w", getErrorMessage(tm.config.Language, "internal"), err)
+}
+
+/**
+ * putTokenLocked 保存token，已打开预写日志时先写入日志（调用方需持有写锁）
+ * @param {string} key token键
+ * @param {*models.Token[T]} t token信息
+ * @returns {error} 日志或存储错误
+ */
+func (tm *Manager[T]) putTokenLocked(key string, t *models.Token[T]) error {
+	mark := tm.journalMarkLocked()
+	if err := tm.journalPutLocked(key, t); err != nil {
+		return err
+	}
+	if err := tm.store.Put(key, t); err != nil {
+		tm.rollbackJournalLocked(mark)
+		return tm.storeError(err)
+	}
+	tm.compactIfNeededLocked()
+	return nil
+}
+
+/**
+ * touchTokenLocked 更新token的最后访问时间（调用方需持有写锁）
+ * 访问时间只用于LRU淘汰，写入失败不影响调用结果
+ * @param {string} key token键
+ * @param {time.Time} at 访问时间
+ */
+func (tm *Manager[T]) touchTokenLocked(key string, at time.Time) {
+	tm.store.Touch(key, at)
+}
+
+/**
+ * tokensWhereLocked 收集满足条件的token（调用方需持有锁）
+ * @param {func(*models.Token[T]) bool} match 筛选条件，为nil表示所有token
+ * @returns {map[string]*models.Token[T], error} token键到token的映射和存储错误
+ */
+func (tm *Manager[T]) tokensWhereLocked(match func(t *models.Token[T]) bool) (map[string]*models.Token[T], error) {
+	result := make(map[string]*models.Token[T])
+	err := tm.store.Range(func(key string, t *models.Token[T]) bool {
+		if match == nil || (t != nil && match(t)) {
+			result[key] = t
+		}
+		return true
+	})
+	if err != nil {
+		return nil, tm.storeError(err)
+	}
+	return result, nil
+}
+
+/**
+ * tokensByKeysLocked 按键批量读取token，已不存在的键被忽略（调用方需持有锁）
+ * @param {[]string} keys token键列表
+ * @param {error} err 获取键列表时的错误，不为nil时直接返回
+ * @returns {map[string]*models.Token[T], error} token键到token的映射和存储错误
+ */
+func (tm *Manager[T]) tokensByKeysLocked(keys []string, err error) (map[string]*models.Token[T], error) {
+	if err != nil {
+		return nil, tm.storeError(err)
+	}
+	result := make(map[string]*models.Token[T], len(keys))
+	for _, key := range keys {
+		t, err := tm.store.Get(key)
+		if err != nil {
+			return nil, tm.storeError(err)
+		}
+		if t != nil {
+			result[key] = t
+		}
+	}
+	return result, nil
+}
+
+/**
+ * loadStoreLocked 根据存储中已有的token重建统计信息和用户级别的状态（调用方需持有写锁）
+ * @returns {error} 存储错误
+ */
+func (tm *Manager[T]) loadStoreLocked() error {
+	tokens, err := tm.tokensWhereLocked(nil)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t == nil {
+			continue
+		}
+		tm.attachUserLocked(t)
+		tm.stats.TotalTokens++
+		if !t.IsExpired() {
+			tm.stats.ActiveTokens++
+		}
+	}
+	tm.stats.LastUpdateTime = time.Now()
+	return nil
+}
@@ -0,0 +1,343 @@
+// Package storetest 提供token存储的一致性测试，所有models.TokenStore实现都必须通过
+//
+// 用法：
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) models.TokenStore[storetest.Data] {
+//			return NewMyStore[storetest.Data](t.TempDir())
+//		})
+//	}
+package storetest
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+// Data 一致性测试使用的用户数据，包含引用类型以检验序列化和复制
+type Data struct {
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags,omitempty"`
+	Prefs map[string]string `json:"prefs,omitempty"`
+}
+
+// Factory 为每个子测试创建一个空的存储
+type Factory func(t *testing.T) models.TokenStore[Data]
+
+/**
+ * Run 运行全部一致性测试
+ * @param {*testing.T} t 测试对象
+ * @param {Factory} newStore 存储工厂，每次调用都必须返回一个空的存储
+ */
+func Run(t *testing.T, newStore Factory) {
+	t.Run("GetMissing", func(t *testing.T) { testGetMissing(t, newStore(t)) })
+	t.Run("PutGet", func(t *testing.T) { testPutGet(t, newStore(t)) })
+	t.Run("Replace", func(t *testing.T) { testReplace(t, newStore(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStore(t)) })
+	t.Run("Touch", func(t *testing.T) { testTouch(t, newStore(t)) })
+	t.Run("Range", func(t *testing.T) { testRange(t, newStore(t)) })
+	t.Run("Indexes", func(t *testing.T) { testIndexes(t, newStore(t)) })
+	t.Run("ConcurrentReads", func(t *testing.T) { testConcurrentReads(t, newStore(t)) })
+	t.Run("Manager", func(t *testing.T) { testManager(t, newStore(t)) })
+}
+
+/**
+ * NewToken 创建测试用的token
+ * @param {string} tenantID 租户ID
+ * @param {uint} userID 用户ID
+ * @param {uint} groupID 用户组ID
+ * @returns {*models.Token[Data]} token
+ */
+func NewToken(tenantID string, userID uint, groupID uint) *models.Token[Data] {
+	now := time.Now().Truncate(time.Millisecond)
+	return &models.Token[Data]{
+		UserID:         userID,
+		GroupID:        groupID,
+		LoginTime:      now,
+		ExpireSeconds:  3600,
+		LastAccessTime: now,
+		UserData:       Data{Name: "user", Tags: []string{"a", "b"}, Prefs: map[string]string{"theme": "dark"}},
+		IP:             "10.0.0.1",
+		TenantID:       tenantID,
+		Version:        1,
+	}
+}
+
+/**
+ * Equal 比较两个token是否相同，时间按时刻比较（忽略时区和单调时钟）
+ * @param {*models.Token[Data]} a token
+ * @param {*models.Token[Data]} b token
+ * @returns {bool} 是否相同
+ */
+func Equal(a, b *models.Token[Data]) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.UserID != b.UserID || a.GroupID != b.GroupID || a.TenantID != b.TenantID || a.IP != b.IP ||
+		a.ExpireSeconds != b.ExpireSeconds || a.Version != b.Version ||
+		!a.LoginTime.Equal(b.LoginTime) || !a.LastAccessTime.Equal(b.LastAccessTime) {
+		return false
+	}
+	if a.UserData.Name != b.UserData.Name || !slices.Equal(a.UserData.Tags, b.UserData.Tags) || len(a.UserData.Prefs) != len(b.UserData.Prefs) {
+		return false
+	}
+	for k, v := range a.UserData.Prefs {
+		if b.UserData.Prefs[k] != v {
+			return false
+		}
+	}
+	if (a.Elevation == nil) != (b.Elevation == nil) {
+		return false
+	}
+	if a.Elevation != nil {
+		ea, eb := a.Elevation, b.Elevation
+		if ea.ID != eb.ID || ea.GroupID != eb.GroupID || ea.OriginalGroupID != eb.OriginalGroupID || ea.Reason != eb.Reason ||
+			!ea.StartedAt.Equal(eb.StartedAt) || !ea.ExpiresAt.Equal(eb.ExpiresAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// mustPut 保存token，出错时终止测试
+func mustPut(t *testing.T, s models.TokenStore[Data], key string, tok *models.Token[Data]) {
+	t.Helper()
+	if err := s.Put(key, tok); err != nil {
+		t.Fatalf("Put(%q) failed: %v", key, err)
+	}
+}
+
+// sortedKeys 获取排序后的键列表，出错时返回包含错误信息的列表，使后续比较失败并显示错误
+func sortedKeys(keys []string, err error) []string {
+	if err != nil {
+		return []string{"error: " + err.Error()}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func testGetMissing(t *testing.T, s models.TokenStore[Data]) {
+	tok, err := s.Get("missing")
+	if tok != nil || err != nil {
+		t.Errorf("Get(missing) = %v, %v; expected nil, nil", tok, err)
+	}
+	if n, err := s.Len(); n != 0 || err != nil {
+		t.Errorf("Len of empty store = %d, %v", n, err)
+	}
+}
+
+func testPutGet(t *testing.T, s models.TokenStore[Data]) {
+	tok := NewToken("", 1, 2)
+	tok.Elevation = &models.Elevation{
+		ID: "fp", UserID: 1, OriginalGroupID: 2, GroupID: 3, Reason: "test",
+		StartedAt: tok.LoginTime, ExpiresAt: tok.LoginTime.Add(time.Hour),
+	}
+	want := *tok
+	mustPut(t, s, "k1", tok)
+	got, err := s.Get("k1")
+	if err != nil || !Equal(got, &want) {
+		t.Fatalf("Get(k1) = %+v, %v; expected %+v", got, err, want)
+	}
+	if n, _ := s.Len(); n != 1 {
+		t.Errorf("Len = %d, expected 1", n)
+	}
+}
+
+func testReplace(t *testing.T, s models.TokenStore[Data]) {
+	mustPut(t, s, "k1", NewToken("", 1, 2))
+	moved := NewToken("", 5, 6)
+	moved.Version = 2
+	mustPut(t, s, "k1", moved)
+
+	if got, _ := s.Get("k1"); !Equal(got, moved) {
+		t.Errorf("Get after replace = %+v", got)
+	}
+	if keys := sortedKeys(s.KeysByUser("", 1)); len(keys) != 0 {
+		t.Errorf("old user index still contains %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByGroup("", 2)); len(keys) != 0 {
+		t.Errorf("old group index still contains %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByUser("", 5)); !slices.Equal(keys, []string{"k1"}) {
+		t.Errorf("KeysByUser(5) = %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByGroup("", 6)); !slices.Equal(keys, []string{"k1"}) {
+		t.Errorf("KeysByGroup(6) = %v", keys)
+	}
+	if n, _ := s.Len(); n != 1 {
+		t.Errorf("Len after replace = %d, expected 1", n)
+	}
+}
+
+func testDelete(t *testing.T, s models.TokenStore[Data]) {
+	mustPut(t, s, "k1", NewToken("", 1, 2))
+	mustPut(t, s, "k2", NewToken("", 1, 2))
+	if err := s.Delete("k1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Delete("k1"); err != nil {
+		t.Errorf("deleting a missing key should not fail: %v", err)
+	}
+	if tok, _ := s.Get("k1"); tok != nil {
+		t.Errorf("deleted token still readable")
+	}
+	if keys := sortedKeys(s.KeysByUser("", 1)); !slices.Equal(keys, []string{"k2"}) {
+		t.Errorf("KeysByUser after delete = %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByGroup("", 2)); !slices.Equal(keys, []string{"k2"}) {
+		t.Errorf("KeysByGroup after delete = %v", keys)
+	}
+	if n, _ := s.Len(); n != 1 {
+		t.Errorf("Len after delete = %d, expected 1", n)
+	}
+}
+
+func testTouch(t *testing.T, s models.TokenStore[Data]) {
+	tok := NewToken("", 1, 2)
+	mustPut(t, s, "k1", tok)
+	at := tok.LastAccessTime.Add(time.Minute)
+	if err := s.Touch("k1", at); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if err := s.Touch("missing", at); err != nil {
+		t.Errorf("touching a missing key should not fail: %v", err)
+	}
+	got, _ := s.Get("k1")
+	if got == nil || !got.LastAccessTime.Equal(at) {
+		t.Fatalf("LastAccessTime after Touch = %+v", got)
+	}
+	if got.Version != 1 || got.UserData.Name != "user" {
+		t.Errorf("Touch must only change LastAccessTime: %+v", got)
+	}
+	if tok, _ := s.Get("missing"); tok != nil {
+		t.Errorf("Touch must not create tokens")
+	}
+}
+
+func testRange(t *testing.T, s models.TokenStore[Data]) {
+	for _, key := range []string{"a", "b", "c"} {
+		mustPut(t, s, key, NewToken("", 1, 2))
+	}
+	var seen []string
+	if err := s.Range(func(key string, tok *models.Token[Data]) bool {
+		if tok == nil || tok.UserID != 1 {
+			t.Errorf("Range yielded %q => %+v", key, tok)
+		}
+		seen = append(seen, key)
+		return true
+	}); err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+	slices.Sort(seen)
+	if !slices.Equal(seen, []string{"a", "b", "c"}) {
+		t.Errorf("Range visited %v", seen)
+	}
+
+	visits := 0
+	s.Range(func(string, *models.Token[Data]) bool {
+		visits++
+		return false
+	})
+	if visits != 1 {
+		t.Errorf("Range should stop when fn returns false, visited %d", visits)
+	}
+}
+
+func testIndexes(t *testing.T, s models.TokenStore[Data]) {
+	mustPut(t, s, "a1", NewToken("", 1, 10))
+	mustPut(t, s, "a2", NewToken("", 1, 20))
+	mustPut(t, s, "b1", NewToken("", 2, 10))
+	mustPut(t, s, "t1", NewToken("acme", 1, 10))
+
+	if keys := sortedKeys(s.KeysByUser("", 1)); !slices.Equal(keys, []string{"a1", "a2"}) {
+		t.Errorf("KeysByUser(default, 1) = %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByGroup("", 10)); !slices.Equal(keys, []string{"a1", "b1"}) {
+		t.Errorf("KeysByGroup(default, 10) = %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByUser("acme", 1)); !slices.Equal(keys, []string{"t1"}) {
+		t.Errorf("KeysByUser(acme, 1) = %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByGroup("acme", 20)); len(keys) != 0 {
+		t.Errorf("KeysByGroup(acme, 20) = %v", keys)
+	}
+	if keys := sortedKeys(s.KeysByUser("", 99)); len(keys) != 0 {
+		t.Errorf("KeysByUser of unknown user = %v", keys)
+	}
+}
+
+func testConcurrentReads(t *testing.T, s models.TokenStore[Data]) {
+	for _, key := range []string{"a", "b", "c", "d"} {
+		mustPut(t, s, key, NewToken("", 1, 2))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if tok, err := s.Get("a"); err != nil || tok == nil {
+					t.Errorf("Get = %v, %v", tok, err)
+					return
+				}
+				s.Range(func(string, *models.Token[Data]) bool { return true })
+				s.KeysByUser("", 1)
+				s.KeysByGroup("", 2)
+				s.Len()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func testManager(t *testing.T, s models.TokenStore[Data]) {
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+	}
+	tm, err := wt.InitTMWithStore[Data](config, groups, s)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	a, err := tm.AddToken(1, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("AddToken failed: %v", err)
+	}
+	b, _ := tm.AddToken(1, 1, "10.0.0.2")
+	c, _ := tm.AddToken(2, 1, "10.0.0.3")
+	if err := tm.Auth(a, "10.0.0.1", "/api"); err != nil {
+		t.Errorf("Auth failed: %v", err)
+	}
+	if err := tm.SetUserData(a, Data{Name: "alice", Tags: []string{"x"}}); err != nil {
+		t.Fatalf("SetUserData failed: %v", err)
+	}
+	if tok, _ := s.Get(a); tok == nil || tok.UserData.Name != "alice" || tok.Version != 2 {
+		t.Errorf("SetUserData did not reach the store: %+v", tok)
+	}
+	if tokens := tm.GetTokensByUserID(1); len(tokens) != 2 {
+		t.Errorf("GetTokensByUserID = %d tokens, expected 2", len(tokens))
+	}
+
+	if err := tm.DelTokensByUserID(1); err != nil {
+		t.Fatalf("DelTokensByUserID failed: %v", err)
+	}
+	for _, key := range []string{a, b} {
+		if tok, _ := s.Get(key); tok != nil {
+			t.Errorf("token %q should be deleted from the store", key)
+		}
+	}
+	if err := tm.Auth(c, "10.0.0.3", "/api"); err != nil {
+		t.Errorf("other user's token should survive: %v", err)
+	}
+	if n, _ := s.Len(); n != 1 {
+		t.Errorf("store Len = %d, expected 1", n)
+	}
+	if stats := tm.GetStats(); stats.TotalTokens != 1 || stats.ActiveTokens != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
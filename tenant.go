@@ -0,0 +1,143 @@
+package wt
+
+import (
+	"github.com/windf17/wt/models"
+)
+
+// TenantManager 租户视图，所有操作只作用于同一个租户下的用户组和token
+// 不同租户的用户组ID和用户ID可以重复，互不影响
+type TenantManager[T any] struct {
+	tm *Manager[T]
+	id string
+}
+
+/**
+ * Tenant 获取指定租户的管理视图，租户无需预先创建
+ * @param {string} tenantID 租户ID，DEFAULT_TENANT表示默认租户
+ * @returns {models.ITenantManager[T]} 租户视图
+ */
+func (tm *Manager[T]) Tenant(tenantID string) models.ITenantManager[T] {
+	return &TenantManager[T]{tm: tm, id: tenantID}
+}
+
+// ID 获取租户ID
+func (t *TenantManager[T]) ID() string {
+	return t.id
+}
+
+/**
+ * SetMaxTokens 设置租户内最大token数量
+ * 达到上限时淘汰该租户内最久没有使用的token，不影响其他租户；全局MaxTokens仍然生效
+ * 写入预写日志失败时设置不生效
+ * @param {int} max 最大token数量，小于等于0表示不单独限制
+ * @returns {error} 日志错误
+ */
+func (t *TenantManager[T]) SetMaxTokens(max int) error {
+	t.tm.lock()
+	defer t.tm.unlock()
+	return t.tm.setTenantMaxTokensLocked(t.id, max)
+}
+
+/**
+ * setTenantMaxTokensLocked 设置租户内最大token数量，已打开预写日志时先写入日志（调用方需持有写锁）
+ * @param {string} tenantID 租户ID
+ * @param {int} max 最大token数量，小于等于0表示不单独限制
+ * @returns {error} 日志错误
+ */
+func (tm *Manager[T]) setTenantMaxTokensLocked(tenantID string, max int) error {
+	if err := tm.journalLocked(journalRecord{Op: journalTenantMax, TenantID: tenantID, Max: max}); err != nil {
+		return err
+	}
+	if max <= 0 {
+		delete(tm.tenantMaxTokens, tenantID)
+	} else {
+		tm.tenantMaxTokens[tenantID] = max
+	}
+	tm.compactIfNeededLocked()
+	return nil
+}
+
+// AddToken 在租户内新增token，用户组只在该租户内查找
+func (t *TenantManager[T]) AddToken(userID uint, groupID uint, clientIp string) (string, error) {
+	return t.tm.addToken(t.id, userID, groupID, clientIp)
+}
+
+// DelTokensByUserID 删除租户内指定用户的所有token
+func (t *TenantManager[T]) DelTokensByUserID(userID uint) error {
+	return t.tm.delTokensByUserID(t.id, userID)
+}
+
+// DelTokensByGroupID 删除租户内指定用户组的所有token
+func (t *TenantManager[T]) DelTokensByGroupID(groupID uint) error {
+	return t.tm.delTokensByGroupID(t.id, groupID)
+}
+
+// BatchDeleteTokensByUserIDs 批量删除租户内多个用户的所有token
+func (t *TenantManager[T]) BatchDeleteTokensByUserIDs(userIDs []uint) error {
+	return t.tm.batchDeleteTokensByUserIDs(t.id, userIDs)
+}
+
+// BatchDeleteTokensByGroupIDs 批量删除租户内多个用户组的所有token
+func (t *TenantManager[T]) BatchDeleteTokensByGroupIDs(groupIDs []uint) error {
+	return t.tm.batchDeleteTokensByGroupIDs(t.id, groupIDs)
+}
+
+// GetTokensByUserID 获取租户内指定用户的所有token
+func (t *TenantManager[T]) GetTokensByUserID(userID uint) []*models.Token[T] {
+	return t.tm.getTokensByUserID(t.id, userID)
+}
+
+// GetTokensByGroupID 获取租户内指定用户组的所有token
+func (t *TenantManager[T]) GetTokensByGroupID(groupID uint) []*models.Token[T] {
+	return t.tm.getTokensByGroupID(t.id, groupID)
+}
+
+// GetGroup 获取租户内的用户组
+func (t *TenantManager[T]) GetGroup(groupID uint) (*models.Group, error) {
+	return t.tm.getGroup(t.id, groupID)
+}
+
+// AddGroup 在租户内新增用户组
+func (t *TenantManager[T]) AddGroup(raw *models.GroupRaw) error {
+	return t.tm.addGroup(t.id, raw)
+}
+
+// DelGroup 删除租户内的用户组及其所有token
+func (t *TenantManager[T]) DelGroup(groupID uint) error {
+	return t.tm.delGroup(t.id, groupID)
+}
+
+// UpdateGroup 更新租户内的用户组
+func (t *TenantManager[T]) UpdateGroup(groupID uint, raw *models.GroupRaw) error {
+	return t.tm.updateGroup(t.id, groupID, raw)
+}
+
+// UpdateAllGroup 替换租户内的所有用户组，其他租户不受影响
+func (t *TenantManager[T]) UpdateAllGroup(groups []models.GroupRaw) error {
+	return t.tm.updateAllGroup(t.id, groups)
+}
+
+// GetQuotaUsage 获取租户内用户在指定用户组各配额上的用量
+func (t *TenantManager[T]) GetQuotaUsage(groupID uint, userID uint) ([]models.QuotaUsage, error) {
+	return t.tm.getQuotaUsage(t.id, groupID, userID)
+}
+
+// ResetQuota 清零租户内用户的配额计数，name为空时清零所有配额
+func (t *TenantManager[T]) ResetQuota(userID uint, name string) error {
+	return t.tm.resetQuota(t.id, userID, name)
+}
+
+// GetSharedData 获取租户内用户的共享数据
+func (t *TenantManager[T]) GetSharedData(userID uint) (T, error) {
+	return t.tm.getSharedData(t.id, userID)
+}
+
+// UpdateSharedData 在管理器锁内修改租户内用户的共享数据
+func (t *TenantManager[T]) UpdateSharedData(userID uint, mutator func(data *T) error) error {
+	return t.tm.updateSharedData(t.id, userID, mutator)
+}
+
+// GetStats 获取租户的token统计信息
+func (t *TenantManager[T]) GetStats() models.Stats {
+	return t.tm.tenantStats(t.id)
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * TestAuthorizerChain 测试自定义鉴权器的执行顺序、短路语义和错误返回
+ */
+func TestAuthorizerChain(t *testing.T) {
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{
+			ID:                 1,
+			Name:               "user",
+			AllowedAPIs:        "/api",
+			DeniedAPIs:         "/api/admin",
+			TokenExpire:        "1h",
+			AllowMultipleLogin: 1,
+		},
+	}
+	tm, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	if err := tm.SetUserData(key, "beta"); err != nil {
+		t.Fatalf("SetUserData failed: %v", err)
+	}
+
+	var calls []string
+	errEntitlement := errors.New("plan does not include reports")
+	pre := models.AuthorizerFunc[string]{ID: "flags", Fn: func(ctx *models.AuthContext[string]) (models.AuthVerdict, error) {
+		calls = append(calls, "pre:"+ctx.API)
+		switch {
+		case ctx.Method == "DELETE":
+			return models.VerdictDeny, nil
+		case ctx.API == "/api/admin/status" && ctx.UserData == "beta":
+			return models.VerdictAllow, nil
+		}
+		return models.VerdictAbstain, nil
+	}}
+	post := models.AuthorizerFunc[string]{ID: "entitlements", Fn: func(ctx *models.AuthContext[string]) (models.AuthVerdict, error) {
+		calls = append(calls, "post:"+ctx.API)
+		if ctx.Rule == nil || ctx.Group.Name != "user" || ctx.IP != "10.0.0.1" {
+			t.Errorf("post authorizer got incomplete context: %+v", ctx)
+		}
+		if len(ctx.PathSegments) > 1 && ctx.PathSegments[1] == "reports" {
+			return models.VerdictAbstain, errEntitlement
+		}
+		return models.VerdictAbstain, nil
+	}}
+	if err := tm.UseAuthorizer(models.AuthStagePreRule, pre); err != nil {
+		t.Fatalf("UseAuthorizer(pre) failed: %v", err)
+	}
+	if err := tm.UseAuthorizer(models.AuthStagePostRule, post); err != nil {
+		t.Fatalf("UseAuthorizer(post) failed: %v", err)
+	}
+	if err := tm.UseAuthorizer(models.AuthStagePostRule, nil); err == nil {
+		t.Errorf("expected nil authorizer to be rejected")
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		api    string
+		err    error
+		calls  []string
+	}{
+		{"both stages abstain", "GET", "/api/users", nil, []string{"pre:/api/users", "post:/api/users"}},
+		{"pre deny short-circuits", "DELETE", "/api/users", errors.New("Access forbidden"), []string{"pre:/api/users"}},
+		{"pre allow skips rules", "GET", "/api/admin/status", nil, []string{"pre:/api/admin/status"}},
+		{"built-in deny skips post", "GET", "/api/admin/users", errors.New("Unauthorized access"), []string{"pre:/api/admin/users"}},
+		{"post error is returned", "GET", "/api/reports", errEntitlement, []string{"pre:/api/reports", "post:/api/reports"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			err := tm.AuthWithMethod(key, "10.0.0.1", tt.method, tt.api)
+			if (err == nil) != (tt.err == nil) || (err != nil && err.Error() != tt.err.Error()) {
+				t.Errorf("AuthWithMethod = %v, expected %v", err, tt.err)
+			}
+			if len(calls) != len(tt.calls) {
+				t.Fatalf("calls = %v, expected %v", calls, tt.calls)
+			}
+			for i := range calls {
+				if calls[i] != tt.calls[i] {
+					t.Errorf("calls = %v, expected %v", calls, tt.calls)
+				}
+			}
+		})
+	}
+
+	// 其他用户的token无法通过前置鉴权器放行
+	if err := tm.Auth(key, "10.0.0.2", "/api/admin/status"); err == nil {
+		t.Errorf("IP binding must be checked before authorizers")
+	}
+
+	d := tm.ExplainWithMethod(key, "10.0.0.1", "GET", "/api/reports")
+	if d.Allowed || d.ErrorKey != "forbidden" || d.Reason != errEntitlement.Error() {
+		t.Errorf("Explain = allowed %v key %q reason %q", d.Allowed, d.ErrorKey, d.Reason)
+	}
+	if len(d.Authorizers) != 2 || d.Authorizers[1].Stage != "post_rule" || d.Authorizers[1].Verdict != "deny" || d.Authorizers[1].Error == "" {
+		t.Errorf("Explain authorizers = %+v", d.Authorizers)
+	}
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+// bypassCorpus 常见的路径绕过写法，同时作为模糊测试的种子语料
+var bypassCorpus = []struct {
+	input    string
+	expected string
+	err      error
+}{
+	{"/api/admin", "api/admin", nil},
+	{"https://example.com/api/./admin?x=1", "api/admin", nil},
+	{"/api/public/../admin", "api/admin", nil},
+	{"/api/public/./../admin/", "api/admin", nil},
+	{"//api///admin", "api/admin", nil},
+	{"/api/%61dmin", "api/admin", nil},
+	{"/api/../..", "", utility.ErrPathTraversal},
+	{"/../api/admin", "", utility.ErrPathTraversal},
+	{"/api/%2e%2e/admin", "", utility.ErrPathTraversal},
+	{"/api/public/%2E/admin", "", utility.ErrPathTraversal},
+	{"/api%2Fadmin", "", utility.ErrEncodedSlash},
+	{"/api%2fadmin", "", utility.ErrEncodedSlash},
+	{"/api/%5Cadmin", "", utility.ErrEncodedSlash},
+	{"https://example.com/api%2Fadmin", "", utility.ErrEncodedSlash},
+	{"/api/%252Fadmin", "", utility.ErrDoubleEncoding},
+	{"/api/%25%32%65%25%32%65/admin", "", utility.ErrDoubleEncoding},
+	{"/api/%zz", "", utility.ErrInvalidEncoding},
+	{"/api/%2", "", utility.ErrInvalidEncoding},
+	{"/api;x=1/admin", "", utility.ErrPathParameter},
+	{"/api/admin;jsessionid=1", "", utility.ErrPathParameter},
+	{"/api/admin.", "", utility.ErrTrailingDot},
+	{"/api/admin%2E", "", utility.ErrTrailingDot},
+	{"/api/admin../x", "", utility.ErrTrailingDot},
+	{"/api\\admin", "", utility.ErrAmbiguousSegment},
+	{"/api/%00admin", "", utility.ErrAmbiguousSegment},
+	{"/api/admin%20", "", utility.ErrAmbiguousSegment},
+	{"/api/ad\tmin", "", utility.ErrAmbiguousSegment},
+}
+
+/**
+ * TestCanonicalizePathCorpus 测试严格路径规范化对常见绕过写法的处理
+ */
+func TestCanonicalizePathCorpus(t *testing.T) {
+	for _, tt := range bypassCorpus {
+		segments, err := utility.CanonicalizePath(tt.input, utility.CanonicalOptions{})
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("CanonicalizePath(%q) error = %v, expected %v", tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("CanonicalizePath(%q) unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got := strings.Join(segments, "/"); got != tt.expected {
+			t.Errorf("CanonicalizePath(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+
+	segments, err := utility.CanonicalizePath("/API/Admin", utility.CanonicalOptions{CaseInsensitive: true})
+	if err != nil || strings.Join(segments, "/") != "api/admin" {
+		t.Errorf("case-insensitive CanonicalizePath = %v, %v", segments, err)
+	}
+}
+
+/**
+ * FuzzCanonicalizePath 模糊测试严格路径规范化
+ * 规范化结果中不能残留点段、斜杠和空段，并且重新编码后再次规范化结果不变
+ */
+func FuzzCanonicalizePath(f *testing.F) {
+	for _, tt := range bypassCorpus {
+		f.Add(tt.input)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		segments, err := utility.CanonicalizePath(input, utility.CanonicalOptions{})
+		if err != nil {
+			return
+		}
+		encoded := make([]string, len(segments))
+		for i, seg := range segments {
+			if seg == "" || seg == "." || seg == ".." || strings.ContainsAny(seg, "/\\;") {
+				t.Fatalf("CanonicalizePath(%q) left unsafe segment %q", input, seg)
+			}
+			encoded[i] = url.PathEscape(seg)
+		}
+		again, err := utility.CanonicalizePath("/"+strings.Join(encoded, "/"), utility.CanonicalOptions{})
+		if err != nil {
+			t.Fatalf("canonical form of %q rejected: %v", input, err)
+		}
+		if strings.Join(again, "/") != strings.Join(segments, "/") {
+			t.Fatalf("CanonicalizePath is not idempotent for %q: %q != %q", input, again, segments)
+		}
+	})
+}
+
+/**
+ * TestAuthStrictPaths 测试严格路径模式下的鉴权，绕过写法不能访问被禁止的API
+ */
+func TestAuthStrictPaths(t *testing.T) {
+	config := models.ConfigRaw{
+		MaxTokens:            100,
+		Delimiter:            ",",
+		TokenRenewTime:       "30m",
+		Language:             "en",
+		StrictPaths:          true,
+		CaseInsensitivePaths: true,
+	}
+	groups := []models.GroupRaw{
+		{
+			ID:                 1,
+			Name:               "user",
+			AllowedAPIs:        "/api,/api/Public",
+			DeniedAPIs:         "/api/Admin",
+			TokenExpire:        "1h",
+			AllowMultipleLogin: 1,
+		},
+	}
+	tm, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+
+	for _, api := range []string{"/api/public/docs", "/API/PUBLIC", "/api/admin/../public"} {
+		if err := tm.Auth(key, "10.0.0.1", api); err != nil {
+			t.Errorf("Auth(%q) = %v, expected access", api, err)
+		}
+	}
+	for _, api := range []string{"/api/ADMIN", "/api/public/../admin", "/api/./Admin/users"} {
+		if err := tm.Auth(key, "10.0.0.1", api); err == nil || err.Error() != "Unauthorized access" {
+			t.Errorf("Auth(%q) = %v, expected unauthorized", api, err)
+		}
+	}
+	for _, api := range []string{"/api%2Fadmin", "/api;x=1/admin", "/api/admin.", "/api/%252e%252e/admin"} {
+		err := tm.Auth(key, "10.0.0.1", api)
+		if err == nil || !strings.HasPrefix(err.Error(), "Invalid request path") {
+			t.Errorf("Auth(%q) = %v, expected invalid path", api, err)
+		}
+	}
+	if err := tm.Auth(key, "10.0.0.1", "/api%2Fadmin"); !errors.Is(err, utility.ErrEncodedSlash) {
+		t.Errorf("expected Auth error to wrap ErrEncodedSlash, got %v", err)
+	}
+
+	d := tm.Explain(key, "10.0.0.1", "/api/public/../admin")
+	if d.Allowed || strings.Join(d.PathSegments, "/") != "api/admin" {
+		t.Errorf("Explain = allowed %v segments %v", d.Allowed, d.PathSegments)
+	}
+	if d := tm.Explain(key, "10.0.0.1", "/api;x=1/admin"); d.ErrorKey != "invalid_path" {
+		t.Errorf("Explain error key = %q, expected invalid_path", d.ErrorKey)
+	}
+
+	config.StrictPaths = false
+	if _, err := wt.InitTM[string](config, groups); err == nil {
+		t.Errorf("expected CaseInsensitivePaths without StrictPaths to be rejected")
+	}
+}
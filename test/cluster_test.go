@@ -0,0 +1,323 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/cluster"
+	"github.com/windf17/wt/models"
+)
+
+// partitionTransport 可以模拟网络分区的传输，分区时发送失败
+type partitionTransport struct {
+	*cluster.HTTPTransport
+	partitioned atomic.Bool
+}
+
+func (p *partitionTransport) Send(ctx context.Context, peer string, msg *cluster.Message) (*cluster.Message, error) {
+	if p.partitioned.Load() {
+		return nil, errors.New("network partition")
+	}
+	return p.HTTPTransport.Send(ctx, peer, msg)
+}
+
+// countingReplica 统计ApplyChange调用次数
+type countingReplica struct {
+	cluster.Replica
+	applied atomic.Int32
+}
+
+func (r *countingReplica) ApplyChange(c models.Change) error {
+	r.applied.Add(1)
+	return r.Replica.ApplyChange(c)
+}
+
+// clusterMember 集群测试中的一个实例
+type clusterMember struct {
+	tm        models.IManager[cart]
+	transport *partitionTransport
+	node      *cluster.Node
+}
+
+/**
+ * newCluster 在本机回环地址上创建n个互为对等节点的实例，所有实例从同一个快照加载相同的token
+ * @returns {[]*clusterMember, []string} 实例和第一个实例中用户1、2、3的token
+ */
+func newCluster(t *testing.T, n int, wrap func(i int, r cluster.Replica) cluster.Replica) ([]*clusterMember, []string) {
+	t.Helper()
+	src := newSnapshotManager(t)
+	var keys []string
+	for _, userID := range []uint{1, 2, 3} {
+		key, err := src.AddToken(userID, 1, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("AddToken failed: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	path := filepath.Join(t.TempDir(), "seed.snap")
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	members := make([]*clusterMember, n)
+	for i := range members {
+		tm := newSnapshotManager(t)
+		if err := tm.LoadSnapshot(path); err != nil {
+			t.Fatalf("LoadSnapshot failed: %v", err)
+		}
+		transport, err := cluster.NewHTTPTransport("127.0.0.1:0", cluster.HTTPOptions{Secret: []byte("cluster secret")})
+		if err != nil {
+			t.Fatalf("NewHTTPTransport failed: %v", err)
+		}
+		t.Cleanup(func() { transport.Close() })
+		members[i] = &clusterMember{tm: tm, transport: &partitionTransport{HTTPTransport: transport}}
+	}
+	for i, m := range members {
+		var peers []string
+		for j, other := range members {
+			if j != i {
+				peers = append(peers, other.transport.Addr())
+			}
+		}
+		var replica cluster.Replica = m.tm.(*wt.Manager[cart])
+		if wrap != nil {
+			replica = wrap(i, replica)
+		}
+		node, err := cluster.New(replica, m.transport, cluster.Options{
+			ID:           string(rune('a' + i)),
+			Peers:        peers,
+			SyncInterval: -1,
+		})
+		if err != nil {
+			t.Fatalf("cluster.New failed: %v", err)
+		}
+		t.Cleanup(func() { node.Close() })
+		m.node = node
+	}
+	return members, keys
+}
+
+// eventually 在截止时间前反复检查条件
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// groupName 获取用户组名称，不存在时为空
+func groupName(tm models.IManager[cart], groupID uint) string {
+	g, err := tm.GetGroup(groupID)
+	if err != nil || g == nil {
+		return ""
+	}
+	return g.Name
+}
+
+/**
+ * TestClusterRevocation 测试注销和按用户删除token传播到所有实例
+ */
+func TestClusterRevocation(t *testing.T) {
+	members, keys := newCluster(t, 3, nil)
+	for _, m := range members {
+		if err := m.tm.Auth(keys[0], "10.0.0.1", "/api"); err != nil {
+			t.Fatalf("Seeded token should be valid on every member: %v", err)
+		}
+	}
+
+	if err := members[0].tm.DelToken(keys[0]); err != nil {
+		t.Fatalf("DelToken failed: %v", err)
+	}
+	if err := members[1].tm.DelTokensByUserID(2); err != nil {
+		t.Fatalf("DelTokensByUserID failed: %v", err)
+	}
+	for i, m := range members {
+		eventually(t, "revocations to propagate", func() bool {
+			return m.tm.Auth(keys[0], "10.0.0.1", "/api") != nil && m.tm.Auth(keys[1], "10.0.0.1", "/api") != nil
+		})
+		if err := m.tm.Auth(keys[2], "10.0.0.1", "/api"); err != nil {
+			t.Errorf("Member %d: unrelated token should stay valid: %v", i, err)
+		}
+	}
+}
+
+/**
+ * TestClusterGroupChange 测试用户组的修改和删除传播到所有实例
+ */
+func TestClusterGroupChange(t *testing.T) {
+	members, _ := newCluster(t, 3, nil)
+	err := members[2].tm.UpdateGroup(1, &models.GroupRaw{ID: 1, Name: "renamed", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1})
+	if err != nil {
+		t.Fatalf("UpdateGroup failed: %v", err)
+	}
+	if err := members[0].tm.AddGroup(&models.GroupRaw{ID: 5, Name: "new", AllowedAPIs: "/new", TokenExpire: "1h"}); err != nil {
+		t.Fatalf("AddGroup failed: %v", err)
+	}
+	for _, m := range members {
+		eventually(t, "group changes to propagate", func() bool {
+			return groupName(m.tm, 1) == "renamed" && groupName(m.tm, 5) == "new"
+		})
+	}
+
+	if err := members[1].tm.DelGroup(5); err != nil {
+		t.Fatalf("DelGroup failed: %v", err)
+	}
+	for _, m := range members {
+		eventually(t, "group removal to propagate", func() bool {
+			return groupName(m.tm, 5) == ""
+		})
+	}
+}
+
+/**
+ * TestClusterIdempotent 测试重复收到的事件只应用一次
+ */
+func TestClusterIdempotent(t *testing.T) {
+	counters := make([]*countingReplica, 2)
+	members, keys := newCluster(t, 2, func(i int, r cluster.Replica) cluster.Replica {
+		counters[i] = &countingReplica{Replica: r}
+		return counters[i]
+	})
+
+	msg := &cluster.Message{From: "x", Events: []cluster.Event{{
+		ID: "x-1", Node: "x", Seq: 1, Time: time.Now().UnixNano(),
+		Change: models.Change{Op: models.ChangeRevoke, Key: keys[0]},
+	}}}
+	for i := 0; i < 3; i++ {
+		if _, err := members[0].transport.Send(context.Background(), members[1].transport.Addr(), msg); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	if n := counters[1].applied.Load(); n != 1 {
+		t.Errorf("Duplicate event applied %d times, expected once", n)
+	}
+	if err := members[1].tm.Auth(keys[0], "10.0.0.1", "/api"); err == nil {
+		t.Error("Revoked token should be rejected")
+	}
+
+	// 同步把事件带给没有收到它的节点，再次同步不重复应用
+	members[0].node.SyncNow()
+	members[0].node.SyncNow()
+	members[1].node.SyncNow()
+	if n := counters[0].applied.Load(); n != 1 {
+		t.Errorf("Anti-entropy applied the event %d times on the other member, expected once", n)
+	}
+	if n := counters[1].applied.Load(); n != 1 {
+		t.Errorf("Anti-entropy should not reapply known events, applied %d times", n)
+	}
+}
+
+/**
+ * TestClusterPartition 测试分区期间丢失的推送在恢复后由反熵同步补齐，并发修改同一个用户组时最后写入者胜出
+ */
+func TestClusterPartition(t *testing.T) {
+	members, keys := newCluster(t, 2, nil)
+	for _, m := range members {
+		m.transport.partitioned.Store(true)
+	}
+
+	members[0].tm.DelToken(keys[0])
+	members[1].tm.DelToken(keys[1])
+	members[0].tm.UpdateGroup(1, &models.GroupRaw{ID: 1, Name: "first", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1})
+	time.Sleep(5 * time.Millisecond)
+	members[1].tm.UpdateGroup(1, &models.GroupRaw{ID: 1, Name: "second", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1})
+
+	if err := members[0].node.SyncNow(); err == nil {
+		t.Error("SyncNow should fail while partitioned")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := members[1].tm.Auth(keys[0], "10.0.0.1", "/api"); err != nil {
+		t.Fatalf("Revocation should not cross the partition: %v", err)
+	}
+
+	for _, m := range members {
+		m.transport.partitioned.Store(false)
+	}
+	if err := members[0].node.SyncNow(); err != nil {
+		t.Fatalf("SyncNow after healing failed: %v", err)
+	}
+	for i, m := range members {
+		for _, key := range keys[:2] {
+			if err := m.tm.Auth(key, "10.0.0.1", "/api"); err == nil {
+				t.Errorf("Member %d: token revoked during the partition should be rejected", i)
+			}
+		}
+		if err := m.tm.Auth(keys[2], "10.0.0.1", "/api"); err != nil {
+			t.Errorf("Member %d: unrelated token should stay valid: %v", i, err)
+		}
+		if name := groupName(m.tm, 1); name != "second" {
+			t.Errorf("Member %d: group name = %q, expected the last write %q", i, name, "second")
+		}
+	}
+}
+
+/**
+ * TestClusterSignature 测试密钥不一致的节点的消息被拒绝
+ */
+func TestClusterSignature(t *testing.T) {
+	members, keys := newCluster(t, 1, nil)
+	rogue, err := cluster.NewHTTPTransport("", cluster.HTTPOptions{Secret: []byte("wrong secret")})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	msg := &cluster.Message{From: "rogue", Events: []cluster.Event{{
+		ID: "rogue-1", Node: "rogue", Seq: 1, Time: time.Now().UnixNano(),
+		Change: models.Change{Op: models.ChangeRevoke, Key: keys[0]},
+	}}}
+	if _, err := rogue.Send(context.Background(), members[0].transport.Addr(), msg); err == nil {
+		t.Error("Message with a wrong signature should be rejected")
+	}
+	if err := members[0].tm.Auth(keys[0], "10.0.0.1", "/api"); err != nil {
+		t.Errorf("Rejected message should not revoke the token: %v", err)
+	}
+}
+
+/**
+ * TestClusterRestart 测试节点重启后序号从头开始，新的撤销事件仍然传播到对等节点，不会被当作重复事件丢弃
+ */
+func TestClusterRestart(t *testing.T) {
+	members, keys := newCluster(t, 3, nil)
+	if err := members[0].tm.DelToken(keys[0]); err != nil {
+		t.Fatalf("DelToken failed: %v", err)
+	}
+	for _, m := range members {
+		eventually(t, "revocation before the restart to propagate", func() bool {
+			return m.tm.Auth(keys[0], "10.0.0.1", "/api") != nil
+		})
+	}
+
+	// 使用相同的节点ID重启第一个节点
+	members[0].node.Close()
+	var peers []string
+	for _, other := range members[1:] {
+		peers = append(peers, other.transport.Addr())
+	}
+	node, err := cluster.New(members[0].tm.(*wt.Manager[cart]), members[0].transport, cluster.Options{
+		ID:           "a",
+		Peers:        peers,
+		SyncInterval: -1,
+	})
+	if err != nil {
+		t.Fatalf("cluster.New failed: %v", err)
+	}
+	t.Cleanup(func() { node.Close() })
+	members[0].node = node
+
+	if err := members[0].tm.DelToken(keys[1]); err != nil {
+		t.Fatalf("DelToken failed: %v", err)
+	}
+	for _, m := range members[1:] {
+		eventually(t, "revocation after the restart to propagate", func() bool {
+			return m.tm.Auth(keys[1], "10.0.0.1", "/api") != nil
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+// profile 包含引用类型的用户数据
+type profile struct {
+	Tags  []string
+	Prefs map[string]string
+	Boss  *profile
+	note  string
+}
+
+// counted 实现了Cloner的用户数据，记录Clone的调用次数
+type counted struct {
+	Values []int
+	clones *int
+}
+
+func (c counted) Clone() counted {
+	*c.clones++
+	return counted{Values: append([]int(nil), c.Values...), clones: c.clones}
+}
+
+/**
+ * newProfileManager 创建用户数据为*profile的管理器
+ */
+func newProfileManager(t *testing.T) models.IManager[*profile] {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+	}
+	manager, err := wt.InitTM[*profile](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	return manager
+}
+
+/**
+ * TestDeepCopy 测试反射深拷贝、循环引用以及Cloner接口
+ */
+func TestDeepCopy(t *testing.T) {
+	p := &profile{Tags: []string{"a"}, Prefs: map[string]string{"theme": "dark"}, note: "n"}
+	p.Boss = p
+	c := utility.DeepCopy(p)
+	if c == p || c.Boss != c {
+		t.Fatalf("cycle should be preserved inside the copy")
+	}
+	c.Tags[0] = "b"
+	c.Prefs["theme"] = "light"
+	if p.Tags[0] != "a" || p.Prefs["theme"] != "dark" || c.note != "n" {
+		t.Errorf("copy shares data with the original: %+v", p)
+	}
+
+	var iface any = []int{1}
+	copied := utility.DeepCopy(iface).([]int)
+	copied[0] = 2
+	if iface.([]int)[0] != 1 {
+		t.Errorf("slice inside an interface should be copied")
+	}
+	var empty any
+	if utility.DeepCopy(empty) != nil {
+		t.Errorf("nil interface should stay nil")
+	}
+
+	n := 0
+	v := counted{Values: []int{1}, clones: &n}
+	cv := utility.DeepCopy(v)
+	cv.Values[0] = 9
+	if n != 1 || v.Values[0] != 1 {
+		t.Errorf("Clone should be used, calls = %d", n)
+	}
+}
+
+/**
+ * TestReadAPIsReturnSnapshots 测试读取接口返回的token和用户数据与管理器互不共享
+ * 使用go test -race运行时，任何共享都会被检测为数据竞争
+ */
+func TestReadAPIsReturnSnapshots(t *testing.T) {
+	tm := newProfileManager(t)
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	input := &profile{Tags: []string{"a"}, Prefs: map[string]string{"theme": "dark"}}
+	tm.SetUserData(key, input)
+	input.Tags[0] = "changed by caller"
+	if data, _ := tm.GetUserData(key); data.Tags[0] != "a" {
+		t.Fatalf("SetUserData should store a copy")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tm.Auth(key, "10.0.0.1", "/api")
+				tm.UpdateUserData(key, func(p **profile) error {
+					(*p).Prefs["theme"] = "light"
+					(*p).Tags = append((*p).Tags, "x")
+					return nil
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				token, err := tm.GetToken(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				token.LastAccessTime = token.LoginTime
+				token.UserData.Prefs["theme"] = "mine"
+				token.UserData.Tags[0] = "mine"
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, token := range tm.GetTokensByUserID(1) {
+					token.LastAccessTime = token.LoginTime
+					token.UserData.Prefs["theme"] = "mine"
+				}
+				for _, token := range tm.GetTokensByGroupID(1) {
+					token.UserData.Tags[0] = "mine"
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				data, err := tm.GetUserData(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data.Prefs["theme"] = "mine"
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, _ := tm.GetUserData(key)
+	if data.Prefs["theme"] != "light" || data.Tags[0] != "a" || len(data.Tags) != 401 {
+		t.Errorf("callers' modifications leaked into the manager: %+v", data)
+	}
+}
+
+/**
+ * TestUpdateTokenStoresCopy 测试UpdateToken保存传入token的副本，调用方之后修改传入的结构与Auth互不影响
+ * 使用go test -race运行时，任何共享都会被检测为数据竞争
+ */
+func TestUpdateTokenStoresCopy(t *testing.T) {
+	tm := newProfileManager(t)
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	token, _ := tm.GetToken(key)
+	token.UserData = &profile{Tags: []string{"a"}, Prefs: map[string]string{"theme": "dark"}}
+	if err := tm.UpdateToken(key, token); err != nil {
+		t.Fatalf("UpdateToken failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			tm.Auth(key, "10.0.0.1", "/api")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			token.LastAccessTime = token.LoginTime
+			token.Version = 0
+			token.UserData.Prefs["theme"] = "mine"
+			token.UserData.Tags[0] = "mine"
+		}
+	}()
+	wg.Wait()
+
+	stored, _ := tm.GetToken(key)
+	if stored.Version == 0 || stored.UserData.Prefs["theme"] != "dark" || stored.UserData.Tags[0] != "a" {
+		t.Errorf("caller's modifications leaked into the manager: version %d, %+v", stored.Version, stored.UserData)
+	}
+}
+
+/**
+ * TestSharedDataSnapshots 测试共享数据的读取同样返回副本
+ */
+func TestSharedDataSnapshots(t *testing.T) {
+	tm := newProfileManager(t)
+	tm.AddToken(1, 1, "10.0.0.1")
+	tm.UpdateSharedData(1, func(p **profile) error {
+		*p = &profile{Prefs: map[string]string{}}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tm.UpdateSharedData(1, func(p **profile) error {
+					(*p).Prefs["cart"] += "x"
+					return nil
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				data, _ := tm.GetSharedData(1)
+				data.Prefs["cart"] = "mine"
+			}
+		}()
+	}
+	wg.Wait()
+	if data, _ := tm.GetSharedData(1); len(data.Prefs["cart"]) != 400 {
+		t.Errorf("cart length = %d, expected 400", len(data.Prefs["cart"]))
+	}
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * TestDiffGroups 测试两套用户组配置的差异比较
+ */
+func TestDiffGroups(t *testing.T) {
+	oldGroups := []models.GroupRaw{
+		{ID: 1, Name: "admin", AllowedAPIs: "/api", DeniedAPIs: "/api/billing", TokenExpire: "60m"},
+		{ID: 2, Name: "user", AllowedAPIs: "/api/user", TokenExpire: "30m"},
+		{ID: 4, Name: "legacy", AllowedAPIs: "/old", TokenExpire: "1h"},
+	}
+	newGroups := []models.GroupRaw{
+		{ID: 1, Name: "admin", AllowedAPIs: "/api", DeniedAPIs: "/api/billing,/api/admin", TokenExpire: "1h"},
+		{ID: 2, Name: "user", AllowedAPIs: "/api/user,/api/billing", TokenExpire: "2h", AllowMultipleLogin: 1},
+		{ID: 3, Name: "ops", AllowedAPIs: "/ops", TokenExpire: "1h"},
+	}
+	diff := wt.DiffGroups(oldGroups, newGroups, ",")
+
+	if len(diff.Added) != 1 || diff.Added[0].ID != 3 {
+		t.Fatalf("unexpected added groups %+v", diff.Added)
+	}
+	if len(diff.Added[0].Access) != 1 || diff.Added[0].Access[0] != (models.AccessChange{Path: "/ops", Old: false, New: true}) {
+		t.Errorf("unexpected access for added group %+v", diff.Added[0].Access)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "legacy" {
+		t.Fatalf("unexpected removed groups %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 2 {
+		t.Fatalf("expected 2 changed groups, got %+v", diff.Changed)
+	}
+
+	admin := diff.Changed[0]
+	if len(admin.Fields) != 0 {
+		t.Errorf("60m and 1h should be treated as the same expiry: %+v", admin.Fields)
+	}
+	if len(admin.Access) != 1 || admin.Access[0] != (models.AccessChange{Path: "/api/admin", Old: true, New: false}) {
+		t.Errorf("unexpected admin access diff %+v", admin.Access)
+	}
+
+	user := diff.Changed[1]
+	fields := make(map[string]models.FieldChange)
+	for _, f := range user.Fields {
+		fields[f.Field] = f
+	}
+	if fields["tokenExpire"].New != "2h" || fields["allowMultipleLogin"].New != "true" {
+		t.Errorf("unexpected user field changes %+v", user.Fields)
+	}
+	if len(user.Access) != 1 || user.Access[0].Path != "/api/billing" || !user.Access[0].New {
+		t.Errorf("unexpected user access diff %+v", user.Access)
+	}
+
+	text := diff.String()
+	for _, want := range []string{"+ group 3 (ops)", "- group 4 (legacy)", "access /api/admin: allow -> deny", `tokenExpire: "30m" -> "2h"`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output missing %q:\n%s", want, text)
+		}
+	}
+
+	if !wt.DiffGroups(oldGroups, oldGroups, ",").Empty() {
+		t.Errorf("identical configurations should have no diff")
+	}
+}
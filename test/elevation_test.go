@@ -0,0 +1,188 @@
+package test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+// memoryAuditSink 测试用的审计输出
+type memoryAuditSink struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+func (s *memoryAuditSink) Record(e models.AuditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+func (s *memoryAuditSink) actions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]string, len(s.events))
+	for i, e := range s.events {
+		result[i] = e.Action
+	}
+	return result
+}
+
+/**
+ * newElevationManager 创建包含普通用户组和管理员用户组的管理器
+ */
+func newElevationManager(t *testing.T, now *time.Time) *wt.Manager[string] {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api/user", TokenExpire: "24h", AllowMultipleLogin: 1},
+		{ID: 2, Name: "admin", AllowedAPIs: "/api/user,/api/admin", TokenExpire: "24h", AllowMultipleLogin: 1},
+	}
+	manager, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	tm := manager.(*wt.Manager[string])
+	tm.SetClock(func() time.Time { return *now })
+	return tm
+}
+
+/**
+ * TestElevationLifecycle 测试提权生效、到期自动恢复以及审计记录
+ */
+func TestElevationLifecycle(t *testing.T) {
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	tm := newElevationManager(t, &now)
+	sink := &memoryAuditSink{}
+	tm.SetAuditSink(sink)
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+
+	if err := tm.Auth(key, "10.0.0.1", "/api/admin"); err == nil {
+		t.Fatalf("user group should not reach /api/admin")
+	}
+	e, err := tm.Elevate(key, 2, 15*time.Minute, "incident #42")
+	if err != nil {
+		t.Fatalf("Elevate failed: %v", err)
+	}
+	if e.OriginalGroupID != 1 || e.GroupID != 2 || !e.ExpiresAt.Equal(now.Add(15*time.Minute)) {
+		t.Errorf("elevation = %+v", e)
+	}
+	if err := tm.Auth(key, "10.0.0.1", "/api/admin"); err != nil {
+		t.Errorf("elevated token should reach /api/admin: %v", err)
+	}
+	d := tm.Explain(key, "10.0.0.1", "/api/admin")
+	if !d.Allowed || d.GroupID != 2 || d.ElevatedFrom != 1 || d.GroupName != "admin" {
+		t.Errorf("Explain = %+v", d)
+	}
+	if token, _ := tm.GetToken(key); token.GroupID != 1 {
+		t.Errorf("elevation must not change the token's own group, got %d", token.GroupID)
+	}
+	if list := tm.ListElevations(); len(list) != 1 || list[0].ID != e.ID {
+		t.Errorf("ListElevations = %+v", list)
+	}
+
+	// 到期后Auth立即使用原用户组，并惰性清除提权
+	now = now.Add(15 * time.Minute)
+	if err := tm.Auth(key, "10.0.0.1", "/api/admin"); err == nil {
+		t.Errorf("expired elevation should no longer grant /api/admin")
+	}
+	if len(tm.ListElevations()) != 0 {
+		t.Errorf("expired elevation should not be listed")
+	}
+	if err := tm.Auth(key, "10.0.0.1", "/api/user"); err != nil {
+		t.Errorf("original group should still work: %v", err)
+	}
+	if token, _ := tm.GetToken(key); token.Elevation != nil {
+		t.Errorf("Auth should revert the expired elevation")
+	}
+	if n := tm.RevertExpiredElevations(); n != 0 {
+		t.Errorf("RevertExpiredElevations = %d, expected nothing left", n)
+	}
+
+	actions := sink.actions()
+	if len(actions) != 2 || actions[0] != models.AuditElevate || actions[1] != models.AuditElevationExpired {
+		t.Fatalf("audit actions = %v", actions)
+	}
+	events := tm.AuditEvents()
+	if len(events) != 2 || events[0].Seq != 1 || events[1].Seq != 2 || events[0].Reason != "incident #42" || events[0].TokenID != e.ID {
+		t.Errorf("AuditEvents = %+v", events)
+	}
+}
+
+/**
+ * TestElevationRevokeAndSweep 测试撤销提权、后台清理以及参数校验
+ */
+func TestElevationRevokeAndSweep(t *testing.T) {
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	tm := newElevationManager(t, &now)
+	a, _ := tm.AddToken(1, 1, "10.0.0.1")
+	b, _ := tm.AddToken(2, 1, "10.0.0.2")
+
+	ea, _ := tm.Elevate(a, 2, time.Hour, "on call")
+	tm.Elevate(b, 2, time.Minute, "debug")
+	if list := tm.ListElevations(); len(list) != 2 || list[0].UserID != 2 {
+		t.Fatalf("ListElevations should be ordered by expiry: %+v", list)
+	}
+
+	if err := tm.RevokeElevation(ea.ID, "done"); err != nil {
+		t.Fatalf("RevokeElevation failed: %v", err)
+	}
+	if err := tm.Auth(a, "10.0.0.1", "/api/admin"); err == nil {
+		t.Errorf("revoked elevation should no longer grant /api/admin")
+	}
+	if err := tm.RevokeElevation(ea.ID, "again"); err == nil || err.Error() != "Elevation not found" {
+		t.Errorf("second revoke = %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n := tm.RevertExpiredElevations(); n != 1 {
+		t.Errorf("RevertExpiredElevations = %d, expected 1", n)
+	}
+	events := tm.AuditEvents()
+	if len(events) != 4 || events[2].Action != models.AuditElevationRevoked || events[2].Reason != "done" || events[3].UserID != 2 {
+		t.Errorf("AuditEvents = %+v", events)
+	}
+
+	// 后台清理
+	tm.Elevate(a, 2, time.Minute, "again")
+	now = now.Add(time.Hour)
+	stop := tm.StartElevationSweeper(time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if token, _ := tm.GetToken(a); token.Elevation == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sweeper did not revert the expired elevation")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+
+	invalid := []struct {
+		key      string
+		group    uint
+		duration time.Duration
+		reason   string
+	}{
+		{a, 2, 0, "no duration"},
+		{a, 2, time.Minute, ""},
+		{a, 1, time.Minute, "same group"},
+		{a, 9, time.Minute, "unknown group"},
+		{"missing", 2, time.Minute, "unknown token"},
+	}
+	for _, tt := range invalid {
+		if _, err := tm.Elevate(tt.key, tt.group, tt.duration, tt.reason); err == nil {
+			t.Errorf("Elevate(%q, %d, %v, %q) should fail", tt.key, tt.group, tt.duration, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+// secretItem 写入用户数据的敏感内容，加密后的文件中不应出现
+const secretItem = "card-4111-1111"
+
+/**
+ * newEncryptedManager 创建使用指定密码和盐值加密持久化文件的管理器
+ */
+func newEncryptedManager(t *testing.T, password string, salt []byte) (*wt.Manager[cart], *wt.SecurityManager) {
+	t.Helper()
+	tm := newSnapshotManager(t).(*wt.Manager[cart])
+	sm := wt.NewSecurityManagerWithSalt(password, salt)
+	if err := tm.SetEncryption(sm); err != nil {
+		t.Fatalf("SetEncryption failed: %v", err)
+	}
+	return tm, sm
+}
+
+// assertNoPlaintext 检查文件中不包含敏感内容和token
+func assertNoPlaintext(t *testing.T, path string, secrets ...string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	for _, s := range secrets {
+		if bytes.Contains(data, []byte(s)) {
+			t.Errorf("%s contains plaintext %q", filepath.Base(path), s)
+		}
+	}
+}
+
+/**
+ * TestEncryptedSnapshot 测试加密快照不包含明文，相同密钥可以加载，密钥不一致时返回明确的错误
+ */
+func TestEncryptedSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.snap")
+	salt := []byte("0123456789abcdef0123456789abcdef")
+	src, sm := newEncryptedManager(t, "correct horse", salt)
+	key, _ := src.AddToken(1, 1, "10.0.0.1")
+	src.SetUserData(key, cart{Items: []string{secretItem}})
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	assertNoPlaintext(t, path, secretItem, key)
+
+	dst, other := newEncryptedManager(t, "correct horse", salt)
+	if other.KeyID() != sm.KeyID() {
+		t.Fatal("Same password and salt should derive the same key")
+	}
+	if err := dst.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot with the same key failed: %v", err)
+	}
+	if data, _ := dst.GetUserData(key); len(data.Items) != 1 || data.Items[0] != secretItem {
+		t.Errorf("Unexpected decrypted user data: %+v", data)
+	}
+
+	wrong, _ := newEncryptedManager(t, "battery staple", salt)
+	existing, _ := wrong.AddToken(5, 1, "10.0.0.1")
+	if err := wrong.LoadSnapshot(path); !errors.Is(err, wt.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey for a wrong key, got %v", err)
+	}
+	if _, err := wrong.GetToken(existing); err != nil {
+		t.Errorf("Failed load should leave manager untouched: %v", err)
+	}
+	if err := newSnapshotManager(t).LoadSnapshot(path); !errors.Is(err, wt.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey without a key, got %v", err)
+	}
+}
+
+/**
+ * TestEncryptionMigratesPlaintext 测试开启加密后仍能读取之前未加密的快照
+ */
+func TestEncryptionMigratesPlaintext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.snap")
+	plain := newSnapshotManager(t)
+	key, _ := plain.AddToken(1, 1, "10.0.0.1")
+	plain.SaveSnapshot(path)
+
+	tm, _ := newEncryptedManager(t, "pw", nil)
+	if err := tm.LoadSnapshot(path); err != nil {
+		t.Fatalf("Plaintext snapshot should load with encryption enabled: %v", err)
+	}
+	if _, err := tm.GetToken(key); err != nil {
+		t.Errorf("Token should be restored: %v", err)
+	}
+}
+
+/**
+ * TestEncryptedJournal 测试加密的预写日志和快照不包含明文，可以用相同密钥恢复
+ */
+func TestEncryptedJournal(t *testing.T) {
+	dir := t.TempDir()
+	src, sm := newEncryptedManager(t, "pw", nil)
+	if err := src.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	key, _ := src.AddToken(1, 1, "10.0.0.1")
+	src.SetUserData(key, cart{Items: []string{secretItem}})
+	assertNoPlaintext(t, filepath.Join(dir, wt.JOURNAL_FILE), secretItem, key)
+	src.CloseJournal()
+
+	dst, _ := newEncryptedManager(t, "pw", sm.Salt())
+	if err := dst.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("Reopen with the same key failed: %v", err)
+	}
+	if data, _ := dst.GetUserData(key); len(data.Items) != 1 {
+		t.Errorf("Unexpected recovered user data: %+v", data)
+	}
+	dst.CloseJournal()
+	assertNoPlaintext(t, filepath.Join(dir, wt.SNAPSHOT_FILE), secretItem, key)
+
+	wrong, _ := newEncryptedManager(t, "not pw", sm.Salt())
+	if err := wrong.OpenJournal(dir, 0); !errors.Is(err, wt.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey, got %v", err)
+	}
+}
+
+/**
+ * TestRotateEncryptionKey 测试轮换密钥后后台重新加密，旧密钥无法再读取；
+ * 重新加密时快照已写入但日志未清空（模拟崩溃）也能用新密钥打开
+ */
+func TestRotateEncryptionKey(t *testing.T) {
+	dir := t.TempDir()
+	src, sm := newEncryptedManager(t, "old", nil)
+	oldSalt := sm.Salt()
+	if err := src.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	key, _ := src.AddToken(1, 1, "10.0.0.1")
+	oldID := sm.KeyID()
+
+	if err := <-src.RotateEncryptionKey("new"); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	if sm.KeyID() == oldID {
+		t.Fatal("Key should change after rotation")
+	}
+	after, _ := src.AddToken(2, 1, "10.0.0.1")
+	src.CloseJournal()
+
+	old, _ := newEncryptedManager(t, "old", oldSalt)
+	if err := old.OpenJournal(dir, 0); !errors.Is(err, wt.ErrEncryptionKey) {
+		t.Errorf("Old key should no longer open the files, got %v", err)
+	}
+
+	reopened, _ := newEncryptedManager(t, "new", sm.Salt())
+	if err := reopened.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("New key should open the files: %v", err)
+	}
+	for _, k := range []string{key, after} {
+		if _, err := reopened.GetToken(k); err != nil {
+			t.Errorf("Token should survive rotation: %v", err)
+		}
+	}
+	reopened.CloseJournal()
+
+	// 模拟压缩写入快照后、清空日志前崩溃：日志仍是轮换前用旧密钥写入的内容
+	crashDir := t.TempDir()
+	crashed, csm := newEncryptedManager(t, "old", nil)
+	crashed.OpenJournal(crashDir, 0)
+	crashKey, _ := crashed.AddToken(3, 1, "10.0.0.1")
+	staleWal, _ := os.ReadFile(filepath.Join(crashDir, wt.JOURNAL_FILE))
+	if err := <-crashed.RotateEncryptionKey("new"); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	crashed.CloseJournal()
+	os.WriteFile(filepath.Join(crashDir, wt.JOURNAL_FILE), staleWal, 0644)
+
+	recovered, _ := newEncryptedManager(t, "new", csm.Salt())
+	if err := recovered.OpenJournal(crashDir, 0); err != nil {
+		t.Fatalf("Journal already folded into the snapshot should be skipped: %v", err)
+	}
+	defer recovered.CloseJournal()
+	if _, err := recovered.GetToken(crashKey); err != nil {
+		t.Errorf("Token should be recovered from the snapshot: %v", err)
+	}
+
+	var plain models.IManager[cart] = newSnapshotManager(t)
+	if err := <-plain.RotateEncryptionKey("x"); err == nil {
+		t.Error("Rotation without encryption should fail")
+	}
+}
+
+/**
+ * TestRotateEncryptionKeyConcurrentWrites 测试后台重新加密期间的写入不会丢失，重新加密后只用新密钥就能恢复
+ */
+func TestRotateEncryptionKeyConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	src, sm := newEncryptedManager(t, "old", nil)
+	if err := src.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		src.AddToken(uint(i+1), 1, "10.0.0.1")
+	}
+
+	var keys []string
+	stop := make(chan struct{})
+	writer := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		defer close(writer)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if key, err := src.AddToken(uint(1000+i), 1, "10.0.0.1"); err == nil {
+				keys = append(keys, key)
+			}
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	err := <-src.RotateEncryptionKey("new")
+	close(stop)
+	<-writer
+	if err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	// 写入较多时最早的token会因为数量上限被淘汰，只检查关闭前仍然有效的token
+	var live []string
+	for _, key := range keys {
+		if _, err := src.GetToken(key); err == nil {
+			live = append(live, key)
+		}
+	}
+	src.CloseJournal()
+
+	reopened, _ := newEncryptedManager(t, "new", sm.Salt())
+	if err := reopened.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("New key alone should open the re-encrypted files: %v", err)
+	}
+	defer reopened.CloseJournal()
+	for _, key := range live {
+		if _, err := reopened.GetToken(key); err != nil {
+			t.Fatalf("Token written during rotation should be recovered: %v", err)
+		}
+	}
+}
+
+/**
+ * TestRotateEncryptionKeyKeyring 测试轮换后仍能读取旧密钥加密的快照，重新加密失败时仍能打开日志目录，
+ * 丢弃旧密钥后不能再读取
+ */
+func TestRotateEncryptionKeyKeyring(t *testing.T) {
+	dir := t.TempDir()
+	tm, sm := newEncryptedManager(t, "old", nil)
+	if err := tm.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	elsewhere := filepath.Join(t.TempDir(), "backup.snap")
+	if err := tm.SaveSnapshot(elsewhere); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	// 快照路径被非空目录占用，重新加密失败，日志目录中仍是旧密钥加密的文件
+	snap := filepath.Join(dir, wt.SNAPSHOT_FILE)
+	os.Remove(snap)
+	os.MkdirAll(filepath.Join(snap, "blocker"), 0o755)
+	if err := <-tm.RotateEncryptionKey("new"); err == nil {
+		t.Fatal("Rotation should report the failed re-encryption")
+	}
+	os.RemoveAll(snap)
+	tm.CloseJournal()
+	if err := tm.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("Files under the previous key should still open: %v", err)
+	}
+	tm.CloseJournal()
+	if err := tm.LoadSnapshot(elsewhere); err != nil {
+		t.Fatalf("Snapshot saved under the previous key should still load: %v", err)
+	}
+	if _, err := tm.GetToken(key); err != nil {
+		t.Errorf("Token should be restored: %v", err)
+	}
+
+	sm.RetirePreviousKeys()
+	if err := tm.LoadSnapshot(elsewhere); !errors.Is(err, wt.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey after retiring the previous key, got %v", err)
+	}
+}
+
+/**
+ * TestRotateEncryptionKeyRingLimit 测试密钥环只保留最近MAX_PREVIOUS_KEYS个旧密钥，更早的密钥在轮换时丢弃
+ */
+func TestRotateEncryptionKeyRingLimit(t *testing.T) {
+	tm, _ := newEncryptedManager(t, "first", nil)
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	path := filepath.Join(t.TempDir(), "first.snap")
+	if err := tm.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	for i := 0; i < wt.MAX_PREVIOUS_KEYS; i++ {
+		if err := <-tm.RotateEncryptionKey(fmt.Sprintf("next-%d", i)); err != nil {
+			t.Fatalf("RotateEncryptionKey failed: %v", err)
+		}
+	}
+	if err := tm.LoadSnapshot(path); err != nil {
+		t.Fatalf("Snapshot should load while its key is in the ring: %v", err)
+	}
+	if _, err := tm.GetToken(key); err != nil {
+		t.Errorf("Token should be restored: %v", err)
+	}
+
+	if err := <-tm.RotateEncryptionKey("last"); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	if err := tm.LoadSnapshot(path); !errors.Is(err, wt.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey once the key falls out of the ring, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * TestExplain 测试鉴权决策解释功能
+ */
+func TestExplain(t *testing.T) {
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{
+			ID:                 1,
+			Name:               "user",
+			AllowedAPIs:        "/api,/api/admin/health",
+			DeniedAPIs:         "/api/admin",
+			TokenExpire:        "1h",
+			AllowMultipleLogin: 1,
+		},
+		{
+			ID:                 2,
+			Name:               "empty",
+			TokenExpire:        "1h",
+			AllowMultipleLogin: 1,
+		},
+	}
+	tm, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	key, err := tm.AddToken(1, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+	emptyKey, err := tm.AddToken(2, 2, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+
+	t.Run("允许规则胜出", func(t *testing.T) {
+		d := tm.Explain(key, "10.0.0.1", "/api/admin/health/db")
+		if !d.Allowed || d.Winner == nil {
+			t.Fatalf("expected allow with a winner, got %+v", d)
+		}
+		if d.Winner.MatchLength != 3 || !d.Winner.Rule.Rule {
+			t.Errorf("unexpected winner %+v", d.Winner)
+		}
+		if len(d.Candidates) != 3 {
+			t.Errorf("expected 3 candidates, got %d", len(d.Candidates))
+		}
+		if d.GroupID != 1 || d.GroupName != "user" {
+			t.Errorf("unexpected group %d %q", d.GroupID, d.GroupName)
+		}
+	})
+
+	t.Run("拒绝规则胜出", func(t *testing.T) {
+		d := tm.Explain(key, "10.0.0.1", "/api/admin/users")
+		if d.Allowed || d.Winner == nil || d.Winner.Rule.Rule {
+			t.Fatalf("expected a deny winner, got %+v", d)
+		}
+		if d.ErrorKey != "unauthorized" {
+			t.Errorf("expected unauthorized, got %q", d.ErrorKey)
+		}
+		if err := tm.Auth(key, "10.0.0.1", "/api/admin/users"); err == nil || err.Error() != d.Reason {
+			t.Errorf("Explain reason %q does not match Auth error %v", d.Reason, err)
+		}
+	})
+
+	t.Run("没有规则匹配", func(t *testing.T) {
+		d := tm.Explain(key, "10.0.0.1", "/other")
+		if d.Allowed || d.Winner != nil {
+			t.Fatalf("expected deny without winner, got %+v", d)
+		}
+	})
+
+	t.Run("用户组没有规则", func(t *testing.T) {
+		d := tm.Explain(emptyKey, "10.0.0.2", "/api")
+		if d.Allowed || !d.GroupFound || len(d.Candidates) != 0 {
+			t.Fatalf("expected deny for empty group, got %+v", d)
+		}
+	})
+
+	t.Run("IP绑定不匹配", func(t *testing.T) {
+		d := tm.Explain(key, "10.0.0.9", "/api")
+		if d.Allowed || !d.TokenCheck.Passed || d.BindingCheck.Passed {
+			t.Fatalf("expected binding failure, got %+v", d)
+		}
+		if d.ErrorKey != "forbidden" {
+			t.Errorf("expected forbidden, got %q", d.ErrorKey)
+		}
+	})
+
+	t.Run("无效Token", func(t *testing.T) {
+		d := tm.Explain("missing", "10.0.0.1", "/api")
+		if d.Allowed || d.TokenCheck.Passed || d.TokenCheck.ErrorKey != "invalid_token" {
+			t.Fatalf("expected token failure, got %+v", d)
+		}
+	})
+}
@@ -0,0 +1,378 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * openJournaled 创建管理器并打开预写日志
+ */
+func openJournaled(t *testing.T, dir string, compactSize int64) models.IManager[cart] {
+	t.Helper()
+	tm := newSnapshotManager(t)
+	if err := tm.OpenJournal(dir, compactSize); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	return tm
+}
+
+// journalSize 获取预写日志文件的大小
+func journalSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, wt.JOURNAL_FILE))
+	if err != nil {
+		t.Fatalf("Failed to stat journal: %v", err)
+	}
+	return info.Size()
+}
+
+/**
+ * TestJournalRecovery 测试没有关闭也没有压缩时（模拟崩溃），重新打开能从快照和日志恢复所有变更
+ */
+func TestJournalRecovery(t *testing.T) {
+	dir := t.TempDir()
+	src := openJournaled(t, dir, 0)
+
+	kept, _ := src.AddToken(1, 1, "10.0.0.1")
+	src.UpdateUserData(kept, func(c *cart) error {
+		c.Items = append(c.Items, "pear")
+		return nil
+	})
+	dropped, _ := src.AddToken(2, 1, "10.0.0.1")
+	src.DelToken(dropped)
+	src.DelGroup(2)
+	acme := src.Tenant("acme")
+	acme.AddGroup(&models.GroupRaw{ID: 7, Name: "acme", AllowedAPIs: "/acme", TokenExpire: "1h"})
+	acme.SetMaxTokens(3)
+	acmeKey, _ := acme.AddToken(9, 7, "10.0.0.2")
+
+	dst := openJournaled(t, dir, 0)
+	defer dst.CloseJournal()
+	if data, err := dst.GetUserData(kept); err != nil || len(data.Items) != 1 || data.Items[0] != "pear" {
+		t.Errorf("Unexpected recovered user data: %+v, %v", data, err)
+	}
+	if _, err := dst.GetToken(dropped); err == nil {
+		t.Error("Deleted token should stay deleted after recovery")
+	}
+	if _, err := dst.GetGroup(2); err == nil {
+		t.Error("Deleted group should stay deleted after recovery")
+	}
+	if err := dst.Auth(acmeKey, "10.0.0.2", "/acme/x"); err != nil {
+		t.Errorf("Recovered tenant token should authenticate: %v", err)
+	}
+	for i := uint(10); i < 13; i++ {
+		dst.Tenant("acme").AddToken(i, 7, "10.0.0.2")
+	}
+	if stats := dst.Tenant("acme").GetStats(); stats.TotalTokens != 3 {
+		t.Errorf("Recovered tenant limit should apply, got %+v", stats)
+	}
+	if stats := dst.GetStats(); stats.TotalTokens != 4 {
+		t.Errorf("Unexpected recovered stats: %+v", stats)
+	}
+}
+
+/**
+ * TestJournalTornTail 测试写了一半的最后一条记录被截掉，之前的记录正常恢复
+ */
+func TestJournalTornTail(t *testing.T) {
+	cases := []struct {
+		name string
+		tear func(data []byte) []byte
+	}{
+		{"PartialRecord", func(data []byte) []byte {
+			return append(data, 0, 0, 0, 100, 1, 2, 3, 4, '{', '"')
+		}},
+		{"PartialHeader", func(data []byte) []byte {
+			return append(data, 0, 0)
+		}},
+		{"BadChecksum", func(data []byte) []byte {
+			data[len(data)-2] ^= 0xff
+			return data
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := openJournaled(t, dir, 0)
+			first, _ := src.AddToken(1, 1, "10.0.0.1")
+			last, _ := src.AddToken(2, 1, "10.0.0.1")
+			src.CloseJournal()
+
+			path := filepath.Join(dir, wt.JOURNAL_FILE)
+			data, _ := os.ReadFile(path)
+			os.WriteFile(path, c.tear(data), 0644)
+
+			dst := openJournaled(t, dir, 0)
+			defer dst.CloseJournal()
+			if _, err := dst.GetToken(first); err != nil {
+				t.Errorf("Records before the torn tail should be recovered: %v", err)
+			}
+			_, err := dst.GetToken(last)
+			if c.name == "BadChecksum" && err == nil {
+				t.Error("Record with a bad checksum should be dropped")
+			}
+			if c.name != "BadChecksum" && err != nil {
+				t.Errorf("Complete last record should be recovered: %v", err)
+			}
+		})
+	}
+}
+
+/**
+ * TestJournalCorrupt 测试中间的记录损坏时拒绝打开，不静默丢弃之后的变更
+ */
+func TestJournalCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	src := openJournaled(t, dir, 0)
+	src.AddToken(1, 1, "10.0.0.1")
+	src.AddToken(2, 1, "10.0.0.1")
+	src.CloseJournal()
+
+	path := filepath.Join(dir, wt.JOURNAL_FILE)
+	data, _ := os.ReadFile(path)
+	// 文件头16字节，第一条记录的长度和校验和8字节，之后是第一条记录的内容
+	data[30] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	if err := newSnapshotManager(t).OpenJournal(dir, 0); !errors.Is(err, wt.ErrJournalCorrupt) {
+		t.Errorf("Expected ErrJournalCorrupt, got %v", err)
+	}
+
+	data[4], data[5] = 0, 99
+	os.WriteFile(path, data, 0644)
+	if err := newSnapshotManager(t).OpenJournal(dir, 0); !errors.Is(err, wt.ErrJournalVersion) {
+		t.Errorf("Expected ErrJournalVersion, got %v", err)
+	}
+}
+
+/**
+ * TestJournalCompact 测试手动和自动压缩会清空日志，压缩后的快照可以正常恢复
+ */
+func TestJournalCompact(t *testing.T) {
+	dir := t.TempDir()
+	src := openJournaled(t, dir, 0)
+	empty := journalSize(t, dir)
+	key, _ := src.AddToken(1, 1, "10.0.0.1")
+	if journalSize(t, dir) <= empty {
+		t.Fatal("Mutation should be appended to the journal")
+	}
+	if err := src.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if size := journalSize(t, dir); size != empty {
+		t.Errorf("Journal should be empty after compaction, got %d bytes", size)
+	}
+	src.CloseJournal()
+	if err := src.Compact(); err == nil {
+		t.Error("Compact without an open journal should fail")
+	}
+
+	auto := openJournaled(t, dir, 1)
+	defer auto.CloseJournal()
+	if _, err := auto.GetToken(key); err != nil {
+		t.Errorf("Token should be recovered from the compacted snapshot: %v", err)
+	}
+	auto.AddToken(2, 1, "10.0.0.1")
+	if size := journalSize(t, dir); size != empty {
+		t.Errorf("Journal should be compacted automatically, got %d bytes", size)
+	}
+	if err := auto.OpenJournal(dir, 0); err == nil {
+		t.Error("Opening the journal twice should fail")
+	}
+}
+
+// txFailingStore 支持事务的存储，删除在提交时才生效，commitErr不为nil时提交失败
+type txFailingStore struct {
+	*wt.MemoryTokenStore[cart]
+	inTx      bool
+	pending   []string
+	commitErr error
+}
+
+func (s *txFailingStore) Begin() error {
+	s.inTx = true
+	return nil
+}
+
+func (s *txFailingStore) Delete(key string) error {
+	if s.inTx {
+		s.pending = append(s.pending, key)
+		return nil
+	}
+	return s.MemoryTokenStore.Delete(key)
+}
+
+func (s *txFailingStore) Commit() error {
+	pending := s.pending
+	s.inTx, s.pending = false, nil
+	if s.commitErr != nil {
+		return s.commitErr
+	}
+	for _, key := range pending {
+		s.MemoryTokenStore.Delete(key)
+	}
+	return nil
+}
+
+func (s *txFailingStore) Rollback() error {
+	s.inTx, s.pending = false, nil
+	return nil
+}
+
+/**
+ * TestJournalTxCommitFailure 测试事务提交失败时预写日志不记录删除，重新打开后token仍然存在
+ */
+func TestJournalTxCommitFailure(t *testing.T) {
+	dir := t.TempDir()
+	store := &txFailingStore{MemoryTokenStore: wt.NewMemoryTokenStore[cart]()}
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1}}
+	src, err := wt.InitTMWithStore[cart](config, groups, store)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	if err := src.OpenJournal(dir, 0); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	key, _ := src.AddToken(1, 1, "10.0.0.1")
+	src.AddToken(1, 1, "10.0.0.2")
+	size := journalSize(t, dir)
+
+	broken := errors.New("commit failed")
+	store.commitErr = broken
+	if err := src.DelTokensByUserID(1); !errors.Is(err, broken) {
+		t.Fatalf("DelTokensByUserID error = %v, expected the commit error", err)
+	}
+	if got := journalSize(t, dir); got != size {
+		t.Errorf("Journal grew from %d to %d bytes for a rolled back deletion", size, got)
+	}
+	if _, err := src.GetToken(key); err != nil {
+		t.Errorf("Token should survive the failed commit: %v", err)
+	}
+
+	// 提交恢复正常后日志可以继续写入
+	store.commitErr = nil
+	other, _ := src.AddToken(2, 1, "10.0.0.1")
+	dst := openJournaled(t, dir, 0)
+	defer dst.CloseJournal()
+	if _, err := dst.GetToken(key); err != nil {
+		t.Errorf("Token should be recovered after the failed deletion: %v", err)
+	}
+	if _, err := dst.GetToken(other); err != nil {
+		t.Errorf("Token added after the failure should be recovered: %v", err)
+	}
+}
+
+/**
+ * TestJournalSharedData 测试共享数据的修改写入日志，用户的token全部删除后重新登录不会恢复旧的共享数据
+ */
+func TestJournalSharedData(t *testing.T) {
+	dir := t.TempDir()
+	src := openJournaled(t, dir, 0)
+	src.AddToken(1, 1, "10.0.0.1")
+	src.AddToken(1, 1, "10.0.0.2")
+	src.UpdateSharedData(1, func(c *cart) error {
+		c.Total = 5
+		return nil
+	})
+	gone, _ := src.AddToken(2, 1, "10.0.0.1")
+	src.UpdateSharedData(2, func(c *cart) error {
+		c.Items = append(c.Items, "stale")
+		return nil
+	})
+	src.DelToken(gone)
+	src.AddToken(2, 1, "10.0.0.1")
+
+	dst := openJournaled(t, dir, 0)
+	if data, err := dst.GetSharedData(1); err != nil || data.Total != 5 {
+		t.Errorf("Shared data should be recovered from the journal: %+v, %v", data, err)
+	}
+	if data, err := dst.GetSharedData(2); err != nil || len(data.Items) != 0 {
+		t.Errorf("Shared data released on logout should not come back: %+v, %v", data, err)
+	}
+
+	// 压缩后从快照恢复
+	if err := dst.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	dst.CloseJournal()
+	again := openJournaled(t, dir, 0)
+	defer again.CloseJournal()
+	if data, err := again.GetSharedData(1); err != nil || data.Total != 5 {
+		t.Errorf("Shared data should be recovered from the snapshot: %+v, %v", data, err)
+	}
+}
+
+/**
+ * TestJournalBootstrapKeepsState 测试目录中没有快照时打开日志，不清除现有的共享数据和限流状态
+ */
+func TestJournalBootstrapKeepsState(t *testing.T) {
+	tm, _ := newRateLimitManager(t, "")
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	tm.UpdateSharedData(1, func(s *string) error {
+		*s = "cart"
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		if err := tm.Auth(key, "10.0.0.1", "/api"); err != nil {
+			t.Fatalf("Request %d should be allowed: %v", i, err)
+		}
+	}
+
+	if err := tm.OpenJournal(t.TempDir(), 0); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer tm.CloseJournal()
+	if data, err := tm.GetSharedData(1); err != nil || data != "cart" {
+		t.Errorf("Shared data should survive opening the journal: %q, %v", data, err)
+	}
+	if err := tm.Auth(key, "10.0.0.1", "/api"); err == nil {
+		t.Error("Rate limit bucket should survive opening the journal")
+	}
+}
+
+/**
+ * TestJournalCompactError 测试自动压缩失败时调用错误回调，变更仍然生效，恢复后再次压缩成功
+ */
+func TestJournalCompactError(t *testing.T) {
+	dir := t.TempDir()
+	tm := newSnapshotManager(t).(*wt.Manager[cart])
+	var errs []error
+	tm.SetJournalErrorHandler(func(err error) { errs = append(errs, err) })
+	if err := tm.OpenJournal(dir, 1); err != nil {
+		t.Fatalf("OpenJournal failed: %v", err)
+	}
+	defer tm.CloseJournal()
+
+	// 快照路径被非空目录占用，重命名临时文件失败
+	snap := filepath.Join(dir, wt.SNAPSHOT_FILE)
+	os.Remove(snap)
+	if err := os.MkdirAll(filepath.Join(snap, "blocker"), 0o755); err != nil {
+		t.Fatalf("Failed to block snapshot path: %v", err)
+	}
+	key, err := tm.AddToken(1, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("AddToken should succeed when compaction fails: %v", err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("Expected one compaction error, got %v", errs)
+	}
+	if _, err := tm.GetToken(key); err != nil {
+		t.Errorf("Token should be added despite the compaction error: %v", err)
+	}
+
+	os.RemoveAll(snap)
+	tm.AddToken(2, 1, "10.0.0.1")
+	if len(errs) != 1 {
+		t.Errorf("Compaction should succeed once the path is free, got %v", errs)
+	}
+	if _, err := os.Stat(snap); err != nil {
+		t.Errorf("Snapshot should be written by the retried compaction: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/kvstore"
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/storetest"
+)
+
+/**
+ * openKVStore 打开键值文件存储，测试结束时关闭
+ */
+func openKVStore(t *testing.T, path string) *kvstore.Store[storetest.Data] {
+	t.Helper()
+	store, err := kvstore.Open(path, kvstore.Options[storetest.Data]{})
+	if err != nil {
+		t.Fatalf("Failed to open KV store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+/**
+ * TestKVTokenStore 键值文件存储的一致性测试
+ */
+func TestKVTokenStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) models.TokenStore[storetest.Data] {
+		return openKVStore(t, filepath.Join(t.TempDir(), "tokens.kv"))
+	})
+}
+
+/**
+ * TestKVStoreReopen 测试token、访问时间和索引在重新打开后恢复
+ */
+func TestKVStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.kv")
+	store := openKVStore(t, path)
+	tok := storetest.NewToken("acme", 1, 2)
+	store.Put("k1", tok)
+	store.Put("k2", storetest.NewToken("", 3, 4))
+	store.Put("gone", storetest.NewToken("", 3, 4))
+	store.Delete("gone")
+	at := tok.LastAccessTime.Add(time.Minute)
+	store.Touch("k1", at)
+	store.Close()
+
+	reopened := openKVStore(t, path)
+	got, err := reopened.Get("k1")
+	if err != nil || got == nil || got.UserData.Name != "user" || !got.LastAccessTime.Equal(at) {
+		t.Fatalf("Reopened token = %+v, %v", got, err)
+	}
+	if keys, _ := reopened.KeysByUser("acme", 1); !slices.Equal(keys, []string{"k1"}) {
+		t.Errorf("User index after reopen = %v", keys)
+	}
+	if keys, _ := reopened.KeysByGroup("", 4); !slices.Equal(keys, []string{"k2"}) {
+		t.Errorf("Group index after reopen = %v", keys)
+	}
+	if n, _ := reopened.Len(); n != 2 {
+		t.Errorf("Len after reopen = %d, expected 2", n)
+	}
+}
+
+/**
+ * TestKVStoreTransaction 测试事务中的读写、回滚，以及写了一半的事务在重新打开后整体丢弃
+ */
+func TestKVStoreTransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.kv")
+	store := openKVStore(t, path)
+	for _, key := range []string{"a", "b", "c"} {
+		store.Put(key, storetest.NewToken("", 1, 1))
+	}
+
+	// 回滚后数据不变
+	store.Begin()
+	store.Delete("a")
+	if tok, _ := store.Get("a"); tok != nil {
+		t.Error("Delete should be visible inside the transaction")
+	}
+	if err := store.Begin(); !errors.Is(err, kvstore.ErrTxActive) {
+		t.Errorf("Nested Begin should fail, got %v", err)
+	}
+	store.Rollback()
+	if tok, _ := store.Get("a"); tok == nil {
+		t.Fatal("Rolled back delete should not take effect")
+	}
+
+	// 提交的事务是一条记录，截掉它的最后一个字节相当于写到一半时崩溃
+	before, _ := os.Stat(path)
+	store.Begin()
+	for _, key := range []string{"a", "b", "c"} {
+		store.Delete(key)
+	}
+	if keys, _ := store.KeysByUser("", 1); len(keys) != 3 {
+		t.Errorf("Index should change only after commit, got %v", keys)
+	}
+	if err := store.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if n, _ := store.Len(); n != 0 {
+		t.Errorf("Len after commit = %d, expected 0", n)
+	}
+	store.Close()
+
+	after, _ := os.Stat(path)
+	if err := os.Truncate(path, after.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	reopened := openKVStore(t, path)
+	if n, _ := reopened.Len(); n != 3 {
+		t.Errorf("Torn transaction should be discarded as a whole, Len = %d", n)
+	}
+	if info, _ := os.Stat(path); info.Size() != before.Size() {
+		t.Errorf("Torn record should be truncated, size %d, expected %d", info.Size(), before.Size())
+	}
+}
+
+/**
+ * TestKVStoreBatchDelete 测试管理器的批量删除在一个事务中完成，只写入一条记录
+ */
+func TestKVStoreBatchDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.kv")
+	store := openKVStore(t, path)
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1}}
+	tm, err := wt.InitTMWithStore[storetest.Data](config, groups, store)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	for _, userID := range []uint{1, 1, 2, 3} {
+		if _, err := tm.AddToken(userID, 1, "10.0.0.1"); err != nil {
+			t.Fatalf("AddToken failed: %v", err)
+		}
+	}
+	survivor, _ := tm.AddToken(4, 1, "10.0.0.1")
+	store.Close()
+
+	// 重新打开以获得确定的文件大小，再执行批量删除
+	store = openKVStore(t, path)
+	tm, _ = wt.InitTMWithStore[storetest.Data](config, groups, store)
+	before, _ := os.Stat(path)
+	if err := tm.BatchDeleteTokensByUserIDs([]uint{1, 2, 3}); err != nil {
+		t.Fatalf("BatchDeleteTokensByUserIDs failed: %v", err)
+	}
+	if stats := tm.GetStats(); stats.TotalTokens != 1 {
+		t.Errorf("stats after batch delete = %+v", stats)
+	}
+	store.Close()
+
+	// 截掉批量删除的记录的最后一个字节：所有删除一起丢失，而不是只丢失一部分
+	after, _ := os.Stat(path)
+	if after.Size() <= before.Size() {
+		t.Fatalf("Batch delete should append to the file")
+	}
+	os.Truncate(path, after.Size()-1)
+	reopened := openKVStore(t, path)
+	if n, _ := reopened.Len(); n != 5 {
+		t.Errorf("Batch delete should be all-or-nothing, %d tokens left", n)
+	}
+	if tok, _ := reopened.Get(survivor); tok == nil {
+		t.Error("Survivor token should be kept")
+	}
+}
+
+// rangeCountingStore 统计Range调用次数，用于确认清理过期token时没有遍历所有token
+type rangeCountingStore struct {
+	*kvstore.Store[storetest.Data]
+	ranges int
+}
+
+func (s *rangeCountingStore) Range(fn func(key string, t *models.Token[storetest.Data]) bool) error {
+	s.ranges++
+	return s.Store.Range(fn)
+}
+
+/**
+ * TestKVStoreExpiryIndex 测试过期时间索引，以及CleanExpiredTokens只读取已过期的token
+ */
+func TestKVStoreExpiryIndex(t *testing.T) {
+	store := openKVStore(t, filepath.Join(t.TempDir(), "tokens.kv"))
+	now := time.Now()
+	for i, offset := range []time.Duration{-3 * time.Hour, -2 * time.Hour, time.Hour} {
+		tok := storetest.NewToken("", uint(i+1), 1)
+		tok.LoginTime = now.Add(offset - time.Hour)
+		store.Put([]string{"stale", "expired", "live"}[i], tok)
+	}
+	forever := storetest.NewToken("", 9, 1)
+	forever.ExpireSeconds = 0
+	forever.LoginTime = now.Add(-24 * time.Hour)
+	store.Put("forever", forever)
+
+	keys, _ := store.ExpiredKeys(now)
+	if !slices.Equal(keys, []string{"stale", "expired"}) {
+		t.Errorf("ExpiredKeys = %v, expected oldest first", keys)
+	}
+
+	// 重新保存后使用新的过期时间
+	renewed, _ := store.Get("stale")
+	renewed.LoginTime = now
+	store.Put("stale", renewed)
+	if keys, _ := store.ExpiredKeys(now); !slices.Equal(keys, []string{"expired"}) {
+		t.Errorf("ExpiredKeys after renewal = %v", keys)
+	}
+
+	counting := &rangeCountingStore{Store: store}
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	tm, err := wt.InitTMWithStore[storetest.Data](config, nil, counting)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	counting.ranges = 0
+	tm.CleanExpiredTokens()
+	if counting.ranges != 0 {
+		t.Errorf("CleanExpiredTokens should use the expiry index, got %d Range calls", counting.ranges)
+	}
+	if tok, _ := store.Get("expired"); tok != nil {
+		t.Error("Expired token should be cleaned")
+	}
+	if n, _ := store.Len(); n != 3 {
+		t.Errorf("Len after cleaning = %d, expected 3", n)
+	}
+	if stats := tm.GetStats(); stats.ExpiredTokens != 1 || stats.TotalTokens != 3 {
+		t.Errorf("stats after cleaning = %+v", stats)
+	}
+}
+
+/**
+ * TestKVStoreCorrupt 测试中间的记录损坏时拒绝打开，而不是静默丢弃之后的数据
+ */
+func TestKVStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.kv")
+	store := openKVStore(t, path)
+	store.Put("a", storetest.NewToken("", 1, 1))
+	store.Put("b", storetest.NewToken("", 1, 1))
+	store.Close()
+
+	data, _ := os.ReadFile(path)
+	data[30] ^= 0xff
+	os.WriteFile(path, data, 0o600)
+	if _, err := kvstore.Open(path, kvstore.Options[storetest.Data]{}); !errors.Is(err, kvstore.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("not a kv file at all"), 0o600)
+	if _, err := kvstore.Open(path, kvstore.Options[storetest.Data]{}); !errors.Is(err, kvstore.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a foreign file, got %v", err)
+	}
+}
+
+/**
+ * TestKVStoreCompact 测试压缩去掉被覆盖的数据，以及超过阈值时自动压缩
+ */
+func TestKVStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.kv")
+	store := openKVStore(t, path)
+	tok := storetest.NewToken("", 1, 1)
+	store.Put("k1", tok)
+	last := tok.LastAccessTime
+	for i := 1; i <= 200; i++ {
+		last = tok.LastAccessTime.Add(time.Duration(i) * time.Second)
+		store.Touch("k1", last)
+	}
+	grown, _ := os.Stat(path)
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	compacted, _ := os.Stat(path)
+	if compacted.Size() >= grown.Size()/4 {
+		t.Errorf("Compact should drop overwritten access times: %d -> %d bytes", grown.Size(), compacted.Size())
+	}
+	store.Put("k2", storetest.NewToken("", 2, 1))
+	store.Close()
+
+	reopened := openKVStore(t, path)
+	if got, _ := reopened.Get("k1"); got == nil || !got.LastAccessTime.Equal(last) {
+		t.Errorf("Token after compaction = %+v", got)
+	}
+	if got, _ := reopened.Get("k2"); got == nil {
+		t.Error("Writes after compaction should be kept")
+	}
+	reopened.Close()
+
+	// 自动压缩：阈值很小时文件大小保持在有效数据的两倍左右
+	auto, err := kvstore.Open(path, kvstore.Options[storetest.Data]{CompactSize: 1024})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer auto.Close()
+	for i := 0; i < 500; i++ {
+		auto.Touch("k1", last.Add(time.Duration(i)*time.Millisecond))
+	}
+	if info, _ := os.Stat(path); info.Size() > 4096 {
+		t.Errorf("Auto compaction should bound the file size, got %d bytes", info.Size())
+	}
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * TestLintGroups 测试策略检查能发现各类问题
+ */
+func TestLintGroups(t *testing.T) {
+	groups := []models.GroupRaw{
+		{
+			ID:          1,
+			Name:        "mixed",
+			AllowedAPIs: "/api,/api/admin/users,/api/orders,/api/orders,/api/report,/api/v1?x=1",
+			DeniedAPIs:  "/api/admin,/api/report,/internal",
+			TokenExpire: "1.5h",
+		},
+		{
+			ID:          2,
+			Name:        "deny-only",
+			DeniedAPIs:  "/api",
+			TokenExpire: "1h",
+		},
+		{
+			ID:          3,
+			Name:        "clean",
+			AllowedAPIs: "/api",
+			DeniedAPIs:  "/api/admin",
+			TokenExpire: "0s",
+		},
+	}
+	findings := wt.LintGroups(groups)
+
+	type key struct {
+		code  string
+		group uint
+		rule  string
+	}
+	got := make(map[key]models.LintSeverity)
+	for _, f := range findings {
+		got[key{f.Code, f.GroupID, f.Rule}] = f.Severity
+	}
+	expected := map[key]models.LintSeverity{
+		{wt.LintInvalidTokenExpire, 1, ""}:           models.LintError,
+		{wt.LintDuplicateRule, 1, "/api/orders"}:     models.LintWarning,
+		{wt.LintAllowDenyConflict, 1, "/api/report"}: models.LintError,
+		{wt.LintRedundantRule, 1, "/api/orders"}:     models.LintWarning,
+		{wt.LintRedundantRule, 1, "/internal"}:       models.LintWarning,
+		{wt.LintDenyOverridden, 1, "/api/admin"}:     models.LintInfo,
+		{wt.LintUnreachableRule, 1, "/api/v1?x=1"}:   models.LintError,
+		{wt.LintNoAllowRules, 2, ""}:                 models.LintError,
+		{wt.LintRedundantRule, 2, "/api"}:            models.LintWarning,
+	}
+	for k, severity := range expected {
+		if got[k] != severity {
+			t.Errorf("expected finding %+v with severity %q, got %q", k, severity, got[k])
+		}
+	}
+	for _, f := range findings {
+		if f.GroupID == 3 {
+			t.Errorf("unexpected finding for clean group: %+v", f)
+		}
+	}
+	// /api/admin/users覆盖了上级禁止规则，不是冗余规则
+	if _, ok := got[key{wt.LintRedundantRule, 1, "/api/admin/users"}]; ok {
+		t.Errorf("allow rule under a deny rule must not be reported as redundant")
+	}
+}
+
+/**
+ * TestLintGroupsDelimiter 测试默认按空白和逗号拆分，其他分隔符通过选项指定
+ */
+func TestLintGroupsDelimiter(t *testing.T) {
+	spaced := []models.GroupRaw{{ID: 1, Name: "spaced", AllowedAPIs: "/api /api", TokenExpire: "1h"}}
+	if findings := wt.LintGroups(spaced); len(findings) != 1 || findings[0].Code != wt.LintDuplicateRule {
+		t.Errorf("expected space separated rules to be split by default, got %+v", findings)
+	}
+
+	piped := []models.GroupRaw{{ID: 1, Name: "piped", AllowedAPIs: "/api|/api/admin", DeniedAPIs: "/api/admin", TokenExpire: "1h"}}
+	findings := wt.LintGroupsWithOptions(piped, wt.LintOptions{Delimiter: "|"})
+	found := false
+	for _, f := range findings {
+		found = found || (f.Code == wt.LintAllowDenyConflict && f.Rule == "/api/admin")
+	}
+	if !found {
+		t.Errorf("expected conflict with a custom delimiter, got %+v", findings)
+	}
+}
+
+/**
+ * TestLintGroupsOrder 测试检查结果按用户组ID、规则路径和问题编码排序，与配置中的书写顺序无关
+ */
+func TestLintGroupsOrder(t *testing.T) {
+	groups := []models.GroupRaw{
+		{ID: 2, Name: "second", AllowedAPIs: "/b,/b,/a,/a", TokenExpire: "1h"},
+		{ID: 1, Name: "first", AllowedAPIs: "/api,/z,/z,/m", DeniedAPIs: "/z,/m", TokenExpire: "1h"},
+	}
+	findings := wt.LintGroups(groups)
+	expected := []struct {
+		group uint
+		rule  string
+		code  string
+	}{
+		{1, "/m", wt.LintAllowDenyConflict},
+		{1, "/z", wt.LintDuplicateRule},
+		{1, "/z", wt.LintAllowDenyConflict},
+		{2, "/a", wt.LintDuplicateRule},
+		{2, "/b", wt.LintDuplicateRule},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("got %d findings, expected %d: %+v", len(findings), len(expected), findings)
+	}
+	for i, e := range expected {
+		f := findings[i]
+		if f.GroupID != e.group || f.Rule != e.rule || f.Code != e.code {
+			t.Errorf("finding %d = %d %s %s, expected %d %s %s", i, f.GroupID, f.Rule, f.Code, e.group, e.rule, e.code)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * TestNetworkPolicyPermits 测试网段允许/禁止列表的判断逻辑
+ */
+func TestNetworkPolicyPermits(t *testing.T) {
+	p, err := models.ParseNetworkPolicy([]string{"10.0.0.0/8", "192.168.1.7", "2001:db8::/32"}, []string{"10.9.0.0/16"})
+	if err != nil {
+		t.Fatalf("ParseNetworkPolicy failed: %v", err)
+	}
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.1.2.3", true},
+		{"10.9.1.1", false},
+		{"192.168.1.7", true},
+		{"192.168.1.8", false},
+		{"::ffff:10.1.2.3", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"not-an-ip", false},
+	}
+	for _, tt := range tests {
+		if got := p.Permits(tt.ip); got != tt.expected {
+			t.Errorf("Permits(%q) = %v, expected %v", tt.ip, got, tt.expected)
+		}
+	}
+
+	if _, err := models.ParseNetworkPolicy([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Errorf("expected invalid prefix to be rejected")
+	}
+	var none *models.NetworkPolicy
+	if !none.Permits("1.2.3.4") {
+		t.Errorf("nil policy should permit everything")
+	}
+}
+
+/**
+ * TestAuthNetworkPolicy 测试AddToken和Auth对网络限制的检查
+ */
+func TestAuthNetworkPolicy(t *testing.T) {
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{
+			ID:                 1,
+			Name:               "admin",
+			AllowedAPIs:        "/api,/api/danger",
+			TokenExpire:        "1h",
+			AllowMultipleLogin: 1,
+			AllowCIDRs:         []string{"10.0.0.0/8", "172.16.0.0/12"},
+			DenyCIDRs:          []string{"10.66.0.0/16"},
+			RuleConditions: map[string]models.RuleCondition{
+				"/api/danger": {AllowCIDRs: []string{"10.1.0.0/16"}},
+			},
+		},
+	}
+	tm, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+
+	if _, err := tm.AddToken(1, 1, "8.8.8.8"); err == nil || err.Error() != "IP not allowed" {
+		t.Errorf("expected login from outside the office network to fail, got %v", err)
+	}
+	if _, err := tm.AddToken(1, 1, "10.66.1.1"); err == nil {
+		t.Errorf("expected login from a denied range to fail")
+	}
+
+	office, err := tm.AddToken(1, 1, "10.1.2.3")
+	if err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+	vpn, err := tm.AddToken(2, 1, "172.16.5.5")
+	if err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+
+	if err := tm.Auth(office, "10.1.2.3", "/api/danger/drop"); err != nil {
+		t.Errorf("expected office access to danger API, got %v", err)
+	}
+	if err := tm.Auth(vpn, "172.16.5.5", "/api/users"); err != nil {
+		t.Errorf("expected VPN access to normal API, got %v", err)
+	}
+	err = tm.Auth(vpn, "172.16.5.5", "/api/danger/drop")
+	if err == nil || err.Error() != "IP not allowed" {
+		t.Errorf("expected rule network restriction, got %v", err)
+	}
+
+	// 用户组网络配置变更后，已登录的token在Auth时同样受限
+	groups[0].DenyCIDRs = []string{"172.16.0.0/12"}
+	if err := tm.UpdateGroup(1, &groups[0]); err != nil {
+		t.Fatalf("UpdateGroup failed: %v", err)
+	}
+	d := tm.Explain(vpn, "172.16.5.5", "/api/users")
+	if d.ErrorKey != "ip_not_allowed" || len(d.Conditions) != 1 || d.Conditions[0].Kind != "network" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
+
+/**
+ * TestValidateGroupRawNetwork 测试网络限制配置校验
+ */
+func TestValidateGroupRawNetwork(t *testing.T) {
+	group := models.GroupRaw{ID: 1, Name: "g", AllowCIDRs: []string{"office"}}
+	if err := wt.ValidateGroupRaw(group); err == nil {
+		t.Errorf("expected invalid CIDR to be rejected")
+	}
+	group = models.GroupRaw{ID: 1, Name: "g", AllowedAPIs: "/api", RuleConditions: map[string]models.RuleCondition{
+		"/api": {DenyCIDRs: []string{"1.2.3.4/99"}},
+	}}
+	if err := wt.ValidateGroupRaw(group); err == nil {
+		t.Errorf("expected invalid rule CIDR to be rejected")
+	}
+}
+
+/**
+ * TestGroupMutationsValidate 测试AddGroup、UpdateGroup和UpdateAllGroup拒绝无效配置，原有用户组保持不变
+ */
+func TestGroupMutationsValidate(t *testing.T) {
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	valid := models.GroupRaw{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h"}
+	tm, err := wt.InitTM[any](config, []models.GroupRaw{valid})
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+
+	invalid := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", AllowCIDRs: []string{"office"}},
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TimeWindows: []models.TimeWindow{{Start: "25:00", End: "26:00"}}},
+		{ID: 1, Name: "user", AllowedAPIs: "/api", RateLimit: &models.RateLimit{Requests: 10, Per: "fortnight"}},
+		{ID: 1, Name: "user", AllowedAPIs: "/api", Quotas: []models.Quota{{API: "/api", Limit: 0, Period: "day"}}},
+	}
+	for i, raw := range invalid {
+		if err := tm.UpdateGroup(1, &raw); err == nil {
+			t.Errorf("case %d: expected UpdateGroup to reject invalid config", i)
+		}
+		raw.ID = 2
+		if err := tm.AddGroup(&raw); err == nil {
+			t.Errorf("case %d: expected AddGroup to reject invalid config", i)
+		}
+		if err := tm.UpdateAllGroup([]models.GroupRaw{valid, raw}); err == nil {
+			t.Errorf("case %d: expected UpdateAllGroup to reject invalid config", i)
+		}
+	}
+
+	g, err := tm.GetGroup(1)
+	if err != nil || g.Network != nil || g.RateLimit != nil || len(g.TimeWindows) != 0 {
+		t.Errorf("rejected updates should leave the group unchanged, got %+v, %v", g, err)
+	}
+	if _, err := tm.GetGroup(2); err == nil {
+		t.Errorf("rejected group should not be added")
+	}
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * TestRunPolicyTests 测试策略测试用例的加载与执行
+ */
+func TestRunPolicyTests(t *testing.T) {
+	suite, err := wt.LoadPolicyTests(strings.NewReader(`schemaVersion: 1
+cases:
+  - group: 2
+    method: GET
+    path: /api/admin/users
+    expect: deny
+  - name: user can read profile
+    group: 2
+    path: /api/user/profile
+    expect: allow
+  - group: 2
+    path: /api/user/admin
+    expect: allow
+  - group: 9
+    path: /api
+    expect: allow
+`))
+	if err != nil {
+		t.Fatalf("LoadPolicyTests failed: %v", err)
+	}
+
+	groups := []models.GroupRaw{
+		{ID: 2, Name: "user", AllowedAPIs: "/api/user", DeniedAPIs: "/api/user/admin"},
+	}
+	results := wt.RunPolicyTests(groups, models.ConfigRaw{Delimiter: ",", Language: "en"}, suite.Cases)
+	passed := []bool{true, true, false, false}
+	for i, r := range results {
+		if r.Passed != passed[i] {
+			t.Errorf("case %q: passed = %v, expected %v", r.Case.Name, r.Passed, passed[i])
+		}
+		if r.Passed != (r.Detail == nil) {
+			t.Errorf("case %q: detail should only be attached to failures", r.Case.Name)
+		}
+	}
+	if results[0].Case.Name != "group 2 GET /api/admin/users" {
+		t.Errorf("unexpected default case name %q", results[0].Case.Name)
+	}
+	if w := results[2].Detail.Winner; w == nil || w.Rule.Rule || w.MatchLength != 3 {
+		t.Errorf("expected deny winner in detail, got %+v", w)
+	}
+	if results[3].Detail.GroupFound {
+		t.Errorf("expected missing group in detail")
+	}
+	if reason := results[2].Detail.Reason; reason != "Unauthorized access" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+
+	// 决策原因使用配置的语言
+	zh := wt.RunPolicyTests(groups, models.ConfigRaw{Delimiter: ",", Language: "zh"}, suite.Cases)
+	if zh[2].Detail.Reason != "未授权访问" || zh[3].Detail.Reason != "用户组不存在" {
+		t.Errorf("expected reasons in Chinese, got %q and %q", zh[2].Detail.Reason, zh[3].Detail.Reason)
+	}
+
+	var out bytes.Buffer
+	if err := wt.FormatPolicyTestResults(&out, results); err == nil {
+		t.Errorf("expected an error when cases fail")
+	}
+	for _, want := range []string{"PASS user can read profile", "FAIL group 2 /api/user/admin: expected allow, got deny", "winner /api/user/admin rule=deny length=3", "2 passed, 2 failed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+/**
+ * TestLoadPolicyTestsValidation 测试用例文件的校验错误带有位置
+ */
+func TestLoadPolicyTestsValidation(t *testing.T) {
+	_, err := wt.LoadPolicyTests(strings.NewReader("schemaVersion: 1\ncases:\n  - group: 1\n    path: /api\n    expect: maybe\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 5: cases[0].expect") {
+		t.Errorf("expected located expect error, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+const samplePolicyYAML = `schemaVersion: 1
+metadata:
+  owner: platform-team
+expiry:
+  defaultTokenExpire: 2h
+groups:
+  - id: 1
+    name: admin
+    allow:
+      - /api
+    deny:
+      - /api/billing
+    allowMultipleLogin: true
+    allowCidrs: [10.0.0.0/8]
+  - id: 2
+    name: user
+    allow: [/api/user]
+    tokenExpire: 30m
+    ruleConditions:
+      /api/user:
+        timeWindows:
+          - start: "08:00"
+            end: "20:00"
+`
+
+/**
+ * TestLoadPolicyYAML 测试加载YAML策略并用于初始化管理器
+ */
+func TestLoadPolicyYAML(t *testing.T) {
+	p, err := wt.LoadPolicy(strings.NewReader(samplePolicyYAML))
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+	if p.Metadata["owner"] != "platform-team" || len(p.Groups) != 2 {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+
+	groups, err := wt.PolicyGroups(p, ",")
+	if err != nil {
+		t.Fatalf("PolicyGroups failed: %v", err)
+	}
+	if groups[0].TokenExpire != "2h" || groups[1].TokenExpire != "30m" {
+		t.Errorf("default expiry not applied: %q %q", groups[0].TokenExpire, groups[1].TokenExpire)
+	}
+	if groups[0].AllowMultipleLogin != 1 || groups[0].DeniedAPIs != "/api/billing" {
+		t.Errorf("unexpected group %+v", groups[0])
+	}
+
+	tm, err := wt.InitTM[string](models.ConfigRaw{Delimiter: ",", TokenRenewTime: "1h"}, groups)
+	if err != nil {
+		t.Fatalf("InitTM failed: %v", err)
+	}
+	key, err := tm.AddToken(1, 1, "10.1.1.1")
+	if err != nil {
+		t.Fatalf("AddToken failed: %v", err)
+	}
+	if err := tm.Auth(key, "10.1.1.1", "/api/orders"); err != nil {
+		t.Errorf("expected access, got %v", err)
+	}
+	if err := tm.Auth(key, "10.1.1.1", "/api/billing/invoices"); err == nil {
+		t.Errorf("expected billing to be denied")
+	}
+}
+
+/**
+ * TestLoadPolicyJSONRoundTrip 测试JSON与YAML导出后可以重新加载
+ */
+func TestLoadPolicyJSONRoundTrip(t *testing.T) {
+	raw := []models.GroupRaw{
+		{ID: 3, Name: "ops", AllowedAPIs: "/ops /metrics", DeniedAPIs: "/ops/shutdown", TokenExpire: "1h"},
+	}
+	p := wt.PolicyFromGroups(raw, " ")
+	p.Metadata = map[string]string{"ticket": "OPS-1"}
+
+	for _, format := range []wt.PolicyFormat{wt.PolicyFormatJSON, wt.PolicyFormatYAML} {
+		var buf bytes.Buffer
+		if err := wt.ExportPolicy(&buf, p, format); err != nil {
+			t.Fatalf("ExportPolicy(%s) failed: %v", format, err)
+		}
+		loaded, err := wt.LoadPolicy(&buf)
+		if err != nil {
+			t.Fatalf("LoadPolicy(%s) failed: %v", format, err)
+		}
+		groups, err := wt.PolicyGroups(loaded, " ")
+		if err != nil {
+			t.Fatalf("PolicyGroups failed: %v", err)
+		}
+		if groups[0].AllowedAPIs != raw[0].AllowedAPIs || groups[0].DeniedAPIs != raw[0].DeniedAPIs {
+			t.Errorf("%s round trip changed rules: %+v", format, groups[0])
+		}
+		if loaded.Metadata["ticket"] != "OPS-1" {
+			t.Errorf("%s round trip lost metadata", format)
+		}
+	}
+}
+
+/**
+ * TestLoadPolicyErrorLocations 测试校验错误带有行号和字段位置
+ */
+func TestLoadPolicyErrorLocations(t *testing.T) {
+	doc := `schemaVersion: 1
+groups:
+  - id: 1
+    name: a
+    allow:
+      - /api
+      - "/"
+    allowCidrs:
+      - office
+  - id: 1
+    name: ""
+    ruleConditions:
+      /missing: {}
+`
+	_, err := wt.LoadPolicy(strings.NewReader(doc))
+	var errs models.PolicyErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected PolicyErrors, got %v", err)
+	}
+	want := map[string]int{
+		"groups[0].allow[1]":                   7,
+		"groups[0].allowCidrs[0]":              9,
+		"groups[1].id":                         10,
+		"groups[1].name":                       11,
+		`groups[1].ruleConditions["/missing"]`: 13,
+	}
+	got := make(map[string]int)
+	for _, e := range errs {
+		got[e.Field] = e.Line
+	}
+	for field, line := range want {
+		if got[field] != line {
+			t.Errorf("expected error at %s line %d, got line %d (all: %v)", field, line, got[field], errs)
+		}
+	}
+}
+
+/**
+ * TestLoadPolicyDecodeErrors 测试解码阶段的错误同样带有行号
+ */
+func TestLoadPolicyDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		line int
+	}{
+		{"YAML未知字段", "schemaVersion: 1\ngroups:\n  - id: 1\n    nmae: x\n", 4},
+		{"YAML类型错误", "schemaVersion: 1\ngroups:\n  - id: abc\n", 3},
+		{"JSON语法错误", "{\n\"schemaVersion\": 1,\n\"groups\": [,]\n}", 3},
+		{"JSON未知字段", "{\n\"schemaVersion\": 1,\n\"extra\": true\n}", 3},
+		{"缺少版本", "groups: []\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := wt.LoadPolicy(strings.NewReader(tt.doc))
+			var errs models.PolicyErrors
+			if !errors.As(err, &errs) || len(errs) == 0 {
+				t.Fatalf("expected PolicyErrors, got %v", err)
+			}
+			if errs[0].Line != tt.line {
+				t.Errorf("expected line %d, got %d (%v)", tt.line, errs[0].Line, errs)
+			}
+		})
+	}
+}
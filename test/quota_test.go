@@ -0,0 +1,287 @@
+package test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+// memoryQuotaStore 测试用的配额持久化实现
+type memoryQuotaStore struct {
+	mu       sync.Mutex
+	counters map[string]models.QuotaCounter
+}
+
+func newMemoryQuotaStore() *memoryQuotaStore {
+	return &memoryQuotaStore{counters: make(map[string]models.QuotaCounter)}
+}
+
+func (s *memoryQuotaStore) key(c models.QuotaCounter) string {
+	return c.TenantID + "|" + c.Name + "|" + strconv.FormatUint(uint64(c.UserID), 10)
+}
+
+func (s *memoryQuotaStore) Load() ([]models.QuotaCounter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]models.QuotaCounter, 0, len(s.counters))
+	for _, c := range s.counters {
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+func (s *memoryQuotaStore) Save(c models.QuotaCounter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[s.key(c)] = c
+	return nil
+}
+
+func (s *memoryQuotaStore) Delete(c models.QuotaCounter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, s.key(c))
+	return nil
+}
+
+/**
+ * newQuotaManager 创建带配额的管理器：/api/search每月3次，所有API每天5次
+ */
+func newQuotaManager(t *testing.T, now *time.Time) *wt.Manager[string] {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+		Timezone:       "UTC",
+	}
+	groups := []models.GroupRaw{
+		{
+			ID:                 1,
+			Name:               "paid",
+			AllowedAPIs:        "/api",
+			TokenExpire:        "1h",
+			AllowMultipleLogin: 1,
+			Quotas: []models.Quota{
+				{API: "/api/search", Limit: 3, Period: models.QuotaMonthly},
+				{Name: "daily", Limit: 5, Period: models.QuotaDaily},
+			},
+		},
+	}
+	manager, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	tm := manager.(*wt.Manager[string])
+	tm.SetClock(func() time.Time { return *now })
+	return tm
+}
+
+/**
+ * TestQuotaConsumption 测试配额按用户跨token计数、按自然月重置以及查询和重置接口
+ */
+func TestQuotaConsumption(t *testing.T) {
+	now := time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC)
+	tm := newQuotaManager(t, &now)
+	a, _ := tm.AddToken(1, 1, "10.0.0.1")
+	b, _ := tm.AddToken(1, 1, "10.0.0.2")
+	c, _ := tm.AddToken(2, 1, "10.0.0.3")
+
+	tm.Auth(a, "10.0.0.1", "/api/search")
+	tm.Auth(b, "10.0.0.2", "/api/search/images")
+	if err := tm.Auth(a, "10.0.0.1", "/api/search"); err != nil {
+		t.Fatalf("third search should pass: %v", err)
+	}
+	err := tm.Auth(b, "10.0.0.2", "/api/search")
+	var exceeded *models.QuotaExceededError
+	if !errors.As(err, &exceeded) || exceeded.Name != "/api/search" || err.Error() != "Usage quota exceeded" {
+		t.Fatalf("fourth search = %v, expected quota exceeded", err)
+	}
+	if !exceeded.ResetAt.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ResetAt = %v, expected start of June", exceeded.ResetAt)
+	}
+	if err := tm.Auth(c, "10.0.0.3", "/api/search"); err != nil {
+		t.Errorf("another user has its own quota: %v", err)
+	}
+	// 被月配额拒绝的请求不计入日配额
+	usage, err := tm.GetQuotaUsage(1, 1)
+	if err != nil || len(usage) != 2 {
+		t.Fatalf("GetQuotaUsage = %v, %v", usage, err)
+	}
+	if usage[0].Used != 3 || usage[0].Remaining != 0 || usage[1].Name != "daily" || usage[1].Used != 3 || usage[1].Remaining != 2 {
+		t.Errorf("usage = %+v", usage)
+	}
+
+	if d := tm.Explain(a, "10.0.0.1", "/api/search"); d.Allowed || d.ErrorKey != "quota_exceeded" {
+		t.Errorf("Explain = allowed %v key %q", d.Allowed, d.ErrorKey)
+	}
+	if d := tm.Explain(a, "10.0.0.1", "/api/users"); !d.Allowed {
+		t.Errorf("Explain of other API should allow: %+v", d)
+	}
+	if usage, _ := tm.GetQuotaUsage(1, 1); usage[1].Used != 3 {
+		t.Errorf("Explain must not consume quota: %+v", usage)
+	}
+
+	// 跨月后月配额自动重置
+	now = now.Add(2 * time.Hour)
+	if err := tm.Auth(a, "10.0.0.1", "/api/search"); err != nil {
+		t.Errorf("search in the next month should pass: %v", err)
+	}
+
+	// 手动重置
+	tm.Auth(a, "10.0.0.1", "/api/search")
+	tm.Auth(a, "10.0.0.1", "/api/search")
+	if err := tm.Auth(a, "10.0.0.1", "/api/search"); err == nil {
+		t.Fatalf("quota should be exhausted again")
+	}
+	if err := tm.ResetQuota(1, "/api/search"); err != nil {
+		t.Fatalf("ResetQuota failed: %v", err)
+	}
+	if err := tm.Auth(a, "10.0.0.1", "/api/search"); err != nil {
+		t.Errorf("search after reset should pass: %v", err)
+	}
+	if usage, _ := tm.GetQuotaUsage(1, 1); usage[1].Used != 4 {
+		t.Errorf("resetting one quota must not touch others: %+v", usage)
+	}
+	if _, err := tm.GetQuotaUsage(9, 1); err == nil {
+		t.Errorf("expected unknown group to be rejected")
+	}
+}
+
+/**
+ * TestQuotaPersistence 测试配额计数通过持久化接口在重启后恢复
+ */
+func TestQuotaPersistence(t *testing.T) {
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	store := newMemoryQuotaStore()
+
+	tm := newQuotaManager(t, &now)
+	if err := tm.SetQuotaStore(store); err != nil {
+		t.Fatalf("SetQuotaStore failed: %v", err)
+	}
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	tm.Auth(key, "10.0.0.1", "/api/search")
+	tm.Auth(key, "10.0.0.1", "/api/search")
+
+	restarted := newQuotaManager(t, &now)
+	if err := restarted.SetQuotaStore(store); err != nil {
+		t.Fatalf("SetQuotaStore failed: %v", err)
+	}
+	usage, _ := restarted.GetQuotaUsage(1, 1)
+	if usage[0].Used != 2 {
+		t.Fatalf("restored usage = %+v, expected 2 searches", usage)
+	}
+	key, _ = restarted.AddToken(1, 1, "10.0.0.1")
+	restarted.Auth(key, "10.0.0.1", "/api/search")
+	if err := restarted.Auth(key, "10.0.0.1", "/api/search"); err == nil {
+		t.Errorf("restored quota should be exhausted")
+	}
+
+	restarted.ResetQuota(1, "")
+	if counters, _ := store.Load(); len(counters) != 0 {
+		t.Errorf("ResetQuota should delete persisted counters, got %+v", counters)
+	}
+}
+
+/**
+ * TestQuotaPeriod 测试自然日、周、月的周期计算
+ */
+func TestQuotaPeriod(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	at := time.Date(2024, 2, 29, 1, 30, 0, 0, loc) // 周四
+	tests := []struct {
+		period string
+		start  time.Time
+		end    time.Time
+	}{
+		{models.QuotaDaily, time.Date(2024, 2, 29, 0, 0, 0, 0, loc), time.Date(2024, 3, 1, 0, 0, 0, 0, loc)},
+		{models.QuotaWeekly, time.Date(2024, 2, 26, 0, 0, 0, 0, loc), time.Date(2024, 3, 4, 0, 0, 0, 0, loc)},
+		{models.QuotaMonthly, time.Date(2024, 2, 1, 0, 0, 0, 0, loc), time.Date(2024, 3, 1, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		start, end := models.QuotaPeriod(tt.period, at)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("QuotaPeriod(%s) = %v - %v, expected %v - %v", tt.period, start, end, tt.start, tt.end)
+		}
+	}
+
+	for _, q := range []models.Quota{{API: "/a", Limit: 0, Period: "day"}, {API: "/a", Limit: 1, Period: "year"}, {Limit: 1, Period: "day"}} {
+		if err := wt.ValidateGroupRaw(models.GroupRaw{ID: 1, Name: "g", TokenExpire: "1h", Quotas: []models.Quota{q}}); err == nil {
+			t.Errorf("expected quota %+v to be rejected", q)
+		}
+	}
+	dup := []models.Quota{{API: "/a", Limit: 1, Period: "day"}, {API: "/a", Limit: 2, Period: "month"}}
+	if err := wt.ValidateGroupRaw(models.GroupRaw{ID: 1, Name: "g", TokenExpire: "1h", Quotas: dup}); err == nil {
+		t.Errorf("expected duplicate quota names to be rejected")
+	}
+}
+
+/**
+ * TestQuotaRejectionKeepsRateLimit 测试被配额拒绝的请求不消耗限流令牌
+ */
+func TestQuotaRejectionKeepsRateLimit(t *testing.T) {
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	tm := newQuotaManager(t, &now)
+	raw := models.GroupRaw{
+		ID: 1, Name: "paid", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1,
+		RateLimit: &models.RateLimit{Requests: 3, Per: "1h"},
+		Quotas:    []models.Quota{{API: "/api/search", Limit: 1, Period: models.QuotaDaily}},
+	}
+	if err := tm.UpdateGroup(1, &raw); err != nil {
+		t.Fatalf("UpdateGroup failed: %v", err)
+	}
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	tm.Auth(key, "10.0.0.1", "/api/search")
+	for i := 0; i < 5; i++ {
+		var exceeded *models.QuotaExceededError
+		if err := tm.Auth(key, "10.0.0.1", "/api/search"); !errors.As(err, &exceeded) {
+			t.Fatalf("search %d = %v, expected quota exceeded", i+2, err)
+		}
+	}
+	// 限流配额为每小时3次，被配额拒绝的5次请求没有消耗它
+	for i := 0; i < 2; i++ {
+		if err := tm.Auth(key, "10.0.0.1", "/api/users"); err != nil {
+			t.Errorf("request %d should still be within the rate limit: %v", i+1, err)
+		}
+	}
+	var limited *models.RateLimitError
+	if err := tm.Auth(key, "10.0.0.1", "/api/users"); !errors.As(err, &limited) {
+		t.Errorf("fourth counted request = %v, expected rate limited", err)
+	}
+}
+
+/**
+ * TestQuotaPrune 测试已过期周期的计数从内存和持久化存储中删除
+ */
+func TestQuotaPrune(t *testing.T) {
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	tm := newQuotaManager(t, &now)
+	store := newMemoryQuotaStore()
+	tm.SetQuotaStore(store)
+	for userID := uint(1); userID <= 3; userID++ {
+		key, _ := tm.AddToken(userID, 1, "10.0.0.1")
+		tm.Auth(key, "10.0.0.1", "/api/users")
+	}
+	if n := len(store.counters); n != 3 {
+		t.Fatalf("expected 3 saved counters, got %d", n)
+	}
+
+	// 第二天只有用户1访问，其他用户前一天的计数被删除
+	now = now.Add(24 * time.Hour)
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	tm.Auth(key, "10.0.0.1", "/api/users")
+	if n := len(store.counters); n != 1 {
+		t.Errorf("expected counters of past periods to be pruned, got %d", n)
+	}
+	for _, c := range store.counters {
+		if c.UserID != 1 || c.Used != 1 || !c.PeriodEnd.Equal(time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected counter %+v", c)
+		}
+	}
+}
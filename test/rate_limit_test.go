@@ -0,0 +1,222 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * newRateLimitManager 创建带限流配置的管理器：用户组每分钟3次，/api/report每分钟1次
+ */
+func newRateLimitManager(t *testing.T, groupKey string) (*wt.Manager[string], *time.Time) {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{
+			ID:                 1,
+			Name:               "free",
+			AllowedAPIs:        "/api,/api/report",
+			TokenExpire:        "1h",
+			AllowMultipleLogin: 1,
+			RateLimit:          &models.RateLimit{Requests: 3, Per: "1m", Key: groupKey},
+			RuleConditions: map[string]models.RuleCondition{
+				"/api/report": {RateLimit: &models.RateLimit{Requests: 1, Per: "1m"}},
+			},
+		},
+	}
+	manager, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	tm := manager.(*wt.Manager[string])
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	tm.SetClock(func() time.Time { return now })
+	return tm, &now
+}
+
+/**
+ * TestRateLimitGroupAndRule 测试用户组和规则限流、重试等待时间以及按用户共享配额
+ */
+func TestRateLimitGroupAndRule(t *testing.T) {
+	tm, now := newRateLimitManager(t, "")
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+	other, _ := tm.AddToken(1, 1, "10.0.0.2")
+
+	if err := tm.Auth(key, "10.0.0.1", "/api/report"); err != nil {
+		t.Fatalf("first report request should pass: %v", err)
+	}
+	err := tm.Auth(key, "10.0.0.1", "/api/report")
+	var limited *models.RateLimitError
+	if !errors.As(err, &limited) || limited.Scope != "rule" {
+		t.Fatalf("second report request = %v, expected rule rate limit", err)
+	}
+	if limited.RetryAfter != time.Minute || err.Error() != "Too many requests, please retry later" {
+		t.Errorf("RetryAfter = %v, message %q", limited.RetryAfter, err.Error())
+	}
+
+	// 被规则限流的请求不消耗用户组配额；同一用户的另一个token共享用户组配额
+	if err := tm.Auth(key, "10.0.0.1", "/api/users"); err != nil {
+		t.Errorf("second group request should pass: %v", err)
+	}
+	if err := tm.Auth(other, "10.0.0.2", "/api/users"); err != nil {
+		t.Errorf("third group request should pass: %v", err)
+	}
+	err = tm.Auth(other, "10.0.0.2", "/api/users")
+	if !errors.As(err, &limited) || limited.Scope != "group" || limited.RetryAfter != 20*time.Second {
+		t.Fatalf("fourth group request = %v (%+v), expected group limit with 20s retry", err, limited)
+	}
+
+	// Explain只检查不扣减
+	d := tm.Explain(key, "10.0.0.1", "/api/users")
+	if d.Allowed || d.ErrorKey != "rate_limited" || d.RetryAfter != 20*time.Second {
+		t.Errorf("Explain = allowed %v key %q retry %v", d.Allowed, d.ErrorKey, d.RetryAfter)
+	}
+
+	*now = now.Add(20 * time.Second)
+	if d := tm.Explain(key, "10.0.0.1", "/api/users"); !d.Allowed {
+		t.Errorf("Explain after refill should allow: %+v", d.Conditions)
+	}
+	if err := tm.Auth(key, "10.0.0.1", "/api/users"); err != nil {
+		t.Errorf("request after refill should pass: %v", err)
+	}
+	if err := tm.Auth(key, "10.0.0.1", "/api/users"); err == nil {
+		t.Errorf("bucket should be empty again")
+	}
+}
+
+/**
+ * TestRateLimitKeys 测试按token和按IP限流
+ */
+func TestRateLimitKeys(t *testing.T) {
+	tm, _ := newRateLimitManager(t, models.RateLimitByToken)
+	a, _ := tm.AddToken(1, 1, "10.0.0.1")
+	b, _ := tm.AddToken(1, 1, "10.0.0.1")
+	for i := 0; i < 3; i++ {
+		tm.Auth(a, "10.0.0.1", "/api/users")
+	}
+	if err := tm.Auth(a, "10.0.0.1", "/api/users"); err == nil {
+		t.Errorf("token a should be limited")
+	}
+	if err := tm.Auth(b, "10.0.0.1", "/api/users"); err != nil {
+		t.Errorf("token b has its own bucket: %v", err)
+	}
+
+	tm, _ = newRateLimitManager(t, models.RateLimitByIP)
+	a, _ = tm.AddToken(1, 1, "10.0.0.1")
+	b, _ = tm.AddToken(2, 1, "10.0.0.1")
+	c, _ := tm.AddToken(3, 1, "10.0.0.2")
+	tm.Auth(a, "10.0.0.1", "/api/users")
+	tm.Auth(a, "10.0.0.1", "/api/users")
+	tm.Auth(b, "10.0.0.1", "/api/users")
+	if err := tm.Auth(b, "10.0.0.1", "/api/users"); err == nil {
+		t.Errorf("users behind the same IP should share a bucket")
+	}
+	if err := tm.Auth(c, "10.0.0.2", "/api/users"); err != nil {
+		t.Errorf("another IP has its own bucket: %v", err)
+	}
+}
+
+/**
+ * TestRateLimitCleanup 测试按token限流的桶随token释放，按用户限流的桶在回满后释放
+ */
+func TestRateLimitCleanup(t *testing.T) {
+	tm, now := newRateLimitManager(t, "")
+	a, _ := tm.AddToken(1, 1, "10.0.0.1")
+	b, _ := tm.AddToken(1, 1, "10.0.0.1")
+	c, _ := tm.AddToken(2, 1, "10.0.0.1")
+	tm.Auth(a, "10.0.0.1", "/api/report")
+	tm.Auth(b, "10.0.0.1", "/api/users")
+	tm.Auth(c, "10.0.0.1", "/api/users")
+	if n := tm.RateLimiterSize(); n != 3 {
+		t.Fatalf("RateLimiterSize = %d, expected 3 (user 1 group + rule, user 2 group)", n)
+	}
+
+	// 按用户限流的桶不随token删除，否则重新登录就能重置配额
+	tm.DelToken(a)
+	tm.DelToken(b)
+	if n := tm.RateLimiterSize(); n != 3 {
+		t.Errorf("RateLimiterSize after DelToken = %d, expected user buckets to be kept", n)
+	}
+
+	// 回满之后的桶与新建的桶没有区别，清理时释放
+	*now = now.Add(2 * time.Minute)
+	token, _ := tm.GetToken(c)
+	token.ExpireSeconds = 1
+	token.LoginTime = time.Now().Add(-time.Hour)
+	tm.UpdateToken(c, token)
+	tm.CleanExpiredTokens()
+	if n := tm.RateLimiterSize(); n != 0 {
+		t.Errorf("RateLimiterSize after refill and cleanup = %d, expected 0", n)
+	}
+
+	// 按token限流的桶随token立即释放
+	tm, _ = newRateLimitManager(t, models.RateLimitByToken)
+	d, _ := tm.AddToken(1, 1, "10.0.0.1")
+	tm.Auth(d, "10.0.0.1", "/api/users")
+	if n := tm.RateLimiterSize(); n != 1 {
+		t.Fatalf("RateLimiterSize = %d, expected 1", n)
+	}
+	tm.DelToken(d)
+	if n := tm.RateLimiterSize(); n != 0 {
+		t.Errorf("RateLimiterSize after DelToken = %d, expected the token bucket to be released", n)
+	}
+}
+
+/**
+ * TestRateLimitRelogin 测试单点登录时重新登录不会重置按用户或IP限流的配额
+ */
+func TestRateLimitRelogin(t *testing.T) {
+	for _, key := range []string{models.RateLimitByUser, models.RateLimitByIP} {
+		tm, _ := newRateLimitManager(t, key)
+		raw := models.GroupRaw{ID: 1, Name: "single", AllowedAPIs: "/api", TokenExpire: "1h",
+			RateLimit: &models.RateLimit{Requests: 3, Per: "1m", Key: key}}
+		if err := tm.UpdateGroup(1, &raw); err != nil {
+			t.Fatalf("UpdateGroup failed: %v", err)
+		}
+		token, _ := tm.AddToken(1, 1, "10.0.0.1")
+		for i := 0; i < 3; i++ {
+			if err := tm.Auth(token, "10.0.0.1", "/api/users"); err != nil {
+				t.Fatalf("%s: request %d should pass: %v", key, i+1, err)
+			}
+		}
+
+		// 不允许多设备登录时，重新登录会删除旧token
+		token, err := tm.AddToken(1, 1, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("AddToken failed: %v", err)
+		}
+		if err := tm.Auth(token, "10.0.0.1", "/api/users"); err == nil || err.Error() != "Too many requests, please retry later" {
+			t.Errorf("%s: logging in again should not restore the quota, got %v", key, err)
+		}
+	}
+}
+
+/**
+ * TestRateLimitValidation 测试限流配置校验
+ */
+func TestRateLimitValidation(t *testing.T) {
+	invalid := []*models.RateLimit{
+		{Requests: 0, Per: "1m"},
+		{Requests: 1, Per: "soon"},
+		{Requests: 1, Per: "1m", Key: "tenant"},
+		{Requests: 1, Per: "1m", Burst: -1},
+	}
+	for _, limit := range invalid {
+		group := models.GroupRaw{ID: 1, Name: "g", TokenExpire: "1h", RateLimit: limit}
+		if err := wt.ValidateGroupRaw(group); err == nil {
+			t.Errorf("expected %+v to be rejected", limit)
+		}
+	}
+	if err := wt.ValidateGroupRaw(models.GroupRaw{ID: 1, Name: "g", TokenExpire: "1h", RateLimit: &models.RateLimit{Requests: 10, Per: "1d", Burst: 2}}); err != nil {
+		t.Errorf("valid rate limit rejected: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/redisstore"
+	"github.com/windf17/wt/storetest"
+)
+
+/**
+ * newRESPClient 启动进程内RESP服务器并创建客户端，测试结束时关闭
+ */
+func newRESPClient(t *testing.T) *redisstore.Client {
+	t.Helper()
+	srv, err := redisstore.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start RESP server: %v", err)
+	}
+	client := redisstore.NewClient(srv.Addr(), time.Second)
+	t.Cleanup(func() {
+		client.Close()
+		srv.Close()
+	})
+	return client
+}
+
+/**
+ * TestRedisTokenStore RESP存储的一致性测试，每个子测试使用不同的键前缀
+ */
+func TestRedisTokenStore(t *testing.T) {
+	client := newRESPClient(t)
+	storetest.Run(t, func(t *testing.T) models.TokenStore[storetest.Data] {
+		return redisstore.New(client, redisstore.Options[storetest.Data]{Prefix: t.Name() + ":"})
+	})
+}
+
+/**
+ * TestRedisStoreTTL 测试token的过期时间映射为键的TTL，过期后从索引和计数中消失
+ */
+func TestRedisStoreTTL(t *testing.T) {
+	client := newRESPClient(t)
+	store := redisstore.New(client, redisstore.Options[storetest.Data]{})
+
+	live := storetest.NewToken("", 1, 1)
+	store.Put("live", live)
+	ttl, err := client.Do("PTTL", redisstore.DEFAULT_PREFIX+"token:live")
+	if err != nil {
+		t.Fatalf("PTTL failed: %v", err)
+	}
+	if ms := ttl.(int64); ms <= 3590*1000 || ms > 3600*1000 {
+		t.Errorf("TTL should follow ExpireSeconds, got %dms", ms)
+	}
+
+	forever := storetest.NewToken("", 1, 1)
+	forever.ExpireSeconds = 0
+	store.Put("forever", forever)
+	if ttl, _ := client.Do("PTTL", redisstore.DEFAULT_PREFIX+"token:forever"); ttl.(int64) != -1 {
+		t.Errorf("Token without expiry should have no TTL, got %v", ttl)
+	}
+
+	expired := storetest.NewToken("", 1, 1)
+	expired.LoginTime = time.Now().Add(-2 * time.Second)
+	expired.ExpireSeconds = 1
+	store.Put("expired", expired)
+	if tok, err := store.Get("expired"); tok != nil || err != nil {
+		t.Errorf("Expired token should be gone, got %v, %v", tok, err)
+	}
+	if keys, _ := store.KeysByUser("", 1); len(keys) != 2 {
+		t.Errorf("Expired token should be filtered from the user index, got %v", keys)
+	}
+	if n, _ := store.Len(); n != 2 {
+		t.Errorf("Len should not count expired tokens, got %d", n)
+	}
+}
+
+/**
+ * TestRedisStoreSharedSessions 测试多个实例共用一个RESP存储时共享登录状态
+ */
+func TestRedisStoreSharedSessions(t *testing.T) {
+	client := newRESPClient(t)
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+	}
+	newInstance := func() models.IManager[cart] {
+		tm, err := wt.InitTMWithStore[cart](config, groups, redisstore.New(client, redisstore.Options[cart]{}))
+		if err != nil {
+			t.Fatalf("InitTMWithStore failed: %v", err)
+		}
+		return tm
+	}
+	a, b := newInstance(), newInstance()
+
+	key, _ := a.AddToken(1, 1, "10.0.0.1")
+	a.SetUserData(key, cart{Items: []string{"tea"}, Total: 1})
+	if err := b.Auth(key, "10.0.0.1", "/api/items"); err != nil {
+		t.Errorf("Token issued by one instance should authenticate on another: %v", err)
+	}
+	if data, err := b.GetUserData(key); err != nil || data.Total != 1 {
+		t.Errorf("User data should be shared, got %+v, %v", data, err)
+	}
+	if err := b.DelTokensByUserID(1); err != nil {
+		t.Fatalf("DelTokensByUserID failed: %v", err)
+	}
+	if err := a.Auth(key, "10.0.0.1", "/api/items"); err == nil {
+		t.Error("Token deleted on one instance should be rejected on another")
+	}
+}
+
+/**
+ * TestRedisStoreConcurrentWriters 测试多个客户端同时修改同一个token的用户组后，索引只指向最终的用户组
+ */
+func TestRedisStoreConcurrentWriters(t *testing.T) {
+	srv, err := redisstore.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start RESP server: %v", err)
+	}
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(group uint) {
+			defer wg.Done()
+			client := redisstore.NewClient(srv.Addr(), time.Second)
+			defer client.Close()
+			store := redisstore.New(client, redisstore.Options[storetest.Data]{})
+			for j := 0; j < 10; j++ {
+				if err := store.Put("shared", storetest.NewToken("", 1, group)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(uint(i + 1))
+	}
+	wg.Wait()
+
+	client := redisstore.NewClient(srv.Addr(), time.Second)
+	defer client.Close()
+	store := redisstore.New(client, redisstore.Options[storetest.Data]{})
+	tok, _ := store.Get("shared")
+	if tok == nil {
+		t.Fatal("Token should exist")
+	}
+	for group := uint(1); group <= 4; group++ {
+		keys, _ := store.KeysByGroup("", group)
+		if want := group == tok.GroupID; (len(keys) == 1) != want || len(keys) > 1 {
+			t.Errorf("Group %d index = %v, token is in group %d", group, keys, tok.GroupID)
+		}
+	}
+}
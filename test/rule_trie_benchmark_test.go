@@ -0,0 +1,43 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/windf17/wt/utility"
+)
+
+/**
+ * BenchmarkHasPermissionLargeGroup 线性扫描算法在1000+规则用户组上的性能
+ */
+func BenchmarkHasPermissionLargeGroup(b *testing.B) {
+	g := buildLargeGroup(2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		utility.HasPermission("/svc17/res3/action1017/detail?id=5", g.ApiRules)
+	}
+}
+
+/**
+ * BenchmarkHasCompiledPermissionLargeGroup 前缀树算法在1000+规则用户组上的性能
+ */
+func BenchmarkHasCompiledPermissionLargeGroup(b *testing.B) {
+	g := buildLargeGroup(2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		utility.HasCompiledPermission("/svc17/res3/action1017/detail?id=5", g)
+	}
+}
+
+/**
+ * BenchmarkHasCompiledPermissionFullURL 前缀树算法处理完整URL（走url.Parse路径）的性能
+ */
+func BenchmarkHasCompiledPermissionFullURL(b *testing.B) {
+	g := buildLargeGroup(2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		utility.HasCompiledPermission("https://example.com/svc17/res3/action1017/detail?id=5", g)
+	}
+}
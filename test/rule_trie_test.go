@@ -0,0 +1,152 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
+)
+
+// trieSegments 用于随机生成规则和请求路径的路径段
+var trieSegments = []string{"api", "v1", "v2", "users", "admin", "*", "orders", "a", "bb", "ccc"}
+
+/**
+ * randomTriePath 随机生成指定最大长度的路径
+ * @param {*rand.Rand} r 随机数生成器
+ * @param {int} maxLen 最大路径段数
+ * @returns {string} 路径字符串
+ */
+func randomTriePath(r *rand.Rand, maxLen int) string {
+	n := r.Intn(maxLen) + 1
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = trieSegments[r.Intn(len(trieSegments))]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+/**
+ * TestRuleTrieDifferential 差分测试：前缀树匹配结果必须与HasPermission完全一致
+ */
+func TestRuleTrieDifferential(t *testing.T) {
+	r := rand.New(rand.NewSource(20240501))
+	for round := 0; round < 300; round++ {
+		allowed := make([]string, r.Intn(12))
+		for i := range allowed {
+			allowed[i] = randomTriePath(r, 4)
+		}
+		denied := make([]string, r.Intn(12))
+		for i := range denied {
+			denied[i] = randomTriePath(r, 4)
+		}
+		g := wt.ConvGroup(models.GroupRaw{
+			ID:          1,
+			Name:        "diff",
+			AllowedAPIs: strings.Join(allowed, ","),
+			DeniedAPIs:  strings.Join(denied, ","),
+		}, ",")
+
+		for i := 0; i < 50; i++ {
+			api := randomTriePath(r, 6)
+			switch r.Intn(4) {
+			case 0:
+				api += "?q=1"
+			case 1:
+				api = "https://example.com" + api
+			case 2:
+				api = strings.TrimPrefix(api, "/")
+			}
+			want := utility.HasPermission(api, g.ApiRules)
+			if got := utility.HasCompiledPermission(api, g); got != want {
+				t.Fatalf("round %d: HasCompiledPermission(%q) = %v, HasPermission = %v, rules %v",
+					round, api, got, want, g.ApiRules)
+			}
+			_, _, winner := utility.ExplainPermission(api, g.ApiRules)
+			if (winner != nil && winner.Rule.Rule) != want {
+				t.Fatalf("round %d: ExplainPermission(%q) disagrees with HasPermission", round, api)
+			}
+		}
+	}
+}
+
+/**
+ * TestRuleTrieEdgeCases 测试URL解析边界情况下两种算法一致
+ */
+func TestRuleTrieEdgeCases(t *testing.T) {
+	g := wt.ConvGroup(models.GroupRaw{
+		ID:          1,
+		Name:        "edge",
+		AllowedAPIs: "/api,/api/a b,/api/*,/x:y",
+		DeniedAPIs:  "/api/admin,/api/admin/*",
+	}, ",")
+	apis := []string{
+		"", "/", "//", "///api", "//host/api/admin", "/api//admin", "/api/ admin /x",
+		"/api/%61dmin", "/api/admin%2Fx", "/api/%zz", "/api/*", "/api/admin/*", "/api/a b",
+		"/api#frag", "/api/admin?x#y", "/api?", "api/admin", "x:y/api", "/x:y", "http://h/api/admin/*",
+		"/api/\x00admin", "/api\t/admin", "/API/admin", "mailto:api",
+	}
+	for _, api := range apis {
+		want := utility.HasPermission(api, g.ApiRules)
+		if got := utility.HasCompiledPermission(api, g); got != want {
+			t.Errorf("HasCompiledPermission(%q) = %v, HasPermission = %v", api, got, want)
+		}
+	}
+}
+
+/**
+ * TestRuleTrieDuplicatePaths 同一路径同时允许和拒绝时，保留排序后最靠前的规则
+ */
+func TestRuleTrieDuplicatePaths(t *testing.T) {
+	rules := []models.ApiRule{
+		{Path: []string{"api", "x"}, Rule: false},
+		{Path: []string{"api", "x"}, Rule: true},
+		{Path: []string{"api"}, Rule: true},
+	}
+	trie := models.NewRuleTrie(rules)
+	index, length := trie.MatchSegments([]string{"api", "x", "y"})
+	if index != 0 || length != 2 {
+		t.Errorf("MatchSegments = (%d, %d), expected (0, 2)", index, length)
+	}
+	if index, _ := trie.MatchPath("/nothing"); index != -1 {
+		t.Errorf("expected no match, got %d", index)
+	}
+}
+
+/**
+ * TestRuleTrieZeroAlloc 普通路径请求的匹配过程不产生内存分配
+ */
+func TestRuleTrieZeroAlloc(t *testing.T) {
+	g := buildLargeGroup(1000)
+	allocs := testing.AllocsPerRun(100, func() {
+		utility.HasCompiledPermission("/svc17/res3/action1/detail?id=5", g)
+	})
+	if allocs != 0 {
+		t.Errorf("expected zero allocations, got %v", allocs)
+	}
+}
+
+/**
+ * buildLargeGroup 构造包含指定数量规则的用户组
+ * @param {int} n 规则数量
+ * @returns {*models.Group} 用户组
+ */
+func buildLargeGroup(n int) *models.Group {
+	allowed := make([]string, 0, n)
+	denied := make([]string, 0, n/4)
+	for i := 0; i < n; i++ {
+		allowed = append(allowed, fmt.Sprintf("/svc%d/res%d/action%d", i%50, i%20, i))
+		if i%4 == 0 {
+			denied = append(denied, fmt.Sprintf("/svc%d/res%d/action%d/admin", i%50, i%20, i))
+		}
+	}
+	return wt.ConvGroup(models.GroupRaw{
+		ID:          1,
+		Name:        "large",
+		AllowedAPIs: strings.Join(allowed, ","),
+		DeniedAPIs:  strings.Join(denied, ","),
+	}, ",")
+}
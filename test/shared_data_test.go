@@ -0,0 +1,136 @@
+package test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+// cart 测试用的用户数据
+type cart struct {
+	Items []string
+	Total int
+}
+
+/**
+ * newCartManager 创建用户数据为cart的管理器
+ */
+func newCartManager(t *testing.T) models.IManager[cart] {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+	}
+	manager, err := wt.InitTM[cart](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	return manager
+}
+
+/**
+ * TestUpdateUserDataConcurrent 测试并发修改用户数据不会丢失更新，mutator出错时不修改
+ */
+func TestUpdateUserDataConcurrent(t *testing.T) {
+	tm := newCartManager(t)
+	key, _ := tm.AddToken(1, 1, "10.0.0.1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tm.UpdateUserData(key, func(c *cart) error {
+				c.Total++
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if data, _ := tm.GetUserData(key); data.Total != 50 {
+		t.Errorf("Total = %d, expected 50", data.Total)
+	}
+
+	failed := errors.New("out of stock")
+	err := tm.UpdateUserData(key, func(c *cart) error {
+		c.Total = 0
+		return failed
+	})
+	if err != failed {
+		t.Errorf("UpdateUserData should return the mutator error, got %v", err)
+	}
+	if data, _ := tm.GetUserData(key); data.Total != 50 {
+		t.Errorf("failed mutator must not modify the data, Total = %d", data.Total)
+	}
+	if err := tm.UpdateUserData("missing", func(c *cart) error { return nil }); err == nil {
+		t.Errorf("expected unknown token to be rejected")
+	}
+}
+
+/**
+ * TestSharedData 测试用户共享数据在多个token间共享，并在最后一个token删除时释放
+ */
+func TestSharedData(t *testing.T) {
+	tm := newCartManager(t)
+	if _, err := tm.GetSharedData(1); err == nil {
+		t.Fatalf("user without tokens should have no shared data")
+	}
+	if err := tm.UpdateSharedData(1, func(c *cart) error { return nil }); err == nil {
+		t.Fatalf("updating shared data of a user without tokens should fail")
+	}
+
+	a, _ := tm.AddToken(1, 1, "10.0.0.1")
+	b, _ := tm.AddToken(1, 1, "10.0.0.2")
+	tm.AddToken(2, 1, "10.0.0.3")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tm.UpdateSharedData(1, func(c *cart) error {
+				c.Items = append(c.Items, "book")
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if data, err := tm.GetSharedData(1); err != nil || len(data.Items) != 20 {
+		t.Fatalf("shared cart = %+v, %v", data, err)
+	}
+	if data, _ := tm.GetSharedData(2); len(data.Items) != 0 {
+		t.Errorf("another user must not see the cart: %+v", data)
+	}
+	if data, _ := tm.Tenant("acme").GetSharedData(1); len(data.Items) != 0 {
+		t.Errorf("same user ID in another tenant must not see the cart: %+v", data)
+	}
+
+	tm.DelToken(a)
+	if data, _ := tm.GetSharedData(1); len(data.Items) != 20 {
+		t.Errorf("shared data should survive while token b exists: %+v", data)
+	}
+	tm.DelToken(b)
+	if _, err := tm.GetSharedData(1); err == nil {
+		t.Errorf("shared data should be released with the last token")
+	}
+	tm.AddToken(1, 1, "10.0.0.1")
+	if data, _ := tm.GetSharedData(1); len(data.Items) != 0 {
+		t.Errorf("new session should start with empty shared data: %+v", data)
+	}
+
+	// 按用户批量删除token时同样释放
+	tm.DelTokensByUserID(2)
+	if _, err := tm.GetSharedData(2); err == nil {
+		t.Errorf("shared data of user 2 should be released")
+	}
+}
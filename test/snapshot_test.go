@@ -0,0 +1,311 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * newSnapshotManager 创建用于快照测试的管理器，组2的token一秒后过期
+ */
+func newSnapshotManager(t *testing.T) models.IManager[cart] {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+		{ID: 2, Name: "short", AllowedAPIs: "/api", TokenExpire: "1s", AllowMultipleLogin: 1},
+	}
+	manager, err := wt.InitTM[cart](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	return manager
+}
+
+/**
+ * TestSnapshotRoundTrip 测试保存后在新的管理器中加载，token、用户组、租户和用户数据完整恢复
+ */
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "tokens.snap")
+	src := newSnapshotManager(t)
+	key, _ := src.AddToken(1, 1, "10.0.0.1")
+	src.SetUserData(key, cart{Items: []string{"apple"}, Total: 3})
+	src.UpdateSharedData(1, func(c *cart) error {
+		c.Total = 4
+		return nil
+	})
+
+	acme := src.Tenant("acme")
+	acme.AddGroup(&models.GroupRaw{ID: 7, Name: "acme", AllowedAPIs: "/acme", TokenExpire: "1h"})
+	acme.SetMaxTokens(5)
+	acmeKey, err := acme.AddToken(9, 7, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("Failed to add tenant token: %v", err)
+	}
+
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file to remain, got %d entries", len(entries))
+	}
+
+	dst := newCartManager(t)
+	if err := dst.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if err := dst.Auth(key, "10.0.0.1", "/api/items"); err != nil {
+		t.Errorf("Restored token should authenticate: %v", err)
+	}
+	if data, err := dst.GetUserData(key); err != nil || data.Total != 3 || len(data.Items) != 1 {
+		t.Errorf("Unexpected restored user data: %+v, %v", data, err)
+	}
+	if data, err := dst.GetSharedData(1); err != nil || data.Total != 4 {
+		t.Errorf("Shared data should be restored: %+v, %v", data, err)
+	}
+	if _, err := dst.GetGroup(2); err != nil {
+		t.Errorf("Group from snapshot should be restored: %v", err)
+	}
+	if err := dst.Auth(acmeKey, "10.0.0.2", "/acme/x"); err != nil {
+		t.Errorf("Restored tenant token should authenticate: %v", err)
+	}
+	if stats := dst.GetStats(); stats.TotalTokens != 2 || stats.ActiveTokens != 2 {
+		t.Errorf("Unexpected restored stats: %+v", stats)
+	}
+	if stats := dst.Tenant("acme").GetStats(); stats.TotalTokens != 1 {
+		t.Errorf("Unexpected restored tenant stats: %+v", stats)
+	}
+}
+
+/**
+ * TestSnapshotSkipsExpired 测试加载快照时跳过已过期的token并计入过期统计
+ */
+func TestSnapshotSkipsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.snap")
+	src := newSnapshotManager(t)
+	live, _ := src.AddToken(1, 1, "10.0.0.1")
+	short, _ := src.AddToken(2, 2, "10.0.0.1")
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	dst := newSnapshotManager(t)
+	if err := dst.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if _, err := dst.GetToken(live); err != nil {
+		t.Errorf("Live token should be restored: %v", err)
+	}
+	if _, err := dst.GetToken(short); err == nil {
+		t.Error("Expired token should not be restored")
+	}
+	if stats := dst.GetStats(); stats.TotalTokens != 1 || stats.ExpiredTokens != 1 {
+		t.Errorf("Unexpected stats after load: %+v", stats)
+	}
+}
+
+/**
+ * TestSnapshotCorrupt 测试损坏、截断和版本不支持的快照文件返回明确的错误，且不修改管理器
+ */
+func TestSnapshotCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.snap")
+	src := newSnapshotManager(t)
+	src.AddToken(1, 1, "10.0.0.1")
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	version := append([]byte(nil), data...)
+	version[5] = 99
+
+	cases := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{"Flipped", flipped, wt.ErrSnapshotCorrupt},
+		{"Truncated", data[:len(data)-10], wt.ErrSnapshotCorrupt},
+		{"Empty", nil, wt.ErrSnapshotCorrupt},
+		{"NotSnapshot", []byte("this is not a snapshot file at all, just some text padding"), wt.ErrSnapshotCorrupt},
+		{"Version", version, wt.ErrSnapshotVersion},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bad := filepath.Join(dir, c.name+".snap")
+			os.WriteFile(bad, c.content, 0644)
+
+			dst := newSnapshotManager(t)
+			key, _ := dst.AddToken(5, 1, "10.0.0.1")
+			err := dst.LoadSnapshot(bad)
+			if !errors.Is(err, c.want) {
+				t.Fatalf("Expected %v, got %v", c.want, err)
+			}
+			if _, err := dst.GetToken(key); err != nil {
+				t.Errorf("Failed load should leave manager untouched: %v", err)
+			}
+		})
+	}
+
+	if err := newSnapshotManager(t).LoadSnapshot(filepath.Join(dir, "missing.snap")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not-exist error, got %v", err)
+	}
+}
+
+// countingCodec 测试用的自定义编解码器，记录调用次数
+type countingCodec struct {
+	calls *int32
+}
+
+func (c countingCodec) Marshal(v cart) ([]byte, error) {
+	atomic.AddInt32(c.calls, 1)
+	return models.JSONCodec[cart]{}.Marshal(v)
+}
+
+func (c countingCodec) Unmarshal(data []byte) (cart, error) {
+	atomic.AddInt32(c.calls, 1)
+	return models.JSONCodec[cart]{}.Unmarshal(data)
+}
+
+/**
+ * TestSnapshotCodec 测试用户数据和共享数据通过设置的编解码器编码
+ */
+func TestSnapshotCodec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.snap")
+	var calls int32
+	src := newSnapshotManager(t)
+	src.SetCodec(countingCodec{calls: &calls})
+	key, _ := src.AddToken(1, 1, "10.0.0.1")
+	src.SetUserData(key, cart{Total: 42})
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	dst := newSnapshotManager(t)
+	dst.SetCodec(countingCodec{calls: &calls})
+	if err := dst.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	// token的用户数据和用户的共享数据各编码、解码一次
+	if calls != 4 {
+		t.Errorf("Expected codec to be called 4 times, got %d", calls)
+	}
+	if data, _ := dst.GetUserData(key); data.Total != 42 {
+		t.Errorf("Unexpected user data: %+v", data)
+	}
+}
+
+/**
+ * TestSnapshotAutosave 测试定期保存，以及停止时再保存一次
+ */
+func TestSnapshotAutosave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.snap")
+	src := newSnapshotManager(t)
+	src.AddToken(1, 1, "10.0.0.1")
+
+	stop := src.StartAutosave(path, 20*time.Millisecond, func(err error) {
+		t.Errorf("Autosave failed: %v", err)
+	})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Autosave did not write a snapshot")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	last, _ := src.AddToken(2, 1, "10.0.0.1")
+	stop()
+	stop()
+
+	dst := newSnapshotManager(t)
+	if err := dst.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if _, err := dst.GetToken(last); err != nil {
+		t.Errorf("Final save on stop should include the latest token: %v", err)
+	}
+}
+
+// putFailingStore err不为nil时写入失败的存储
+type putFailingStore struct {
+	*wt.MemoryTokenStore[cart]
+	err error
+}
+
+func (s *putFailingStore) Put(key string, t *models.Token[cart]) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.MemoryTokenStore.Put(key, t)
+}
+
+/**
+ * TestSnapshotLoadStoreError 测试加载快照时存储写入失败，现有的token、用户组和统计信息都保持不变
+ */
+func TestSnapshotLoadStoreError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.snap")
+	src := newSnapshotManager(t)
+	src.AddToken(1, 1, "10.0.0.1")
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	store := &putFailingStore{MemoryTokenStore: wt.NewMemoryTokenStore[cart]()}
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1}}
+	dst, err := wt.InitTMWithStore[cart](config, groups, store)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	keys := make([]string, 2)
+	for i := range keys {
+		keys[i], _ = dst.AddToken(uint(i+5), 1, "10.0.0.1")
+	}
+	dst.UpdateSharedData(5, func(c *cart) error {
+		c.Total = 7
+		return nil
+	})
+	before := dst.GetStats()
+
+	broken := errors.New("disk full")
+	store.err = broken
+	if err := dst.LoadSnapshot(path); !errors.Is(err, broken) {
+		t.Fatalf("LoadSnapshot error = %v, expected the store error", err)
+	}
+	for _, key := range keys {
+		if err := dst.Auth(key, "10.0.0.1", "/api"); err != nil {
+			t.Errorf("Existing token should survive the failed load: %v", err)
+		}
+	}
+	if _, err := dst.GetGroup(2); err == nil {
+		t.Error("Groups from the snapshot should not be applied when the load fails")
+	}
+	if data, err := dst.GetSharedData(5); err != nil || data.Total != 7 {
+		t.Errorf("Shared data should survive the failed load: %+v, %v", data, err)
+	}
+	if stats := dst.GetStats(); stats.TotalTokens != before.TotalTokens {
+		t.Errorf("Stats changed by the failed load: %+v, expected %+v", stats, before)
+	}
+}
@@ -0,0 +1,371 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/sqlstore"
+	"github.com/windf17/wt/sqlstore/sqlfake"
+	"github.com/windf17/wt/storetest"
+)
+
+/**
+ * openSQLStore 在内存数据库上创建SQL存储，访问时间不在后台写入，测试结束时关闭
+ */
+func openSQLStore(t *testing.T, db *sqlfake.DB, opts sqlstore.Options[storetest.Data]) *sqlstore.Store[storetest.Data] {
+	t.Helper()
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = -1
+	}
+	store, err := sqlstore.Open(db.Open(), opts)
+	if err != nil {
+		t.Fatalf("Failed to open SQL store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+/**
+ * TestSQLTokenStore SQL存储的一致性测试，分别使用?和$n占位符
+ */
+func TestSQLTokenStore(t *testing.T) {
+	t.Run("Question", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) models.TokenStore[storetest.Data] {
+			return openSQLStore(t, sqlfake.New(), sqlstore.Options[storetest.Data]{})
+		})
+	})
+	t.Run("Dollar", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) models.TokenStore[storetest.Data] {
+			return openSQLStore(t, sqlfake.New(), sqlstore.Options[storetest.Data]{Placeholder: sqlstore.DollarPlaceholder})
+		})
+	})
+}
+
+/**
+ * TestSQLStoreMigrations 测试结构变更只执行一次，并创建用户、用户组和过期时间的索引
+ */
+func TestSQLStoreMigrations(t *testing.T) {
+	db := sqlfake.New()
+	openSQLStore(t, db, sqlstore.Options[storetest.Data]{})
+	creates := db.Count("CREATE")
+
+	// 再次打开时不重复执行结构变更
+	openSQLStore(t, db, sqlstore.Options[storetest.Data]{})
+	if n := db.Count("CREATE") - creates; n != 1 {
+		t.Errorf("Reopening should only ensure the version table, got %d CREATE statements", n)
+	}
+	var versions int
+	if err := db.Open().QueryRow("SELECT COUNT(*) FROM wt_schema_migrations").Scan(&versions); err != nil || versions != 1 {
+		t.Errorf("Expected one applied migration, got %d, %v", versions, err)
+	}
+
+	want := []string{"wt_tokens_expires", "wt_tokens_group", "wt_tokens_user"}
+	if got := db.Indexes("wt_tokens"); !slices.Equal(got, want) {
+		t.Errorf("Indexes = %v, expected %v", got, want)
+	}
+
+	// 不同前缀的存储使用各自的表
+	openSQLStore(t, db, sqlstore.Options[storetest.Data]{Prefix: "other_"})
+	if got := db.Indexes("other_tokens"); len(got) != 3 {
+		t.Errorf("Prefixed store should have its own indexes, got %v", got)
+	}
+}
+
+/**
+ * TestSQLStoreConcurrentMigrations 测试多个实例同时启动、都读到结构变更尚未执行时，只有一个实例执行，所有实例都能打开
+ */
+func TestSQLStoreConcurrentMigrations(t *testing.T) {
+	const instances = 4
+	db := sqlfake.New()
+	// 所有实例都读取了已执行的版本之后才继续
+	var read sync.WaitGroup
+	read.Add(instances)
+	db.AfterStatement(func(query string) {
+		if strings.HasPrefix(query, "SELECT version FROM") {
+			read.Done()
+			read.Wait()
+		}
+	})
+	errs := make(chan error, instances)
+	for i := 0; i < instances; i++ {
+		go func() {
+			store, err := sqlstore.Open(db.Open(), sqlstore.Options[storetest.Data]{FlushInterval: -1})
+			if err == nil {
+				store.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < instances; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Concurrent Open failed: %v", err)
+		}
+	}
+	db.AfterStatement(nil)
+	var versions int
+	if err := db.Open().QueryRow("SELECT COUNT(*) FROM wt_schema_migrations").Scan(&versions); err != nil || versions != 1 {
+		t.Errorf("Expected one applied migration, got %d, %v", versions, err)
+	}
+	if got := db.Indexes("wt_tokens"); len(got) != 3 {
+		t.Errorf("Migration should run exactly once, got indexes %v", got)
+	}
+}
+
+/**
+ * TestSQLStoreTouchBatching 测试访问时间在内存中合并，只在Flush、达到上限或Close时写入
+ */
+func TestSQLStoreTouchBatching(t *testing.T) {
+	db := sqlfake.New()
+	store := openSQLStore(t, db, sqlstore.Options[storetest.Data]{MaxPendingTouches: 3})
+
+	tok := storetest.NewToken("", 1, 1)
+	store.Put("k1", tok)
+	store.Put("k2", storetest.NewToken("", 1, 1))
+	last := tok.LastAccessTime
+	for i := 1; i <= 100; i++ {
+		last = tok.LastAccessTime.Add(time.Duration(i) * time.Second)
+		store.Touch("k1", last)
+	}
+	if n := db.Count("UPDATE"); n != 0 {
+		t.Fatalf("Touch should not write immediately, got %d UPDATE statements", n)
+	}
+	if got, _ := store.Get("k1"); got == nil || !got.LastAccessTime.Equal(last) {
+		t.Errorf("Get should see the pending access time, got %+v", got)
+	}
+
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if n := db.Count("UPDATE"); n != 1 {
+		t.Errorf("100 touches of one token should be one UPDATE, got %d", n)
+	}
+
+	// 旧的访问时间不会覆盖新的
+	store.Touch("k1", tok.LastAccessTime)
+	store.Flush()
+	reopened := openSQLStore(t, db, sqlstore.Options[storetest.Data]{})
+	if got, _ := reopened.Get("k1"); got == nil || !got.LastAccessTime.Equal(last) {
+		t.Errorf("Access time should only move forward, got %+v", got)
+	}
+
+	// 达到上限时立即写入
+	before := db.Count("UPDATE")
+	store.Touch("k1", last.Add(time.Second))
+	store.Touch("k2", last.Add(time.Second))
+	if n := db.Count("UPDATE") - before; n != 0 {
+		t.Errorf("Below the limit nothing should be written, got %d", n)
+	}
+	store.Touch("missing", last.Add(time.Second))
+	if n := db.Count("UPDATE") - before; n != 3 {
+		t.Errorf("Reaching the limit should write all pending touches, got %d", n)
+	}
+
+	// Close写入剩余的访问时间
+	store.Touch("k2", last.Add(time.Minute))
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, _ := reopened.Get("k2"); got == nil || !got.LastAccessTime.Equal(last.Add(time.Minute)) {
+		t.Errorf("Close should flush pending touches, got %+v", got)
+	}
+}
+
+/**
+ * TestSQLStoreAuthDoesNotWrite 测试通过管理器鉴权时不产生数据库写入
+ */
+func TestSQLStoreAuthDoesNotWrite(t *testing.T) {
+	db := sqlfake.New()
+	store := openSQLStore(t, db, sqlstore.Options[storetest.Data]{})
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1}}
+	tm, err := wt.InitTMWithStore[storetest.Data](config, groups, store)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	key, err := tm.AddToken(1, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("AddToken failed: %v", err)
+	}
+
+	writes := db.Count("INSERT") + db.Count("UPDATE") + db.Count("DELETE")
+	for i := 0; i < 50; i++ {
+		if err := tm.Auth(key, "10.0.0.1", "/api"); err != nil {
+			t.Fatalf("Auth failed: %v", err)
+		}
+	}
+	if n := db.Count("INSERT") + db.Count("UPDATE") + db.Count("DELETE") - writes; n != 0 {
+		t.Errorf("Auth should not write to the database, got %d writes", n)
+	}
+	store.Flush()
+	if n := db.Count("UPDATE"); n != 1 {
+		t.Errorf("Flush should write the access time once, got %d", n)
+	}
+}
+
+/**
+ * TestSQLStoreGroups 测试用户组保存在数据库中，新的管理器初始化时加载
+ */
+func TestSQLStoreGroups(t *testing.T) {
+	db := sqlfake.New()
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h"}}
+
+	tm, err := wt.InitTMWithStore[storetest.Data](config, groups, openSQLStore(t, db, sqlstore.Options[storetest.Data]{}))
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	if err := tm.AddGroup(&models.GroupRaw{ID: 2, Name: "admin", AllowedAPIs: "/admin", TokenExpire: "1h"}); err != nil {
+		t.Fatalf("AddGroup failed: %v", err)
+	}
+	if err := tm.Tenant("acme").AddGroup(&models.GroupRaw{ID: 1, Name: "acme", AllowedAPIs: "/acme", TokenExpire: "1h"}); err != nil {
+		t.Fatalf("Tenant AddGroup failed: %v", err)
+	}
+
+	// 另一个实例不带用户组配置，从数据库加载
+	other, err := wt.InitTMWithStore[storetest.Data](config, nil, openSQLStore(t, db, sqlstore.Options[storetest.Data]{}))
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	if g, err := other.GetGroup(2); err != nil || g.Name != "admin" {
+		t.Errorf("Runtime group should be loaded from the database, got %+v, %v", g, err)
+	}
+	if g, err := other.Tenant("acme").GetGroup(1); err != nil || g.Name != "acme" {
+		t.Errorf("Tenant group should be loaded from the database, got %+v, %v", g, err)
+	}
+
+	if err := tm.DelGroup(2); err != nil {
+		t.Fatalf("DelGroup failed: %v", err)
+	}
+	third, _ := wt.InitTMWithStore[storetest.Data](config, nil, openSQLStore(t, db, sqlstore.Options[storetest.Data]{}))
+	if _, err := third.GetGroup(2); err == nil {
+		t.Error("Deleted group should be removed from the database")
+	}
+	if _, err := third.GetGroup(1); err != nil {
+		t.Errorf("Configured group should be saved too: %v", err)
+	}
+}
+
+/**
+ * TestSQLStorePurgeExpired 测试按过期时间删除token，永不过期的token保留
+ */
+func TestSQLStorePurgeExpired(t *testing.T) {
+	store := openSQLStore(t, sqlfake.New(), sqlstore.Options[storetest.Data]{})
+	store.Put("live", storetest.NewToken("", 1, 1))
+	expired := storetest.NewToken("", 1, 1)
+	expired.LoginTime = time.Now().Add(-2 * time.Hour)
+	store.Put("expired", expired)
+	forever := storetest.NewToken("", 1, 1)
+	forever.ExpireSeconds = 0
+	store.Put("forever", forever)
+
+	n, err := store.PurgeExpired(time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeExpired = %d, %v; expected 1", n, err)
+	}
+	if tok, _ := store.Get("expired"); tok != nil {
+		t.Error("Expired token should be purged")
+	}
+	if n, _ := store.Len(); n != 2 {
+		t.Errorf("Len after purge = %d, expected 2", n)
+	}
+}
+
+/**
+ * TestSQLStoreErrors 测试驱动错误映射到db_*错误键，并且可以通过管理器返回的错误获取
+ */
+func TestSQLStoreErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		key  string
+	}{
+		{"Timeout", context.DeadlineExceeded, "db_timeout"},
+		{"Locked", errors.New("database is locked"), "db_timeout"},
+		{"Duplicate", errors.New("Error 1062: Duplicate entry 'k1' for key 'PRIMARY'"), "db_duplicate"},
+		{"Unique", errors.New("UNIQUE constraint failed: wt_tokens.token_key"), "db_duplicate"},
+		{"ForeignKey", errors.New("FOREIGN KEY constraint failed"), "db_foreign_key"},
+		{"Deadlock", errors.New("ERROR: deadlock detected (SQLSTATE 40P01)"), "db_deadlock"},
+		{"Connect", errors.New("dial tcp 127.0.0.1:5432: connect: connection refused"), "db_connect"},
+		{"Other", errors.New("disk I/O error"), "db_insert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqlfake.New()
+			store := openSQLStore(t, db, sqlstore.Options[storetest.Data]{Language: "zh"})
+			db.FailNext(tt.err)
+			err := store.Put("k1", storetest.NewToken("", 1, 1))
+			var dbErr *models.DBError
+			if !errors.As(err, &dbErr) {
+				t.Fatalf("Expected *models.DBError, got %v", err)
+			}
+			if dbErr.Key != tt.key || dbErr.Message != wt.GetErrorMessage("zh", tt.key) {
+				t.Errorf("Key = %q, Message = %q; expected %q", dbErr.Key, dbErr.Message, tt.key)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Driver error should be wrapped: %v", err)
+			}
+			if tok, _ := store.Get("k1"); tok != nil {
+				t.Error("Failed Put should be rolled back")
+			}
+		})
+	}
+
+	t.Run("Operations", func(t *testing.T) {
+		db := sqlfake.New()
+		store := openSQLStore(t, db, sqlstore.Options[storetest.Data]{})
+		store.Put("k1", storetest.NewToken("", 1, 1))
+		cause := errors.New("disk I/O error")
+		keyOf := func(err error) string {
+			var dbErr *models.DBError
+			if errors.As(err, &dbErr) {
+				return dbErr.Key
+			}
+			return "none"
+		}
+
+		db.FailNext(cause)
+		if _, err := store.Get("k1"); keyOf(err) != "db_query" {
+			t.Errorf("Get error = %v", err)
+		}
+		db.FailNext(cause)
+		if err := store.Delete("k1"); keyOf(err) != "db_delete" {
+			t.Errorf("Delete error = %v", err)
+		}
+		store.Touch("k1", time.Now())
+		db.FailNext(cause)
+		if err := store.Flush(); keyOf(err) != "db_update" {
+			t.Errorf("Flush error = %v", err)
+		}
+		// 写入失败的访问时间在下次写入时重试
+		before := db.Count("UPDATE")
+		if err := store.Flush(); err != nil || db.Count("UPDATE") != before+1 {
+			t.Errorf("Failed touches should be retried, err = %v", err)
+		}
+	})
+
+	t.Run("Manager", func(t *testing.T) {
+		db := sqlfake.New()
+		config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+		groups := []models.GroupRaw{{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h"}}
+		tm, err := wt.InitTMWithStore[storetest.Data](config, groups, openSQLStore(t, db, sqlstore.Options[storetest.Data]{}))
+		if err != nil {
+			t.Fatalf("InitTMWithStore failed: %v", err)
+		}
+		db.FailNext(errors.New("ERROR: deadlock detected"))
+		_, err = tm.AddToken(1, 1, "10.0.0.1")
+		var dbErr *models.DBError
+		if !errors.As(err, &dbErr) || dbErr.Key != "db_deadlock" {
+			t.Errorf("Manager should surface the mapped error, got %v", err)
+		}
+		if stats := tm.GetStats(); stats.TotalTokens != 0 {
+			t.Errorf("Failed AddToken should not be counted: %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * newTenantTestManager 创建带有默认租户用户组的管理器，并在acme、globex两个租户下注册同ID的用户组
+ */
+func newTenantTestManager(t *testing.T) models.IManager[string] {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "default-admin", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+	}
+	tm, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	if err := tm.Tenant("acme").AddGroup(&models.GroupRaw{ID: 1, Name: "acme-reader", AllowedAPIs: "/api/orders", TokenExpire: "1h", AllowMultipleLogin: 1}); err != nil {
+		t.Fatalf("AddGroup(acme) failed: %v", err)
+	}
+	if err := tm.Tenant("globex").AddGroup(&models.GroupRaw{ID: 1, Name: "globex-reader", AllowedAPIs: "/api/invoices", TokenExpire: "1h", AllowMultipleLogin: 1}); err != nil {
+		t.Fatalf("AddGroup(globex) failed: %v", err)
+	}
+	return tm
+}
+
+/**
+ * TestTenantGroupIsolation 测试不同租户的同ID用户组互相独立，Auth只在token所属租户内查找用户组
+ */
+func TestTenantGroupIsolation(t *testing.T) {
+	tm := newTenantTestManager(t)
+
+	for tenant, name := range map[string]string{"": "default-admin", "acme": "acme-reader", "globex": "globex-reader"} {
+		g, err := tm.Tenant(tenant).GetGroup(1)
+		if err != nil || g.Name != name {
+			t.Errorf("tenant %q group 1 = %v, %v; expected %s", tenant, g, err, name)
+		}
+	}
+	if _, err := tm.Tenant("initech").GetGroup(1); err == nil {
+		t.Errorf("expected unknown tenant to have no groups")
+	}
+
+	acmeKey, err := tm.Tenant("acme").AddToken(7, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("AddToken(acme) failed: %v", err)
+	}
+	globexKey, err := tm.Tenant("globex").AddToken(7, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("AddToken(globex) failed: %v", err)
+	}
+	if _, err := tm.Tenant("initech").AddToken(7, 1, "10.0.0.1"); err == nil {
+		t.Errorf("expected AddToken to fail for a tenant without group 1")
+	}
+
+	if err := tm.Auth(acmeKey, "10.0.0.1", "/api/orders/1"); err != nil {
+		t.Errorf("acme token should reach its own API: %v", err)
+	}
+	if err := tm.Auth(acmeKey, "10.0.0.1", "/api/invoices/1"); err == nil {
+		t.Errorf("acme token must not use globex group 1")
+	}
+	if err := tm.Auth(globexKey, "10.0.0.1", "/api/invoices/1"); err != nil {
+		t.Errorf("globex token should reach its own API: %v", err)
+	}
+	if err := tm.Auth(globexKey, "10.0.0.1", "/api/users"); err == nil {
+		t.Errorf("globex token must not use default tenant group 1")
+	}
+
+	d := tm.Explain(acmeKey, "10.0.0.1", "/api/orders")
+	if d.TenantID != "acme" || d.GroupName != "acme-reader" {
+		t.Errorf("Explain = tenant %q group %q, expected acme/acme-reader", d.TenantID, d.GroupName)
+	}
+	token, err := tm.GetToken(acmeKey)
+	if err != nil || token.TenantID != "acme" {
+		t.Errorf("GetToken tenant = %v, %v; expected acme", token, err)
+	}
+}
+
+/**
+ * TestTenantBulkOperations 测试按用户组、用户删除token以及统计信息只作用于所属租户
+ */
+func TestTenantBulkOperations(t *testing.T) {
+	tm := newTenantTestManager(t)
+	acme, globex := tm.Tenant("acme"), tm.Tenant("globex")
+
+	defaultKey, _ := tm.AddToken(7, 1, "10.0.0.1")
+	acmeKey, _ := acme.AddToken(7, 1, "10.0.0.1")
+	globexKey, _ := globex.AddToken(7, 1, "10.0.0.1")
+	acme.AddToken(8, 1, "10.0.0.2")
+
+	if n := len(acme.GetTokensByGroupID(1)); n != 2 {
+		t.Errorf("acme tokens in group 1 = %d, expected 2", n)
+	}
+	if n := len(tm.GetTokensByUserID(7)); n != 1 {
+		t.Errorf("default tenant tokens of user 7 = %d, expected 1", n)
+	}
+	if s := acme.GetStats(); s.TotalTokens != 2 || s.ActiveTokens != 2 {
+		t.Errorf("acme stats = %+v, expected 2 active tokens", s)
+	}
+	if s := tm.GetStats(); s.TotalTokens != 4 {
+		t.Errorf("global stats = %+v, expected 4 tokens", s)
+	}
+
+	if err := acme.DelTokensByGroupID(1); err != nil {
+		t.Fatalf("DelTokensByGroupID(acme) failed: %v", err)
+	}
+	if _, err := tm.GetToken(acmeKey); err == nil {
+		t.Errorf("acme token should be deleted")
+	}
+	if _, err := tm.GetToken(globexKey); err != nil {
+		t.Errorf("globex token should survive acme bulk delete: %v", err)
+	}
+	if _, err := tm.GetToken(defaultKey); err != nil {
+		t.Errorf("default tenant token should survive acme bulk delete: %v", err)
+	}
+
+	if err := globex.DelTokensByUserID(7); err != nil {
+		t.Fatalf("DelTokensByUserID(globex) failed: %v", err)
+	}
+	if _, err := tm.GetToken(defaultKey); err != nil {
+		t.Errorf("default tenant token of the same user ID should survive: %v", err)
+	}
+	if s := tm.GetStats(); s.TotalTokens != 1 || s.ActiveTokens != 1 {
+		t.Errorf("global stats = %+v, expected 1 active token", s)
+	}
+
+	if err := acme.DelGroup(1); err != nil {
+		t.Fatalf("DelGroup(acme) failed: %v", err)
+	}
+	if _, err := globex.GetGroup(1); err != nil {
+		t.Errorf("globex group 1 should survive acme DelGroup: %v", err)
+	}
+	if err := globex.UpdateAllGroup([]models.GroupRaw{{ID: 2, Name: "globex-admin", AllowedAPIs: "/api", TokenExpire: "1h"}}); err != nil {
+		t.Fatalf("UpdateAllGroup(globex) failed: %v", err)
+	}
+	if _, err := tm.GetGroup(1); err != nil {
+		t.Errorf("default tenant group should survive globex UpdateAllGroup: %v", err)
+	}
+}
+
+/**
+ * TestTenantMaxTokens 测试租户配额只淘汰本租户内最久没有使用的token
+ */
+func TestTenantMaxTokens(t *testing.T) {
+	tm := newTenantTestManager(t)
+	acme := tm.Tenant("acme")
+	if err := acme.SetMaxTokens(2); err != nil {
+		t.Fatalf("SetMaxTokens failed: %v", err)
+	}
+
+	defaultKey, _ := tm.AddToken(1, 1, "10.0.0.1")
+	first, _ := acme.AddToken(1, 1, "10.0.0.1")
+	second, _ := acme.AddToken(2, 1, "10.0.0.1")
+	third, err := acme.AddToken(3, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("AddToken over quota should evict instead of failing: %v", err)
+	}
+
+	if _, err := tm.GetToken(first); err == nil {
+		t.Errorf("oldest acme token should be evicted")
+	}
+	for _, key := range []string{second, third, defaultKey} {
+		if _, err := tm.GetToken(key); err != nil {
+			t.Errorf("token %s should survive: %v", key, err)
+		}
+	}
+	if s := acme.GetStats(); s.TotalTokens != 2 {
+		t.Errorf("acme stats = %+v, expected 2 tokens", s)
+	}
+
+	if err := acme.SetMaxTokens(0); err != nil {
+		t.Fatalf("SetMaxTokens failed: %v", err)
+	}
+	acme.AddToken(4, 1, "10.0.0.1")
+	if s := acme.GetStats(); s.TotalTokens != 3 {
+		t.Errorf("acme stats after removing quota = %+v, expected 3 tokens", s)
+	}
+}
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * TestTimeWindowContains 测试时间窗口的判断逻辑
+ */
+func TestTimeWindowContains(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("时区数据不可用: %v", err)
+	}
+	tests := []struct {
+		name     string
+		window   models.TimeWindow
+		at       time.Time
+		expected bool
+	}{
+		{"工作时间内", models.TimeWindow{Weekdays: []string{"mon", "fri"}, Start: "09:00", End: "18:00"},
+			time.Date(2024, 5, 6, 10, 0, 0, 0, shanghai), true},
+		{"工作日以外", models.TimeWindow{Weekdays: []string{"mon", "fri"}, Start: "09:00", End: "18:00"},
+			time.Date(2024, 5, 7, 10, 0, 0, 0, shanghai), false},
+		{"结束时间不含", models.TimeWindow{Start: "09:00", End: "18:00"},
+			time.Date(2024, 5, 6, 18, 0, 0, 0, shanghai), false},
+		{"跨午夜-当晚", models.TimeWindow{Weekdays: []string{"mon"}, Start: "22:00", End: "06:00"},
+			time.Date(2024, 5, 6, 23, 0, 0, 0, shanghai), true},
+		{"跨午夜-次日凌晨归属前一天", models.TimeWindow{Weekdays: []string{"mon"}, Start: "22:00", End: "06:00"},
+			time.Date(2024, 5, 7, 5, 59, 0, 0, shanghai), true},
+		{"跨午夜-白天", models.TimeWindow{Start: "22:00", End: "06:00"},
+			time.Date(2024, 5, 7, 12, 0, 0, 0, shanghai), false},
+		{"日期范围内", models.TimeWindow{StartDate: "2024-05-01", EndDate: "2024-05-31"},
+			time.Date(2024, 5, 31, 23, 0, 0, 0, shanghai), true},
+		{"日期范围外", models.TimeWindow{StartDate: "2024-05-01", EndDate: "2024-05-31"},
+			time.Date(2024, 6, 1, 0, 0, 0, 0, shanghai), false},
+		{"窗口时区转换", models.TimeWindow{Start: "09:00", End: "18:00", Timezone: "Asia/Shanghai"},
+			time.Date(2024, 5, 6, 2, 0, 0, 0, time.UTC), true},
+		{"配置错误的窗口视为不满足", models.TimeWindow{Start: "25:00"},
+			time.Date(2024, 5, 6, 2, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.window
+			w.Compile()
+			if got := w.Contains(tt.at); got != tt.expected {
+				t.Errorf("Contains(%v) = %v, expected %v", tt.at, got, tt.expected)
+			}
+		})
+	}
+}
+
+/**
+ * TestAuthTimeWindow 测试Auth对用户组和规则时间窗口的检查
+ */
+func TestAuthTimeWindow(t *testing.T) {
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+		Timezone:       "UTC",
+	}
+	groups := []models.GroupRaw{
+		{
+			ID:                 1,
+			Name:               "contractor",
+			AllowedAPIs:        "/api,/api/batch",
+			TokenExpire:        "24h",
+			AllowMultipleLogin: 1,
+			TimeWindows: []models.TimeWindow{
+				{Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "23:59"},
+				{Start: "00:00", End: "03:00"},
+			},
+			RuleConditions: map[string]models.RuleCondition{
+				"/api/batch": {TimeWindows: []models.TimeWindow{{Start: "22:00", End: "03:00"}}},
+			},
+		},
+	}
+	manager, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	tm := manager.(*wt.Manager[string])
+
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC) // 周一
+	tm.SetClock(func() time.Time { return now })
+
+	key, err := tm.AddToken(1, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+
+	if err := tm.Auth(key, "10.0.0.1", "/api/users"); err != nil {
+		t.Errorf("expected access during business hours, got %v", err)
+	}
+	err = tm.Auth(key, "10.0.0.1", "/api/batch/run")
+	if err == nil || err.Error() != "Access outside the permitted time window" {
+		t.Errorf("expected batch API to be outside its window, got %v", err)
+	}
+	d := tm.Explain(key, "10.0.0.1", "/api/batch/run")
+	if d.ErrorKey != "outside_time_window" || len(d.Conditions) != 2 || d.Conditions[1].Scope != "rule" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+
+	now = time.Date(2024, 5, 6, 23, 30, 0, 0, time.UTC)
+	if err := tm.Auth(key, "10.0.0.1", "/api/batch/run"); err != nil {
+		t.Errorf("expected batch API at night, got %v", err)
+	}
+
+	now = time.Date(2024, 5, 11, 10, 0, 0, 0, time.UTC) // 周六
+	if err := tm.Auth(key, "10.0.0.1", "/api/users"); err == nil {
+		t.Errorf("expected weekend access to be denied")
+	}
+}
+
+/**
+ * TestValidateGroupRawTimeWindow 测试时间窗口配置校验
+ */
+func TestValidateGroupRawTimeWindow(t *testing.T) {
+	group := models.GroupRaw{ID: 1, Name: "g", TimeWindows: []models.TimeWindow{{Weekdays: []string{"someday"}}}}
+	if err := wt.ValidateGroupRaw(group); err == nil {
+		t.Errorf("expected invalid weekday to be rejected")
+	}
+	group = models.GroupRaw{ID: 1, Name: "g", AllowedAPIs: "/api", RuleConditions: map[string]models.RuleCondition{
+		"/api": {TimeWindows: []models.TimeWindow{{Timezone: "Mars/Base"}}},
+	}}
+	if err := wt.ValidateGroupRaw(group); err == nil {
+		t.Errorf("expected invalid timezone to be rejected")
+	}
+	if err := wt.ValidateConfig(models.ConfigRaw{Delimiter: ",", TokenRenewTime: "1h", Timezone: "Nowhere/City"}); err == nil {
+		t.Errorf("expected invalid config timezone to be rejected")
+	}
+}
+
+/**
+ * TestValidateGroupRawRuleConditionPath 测试附加条件引用的路径不在规则中时被拒绝，而不是静默忽略
+ */
+func TestValidateGroupRawRuleConditionPath(t *testing.T) {
+	window := models.RuleCondition{TimeWindows: []models.TimeWindow{{Start: "09:00", End: "18:00"}}}
+	group := models.GroupRaw{ID: 1, Name: "g", TokenExpire: "1h", AllowedAPIs: "/api/users,/api/report",
+		RuleConditions: map[string]models.RuleCondition{"/api/reprot": window}}
+	if err := wt.ValidateGroupRaw(group); err == nil {
+		t.Errorf("expected a condition on an unknown path to be rejected")
+	}
+	group.RuleConditions = map[string]models.RuleCondition{"/api/report/": window}
+	if err := wt.ValidateGroupRaw(group); err != nil {
+		t.Errorf("expected a condition on a listed path to be accepted, got %v", err)
+	}
+
+	// 管理器按配置的分隔符拆分规则
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ";", TokenRenewTime: "30m", Language: "en"}
+	group.AllowedAPIs = "/api/users;/api/report"
+	if _, err := wt.InitTM[any](config, []models.GroupRaw{group}); err != nil {
+		t.Errorf("expected group to be accepted with a custom delimiter, got %v", err)
+	}
+	group.RuleConditions = map[string]models.RuleCondition{"/api/reprot": window}
+	if _, err := wt.InitTM[any](config, []models.GroupRaw{group}); err == nil {
+		t.Errorf("expected InitTM to reject a condition on an unknown path")
+	}
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * newPatchManager 创建包含两个用户组的管理器，用户组2只允许内网访问
+ */
+func newPatchManager(t *testing.T) models.IManager[string] {
+	t.Helper()
+	config := models.ConfigRaw{
+		MaxTokens:      100,
+		Delimiter:      ",",
+		TokenRenewTime: "30m",
+		Language:       "en",
+	}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+		{ID: 2, Name: "intranet", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1, AllowCIDRs: []string{"10.0.0.0/8"}},
+	}
+	manager, err := wt.InitTM[string](config, groups)
+	if err != nil {
+		t.Fatalf("Failed to initialize token manager: %v", err)
+	}
+	return manager
+}
+
+/**
+ * TestPatchToken 测试按版本修改token、字段校验以及版本冲突
+ */
+func TestPatchToken(t *testing.T) {
+	tm := newPatchManager(t)
+	key, _ := tm.AddToken(1, 1, "192.168.1.1")
+	token, _ := tm.GetToken(key)
+	if token.Version != 1 {
+		t.Fatalf("new token version = %d, expected 1", token.Version)
+	}
+	if err := tm.Auth(key, "192.168.1.1", "/api"); err != nil {
+		t.Fatalf("Auth failed: %v", err)
+	}
+	if token, _ := tm.GetToken(key); token.Version != 1 {
+		t.Errorf("access must not change the version, got %d", token.Version)
+	}
+
+	data := "profile"
+	expire := int64(60)
+	patched, err := tm.PatchToken(key, 1, models.TokenPatch[string]{UserData: &data, ExpireSeconds: &expire})
+	if err != nil {
+		t.Fatalf("PatchToken failed: %v", err)
+	}
+	if patched.Version != 2 || patched.UserData != "profile" || patched.ExpireSeconds != 60 || patched.UserID != 1 {
+		t.Errorf("patched token = %+v", patched)
+	}
+
+	// 基于旧版本的修改被拒绝，且不产生任何修改
+	other := "stale"
+	_, err = tm.PatchToken(key, 1, models.TokenPatch[string]{UserData: &other})
+	var conflict *models.VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Actual != 2 || conflict.Expected != 1 {
+		t.Fatalf("stale patch = %v, expected version conflict", err)
+	}
+	if data, _ := tm.GetUserData(key); data != "profile" {
+		t.Errorf("stale patch must not apply, user data = %q", data)
+	}
+
+	// 校验失败时所有字段都不生效
+	group := uint(2)
+	if _, err := tm.PatchToken(key, 2, models.TokenPatch[string]{GroupID: &group, UserData: &other}); err == nil || err.Error() != "IP not allowed" {
+		t.Errorf("moving to a group that rejects the token IP = %v", err)
+	}
+	missing := uint(9)
+	badIP := "not-an-ip"
+	negative := int64(-1)
+	for _, patch := range []models.TokenPatch[string]{{}, {GroupID: &missing}, {IP: &badIP}, {ExpireSeconds: &negative}} {
+		if _, err := tm.PatchToken(key, 2, patch); err == nil {
+			t.Errorf("expected patch %+v to be rejected", patch)
+		}
+	}
+	if token, _ := tm.GetToken(key); token.Version != 2 || token.GroupID != 1 || token.UserData != "profile" {
+		t.Errorf("rejected patches must not modify the token: %+v", token)
+	}
+
+	ip := "10.1.2.3"
+	patched, err = tm.PatchToken(key, 2, models.TokenPatch[string]{GroupID: &group, IP: &ip})
+	if err != nil || patched.GroupID != 2 || patched.Version != 3 {
+		t.Fatalf("PatchToken group and IP = %+v, %v", patched, err)
+	}
+	if err := tm.Auth(key, "10.1.2.3", "/api"); err != nil {
+		t.Errorf("Auth with the new IP failed: %v", err)
+	}
+	if err := tm.SetUserData(key, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := tm.GetToken(key); token.Version != 4 {
+		t.Errorf("SetUserData should bump the version, got %d", token.Version)
+	}
+	if _, err := tm.PatchToken("missing", 1, models.TokenPatch[string]{UserData: &data}); err == nil {
+		t.Errorf("expected unknown token to be rejected")
+	}
+}
+
+/**
+ * TestPatchTokenConcurrent 测试并发的读改写不会丢失更新
+ */
+func TestPatchTokenConcurrent(t *testing.T) {
+	tm := newPatchManager(t)
+	key, _ := tm.AddToken(1, 1, "192.168.1.1")
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				token, err := tm.GetToken(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data := token.UserData + "x"
+				_, err = tm.PatchToken(key, token.Version, models.TokenPatch[string]{UserData: &data})
+				var conflict *models.VersionConflictError
+				if errors.As(err, &conflict) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+		}()
+	}
+	wg.Wait()
+
+	token, _ := tm.GetToken(key)
+	if len(token.UserData) != workers || token.Version != workers+1 {
+		t.Errorf("user data %q version %d, expected %d updates", token.UserData, token.Version, workers)
+	}
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/windf17/wt"
+	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/storetest"
+)
+
+/**
+ * TestMemoryTokenStore 内存存储的一致性测试
+ */
+func TestMemoryTokenStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) models.TokenStore[storetest.Data] {
+		return wt.NewMemoryTokenStore[storetest.Data]()
+	})
+}
+
+// failingStore 所有写操作都失败的存储
+type failingStore struct {
+	*wt.MemoryTokenStore[string]
+	err error
+}
+
+func (s *failingStore) Put(key string, t *models.Token[string]) error {
+	return s.err
+}
+
+func (s *failingStore) Delete(key string) error {
+	return s.err
+}
+
+/**
+ * TestInitTMWithStore 测试管理器复用存储中已有的token，以及存储错误的传递
+ */
+func TestInitTMWithStore(t *testing.T) {
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	groups := []models.GroupRaw{
+		{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h", AllowMultipleLogin: 1},
+	}
+	store := wt.NewMemoryTokenStore[string]()
+	first, err := wt.InitTMWithStore[string](config, groups, store)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	key, _ := first.AddToken(1, 1, "10.0.0.1")
+	first.AddToken(1, 1, "10.0.0.2")
+	first.UpdateSharedData(1, func(s *string) error {
+		*s = "cart"
+		return nil
+	})
+
+	// 使用同一个存储重新创建管理器，相当于重启
+	second, err := wt.InitTMWithStore[string](config, groups, store)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	if err := second.Auth(key, "10.0.0.1", "/api"); err != nil {
+		t.Errorf("token should survive the restart: %v", err)
+	}
+	if stats := second.GetStats(); stats.TotalTokens != 2 || stats.ActiveTokens != 2 {
+		t.Errorf("stats after restart = %+v", stats)
+	}
+	if _, err := second.GetSharedData(1); err != nil {
+		t.Errorf("user state should be rebuilt from the store: %v", err)
+	}
+	second.DelToken(key)
+	if n, _ := store.Len(); n != 1 {
+		t.Errorf("store Len = %d, expected 1", n)
+	}
+
+	if _, err := wt.InitTMWithStore[string](config, groups, nil); err == nil {
+		t.Errorf("expected nil store to be rejected")
+	}
+
+	// 存储错误包装后返回，可以用errors.Is判断
+	broken := errors.New("disk full")
+	tm, _ := wt.InitTMWithStore[string](config, groups, &failingStore{wt.NewMemoryTokenStore[string](), broken})
+	if _, err := tm.AddToken(1, 1, "10.0.0.1"); !errors.Is(err, broken) {
+		t.Errorf("AddToken error = %v, expected the store error", err)
+	}
+}
+
+// deleteFailingStore 删除操作失败的存储
+type deleteFailingStore struct {
+	*wt.MemoryTokenStore[string]
+	err error
+}
+
+func (s *deleteFailingStore) Delete(key string) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.MemoryTokenStore.Delete(key)
+}
+
+/**
+ * TestAddTokenSingleLoginDeleteError 测试单点登录时旧token删除失败，AddToken返回错误且不签发新token
+ */
+func TestAddTokenSingleLoginDeleteError(t *testing.T) {
+	groups := []models.GroupRaw{{ID: 1, Name: "user", AllowedAPIs: "/api", TokenExpire: "1h"}}
+	store := &deleteFailingStore{MemoryTokenStore: wt.NewMemoryTokenStore[string]()}
+	config := models.ConfigRaw{MaxTokens: 100, Delimiter: ",", TokenRenewTime: "30m", Language: "en"}
+	tm, err := wt.InitTMWithStore[string](config, groups, store)
+	if err != nil {
+		t.Fatalf("InitTMWithStore failed: %v", err)
+	}
+	old, err := tm.AddToken(1, 1, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("AddToken failed: %v", err)
+	}
+
+	broken := errors.New("disk full")
+	store.err = broken
+	if _, err := tm.AddToken(1, 1, "10.0.0.2"); !errors.Is(err, broken) {
+		t.Errorf("AddToken error = %v, expected the store error", err)
+	}
+	if n, _ := store.Len(); n != 1 {
+		t.Errorf("store Len = %d, expected only the old token", n)
+	}
+	if err := tm.Auth(old, "10.0.0.1", "/api"); err != nil {
+		t.Errorf("old token should stay valid when its deletion fails: %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
 )
 
 /**
@@ -19,7 +20,11 @@ func (tm *Manager[T]) GetToken(key string) (*models.Token[T], error) {
 
 	// 先用读锁检查token是否存在
 	tm.rLock()
-	t := tm.tokens[key]
+	t, err := tm.store.Get(key)
+	if err != nil {
+		tm.rUnlock()
+		return nil, tm.storeError(err)
+	}
 	if t == nil {
 		tm.rUnlock()
 		return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
@@ -35,30 +40,42 @@ func (tm *Manager[T]) GetToken(key string) (*models.Token[T], error) {
 	}
 
 	// 创建token副本，避免返回指针导致的并发问题
-	tokenCopy := *t
+	tokenCopy := snapshotToken(t)
 	tm.rUnlock()
 
 	// 更新最后访问时间（用于LRU策略）
 	tm.lock()
-	if currentToken, exists := tm.tokens[key]; exists && !currentToken.IsExpired() {
-		currentToken.LastAccessTime = time.Now()
-		tm.tokens[key] = currentToken
+	if currentToken, _ := tm.store.Get(key); currentToken != nil && !currentToken.IsExpired() {
+		now := time.Now()
+		tm.touchTokenLocked(key, now)
 		// 更新副本中的访问时间
-		tokenCopy.LastAccessTime = currentToken.LastAccessTime
+		tokenCopy.LastAccessTime = now
 	}
 	tm.unlock()
 
-	return &tokenCopy, nil
+	return tokenCopy, nil
 }
 
 /**
- * AddToken 新增token，通过它申请token，不存储用户数据，存储用户数据另外用SetUserData
+ * AddToken 在默认租户下新增token，通过它申请token，不存储用户数据，存储用户数据另外用SetUserData
  * @param {uint} userID 用户ID
  * @param {uint} groupID 用户组ID
  * @param {string} clientIp 客户端IP地址
  * @returns {string, error} token字符串和错误信息
  */
 func (tm *Manager[T]) AddToken(userID uint, groupID uint, clientIp string) (string, error) {
+	return tm.addToken(DEFAULT_TENANT, userID, groupID, clientIp)
+}
+
+/**
+ * addToken 在指定租户下新增token，用户组只在该租户内查找
+ * @param {string} tenantID 租户ID
+ * @param {uint} userID 用户ID
+ * @param {uint} groupID 用户组ID
+ * @param {string} clientIp 客户端IP地址
+ * @returns {string, error} token字符串和错误信息
+ */
+func (tm *Manager[T]) addToken(tenantID string, userID uint, groupID uint, clientIp string) (string, error) {
 	if userID < 1 {
 		return "", errors.New(getErrorMessage(tm.config.Language, "user_invalid"))
 	}
@@ -71,42 +88,31 @@ func (tm *Manager[T]) AddToken(userID uint, groupID uint, clientIp string) (stri
 
 	// 首先检查用户组是否存在
 	tm.rLock()
-	g := tm.groups[groupID]
+	g := tm.groups[tenantID][groupID]
 	if g == nil {
 		tm.rUnlock()
 		return "", errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
 	}
 	tm.rUnlock()
 
+	// 检查客户端IP是否在用户组允许的网络内
+	if !g.Network.Permits(clientIp) {
+		return "", errors.New(getErrorMessage(tm.config.Language, "ip_not_allowed"))
+	}
+
 	// 获取写锁进行token操作
 	tm.lock()
 	defer tm.unlock()
 
-	// 如果不允许多设备登录，则清理该用户在其他设备上的token
+	// 如果不允许多设备登录，则清理该用户在其他设备上的token（同一用户ID在不同租户下视为不同用户）
 	if !g.AllowMultipleLogin {
-		expiredDeleted := 0
-		activeDeleted := 0
-		for t, ut := range tm.tokens {
-			if ut.UserID == userID {
-				// 检查token是否过期
-				if ut.IsExpired() {
-					expiredDeleted++
-				} else {
-					activeDeleted++
-				}
-				delete(tm.tokens, t)
-			}
-		}
-		// 直接更新统计信息，避免重复加锁
-		if activeDeleted > 0 {
-			tm.stats.TotalTokens -= activeDeleted
-			tm.stats.ActiveTokens -= activeDeleted
-			tm.stats.LastUpdateTime = time.Now()
+		tokens, err := tm.tokensByKeysLocked(tm.store.KeysByUser(tenantID, userID))
+		if err != nil {
+			return "", err
 		}
-		if expiredDeleted > 0 {
-			// 对于过期token，只减少总数，不减少过期token计数
-			tm.stats.TotalTokens -= expiredDeleted
-			tm.stats.LastUpdateTime = time.Now()
+		// 旧token删除失败时不签发新token，否则单点登录失效
+		if _, err := tm.deleteTokensLocked(tokens); err != nil {
+			return "", err
 		}
 	}
 
@@ -127,6 +133,8 @@ func (tm *Manager[T]) AddToken(userID uint, groupID uint, clientIp string) (stri
 		ExpireSeconds:  g.ExpireSeconds,
 		UserData:       zero,
 		IP:             clientIp,
+		TenantID:       tenantID,
+		Version:        1,
 	}
 
 	// 如果配置了最大token数量，先清理过期token
@@ -134,14 +142,29 @@ func (tm *Manager[T]) AddToken(userID uint, groupID uint, clientIp string) (stri
 		tm.cleanExpiredTokensInternal()
 
 		// 检查清理后的token数量是否仍然达到上限
-		if len(tm.tokens) >= tm.config.MaxTokens {
+		n, err := tm.store.Len()
+		if err != nil {
+			return "", tm.storeError(err)
+		}
+		if n >= tm.config.MaxTokens {
 			// 清理最久没有使用的token（LRU策略）
-			tm.cleanOldestTokensInternal(1)
+			tm.cleanOldestTokensInternal(1, nil)
+		}
+	}
+
+	// 租户配额：达到上限时只淘汰该租户内最久没有使用的token
+	if quota := tm.tenantMaxTokens[tenantID]; quota > 0 {
+		inTenant := func(t *models.Token[T]) bool { return t.TenantID == tenantID }
+		if n := tm.countTokensLocked(inTenant); n >= quota {
+			tm.cleanOldestTokensInternal(n-quota+1, inTenant)
 		}
 	}
 
 	// 存储token
-	tm.tokens[tokenKey] = &tokenData
+	if err := tm.putTokenLocked(tokenKey, &tokenData); err != nil {
+		return "", err
+	}
+	tm.attachUserLocked(&tokenData)
 	// 直接更新统计信息，避免重复加锁
 	tm.stats.TotalTokens += 1
 	tm.stats.ActiveTokens += 1
@@ -158,14 +181,19 @@ func (tm *Manager[T]) AddToken(userID uint, groupID uint, clientIp string) (stri
 func (tm *Manager[T]) DelToken(key string) error {
 	tm.lock()
 	defer tm.unlock()
-	token, exists := tm.tokens[key]
-	if !exists {
+	token, err := tm.store.Get(key)
+	if err != nil {
+		return tm.storeError(err)
+	}
+	if token == nil {
 		return errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
 	}
 
 	// 检查token是否过期
 	isExpired := token.IsExpired()
-	delete(tm.tokens, key)
+	if err := tm.removeTokenLocked(key, token); err != nil {
+		return err
+	}
 	// 直接更新统计信息，避免重复加锁
 	if isExpired {
 		// 对于过期token，只减少总数
@@ -182,69 +210,73 @@ func (tm *Manager[T]) DelToken(key string) error {
 }
 
 /**
- * DelTokensByUserID 删除指定用户的所有token
+ * DelTokensByUserID 删除默认租户下指定用户的所有token
  * @param {uint} userID 用户ID
  * @returns {error} 操作结果错误信息
  */
 func (tm *Manager[T]) DelTokensByUserID(userID uint) error {
+	return tm.delTokensByUserID(DEFAULT_TENANT, userID)
+}
+
+/**
+ * DelTokensByGroupID 删除默认租户下指定用户组的所有token
+ * @param {uint} groupID 用户组ID
+ * @returns {error} 操作结果错误信息
+ */
+func (tm *Manager[T]) DelTokensByGroupID(groupID uint) error {
+	return tm.delTokensByGroupID(DEFAULT_TENANT, groupID)
+}
+
+// delTokensByUserID 删除指定租户下某个用户的所有token
+func (tm *Manager[T]) delTokensByUserID(tenantID string, userID uint) error {
 	if userID == 0 {
 		return errors.New(getErrorMessage(tm.config.Language, "user_invalid"))
 	}
 	tm.lock()
 	defer tm.unlock()
-	expiredDeleted := 0
-	activeDeleted := 0
-	for token, ut := range tm.tokens {
-		if ut.UserID == userID {
-			// 检查token是否过期
-			if ut.IsExpired() {
-				expiredDeleted++
-			} else {
-				activeDeleted++
-			}
-			delete(tm.tokens, token)
-		}
+	tokens, err := tm.tokensByKeysLocked(tm.store.KeysByUser(tenantID, userID))
+	if err != nil {
+		return err
 	}
-	// 直接更新统计信息，避免重复加锁
-	if activeDeleted > 0 {
-		tm.stats.TotalTokens -= activeDeleted
-		tm.stats.ActiveTokens -= activeDeleted
-		tm.stats.LastUpdateTime = time.Now()
-	}
-	if expiredDeleted > 0 {
-		// 对于过期token，只减少总数，不减少过期token计数
-		tm.stats.TotalTokens -= expiredDeleted
-		tm.stats.LastUpdateTime = time.Now()
-	}
-	return nil
+	_, err = tm.deleteTokensLocked(tokens)
+	return err
 }
 
-/**
- * DelTokensByGroupID 删除指定用户组的所有token
- * @param {uint} groupID 用户组ID
- * @returns {error} 操作结果错误信息
- */
-func (tm *Manager[T]) DelTokensByGroupID(groupID uint) error {
+// delTokensByGroupID 删除指定租户下某个用户组的所有token
+func (tm *Manager[T]) delTokensByGroupID(tenantID string, groupID uint) error {
 	if groupID == 0 {
 		return errors.New(getErrorMessage(tm.config.Language, "group_invalid"))
 	}
 	tm.lock()
 	defer tm.unlock()
 	// 检查用户组id是不是存在
-	if _, exists := tm.groups[groupID]; !exists {
+	if _, exists := tm.groups[tenantID][groupID]; !exists {
 		return errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
 	}
+	tokens, err := tm.tokensByKeysLocked(tm.store.KeysByGroup(tenantID, groupID))
+	if err != nil {
+		return err
+	}
+	_, err = tm.deleteTokensLocked(tokens)
+	return err
+}
+
+/**
+ * deleteTokensLocked 删除token并更新统计信息（调用方需持有写锁）
+ * 存储出错时停止删除，已删除的token仍然计入统计信息；存储支持事务时出错则一个都不删除
+ * @param {map[string]*models.Token[T]} tokens 要删除的token，通常由tokensWhereLocked或tokensByKeysLocked得到
+ * @returns {int, error} 删除的token数量和存储错误
+ */
+func (tm *Manager[T]) deleteTokensLocked(tokens map[string]*models.Token[T]) (int, error) {
 	expiredDeleted := 0
 	activeDeleted := 0
-	for token, ut := range tm.tokens {
-		if ut.GroupID == groupID {
-			// 检查token是否过期
-			if ut.IsExpired() {
-				expiredDeleted++
-			} else {
-				activeDeleted++
-			}
-			delete(tm.tokens, token)
+	removed, err := tm.removeTokensLocked(tokens)
+	for _, t := range removed {
+		// 检查token是否过期
+		if t != nil && t.IsExpired() {
+			expiredDeleted++
+		} else {
+			activeDeleted++
 		}
 	}
 	// 直接更新统计信息，避免重复加锁
@@ -258,25 +290,268 @@ func (tm *Manager[T]) DelTokensByGroupID(groupID uint) error {
 		tm.stats.TotalTokens -= expiredDeleted
 		tm.stats.LastUpdateTime = time.Now()
 	}
+	return activeDeleted + expiredDeleted, err
+}
+
+/**
+ * removeTokensLocked 删除多个token并释放与其关联的状态（调用方需持有写锁，不更新统计信息）
+ * 存储实现了models.TxStore时所有删除在一个事务中完成，提交成功后才释放关联的状态；
+ * 否则逐个删除，出错时停止，已删除的token同样释放状态
+ * @param {map[string]*models.Token[T]} tokens 要删除的token，值为nil时从存储中读取
+ * @returns {map[string]*models.Token[T], error} 已删除的token和存储错误
+ */
+func (tm *Manager[T]) removeTokensLocked(tokens map[string]*models.Token[T]) (map[string]*models.Token[T], error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	removed := make(map[string]*models.Token[T], len(tokens))
+	err := tm.storeTxLocked(func() error {
+		for key, t := range tokens {
+			if t == nil {
+				var err error
+				if t, err = tm.store.Get(key); err != nil {
+					return tm.storeError(err)
+				}
+			}
+			if err := tm.deleteJournaledLocked(key); err != nil {
+				return err
+			}
+			removed[key] = t
+		}
+		return nil
+	})
+	if _, ok := tm.store.(models.TxStore); ok && err != nil {
+		// 事务已回滚，存储中的token都还在
+		removed = nil
+	}
+	for key, t := range removed {
+		if t != nil {
+			tm.detachUserLocked(t)
+		}
+		tm.limiter.forget(key, tm.now())
+		tm.notifyRevokeLocked(key, t)
+	}
+	tm.compactIfNeededLocked()
+	return removed, err
+}
+
+/**
+ * deleteJournaledLocked 先写入预写日志再从存储中删除token，存储删除失败时撤销日志记录（调用方需持有写锁）
+ * @param {string} key token键
+ * @returns {error} 日志或存储错误
+ */
+func (tm *Manager[T]) deleteJournaledLocked(key string) error {
+	mark := tm.journalMarkLocked()
+	if err := tm.journalLocked(journalRecord{Op: journalDelToken, Key: key}); err != nil {
+		return err
+	}
+	if err := tm.store.Delete(key); err != nil {
+		tm.rollbackJournalLocked(mark)
+		return tm.storeError(err)
+	}
+	return nil
+}
+
+/**
+ * storeTxLocked 存储实现了models.TxStore时在事务中执行fn，fn返回错误时回滚；否则直接执行fn（调用方需持有写锁）
+ * 事务回滚或提交失败时同时撤销fn写入的预写日志记录，日志不会记下没有生效的变更
+ * @param {func() error} fn 要执行的写操作
+ * @returns {error} fn返回的错误或事务错误
+ */
+func (tm *Manager[T]) storeTxLocked(fn func() error) error {
+	tx, ok := tm.store.(models.TxStore)
+	if !ok {
+		return fn()
+	}
+	if err := tx.Begin(); err != nil {
+		return tm.storeError(err)
+	}
+	mark := tm.journalMarkLocked()
+	if err := fn(); err != nil {
+		tx.Rollback()
+		tm.rollbackJournalLocked(mark)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		tm.rollbackJournalLocked(mark)
+		return tm.storeError(err)
+	}
+	return nil
+}
+
+/**
+ * deleteTokensWhereLocked 删除满足条件的token并更新统计信息（调用方需持有写锁）
+ * @param {func(*models.Token[T]) bool} match 筛选条件
+ * @returns {int, error} 删除的token数量和存储错误
+ */
+func (tm *Manager[T]) deleteTokensWhereLocked(match func(t *models.Token[T]) bool) (int, error) {
+	tokens, err := tm.tokensWhereLocked(match)
+	if err != nil {
+		return 0, err
+	}
+	return tm.deleteTokensLocked(tokens)
+}
+
+/**
+ * removeTokenLocked 删除单个token并释放与其关联的状态（调用方需持有写锁，不更新统计信息）
+ * 所有删除token的路径都必须经过这里，避免限流等状态泄漏
+ * @param {string} key token键
+ * @param {*models.Token[T]} t 调用方已读取的token，为nil时从存储中读取
+ * @returns {error} 存储错误，出错时token和关联的状态都保持不变
+ */
+func (tm *Manager[T]) removeTokenLocked(key string, t *models.Token[T]) error {
+	if t == nil {
+		var err error
+		if t, err = tm.store.Get(key); err != nil {
+			return tm.storeError(err)
+		}
+	}
+	if err := tm.deleteJournaledLocked(key); err != nil {
+		return err
+	}
+	if t != nil {
+		tm.detachUserLocked(t)
+	}
+	tm.limiter.forget(key, tm.now())
+	tm.notifyRevokeLocked(key, t)
+	tm.compactIfNeededLocked()
 	return nil
 }
 
+/**
+ * snapshotToken 生成token的独立副本，用户数据和提权记录都会深拷贝（调用方需持有锁）
+ * @param {*models.Token[T]} t token信息
+ * @returns {*models.Token[T]} 副本
+ */
+func snapshotToken[T any](t *models.Token[T]) *models.Token[T] {
+	s := *t
+	s.UserData = utility.DeepCopy(t.UserData)
+	if t.Elevation != nil {
+		e := *t.Elevation
+		s.Elevation = &e
+	}
+	return &s
+}
+
+/**
+ * countTokensLocked 统计满足条件的token数量（调用方需持有锁）
+ * @param {func(*models.Token[T]) bool} match 筛选条件
+ * @returns {int} token数量
+ */
+func (tm *Manager[T]) countTokensLocked(match func(t *models.Token[T]) bool) int {
+	n := 0
+	tm.store.Range(func(_ string, t *models.Token[T]) bool {
+		if t != nil && match(t) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
 // UpdateToken 更新指定的token
+//
+// Deprecated: UpdateToken直接用传入的结构替换token，不做任何校验，基于GetToken的读改写也会丢失并发修改；请使用PatchToken
 func (tm *Manager[T]) UpdateToken(key string, token *models.Token[T]) error {
 	tm.lock()
 	defer tm.unlock()
-	if _, exists := tm.tokens[key]; !exists {
+	current, err := tm.store.Get(key)
+	if err != nil {
+		return tm.storeError(err)
+	}
+	if current == nil {
 		return errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
 	}
 	if token == nil {
 		return errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
 	}
-	token.LastAccessTime = time.Now()
-	tm.tokens[key] = token
+	// 保存副本，调用方之后修改传入的结构不会影响管理器中的token
+	stored := snapshotToken(token)
+	stored.LastAccessTime = time.Now()
+	stored.Version = current.Version + 1
+	if err := tm.putTokenLocked(key, stored); err != nil {
+		return err
+	}
+	// 替换的token可能属于其他用户，需要同步用户级别的引用计数
+	tm.detachUserLocked(current)
+	tm.attachUserLocked(stored)
 
 	return nil
 }
 
+/**
+ * PatchToken 修改token的部分字段，只有版本号与expectedVersion一致时才会修改
+ * 所有字段校验通过后才会一次性生效，修改成功后版本号加1
+ * @param {string} key token键
+ * @param {uint64} expectedVersion 调用方读取token时得到的版本号
+ * @param {models.TokenPatch[T]} patch 要修改的字段
+ * @returns {*models.Token[T], error} 修改后的token副本和错误信息，版本不一致时返回*models.VersionConflictError
+ */
+func (tm *Manager[T]) PatchToken(key string, expectedVersion uint64, patch models.TokenPatch[T]) (*models.Token[T], error) {
+	if patch.GroupID == nil && patch.ExpireSeconds == nil && patch.UserData == nil && patch.IP == nil {
+		return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+	if patch.ExpireSeconds != nil && *patch.ExpireSeconds < 0 {
+		return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_params"))
+	}
+	if patch.IP != nil {
+		if err := ValidateIPAddress(*patch.IP); err != nil {
+			return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_ip"))
+		}
+	}
+
+	tm.lock()
+	defer tm.unlock()
+	t, err := tm.store.Get(key)
+	if err != nil {
+		return nil, tm.storeError(err)
+	}
+	if t == nil {
+		return nil, errors.New(getErrorMessage(tm.config.Language, "invalid_token"))
+	}
+	if t.IsExpired() {
+		return nil, errors.New(getErrorMessage(tm.config.Language, "token_expired"))
+	}
+	if t.Version != expectedVersion {
+		return nil, &models.VersionConflictError{
+			Expected: expectedVersion,
+			Actual:   t.Version,
+			Message:  getErrorMessage(tm.config.Language, "version_conflict"),
+		}
+	}
+
+	// 先在副本上修改并校验，全部通过后再替换
+	updated := *t
+	if patch.GroupID != nil {
+		updated.GroupID = *patch.GroupID
+	}
+	if patch.ExpireSeconds != nil {
+		updated.ExpireSeconds = *patch.ExpireSeconds
+	}
+	if patch.UserData != nil {
+		// 保存副本，调用方之后修改传入的数据不会影响管理器
+		updated.UserData = utility.DeepCopy(*patch.UserData)
+	}
+	if patch.IP != nil {
+		updated.IP = *patch.IP
+	}
+	if patch.GroupID != nil || patch.IP != nil {
+		g := tm.groups[updated.TenantID][updated.GroupID]
+		if g == nil {
+			return nil, errors.New(getErrorMessage(tm.config.Language, "group_not_found"))
+		}
+		if !g.Network.Permits(updated.IP) {
+			return nil, errors.New(getErrorMessage(tm.config.Language, "ip_not_allowed"))
+		}
+	}
+	updated.Version++
+	if err := tm.putTokenLocked(key, &updated); err != nil {
+		return nil, err
+	}
+
+	return snapshotToken(&updated), nil
+}
+
 /**
  * CleanExpiredTokens 清理过期token并更新缓存文件
  */
@@ -292,12 +567,27 @@ func (tm *Manager[T]) CleanExpiredTokens() {
 func (tm *Manager[T]) cleanExpiredTokensInternal() {
 	expiredCount := 0
 	nullCount := 0
-	for key, token := range tm.tokens {
+	var tokens map[string]*models.Token[T]
+	var err error
+	if idx, ok := tm.store.(models.ExpiryIndex); ok {
+		// 存储按过期时间建立了索引，只读取已过期的token
+		tokens, err = tm.tokensByKeysLocked(idx.ExpiredKeys(time.Now()))
+	} else {
+		tokens, err = tm.tokensWhereLocked(nil)
+	}
+	if err != nil {
+		return
+	}
+	for key, token := range tokens {
+		if token != nil && !token.IsExpired() {
+			delete(tokens, key)
+		}
+	}
+	removed, _ := tm.removeTokensLocked(tokens)
+	for _, token := range removed {
 		if token == nil {
-			delete(tm.tokens, key)
 			nullCount++
-		} else if token.IsExpired() {
-			delete(tm.tokens, key)
+		} else {
 			expiredCount++
 		}
 	}
@@ -342,8 +632,7 @@ func (tm *Manager[T]) removeExpiredTokenSafe(key string) {
 	defer tm.unlock()
 
 	// 重新检查，因为在锁切换期间可能有变化
-	if t, exists := tm.tokens[key]; exists && t != nil && t.IsExpired() {
-		delete(tm.tokens, key)
+	if t, _ := tm.store.Get(key); t != nil && t.IsExpired() && tm.removeTokenLocked(key, t) == nil {
 		// 删除过期token时，只减少总数，不减少过期token计数（过期token数是累计统计）
 		tm.stats.TotalTokens -= 1
 		tm.stats.LastUpdateTime = time.Now()
@@ -353,9 +642,14 @@ func (tm *Manager[T]) removeExpiredTokenSafe(key string) {
 /**
  * cleanOldestTokensInternal 清理最久没有使用的token（LRU策略）
  * @param {int} count 要清理的token数量
+ * @param {func(*models.Token[T]) bool} match 候选token的筛选条件，为nil表示所有token
  */
-func (tm *Manager[T]) cleanOldestTokensInternal(count int) {
-	if count <= 0 || len(tm.tokens) == 0 {
+func (tm *Manager[T]) cleanOldestTokensInternal(count int, match func(t *models.Token[T]) bool) {
+	if count <= 0 {
+		return
+	}
+	tokens, err := tm.tokensWhereLocked(match)
+	if err != nil || len(tokens) == 0 {
 		return
 	}
 
@@ -365,8 +659,11 @@ func (tm *Manager[T]) cleanOldestTokensInternal(count int) {
 		lastAccess time.Time
 	}
 
-	tokensToSort := make([]tokenInfo, 0, len(tm.tokens))
-	for key, token := range tm.tokens {
+	tokensToSort := make([]tokenInfo, 0, len(tokens))
+	for key, token := range tokens {
+		if token == nil {
+			continue
+		}
 		tokensToSort = append(tokensToSort, tokenInfo{
 			key:        key,
 			lastAccess: token.LastAccessTime,
@@ -390,10 +687,8 @@ func (tm *Manager[T]) cleanOldestTokensInternal(count int) {
 	for i := 0; i < deleteCount; i++ {
 		key := tokensToSort[i].key
 		// 检查token是否过期，以便正确更新统计信息
-		if token, exists := tm.tokens[key]; exists {
-			isExpired := token.IsExpired()
-			delete(tm.tokens, key)
-			if isExpired {
+		if token := tokens[key]; tm.removeTokenLocked(key, token) == nil {
+			if token.IsExpired() {
 				expiredDeleted++
 			} else {
 				activeDeleted++
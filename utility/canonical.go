@@ -0,0 +1,147 @@
+package utility
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// 严格路径规范化的错误，可以用errors.Is判断具体原因
+var (
+	// ErrPathTraversal 路径中的".."越过了根路径，或使用了编码的"."、".."段
+	ErrPathTraversal = errors.New("路径包含越界或编码的点段")
+	// ErrEncodedSlash 路径段中包含编码的斜杠或反斜杠（%2F、%5C）
+	ErrEncodedSlash = errors.New("路径包含编码的斜杠")
+	// ErrDoubleEncoding 路径段解码一次后仍然包含百分号编码，如"%252F"
+	ErrDoubleEncoding = errors.New("路径包含重复的百分号编码")
+	// ErrInvalidEncoding 路径包含无法解析的百分号编码
+	ErrInvalidEncoding = errors.New("路径包含无效的百分号编码")
+	// ErrPathParameter 路径段中包含分号参数，如"/api;x=1/admin"
+	ErrPathParameter = errors.New("路径包含分号参数")
+	// ErrTrailingDot 路径段以"."结尾，如"admin."
+	ErrTrailingDot = errors.New("路径段以点结尾")
+	// ErrAmbiguousSegment 路径包含反斜杠、控制字符或首尾空白等可能被不同服务器解释为不同路径的内容
+	ErrAmbiguousSegment = errors.New("路径段包含有歧义的字符")
+)
+
+// CanonicalOptions 严格路径规范化选项
+type CanonicalOptions struct {
+	// 是否忽略大小写，开启后所有路径段转换为小写
+	CaseInsensitive bool
+}
+
+/**
+ * CanonicalizePath 严格规范化请求路径，返回与实际路由一致的路径段
+ * 与ParseURLToPathSegments不同，这里会消解"."和".."段，并拒绝所有可能让鉴权与路由产生分歧的写法：
+ * 编码的斜杠、重复编码、分号参数、以点结尾的路径段、反斜杠和控制字符
+ * @param {string} urlStr 请求的URL字符串，可以是完整URL或只有路径
+ * @param {CanonicalOptions} opts 规范化选项
+ * @returns {[]string, error} 规范化后的路径段和错误
+ */
+func CanonicalizePath(urlStr string, opts CanonicalOptions) ([]string, error) {
+	rawPath, err := rawURLPath(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []string{}
+	for _, raw := range strings.Split(rawPath, "/") {
+		if raw == "" {
+			continue
+		}
+		if strings.Contains(raw, ";") {
+			return nil, ErrPathParameter
+		}
+		if strings.Contains(raw, "\\") {
+			return nil, ErrAmbiguousSegment
+		}
+		seg, err := url.PathUnescape(raw)
+		if err != nil {
+			return nil, ErrInvalidEncoding
+		}
+		if err := checkDecodedSegment(raw, seg); err != nil {
+			return nil, err
+		}
+
+		switch seg {
+		case ".":
+			continue
+		case "..":
+			if len(segments) == 0 {
+				return nil, ErrPathTraversal
+			}
+			segments = segments[:len(segments)-1]
+			continue
+		}
+		if opts.CaseInsensitive {
+			seg = strings.ToLower(seg)
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+/**
+ * rawURLPath 提取URL中未解码的路径部分
+ * @param {string} urlStr 请求的URL字符串
+ * @returns {string, error} 未解码的路径和错误
+ */
+func rawURLPath(urlStr string) (string, error) {
+	for i := 0; i < len(urlStr); i++ {
+		if c := urlStr[i]; c < 0x20 || c == 0x7f {
+			return "", ErrAmbiguousSegment
+		}
+	}
+	// 只有路径时直接截掉查询参数和锚点，避免"//"开头的路径被当作主机名
+	if strings.HasPrefix(urlStr, "/") {
+		if i := strings.IndexAny(urlStr, "?#"); i >= 0 {
+			urlStr = urlStr[:i]
+		}
+		return urlStr, nil
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", ErrInvalidEncoding
+	}
+	// EscapedPath在编码与默认编码不同时返回原始写法，保留%2F等信息
+	return u.EscapedPath(), nil
+}
+
+/**
+ * checkDecodedSegment 检查解码后的路径段是否有歧义
+ * @param {string} raw 原始路径段
+ * @param {string} seg 解码后的路径段
+ * @returns {error} 有歧义时返回对应的错误
+ */
+func checkDecodedSegment(raw, seg string) error {
+	if strings.ContainsAny(seg, "/\\") {
+		return ErrEncodedSlash
+	}
+	for i := 0; i < len(seg); i++ {
+		if c := seg[i]; c < 0x20 || c == 0x7f {
+			return ErrAmbiguousSegment
+		}
+		if seg[i] == '%' && i+2 < len(seg) && isHex(seg[i+1]) && isHex(seg[i+2]) {
+			return ErrDoubleEncoding
+		}
+	}
+	if strings.TrimSpace(seg) != seg {
+		return ErrAmbiguousSegment
+	}
+	if seg == "." || seg == ".." {
+		// 编码的点段（如"%2e%2e"）在不同服务器上解释不同，一律拒绝
+		if raw != seg {
+			return ErrPathTraversal
+		}
+		return nil
+	}
+	if strings.HasSuffix(seg, ".") {
+		return ErrTrailingDot
+	}
+	return nil
+}
+
+// isHex 判断字符是否为十六进制数字
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,126 @@
+package utility
+
+import (
+	"reflect"
+
+	"github.com/windf17/wt/models"
+)
+
+/**
+ * DeepCopy 深拷贝任意值，返回的副本与原值不共享任何可变数据
+ * 实现了models.Cloner[T]（值或指针接收者均可）时使用Clone，否则使用反射逐层复制
+ * 反射复制时结构体的未导出字段按值复制，通道和函数保持共享
+ * @param {T} v 原值
+ * @returns {T} 副本
+ */
+func DeepCopy[T any](v T) T {
+	if c, ok := any(v).(models.Cloner[T]); ok {
+		return c.Clone()
+	}
+	if c, ok := any(&v).(models.Cloner[T]); ok {
+		return c.Clone()
+	}
+	rv := reflect.ValueOf(&v).Elem()
+	if !needsCopy(rv.Type()) {
+		return v
+	}
+	var out T
+	reflect.ValueOf(&out).Elem().Set(deepCopyValue(rv, make(map[visit]reflect.Value)))
+	return out
+}
+
+// visit 已复制的指针，同一地址可能以不同类型出现（如结构体和它的第一个字段）
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+/**
+ * needsCopy 判断类型是否包含引用类型，不包含时直接赋值即可
+ * @param {reflect.Type} t 类型
+ * @returns {bool} 是否需要深拷贝
+ */
+func needsCopy(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Array:
+		return needsCopy(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if needsCopy(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+/**
+ * deepCopyValue 递归复制反射值
+ * @param {reflect.Value} v 原值
+ * @param {map[visit]reflect.Value} seen 已复制的指针，用于处理循环引用
+ * @returns {reflect.Value} 副本
+ */
+func deepCopyValue(v reflect.Value, seen map[visit]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		k := visit{v.Pointer(), v.Type()}
+		if p, ok := seen[k]; ok {
+			return p
+		}
+		p := reflect.New(v.Type().Elem())
+		seen[k] = p
+		p.Elem().Set(deepCopyValue(v.Elem(), seen))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type()).Elem()
+		n.Set(deepCopyValue(v.Elem(), seen))
+		return n
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(deepCopyValue(v.Index(i), seen))
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			n.SetMapIndex(deepCopyValue(iter.Key(), seen), deepCopyValue(iter.Value(), seen))
+		}
+		return n
+	case reflect.Array:
+		n := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(deepCopyValue(v.Index(i), seen))
+		}
+		return n
+	case reflect.Struct:
+		n := reflect.New(v.Type()).Elem()
+		// 先整体复制，未导出字段保留原值
+		n.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := n.Field(i); f.CanSet() && needsCopy(f.Type()) {
+				f.Set(deepCopyValue(v.Field(i), seen))
+			}
+		}
+		return n
+	default:
+		return v
+	}
+}
@@ -229,3 +229,147 @@ func ParseDuration(duration string) int64 {
 		return 0
 	}
 }
+
+/**
+ * ExplainPermission 按HasPermission相同的算法匹配规则，并返回完整的匹配过程
+ * 用于鉴权结果的诊断，不用于请求热路径
+ * @param {string} urlStr 请求的URL字符串
+ * @param {[]models.ApiRule} apiRules API规则数组（已按优先级排序）
+ * @returns {[]string} 解析后的请求路径段
+ * @returns {[]models.RuleMatch} 每条规则的匹配情况
+ * @returns {*models.RuleMatch} 最终生效的规则，为nil表示没有规则匹配
+ */
+func ExplainPermission(urlStr string, apiRules []models.ApiRule) ([]string, []models.RuleMatch, *models.RuleMatch) {
+	return ExplainSegments(ParseURLToPathSegments(urlStr), apiRules)
+}
+
+/**
+ * ExplainSegments 对已经解析好的路径段执行ExplainPermission的匹配过程
+ * @param {[]string} apiPath 请求路径段
+ * @param {[]models.ApiRule} apiRules API规则数组（已按优先级排序）
+ * @returns {[]string} 请求路径段
+ * @returns {[]models.RuleMatch} 每条规则的匹配情况
+ * @returns {*models.RuleMatch} 最终生效的规则，为nil表示没有规则匹配
+ */
+func ExplainSegments(apiPath []string, apiRules []models.ApiRule) ([]string, []models.RuleMatch, *models.RuleMatch) {
+	candidates := make([]models.RuleMatch, 0, len(apiRules))
+	if len(apiPath) == 0 {
+		return apiPath, candidates, nil
+	}
+
+	winner := -1
+	maxRuleLength := 0
+	for i, rule := range apiRules {
+		matchedSegments := 0
+		for j := 0; j < len(apiPath) && j < len(rule.Path); j++ {
+			if apiPath[j] != rule.Path[j] {
+				break
+			}
+			matchedSegments++
+		}
+		matched := matchedSegments == len(rule.Path)
+		candidates = append(candidates, models.RuleMatch{
+			Index:       i,
+			Rule:        rule,
+			MatchLength: matchedSegments,
+			Matched:     matched,
+		})
+		// 与HasPermission保持一致：只有更长的完整前缀匹配才能取代当前结果
+		if matched && len(rule.Path) > maxRuleLength {
+			maxRuleLength = len(rule.Path)
+			winner = len(candidates) - 1
+		}
+	}
+
+	if winner < 0 {
+		return apiPath, candidates, nil
+	}
+	best := candidates[winner]
+	return apiPath, candidates, &best
+}
+
+/**
+ * HasCompiledPermission 使用用户组编译好的前缀树检查API权限
+ * 结果与HasPermission完全一致，但匹配成本只与请求路径段数相关；
+ * 对于普通的路径请求（以"/"开头、不含百分号编码），匹配过程不产生内存分配
+ * @param {string} urlStr 请求的URL字符串
+ * @param {*models.Group} g 用户组，Trie为nil时退回HasPermission
+ * @returns {bool} 权限验证结果（true=允许访问，false=拒绝访问）
+ */
+func HasCompiledPermission(urlStr string, g *models.Group) bool {
+	index := MatchCompiledRule(urlStr, g)
+	return index >= 0 && g.ApiRules[index].Rule
+}
+
+/**
+ * MatchCompiledRule 使用用户组编译好的前缀树查找最终生效的规则
+ * @param {string} urlStr 请求的URL字符串
+ * @param {*models.Group} g 用户组，Trie为nil时退回线性扫描
+ * @returns {int} 生效规则在g.ApiRules中的下标，-1表示没有规则匹配
+ */
+func MatchCompiledRule(urlStr string, g *models.Group) int {
+	var index int
+	if g.Trie == nil {
+		_, _, winner := ExplainPermission(urlStr, g.ApiRules)
+		if winner == nil {
+			return -1
+		}
+		return winner.Index
+	}
+
+	if path, ok := fastURLPath(urlStr); ok {
+		index, _ = g.Trie.MatchPath(path)
+	} else {
+		index, _ = g.Trie.MatchSegments(ParseURLToPathSegments(urlStr))
+	}
+	if index >= len(g.ApiRules) {
+		return -1
+	}
+	return index
+}
+
+/**
+ * MatchCompiledSegments 对已经解析好的路径段查找最终生效的规则
+ * @param {[]string} segments 请求路径段
+ * @param {*models.Group} g 用户组，Trie为nil时退回线性扫描
+ * @returns {int} 生效规则在g.ApiRules中的下标，-1表示没有规则匹配
+ */
+func MatchCompiledSegments(segments []string, g *models.Group) int {
+	if g.Trie == nil {
+		_, _, winner := ExplainSegments(segments, g.ApiRules)
+		if winner == nil {
+			return -1
+		}
+		return winner.Index
+	}
+	index, _ := g.Trie.MatchSegments(segments)
+	if index >= len(g.ApiRules) {
+		return -1
+	}
+	return index
+}
+
+/**
+ * fastURLPath 不经过url.Parse直接提取URL中的路径部分
+ * 只处理与url.Parse结果必然相同的简单情况：以单个"/"开头，不含百分号编码和控制字符；
+ * 其他情况返回false，由调用方退回url.Parse
+ * @param {string} urlStr 请求的URL字符串
+ * @returns {string} 路径部分
+ * @returns {bool} 是否可以使用快速路径
+ */
+func fastURLPath(urlStr string) (string, bool) {
+	if len(urlStr) == 0 || urlStr[0] != '/' || strings.HasPrefix(urlStr, "//") {
+		return "", false
+	}
+	end := len(urlStr)
+	for i := 0; i < len(urlStr); i++ {
+		c := urlStr[i]
+		if c < 0x20 || c == 0x7f || c == '%' {
+			return "", false
+		}
+		if (c == '?' || c == '#') && end == len(urlStr) {
+			end = i
+		}
+	}
+	return urlStr[:end], true
+}
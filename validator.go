@@ -4,8 +4,11 @@ import (
 	"errors"
 	"net"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/windf17/wt/models"
+	"github.com/windf17/wt/utility"
 )
 
 /**
@@ -36,6 +39,18 @@ func ValidateConfig(config models.ConfigRaw) error {
 		return err
 	}
 
+	// 验证时区
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			return errors.New("Timezone无法识别: " + config.Timezone)
+		}
+	}
+
+	// 验证路径匹配模式
+	if config.CaseInsensitivePaths && !config.StrictPaths {
+		return errors.New("CaseInsensitivePaths需要同时开启StrictPaths")
+	}
+
 	return nil
 }
 
@@ -72,10 +87,21 @@ func validateTokenRenewTime(renewTime string) error {
 
 /**
  * ValidateGroupRaw 验证用户组配置
+ * 不知道管理器的分隔符，检查附加条件引用的路径时AllowedAPIs和DeniedAPIs按空白和逗号拆分
  * @param {GroupRaw} group 用户组配置
  * @returns {error} 验证错误
  */
 func ValidateGroupRaw(group models.GroupRaw) error {
+	return validateGroupRaw(group, "")
+}
+
+/**
+ * validateGroupRaw 按分隔符验证用户组配置
+ * @param {GroupRaw} group 用户组配置
+ * @param {string} delimiter API分隔符，为空时按空白和逗号拆分
+ * @returns {error} 验证错误
+ */
+func validateGroupRaw(group models.GroupRaw, delimiter string) error {
 	if group.ID == 0 {
 		return errors.New("用户组ID不能为0")
 	}
@@ -90,10 +116,74 @@ func ValidateGroupRaw(group models.GroupRaw) error {
 			return errors.New("用户组TokenExpire格式错误: " + err.Error())
 		}
 	}
-	
+
+	// 验证网络限制
+	if _, err := models.ParseNetworkPolicy(group.AllowCIDRs, group.DenyCIDRs); err != nil {
+		return errors.New("用户组网络限制配置错误: " + err.Error())
+	}
+
+	// 验证时间窗口
+	for _, w := range group.TimeWindows {
+		if err := w.Compile(); err != nil {
+			return errors.New("用户组时间窗口配置错误: " + err.Error())
+		}
+	}
+	// 验证限流
+	if group.RateLimit != nil {
+		if err := group.RateLimit.Compiled().Compile(); err != nil {
+			return errors.New("用户组限流配置错误: " + err.Error())
+		}
+	}
+	// 验证用量配额
+	quotaNames := make(map[string]bool, len(group.Quotas))
+	for _, q := range group.Quotas {
+		if err := q.Validate(); err != nil {
+			return errors.New("用户组配额配置错误: " + err.Error())
+		}
+		if quotaNames[q.Key()] {
+			return errors.New("用户组配额名称重复: " + q.Key())
+		}
+		quotaNames[q.Key()] = true
+	}
+	rules := make(map[string]bool)
+	for _, apis := range []string{group.AllowedAPIs, group.DeniedAPIs} {
+		for _, api := range splitRuleAPIs(apis, delimiter) {
+			rules[strings.Join(utility.ParsePathToSegments(api), "/")] = true
+		}
+	}
+	for api, cond := range group.RuleConditions {
+		// 引用的路径不在规则中时附加条件不会生效，拼写错误会让限制静默失效
+		if !rules[strings.Join(utility.ParsePathToSegments(api), "/")] {
+			return errors.New("规则" + api + "的附加条件引用的路径不在AllowedAPIs或DeniedAPIs中")
+		}
+		if _, err := models.ParseNetworkPolicy(cond.AllowCIDRs, cond.DenyCIDRs); err != nil {
+			return errors.New("规则" + api + "的网络限制配置错误: " + err.Error())
+		}
+		for _, w := range cond.TimeWindows {
+			if err := w.Compile(); err != nil {
+				return errors.New("规则" + api + "的时间窗口配置错误: " + err.Error())
+			}
+		}
+		if cond.RateLimit != nil {
+			if err := cond.RateLimit.Compiled().Compile(); err != nil {
+				return errors.New("规则" + api + "的限流配置错误: " + err.Error())
+			}
+		}
+	}
+
 	return nil
 }
 
+// splitRuleAPIs 按分隔符拆分API列表，分隔符为空时按空白和逗号拆分
+func splitRuleAPIs(apis, delimiter string) []string {
+	if delimiter != "" {
+		return strings.Split(apis, delimiter)
+	}
+	return strings.FieldsFunc(apis, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
 /**
  * ValidateIPAddress 验证IP地址格式
  * @param {string} ip IP地址字符串